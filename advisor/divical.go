@@ -0,0 +1,174 @@
+package advisor
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/carusyte/stock/util"
+)
+
+//dividend plan progress
+const (
+	STAGE_BOARD = "BOARD" // proposed by board of directors
+	STAGE_GMS   = "GMS"   // approved by general meeting of shareholders
+	STAGE_IMPL  = "IMPL"  // implemented
+)
+
+func init() {
+	Register(&Spec{
+		Name: "DiviCal",
+		Desc: "Upcoming and recent dividend events with expected yield and plan progress.",
+		Params: []Param{
+			{Name: "codes", Type: PARAM_STRINGS, Desc: "stock codes, the whole market if empty"},
+			{Name: "stages", Type: PARAM_STRINGS, Desc: "plan stages, BOARD, GMS or IMPL"},
+			{Name: "recent", Type: PARAM_INT, Default: "30", Desc: "days back of registration date"},
+			{Name: "ahead", Type: PARAM_INT, Default: "90", Desc: "days forward of registration date"},
+			{Name: "minyield", Type: PARAM_FLOAT, Default: "0", Desc: "minimum expected yield in percentage"},
+			{Name: "sort", Type: PARAM_STRING, Default: "reg_date",
+				Desc: "reg_date, days or yield, pending plans come last by reg_date or days"},
+			{Name: "desc", Type: PARAM_BOOL, Desc: "sort in descending order"},
+		},
+		Advise: func(a *advisor, p Params) *Table {
+			return a.DiviCal(DiviCalOpts{Codes: p.Strings("codes"), Stages: p.Strings("stages"),
+				Recent: p.Int("recent"), Ahead: p.Int("ahead"), MinYield: p.Float("minyield"),
+				SortBy: p.String("sort"), Desc: p.Bool("desc")})
+		},
+	})
+}
+
+//DiviCalOpts filters and orders the dividend calendar.
+type DiviCalOpts struct {
+	//Codes restricts to the stocks, the whole market if empty
+	Codes []string
+	//Recent days back and Ahead days forward of registration date to include. Pending plans without
+	// registration date are included if noticed within Recent days.
+	Recent, Ahead int
+	//Stages of plan progress to include, all if empty
+	Stages []string
+	//MinYield minimum expected yield at current price in percentage
+	MinYield float64
+	//SortBy "reg_date" or "days" (equivalent), or "yield", defaults to "reg_date"
+	SortBy string
+	Desc   bool
+}
+
+//DiviEvent a row of dividend calendar. Yield is the expected yield in percentage at current price,
+// DaysToReg is negative for past registrations and empty for pending plans.
+type DiviEvent struct {
+	Code       string
+	Name       string
+	Stage      string
+	Divi       float64
+	Price      float64
+	Yield      float64
+	RegDate    string
+	DaysToReg  string
+	XdxrDate   string
+	PayoutDate string
+	NoticeDate string
+	Progress   string
+}
+
+type diviRow struct {
+	Code       string
+	Name       string
+	NoticeDate sql.NullString `db:"notice_date"`
+	RegDate    sql.NullString `db:"reg_date"`
+	XdxrDate   sql.NullString `db:"xdxr_date"`
+	PayoutDate sql.NullString `db:"payout_date"`
+	Progress   sql.NullString
+	Divi       float64
+	Close      sql.NullFloat64
+}
+
+//DiviCal lists upcoming and recent dividend events along with expected yield at the latest close,
+// days to registration and plan progress.
+func (a *advisor) DiviCal(o DiviCalOpts) *Table {
+	now := time.Now()
+	from := now.AddDate(0, 0, -o.Recent).Format("2006-01-02")
+	to := now.AddDate(0, 0, o.Ahead).Format("2006-01-02")
+	query := "SELECT x.code, b.name, x.notice_date, x.reg_date, x.xdxr_date, x.payout_date, x.progress, x.divi, " +
+		"k.close FROM xdxr x INNER JOIN basics b USING (code) LEFT JOIN (SELECT k.code, k.close FROM kline_d_n k " +
+		"INNER JOIN (SELECT code, MAX(klid) klid FROM kline_d_n GROUP BY code) l USING (code, klid)) k " +
+		"USING (code) WHERE x.divi > 0 AND ((x.reg_date BETWEEN ? AND ?) OR (x.reg_date IS NULL " +
+		"AND x.progress IN ('董事会预案', '股东大会预案') AND x.notice_date >= ?))"
+	if len(o.Codes) > 0 {
+		query += fmt.Sprintf(" AND x.code IN (%s)", util.Join(o.Codes, ",", true))
+	}
+	var rows []*diviRow
+	_, e := a.dbMap.Select(&rows, query, from, to, from)
+	util.CheckErr(e, "failed to query dividend calendar")
+	stages := make(map[string]bool)
+	for _, s := range o.Stages {
+		stages[strings.ToUpper(s)] = true
+	}
+	var evts []*DiviEvent
+	for _, r := range rows {
+		ev := toDiviEvent(r, now)
+		if (len(stages) > 0 && !stages[ev.Stage]) || ev.Yield < o.MinYield {
+			continue
+		}
+		evts = append(evts, ev)
+	}
+	sortDiviEvents(evts, o.SortBy, o.Desc)
+	data := make([]interface{}, len(evts))
+	for i, ev := range evts {
+		data[i] = ev
+	}
+	return newTable(DiviEvent{}, data)
+}
+
+func toDiviEvent(r *diviRow, now time.Time) *DiviEvent {
+	ev := &DiviEvent{Code: r.Code, Name: r.Name, Stage: diviStage(r.Progress.String), Divi: r.Divi,
+		RegDate: r.RegDate.String, XdxrDate: r.XdxrDate.String, PayoutDate: r.PayoutDate.String,
+		NoticeDate: r.NoticeDate.String, Progress: r.Progress.String}
+	if r.Close.Valid && r.Close.Float64 > 0 {
+		ev.Price = r.Close.Float64
+		ev.Yield = math.Floor(r.Divi/10/r.Close.Float64*10000+0.5) / 100
+	}
+	if t, e := time.ParseInLocation("2006-01-02", ev.RegDate, now.Location()); e == nil {
+		today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+		ev.DaysToReg = fmt.Sprintf("%d", int(math.Floor(t.Sub(today).Hours()/24+0.5)))
+	}
+	return ev
+}
+
+//diviStage classifies the progress of dividend plan.
+func diviStage(progress string) string {
+	switch progress {
+	case "董事会预案":
+		return STAGE_BOARD
+	case "股东大会预案":
+		return STAGE_GMS
+	case "实施方案":
+		return STAGE_IMPL
+	}
+	return progress
+}
+
+//sortDiviEvents sorts the events in place. Pending plans without registration date come last when sorted
+// by registration date or days.
+func sortDiviEvents(evts []*DiviEvent, by string, desc bool) {
+	less := func(i, j int) bool {
+		a, b := evts[i], evts[j]
+		switch by {
+		case "yield":
+			if a.Yield != b.Yield {
+				return a.Yield < b.Yield != desc
+			}
+		default:
+			if (a.RegDate == "") != (b.RegDate == "") {
+				return b.RegDate == ""
+			}
+			if a.RegDate != b.RegDate {
+				return a.RegDate < b.RegDate != desc
+			}
+		}
+		return a.Code < b.Code
+	}
+	sort.SliceStable(evts, less)
+}
@@ -0,0 +1,38 @@
+package advisor
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+)
+
+func TestToDiviEvent(t *testing.T) {
+	now := time.Date(2018, 6, 1, 15, 30, 0, 0, time.Local)
+	r := &diviRow{Code: "600000", Divi: 5, Progress: sql.NullString{String: "股东大会预案", Valid: true},
+		RegDate: sql.NullString{String: "2018-06-11", Valid: true}, Close: sql.NullFloat64{Float64: 12.5, Valid: true}}
+	ev := toDiviEvent(r, now)
+	if ev.Stage != STAGE_GMS || ev.Yield != 4 || ev.DaysToReg != "10" {
+		t.Errorf("unexpected event: %+v", ev)
+	}
+	r.RegDate = sql.NullString{String: "2018-05-30", Valid: true}
+	r.Close.Valid = false
+	if ev = toDiviEvent(r, now); ev.DaysToReg != "-2" || ev.Yield != 0 {
+		t.Errorf("unexpected past event: %+v", ev)
+	}
+}
+
+func TestSortDiviEvents(t *testing.T) {
+	evts := []*DiviEvent{
+		{Code: "A", RegDate: "", Yield: 5},
+		{Code: "B", RegDate: "2018-06-20", Yield: 2},
+		{Code: "C", RegDate: "2018-06-10", Yield: 3},
+	}
+	sortDiviEvents(evts, "reg_date", false)
+	if evts[0].Code != "C" || evts[1].Code != "B" || evts[2].Code != "A" {
+		t.Errorf("unexpected order by reg_date: %s%s%s", evts[0].Code, evts[1].Code, evts[2].Code)
+	}
+	sortDiviEvents(evts, "yield", true)
+	if evts[0].Code != "A" || evts[1].Code != "C" || evts[2].Code != "B" {
+		t.Errorf("unexpected order by yield: %s%s%s", evts[0].Code, evts[1].Code, evts[2].Code)
+	}
+}
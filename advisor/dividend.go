@@ -3,9 +3,21 @@ package advisor
 import (
 	"github.com/carusyte/stock/util"
 	"reflect"
-	"gopkg.in/gorp.v2"
 )
 
+func init() {
+	Register(&Spec{
+		Name: "HiDivi",
+		Desc: "Stocks of the highest dividend yield in the latest report year.",
+		Params: []Param{
+			{Name: "n", Type: PARAM_INT, Default: "25", Desc: "number of stocks"},
+		},
+		Advise: func(a *advisor, p Params) *Table {
+			return a.HiDivi(p.Int("n"))
+		},
+	})
+}
+
 type cols struct {
 	Code       string
 	Name       string
@@ -32,7 +44,7 @@ type cols struct {
 func (a *advisor) HiDivi(firstN int) *Table {
 	query, err := a.dotsql.Raw("HiDivi")
 	util.CheckErr(err, "failed to fetch query string for HiDivi")
-	r, err := a.dbMap.Select(cols{}, query, 25)
+	r, err := a.dbMap.Select(cols{}, query, firstN)
 	util.CheckErr(err, "failed to execute query")
 	return newTable(cols{}, r)
 }
@@ -0,0 +1,177 @@
+package advisor
+
+import (
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+//parameter types
+const (
+	PARAM_INT     = "int"
+	PARAM_FLOAT   = "float"
+	PARAM_BOOL    = "bool"
+	PARAM_STRING  = "string"
+	PARAM_STRINGS = "strings" // comma separated
+)
+
+//Param a typed parameter accepted by an advisor.
+type Param struct {
+	Name    string
+	Type    string
+	Default string
+	Desc    string
+}
+
+//Params parameter values of an advisor call keyed by name, see Spec.Parse.
+type Params map[string]interface{}
+
+func (p Params) Int(name string) int {
+	v, _ := p[name].(int)
+	return v
+}
+
+func (p Params) Float(name string) float64 {
+	v, _ := p[name].(float64)
+	return v
+}
+
+func (p Params) Bool(name string) bool {
+	v, _ := p[name].(bool)
+	return v
+}
+
+func (p Params) String(name string) string {
+	v, _ := p[name].(string)
+	return v
+}
+
+func (p Params) Strings(name string) []string {
+	v, _ := p[name].([]string)
+	return v
+}
+
+//Spec a named advisor.
+type Spec struct {
+	Name   string
+	Desc   string
+	Params []Param
+	//Advise queries the advice with parsed parameters
+	Advise func(a *advisor, p Params) *Table
+}
+
+//Parse converts the raw values into typed parameters, taking defaults for the absent ones.
+// Unknown parameters and malformed values are errors.
+func (s *Spec) Parse(raw map[string]string) (Params, error) {
+	p := make(Params)
+	known := make(map[string]bool)
+	for _, pm := range s.Params {
+		known[pm.Name] = true
+		str, ok := raw[pm.Name]
+		if !ok {
+			str = pm.Default
+		}
+		v, e := parseParam(pm.Type, str)
+		if e != nil {
+			return nil, errors.Wrapf(e, "invalid parameter %s for %s: %s", pm.Name, s.Name, str)
+		}
+		p[pm.Name] = v
+	}
+	for k := range raw {
+		if !known[k] {
+			return nil, errors.Errorf("unknown parameter for %s: %s", s.Name, k)
+		}
+	}
+	return p, nil
+}
+
+func parseParam(typ, str string) (interface{}, error) {
+	str = strings.TrimSpace(str)
+	switch typ {
+	case PARAM_INT:
+		if str == "" {
+			return 0, nil
+		}
+		return strconv.Atoi(str)
+	case PARAM_FLOAT:
+		if str == "" {
+			return 0., nil
+		}
+		return strconv.ParseFloat(str, 64)
+	case PARAM_BOOL:
+		if str == "" {
+			return false, nil
+		}
+		return strconv.ParseBool(str)
+	case PARAM_STRING:
+		return str, nil
+	case PARAM_STRINGS:
+		var ss []string
+		for _, e := range strings.Split(str, ",") {
+			if e = strings.TrimSpace(e); e != "" {
+				ss = append(ss, e)
+			}
+		}
+		return ss, nil
+	}
+	return nil, errors.Errorf("unknown parameter type: %s", typ)
+}
+
+var (
+	specs    = make(map[string]*Spec)
+	specLock = sync.RWMutex{}
+)
+
+//Register registers the advisor, replacing the previous one of the same name. Names are case-insensitive.
+func Register(s *Spec) {
+	if s.Name == "" || s.Advise == nil {
+		log.Panicf("invalid advisor: %+v", s)
+	}
+	for _, pm := range s.Params {
+		if _, e := parseParam(pm.Type, pm.Default); e != nil {
+			log.Panicf("invalid default of parameter %s for advisor %s: %+v", pm.Name, s.Name, e)
+		}
+	}
+	specLock.Lock()
+	defer specLock.Unlock()
+	specs[strings.ToLower(s.Name)] = s
+}
+
+//SpecOf returns the registered advisor of the name.
+func SpecOf(name string) (*Spec, bool) {
+	specLock.RLock()
+	defer specLock.RUnlock()
+	s, ok := specs[strings.ToLower(name)]
+	return s, ok
+}
+
+//Specs returns all registered advisors ordered by name.
+func Specs() []*Spec {
+	specLock.RLock()
+	defer specLock.RUnlock()
+	r := make([]*Spec, 0, len(specs))
+	for _, s := range specs {
+		r = append(r, s)
+	}
+	sort.Slice(r, func(i, j int) bool {
+		return r[i].Name < r[j].Name
+	})
+	return r
+}
+
+//Ask runs the named advisor with the raw parameters.
+func (a *advisor) Ask(name string, raw map[string]string) (*Table, error) {
+	s, ok := SpecOf(name)
+	if !ok {
+		return nil, errors.Errorf("unknown advisor: %s", name)
+	}
+	p, e := s.Parse(raw)
+	if e != nil {
+		return nil, e
+	}
+	return s.Advise(a, p), nil
+}
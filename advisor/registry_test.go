@@ -0,0 +1,88 @@
+package advisor
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestSpecParse(t *testing.T) {
+	s := &Spec{Name: "Test", Params: []Param{
+		{Name: "n", Type: PARAM_INT, Default: "25"},
+		{Name: "max", Type: PARAM_FLOAT, Default: "1.5"},
+		{Name: "codes", Type: PARAM_STRINGS},
+		{Name: "on", Type: PARAM_BOOL},
+	}}
+	p, e := s.Parse(map[string]string{"n": "10", "codes": "600000, 000001,"})
+	if e != nil {
+		t.Fatal(e)
+	}
+	if p.Int("n") != 10 || p.Float("max") != 1.5 || p.Bool("on") || len(p.Strings("codes")) != 2 ||
+		p.Strings("codes")[1] != "000001" {
+		t.Errorf("unexpected params: %+v", p)
+	}
+	if _, e = s.Parse(map[string]string{"n": "ten"}); e == nil {
+		t.Error("expecting error on malformed int")
+	}
+	if _, e = s.Parse(map[string]string{"limit": "1"}); e == nil {
+		t.Error("expecting error on unknown parameter")
+	}
+}
+
+type testRow struct {
+	Code    string
+	RegDate string
+	Yield   float64
+}
+
+func testTable() *Table {
+	return newTable(testRow{}, []interface{}{
+		&testRow{"A", "", 5},
+		&testRow{"B", "2018-06-20", 2},
+		&testRow{"C", "2018-06-10", 3},
+	})
+}
+
+func codes(t *Table) string {
+	var s []string
+	for _, d := range t.Data {
+		s = append(s, d.(*testRow).Code)
+	}
+	return strings.Join(s, "")
+}
+
+func TestTableSortLimit(t *testing.T) {
+	tb := testTable()
+	if e := tb.Sort("yield", true); e != nil || codes(tb) != "ACB" {
+		t.Errorf("unexpected order by yield desc: %s, %v", codes(tb), e)
+	}
+	if tb.Sort("reg_date", false); codes(tb) != "CBA" {
+		t.Errorf("unexpected order by reg_date: %s", codes(tb))
+	}
+	if tb.Sort("reg_date", true); codes(tb) != "BCA" {
+		t.Errorf("unexpected order by reg_date desc: %s", codes(tb))
+	}
+	if e := tb.Sort("price", false); e == nil {
+		t.Error("expecting error on unknown column")
+	}
+	if tb.Limit(2); codes(tb) != "BC" {
+		t.Errorf("unexpected rows after limit: %s", codes(tb))
+	}
+}
+
+func TestTableWrite(t *testing.T) {
+	var b bytes.Buffer
+	if e := testTable().Write(&b, FMT_CSV); e != nil {
+		t.Fatal(e)
+	}
+	if exp := "Code,RegDate,Yield\nA,,5\nB,2018-06-20,2\nC,2018-06-10,3\n"; b.String() != exp {
+		t.Errorf("unexpected csv:\n%s", b.String())
+	}
+	b.Reset()
+	if e := testTable().Write(&b, FMT_JSON); e != nil || !strings.Contains(b.String(), `"RegDate": "2018-06-20"`) {
+		t.Errorf("unexpected json: %s, %v", b.String(), e)
+	}
+	if e := testTable().Write(&b, "xml"); e == nil {
+		t.Error("expecting error on unsupported format")
+	}
+}
@@ -0,0 +1,88 @@
+-- name: HiDivi
+SELECT
+    A.code,
+    B.name,
+    A.date last_price_date,
+    A.close,
+    B.divi,
+    B.shares,
+    B.report_year,
+    TRUNCATE(B.divi / A.close * 10 * (1 - 0.18413),
+        3) dps,
+    C.pe,
+    C.esp,
+    C.bvps,
+    C.pb,
+    C.undp,
+    C.rev,
+    C.profit,
+    C.gpr,
+    C.npr,
+    D.kdj_k k_d,
+    E.kdj_k k_w,
+    F.kdj_k k_m
+FROM
+    (SELECT
+        *
+    FROM
+        kline_d
+    INNER JOIN (SELECT
+        code, MAX(date) date
+    FROM
+        kline_d
+    GROUP BY code) AS kmax USING (code , date)) AS A,
+    (SELECT
+        *
+    FROM
+        (SELECT
+        code,
+            MAX(name) name,
+            SUBSTR(report_year, 1, 4) AS report_year,
+            SUM(IFNULL(divi, 0)) divi,
+            SUM(IFNULL(shares_allot, 0) + IFNULL(shares_cvt, 0)) shares
+    FROM
+        xdxr
+    GROUP BY code , SUBSTR(report_year, 1, 4)) AS T1
+    INNER JOIN (SELECT
+        code, MAX(SUBSTR(report_year, 1, 4)) AS report_year
+    FROM
+        xdxr
+    WHERE
+        divi > 0
+    GROUP BY code) AS T2 USING (code , report_year)) AS B,
+    (SELECT
+        code, pe, esp, bvps, pb, undp, rev, profit, gpr, npr
+    FROM
+        basics) AS C,
+    (SELECT
+        code, kdj_k
+    FROM
+        indicator_d
+    INNER JOIN (SELECT
+        code, MAX(date) date
+    FROM
+        indicator_d
+    GROUP BY code) AS imaxd USING (code , date)) AS D,
+    (SELECT
+        code, kdj_k
+    FROM
+        indicator_w
+    INNER JOIN (SELECT
+        code, MAX(date) date
+    FROM
+        indicator_w
+    GROUP BY code) AS imaxw USING (code , date)) AS E,
+    (SELECT
+        code, kdj_k
+    FROM
+        indicator_m
+    INNER JOIN (SELECT
+        code, MAX(date) date
+    FROM
+        indicator_m
+    GROUP BY code) AS imaxm USING (code , date)) AS F
+WHERE
+    A.code = B.code AND A.code = C.code
+        AND A.code = D.code and A.code = E.code and A.code = F.code
+ORDER BY dps DESC
+LIMIT ?
@@ -0,0 +1,11 @@
+-- name: HiRoeHist
+SELECT
+    f.code, b.name, b.industry, IFNULL(b.pe, 0) pe, IFNULL(b.pb, 0) pb, f.year, f.roe
+FROM
+    finance f
+        INNER JOIN
+    basics b USING (code)
+WHERE
+    f.year LIKE '%-12-31'
+        AND f.roe IS NOT NULL
+ORDER BY f.code , f.year DESC
@@ -0,0 +1,40 @@
+-- name: LowPB
+SELECT
+    b.code,
+    b.name,
+    b.industry,
+    p.date last_price_date,
+    p.close,
+    b.pb,
+    b.pe,
+    b.bvps,
+    f.roe,
+    f.dar
+FROM
+    basics b
+        INNER JOIN
+    (SELECT
+        p1.code, p1.date, p1.close
+    FROM
+        kline_d p1
+    INNER JOIN (SELECT
+        code, MAX(klid) klid
+    FROM
+        kline_d
+    GROUP BY code) p2 USING (code , klid)) p USING (code)
+        INNER JOIN
+    (SELECT
+        f1.code, IFNULL(f1.roe, 0) roe, IFNULL(f1.dar, 0) dar
+    FROM
+        finance f1
+    INNER JOIN (SELECT
+        code, MAX(year) year
+    FROM
+        finance
+    WHERE
+        year LIKE '%-12-31'
+    GROUP BY code) f2 USING (code , year)) f USING (code)
+WHERE
+    b.pb > 0 AND b.pb <= ?
+        AND f.roe >= ?
+ORDER BY b.pb ASC
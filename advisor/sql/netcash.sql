@@ -0,0 +1,42 @@
+-- name: NetCash
+SELECT
+    t.*, ROUND(t.ncav / t.mktcap, 3) ratio
+FROM
+    (SELECT
+        b.code,
+            b.name,
+            b.industry,
+            p.date last_price_date,
+            p.close,
+            ROUND(b.totals * p.close, 2) mktcap,
+            ROUND((b.liquidAssets - b.totalAssets * f.dar / 100) / 10000, 2) ncav,
+            f.dar,
+            IFNULL(b.pb, 0) pb
+    FROM
+        basics b
+    INNER JOIN (SELECT
+        p1.code, p1.date, p1.close
+    FROM
+        kline_d p1
+    INNER JOIN (SELECT
+        code, MAX(klid) klid
+    FROM
+        kline_d
+    GROUP BY code) p2 USING (code , klid)) p USING (code)
+    INNER JOIN (SELECT
+        f1.code, f1.dar
+    FROM
+        finance f1
+    INNER JOIN (SELECT
+        code, MAX(year) year
+    FROM
+        finance
+    GROUP BY code) f2 USING (code , year)
+    WHERE
+        f1.dar IS NOT NULL) f USING (code)
+    WHERE
+        b.totals > 0 AND b.totalAssets > 0
+            AND b.liquidAssets IS NOT NULL) t
+WHERE
+    t.ncav > 0 AND t.ncav / t.mktcap >= ?
+ORDER BY ratio DESC
@@ -0,0 +1,64 @@
+-- name: OversoldBlue
+SELECT
+    b.code,
+    b.name,
+    b.industry,
+    p.date last_price_date,
+    p.close,
+    ROUND(b.totals * p.close, 2) mktcap,
+    b.pe,
+    IFNULL(b.pb, 0) pb,
+    f.roe,
+    d.kdj_k k_d,
+    w.kdj_k k_w
+FROM
+    basics b
+        INNER JOIN
+    (SELECT
+        p1.code, p1.date, p1.close
+    FROM
+        kline_d p1
+    INNER JOIN (SELECT
+        code, MAX(klid) klid
+    FROM
+        kline_d
+    GROUP BY code) p2 USING (code , klid)) p USING (code)
+        INNER JOIN
+    (SELECT
+        f1.code, f1.roe
+    FROM
+        finance f1
+    INNER JOIN (SELECT
+        code, MAX(year) year
+    FROM
+        finance
+    WHERE
+        year LIKE '%-12-31'
+    GROUP BY code) f2 USING (code , year)) f USING (code)
+        INNER JOIN
+    (SELECT
+        i1.code, i1.kdj_k
+    FROM
+        indicator_d i1
+    INNER JOIN (SELECT
+        code, MAX(klid) klid
+    FROM
+        indicator_d
+    GROUP BY code) i2 USING (code , klid)) d USING (code)
+        INNER JOIN
+    (SELECT
+        i1.code, i1.kdj_k
+    FROM
+        indicator_w i1
+    INNER JOIN (SELECT
+        code, MAX(klid) klid
+    FROM
+        indicator_w
+    GROUP BY code) i2 USING (code , klid)) w USING (code)
+WHERE
+    b.totals * p.close >= ?
+        AND b.pe > 0 AND b.pe <= ?
+        AND f.roe >= ?
+        AND d.kdj_k <= ?
+        AND w.kdj_k <= ?
+ORDER BY d.kdj_k ASC
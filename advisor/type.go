@@ -2,26 +2,66 @@ package advisor
 
 import (
 	"bytes"
+	"embed"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"io/fs"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
 	"github.com/carusyte/stock/db"
 	"github.com/carusyte/stock/util"
 	"github.com/gchaincl/dotsql"
 	"github.com/olekukonko/tablewriter"
+	"github.com/pkg/errors"
 	"gopkg.in/gorp.v2"
 	"reflect"
 )
 
+//output formats of Table
+const (
+	FMT_TABLE = "table"
+	FMT_CSV   = "csv"
+	FMT_JSON  = "json"
+)
+
+//sqlFiles queries of the advisors in dotsql format, shipped with the binary.
+//go:embed sql/*.sql
+var sqlFiles embed.FS
+
 type advisor struct {
 	dbMap  *gorp.DbMap
 	dotsql *dotsql.DotSql
 }
 
 func New() *advisor {
-	dot, err := dotsql.LoadFromFile("/Users/jx/ProgramData/go/src/github.com/carusyte/stock/ask/sql.txt")
+	dot, err := loadSql()
 	util.CheckErr(err, "failed to init dotsql")
 	a := &advisor{db.Get(false, false), dot}
 	return a
 }
 
+//loadSql loads all the embedded sql files as one.
+func loadSql() (*dotsql.DotSql, error) {
+	files, e := fs.Glob(sqlFiles, "sql/*.sql")
+	if e != nil {
+		return nil, errors.WithStack(e)
+	}
+	var sb strings.Builder
+	for _, f := range files {
+		b, e := sqlFiles.ReadFile(f)
+		if e != nil {
+			return nil, errors.Wrapf(e, "failed to read %s", f)
+		}
+		sb.Write(b)
+		sb.WriteString("\n")
+	}
+	return dotsql.LoadFromString(sb.String())
+}
+
 type Table struct {
 	Head []Head
 	Data []interface{}
@@ -59,3 +99,98 @@ func (t *Table) String() string {
 
 	return bytes.String()
 }
+
+//Sort sorts the rows by the column in place, matched case-insensitively with underscores ignored, e.g.
+// "reg_date" for RegDate. Numeric strings compare as numbers. Empty values come last in either order.
+func (t *Table) Sort(col string, desc bool) error {
+	idx := t.colIndex(col)
+	if idx < 0 {
+		return errors.Errorf("no such column: %s", col)
+	}
+	sort.SliceStable(t.Data, func(i, j int) bool {
+		a := reflect.Indirect(reflect.ValueOf(t.Data[i])).Field(idx)
+		b := reflect.Indirect(reflect.ValueOf(t.Data[j])).Field(idx)
+		return lessValue(a, b, desc)
+	})
+	return nil
+}
+
+func (t *Table) colIndex(col string) int {
+	norm := func(s string) string {
+		return strings.ToLower(strings.Replace(s, "_", "", -1))
+	}
+	for i, h := range t.Head {
+		if norm(h.Name) == norm(col) {
+			return i
+		}
+	}
+	return -1
+}
+
+func lessValue(a, b reflect.Value, desc bool) bool {
+	var fa, fb float64
+	switch a.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		fa, fb = float64(a.Int()), float64(b.Int())
+	case reflect.Float32, reflect.Float64:
+		fa, fb = a.Float(), b.Float()
+	case reflect.String:
+		sa, sb := a.String(), b.String()
+		if (sa == "") != (sb == "") {
+			return sb == ""
+		}
+		var ea, eb error
+		fa, ea = strconv.ParseFloat(sa, 64)
+		fb, eb = strconv.ParseFloat(sb, 64)
+		if ea != nil || eb != nil {
+			return sa < sb != desc && sa != sb
+		}
+	default:
+		return false
+	}
+	if math.IsNaN(fa) != math.IsNaN(fb) {
+		return math.IsNaN(fb)
+	}
+	return fa < fb != desc && fa != fb
+}
+
+//Limit keeps the first n rows. Non-positive n means no limit.
+func (t *Table) Limit(n int) {
+	if n > 0 && n < len(t.Data) {
+		t.Data = t.Data[:n]
+	}
+}
+
+//Write renders the table to w in the format, one of FMT_TABLE, FMT_CSV or FMT_JSON.
+func (t *Table) Write(w io.Writer, format string) error {
+	switch strings.ToLower(format) {
+	case "", FMT_TABLE:
+		_, e := io.WriteString(w, t.String())
+		return errors.WithStack(e)
+	case FMT_CSV:
+		cw := csv.NewWriter(w)
+		hd := make([]string, len(t.Head))
+		for i, h := range t.Head {
+			hd[i] = h.Name
+		}
+		cw.Write(hd)
+		for _, e := range t.Data {
+			rec := make([]string, len(hd))
+			for j := range rec {
+				rec[j] = util.FieldValueStr(e, j)
+			}
+			cw.Write(rec)
+		}
+		cw.Flush()
+		return errors.WithStack(cw.Error())
+	case FMT_JSON:
+		data := t.Data
+		if data == nil {
+			data = []interface{}{}
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return errors.WithStack(enc.Encode(data))
+	}
+	return errors.Errorf("unsupported output format: %s", format)
+}
@@ -0,0 +1,201 @@
+package advisor
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+
+	"github.com/carusyte/stock/util"
+)
+
+func init() {
+	Register(&Spec{
+		Name: "LowPB",
+		Desc: "Stocks trading at low price to book with non-negative return on equity.",
+		Params: []Param{
+			{Name: "maxpb", Type: PARAM_FLOAT, Default: "1", Desc: "maximum price to book"},
+			{Name: "minroe", Type: PARAM_FLOAT, Default: "0", Desc: "minimum ROE of the latest annual report"},
+		},
+		Advise: func(a *advisor, p Params) *Table {
+			return a.LowPB(p.Float("maxpb"), p.Float("minroe"))
+		},
+	})
+	Register(&Spec{
+		Name: "HiRoe",
+		Desc: "Stocks with a streak of high ROE in consecutive annual reports up to the latest.",
+		Params: []Param{
+			{Name: "years", Type: PARAM_INT, Default: "5", Desc: "minimum length of the streak"},
+			{Name: "minroe", Type: PARAM_FLOAT, Default: "15", Desc: "minimum ROE of each year"},
+		},
+		Advise: func(a *advisor, p Params) *Table {
+			return a.HiRoe(p.Int("years"), p.Float("minroe"))
+		},
+	})
+	Register(&Spec{
+		Name: "NetCash",
+		Desc: "Stocks whose current assets exceed total liabilities, ranked by the surplus to market cap.",
+		Params: []Param{
+			{Name: "minratio", Type: PARAM_FLOAT, Default: "0", Desc: "minimum ratio of the surplus to market cap"},
+		},
+		Advise: func(a *advisor, p Params) *Table {
+			return a.NetCash(p.Float("minratio"))
+		},
+	})
+	Register(&Spec{
+		Name: "OversoldBlue",
+		Desc: "Large profitable stocks of reasonable PE whose daily and weekly KDJ are oversold.",
+		Params: []Param{
+			{Name: "mincap", Type: PARAM_FLOAT, Default: "100", Desc: "minimum market cap in 100 million"},
+			{Name: "maxpe", Type: PARAM_FLOAT, Default: "30", Desc: "maximum PE"},
+			{Name: "minroe", Type: PARAM_FLOAT, Default: "10", Desc: "minimum ROE of the latest annual report"},
+			{Name: "maxkd", Type: PARAM_FLOAT, Default: "20", Desc: "maximum daily KDJ K"},
+			{Name: "maxkw", Type: PARAM_FLOAT, Default: "30", Desc: "maximum weekly KDJ K"},
+		},
+		Advise: func(a *advisor, p Params) *Table {
+			return a.OversoldBlue(p.Float("mincap"), p.Float("maxpe"), p.Float("minroe"), p.Float("maxkd"),
+				p.Float("maxkw"))
+		},
+	})
+}
+
+type lowPB struct {
+	Code     string
+	Name     string
+	Industry string
+	Date     string `db:"last_price_date"`
+	Close    float64
+	PB       float64
+	PE       float64
+	BVPS     float64
+	ROE      float64
+	DAR      float64
+}
+
+//LowPB lists stocks of price to book no more than maxPB and ROE of the latest annual report no less than minRoe.
+func (a *advisor) LowPB(maxPB, minRoe float64) *Table {
+	return a.query("LowPB", lowPB{}, maxPB, minRoe)
+}
+
+type netCash struct {
+	Code     string
+	Name     string
+	Industry string
+	Date     string `db:"last_price_date"`
+	Close    float64
+	MktCap   float64
+	NCAV     float64
+	Ratio    float64
+	DAR      float64
+	PB       float64
+}
+
+//NetCash lists stocks whose net current asset value (current assets less total liabilities, in 100 million)
+// is positive and no less than minRatio of market cap.
+func (a *advisor) NetCash(minRatio float64) *Table {
+	return a.query("NetCash", netCash{}, minRatio)
+}
+
+type oversoldBlue struct {
+	Code     string
+	Name     string
+	Industry string
+	Date     string `db:"last_price_date"`
+	Close    float64
+	MktCap   float64
+	PE       float64
+	PB       float64
+	ROE      float64
+	K_D      float64
+	K_W      float64
+}
+
+//OversoldBlue lists stocks of market cap at least minCap (100 million), PE within maxPE, ROE at least minRoe,
+// and latest KDJ K no more than maxKd on daily and maxKw on weekly.
+func (a *advisor) OversoldBlue(minCap, maxPE, minRoe, maxKd, maxKw float64) *Table {
+	return a.query("OversoldBlue", oversoldBlue{}, minCap, maxPE, minRoe, maxKd, maxKw)
+}
+
+func (a *advisor) query(name string, row interface{}, args ...interface{}) *Table {
+	query, err := a.dotsql.Raw(name)
+	util.CheckErr(err, "failed to fetch query string for "+name)
+	r, err := a.dbMap.Select(row, query, args...)
+	util.CheckErr(err, "failed to execute query "+name)
+	return newTable(row, r)
+}
+
+type roeHist struct {
+	Code     string
+	Name     string
+	Industry string
+	PE       float64
+	PB       float64
+	Year     string
+	ROE      float64
+}
+
+//RoeStreak a stock of high ROE streak.
+type RoeStreak struct {
+	Code     string
+	Name     string
+	Industry string
+	Years    int
+	Since    string
+	Latest   float64
+	Avg      float64
+	Min      float64
+	PE       float64
+	PB       float64
+}
+
+//HiRoe lists stocks whose ROE is at least minRoe in at least the recent n consecutive annual reports.
+func (a *advisor) HiRoe(n int, minRoe float64) *Table {
+	query, err := a.dotsql.Raw("HiRoeHist")
+	util.CheckErr(err, "failed to fetch query string for HiRoeHist")
+	var hist []*roeHist
+	_, err = a.dbMap.Select(&hist, query)
+	util.CheckErr(err, "failed to execute query HiRoeHist")
+	var data []interface{}
+	for i := 0; i < len(hist); {
+		j := i + 1
+		for ; j < len(hist) && hist[j].Code == hist[i].Code; j++ {
+		}
+		if s := roeStreak(hist[i:j], minRoe); s != nil && s.Years >= n {
+			data = append(data, s)
+		}
+		i = j
+	}
+	return newTable(RoeStreak{}, data)
+}
+
+//roeStreak returns the streak of ROE no less than minRoe from the latest annual report backwards, in which
+// the years are consecutive. Hist of the same stock is in descending order of year. Returns nil if the latest
+// doesn't qualify.
+func roeStreak(hist []*roeHist, minRoe float64) *RoeStreak {
+	if len(hist) == 0 || hist[0].ROE < minRoe {
+		return nil
+	}
+	h := hist[0]
+	s := &RoeStreak{Code: h.Code, Name: h.Name, Industry: h.Industry, Latest: h.ROE, Min: h.ROE, PE: h.PE,
+		PB: h.PB}
+	sum := 0.
+	for i, h := range hist {
+		if h.ROE < minRoe {
+			break
+		}
+		if i > 0 && yearOf(hist[i-1].Year)-yearOf(h.Year) != 1 {
+			break
+		}
+		s.Years++
+		s.Since = h.Year[:4]
+		sum += h.ROE
+		s.Min = math.Min(s.Min, h.ROE)
+	}
+	s.Avg, _ = strconv.ParseFloat(fmt.Sprintf("%.2f", sum/float64(s.Years)), 64)
+	return s
+}
+
+func yearOf(date string) int {
+	y, e := strconv.Atoi(date[:4])
+	util.CheckErr(e, "unable to parse year: "+date)
+	return y
+}
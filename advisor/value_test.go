@@ -0,0 +1,22 @@
+package advisor
+
+import "testing"
+
+func TestRoeStreak(t *testing.T) {
+	hist := []*roeHist{
+		{Code: "600000", Year: "2017-12-31", ROE: 18},
+		{Code: "600000", Year: "2016-12-31", ROE: 16},
+		{Code: "600000", Year: "2015-12-31", ROE: 20},
+		{Code: "600000", Year: "2013-12-31", ROE: 25},
+	}
+	s := roeStreak(hist, 15)
+	if s == nil || s.Years != 3 || s.Since != "2015" || s.Min != 16 || s.Avg != 18 || s.Latest != 18 {
+		t.Errorf("unexpected streak: %+v", s)
+	}
+	if s = roeStreak(hist, 17); s == nil || s.Years != 1 {
+		t.Errorf("unexpected streak with roe gap: %+v", s)
+	}
+	if s = roeStreak(hist, 19); s != nil {
+		t.Errorf("expecting no streak: %+v", s)
+	}
+}
@@ -0,0 +1,258 @@
+//
+// Watchlist alerting. Rules configured in conf.AlertArgs are evaluated after each data refresh by getd.Get,
+// alerts fired are de-duplicated against alert_log and sent to the configured sinks. Deliveries are recorded
+// in alert_sent for each sink, alerts failed to send are retried in later runs.
+// Programs refreshing data enable alerting by importing this package.
+//
+package alert
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/carusyte/stock/conf"
+	"github.com/carusyte/stock/getd"
+	"github.com/carusyte/stock/global"
+	"github.com/carusyte/stock/model"
+	"github.com/carusyte/stock/score"
+	"github.com/carusyte/stock/util"
+	logr "github.com/sirupsen/logrus"
+)
+
+const (
+	//RETRY_DAYS alerts fired within this number of days are resent to the sinks that failed to deliver them
+	RETRY_DAYS = 3
+)
+
+var (
+	dbmap = global.Dbmap
+	dot   = global.Dot
+)
+
+//Alert an event fired by a rule. Key identifies the event of the rule and code for de-duplication,
+// i.e. the date of the quote or the cross.
+type Alert struct {
+	Rule string `json:"rule"`
+	Kind string `json:"kind"`
+	Code string `json:"code"`
+	Key  string `json:"key" db:"ekey"`
+	Msg  string `json:"msg"`
+	Time string `json:"time"`
+}
+
+func (a *Alert) String() string {
+	return fmt.Sprintf("%s [%s] %s: %s", a.Time, a.Rule, a.Code, a.Msg)
+}
+
+//Evaluator evaluates the rule against the codes, returning the alerts fired.
+type Evaluator func(rule *conf.AlertRule, codes []string) []*Alert
+
+var (
+	evaluators = make(map[string]Evaluator)
+	evalLock   = sync.RWMutex{}
+)
+
+func init() {
+	RegisterEvaluator("price_above", evalPrice)
+	RegisterEvaluator("price_below", evalPrice)
+	RegisterEvaluator("kdj_cross", evalKdjCross)
+	RegisterEvaluator("kdjst_above", evalKdjSt)
+	RegisterEvaluator("divi_reg", evalDiviReg)
+	getd.AfterGet("alert", func() {
+		Run()
+	})
+}
+
+//RegisterEvaluator registers the evaluator of rule kind, replacing the existing one if any. Config validation
+// only checks the built-in kinds, custom kinds become configurable once registered here.
+func RegisterEvaluator(kind string, ev Evaluator) {
+	evalLock.Lock()
+	defer evalLock.Unlock()
+	evaluators[kind] = ev
+}
+
+func evaluator(kind string) (ev Evaluator, ok bool) {
+	evalLock.RLock()
+	defer evalLock.RUnlock()
+	ev, ok = evaluators[kind]
+	return
+}
+
+//Run evaluates all the rules, logging the alerts not fired before, and sends each sink the alerts it hasn't
+// delivered yet, including those failed in previous runs within RETRY_DAYS. A failing sink doesn't stop the
+// others. Returns the alerts newly fired.
+func Run() (alerts []*Alert) {
+	a := conf.Args().Alert
+	if len(a.Rules) == 0 {
+		return
+	}
+	for i := range a.Rules {
+		r := &a.Rules[i]
+		ev, ok := evaluator(r.Kind)
+		if !ok {
+			logr.Errorf("no evaluator for alert rule %s of kind %s", r.Name, r.Kind)
+			continue
+		}
+		codes := r.Codes
+		if len(codes) == 0 {
+			codes = a.Watchlist
+		}
+		for _, al := range ev(r, codes) {
+			al.Rule, al.Kind = r.Name, r.Kind
+			if fresh(al) {
+				alerts = append(alerts, al)
+			}
+		}
+	}
+	logr.Infof("%d alerts fired", len(alerts))
+	for _, sc := range a.Sinks {
+		sid := sinkID(sc)
+		pending := undelivered(sid)
+		if len(pending) == 0 {
+			continue
+		}
+		if e := NewSink(sc).Send(pending); e != nil {
+			logr.Errorf("failed to send %d alerts to %s sink: %+v", len(pending), sid, e)
+			continue
+		}
+		delivered(sid, pending)
+	}
+	return
+}
+
+//fresh logs the alert and returns true if it's not fired before.
+func fresh(a *Alert) bool {
+	d, t := util.TimeStr()
+	a.Time = d + " " + t
+	r, e := dbmap.Exec("insert ignore into alert_log (rule, kind, code, ekey, msg, udate, utime) values "+
+		"(?, ?, ?, ?, ?, ?, ?)", a.Rule, a.Kind, a.Code, a.Key, a.Msg, d, t)
+	util.CheckErr(e, "failed to log alert "+a.String())
+	n, e := r.RowsAffected()
+	util.CheckErr(e, "failed to log alert "+a.String())
+	return n > 0
+}
+
+//sinkID identifies the sink by its kind and destination, i.e. "webhook:http://example.com/hook".
+func sinkID(c conf.AlertSink) string {
+	switch c.Kind {
+	case "log":
+		return c.Kind + ":" + c.Path
+	case "webhook":
+		return c.Kind + ":" + c.URL
+	case "smtp":
+		return c.Kind + ":" + c.Addr + "/" + strings.Join(c.To, ",")
+	}
+	return c.Kind
+}
+
+//undelivered returns the alerts fired within RETRY_DAYS not yet delivered by the sink, in the order fired.
+func undelivered(sid string) (alerts []*Alert) {
+	_, e := dbmap.Select(&alerts, "select l.rule, l.kind, l.code, l.ekey, coalesce(l.msg, '') msg, "+
+		"concat(l.udate, ' ', l.utime) `time` from alert_log l where l.udate >= ? and not exists (select 1 "+
+		"from alert_sent s where s.sink = ? and s.rule = l.rule and s.code = l.code and s.ekey = l.ekey) "+
+		"order by l.udate, l.utime", time.Now().AddDate(0, 0, -RETRY_DAYS).Format("2006-01-02"), sid)
+	if e != nil && "sql: no rows in result set" != e.Error() {
+		log.Panicf("failed to query alerts undelivered by %s: %+v", sid, e)
+	}
+	return
+}
+
+//delivered records the alerts as delivered by the sink.
+func delivered(sid string, alerts []*Alert) {
+	d, t := util.TimeStr()
+	valueStrings := make([]string, 0, len(alerts))
+	valueArgs := make([]interface{}, 0, len(alerts)*6)
+	for _, a := range alerts {
+		valueStrings = append(valueStrings, "(?, ?, ?, ?, ?, ?)")
+		valueArgs = append(valueArgs, a.Rule, a.Code, a.Key, sid, d, t)
+	}
+	_, e := dbmap.Exec(fmt.Sprintf("insert ignore into alert_sent (rule, code, ekey, sink, udate, utime) values %s",
+		strings.Join(valueStrings, ",")), valueArgs...)
+	util.CheckErr(e, fmt.Sprintf("failed to record %d alerts delivered by %s", len(alerts), sid))
+}
+
+//evalPrice fires when the latest non-reinstated close crosses the value.
+func evalPrice(rule *conf.AlertRule, codes []string) (alerts []*Alert) {
+	for _, c := range codes {
+		kls := getd.GetKlineDb(c, model.KLINE_DAY_NR, 2, false)
+		if len(kls) < 2 {
+			continue
+		}
+		prev, last := kls[0].Close, kls[1].Close
+		if (rule.Kind == "price_above" && prev <= rule.Value && last > rule.Value) ||
+			(rule.Kind == "price_below" && prev >= rule.Value && last < rule.Value) {
+			alerts = append(alerts, &Alert{Code: c, Key: kls[1].Date,
+				Msg: fmt.Sprintf("close %.2f on %s crossed %.2f from %.2f", last, kls[1].Date, rule.Value, prev)})
+		}
+	}
+	return
+}
+
+//evalKdjCross fires when J crosses D in the latest period.
+func evalKdjCross(rule *conf.AlertRule, codes []string) (alerts []*Alert) {
+	tab := map[string]model.DBTab{"D": model.INDICATOR_DAY, "W": model.INDICATOR_WEEK,
+		"M": model.INDICATOR_MONTH}[rule.Cytp]
+	for _, c := range codes {
+		hist := getd.GetKdjHist(c, tab, 2, "")
+		x := kdjCross(hist)
+		if x == "" || (rule.Cross != "" && rule.Cross != x) {
+			continue
+		}
+		last := hist[len(hist)-1]
+		alerts = append(alerts, &Alert{Code: c, Key: last.Date,
+			Msg: fmt.Sprintf("kdj %s cross on %s of %s: K %.2f, D %.2f, J %.2f", x, rule.Cytp, last.Date,
+				last.KDJ_K, last.KDJ_D, last.KDJ_J)})
+	}
+	return
+}
+
+//kdjCross returns "golden" if J crosses D upward in the last two periods, "dead" if downward,
+// or empty string if there's no cross.
+func kdjCross(hist []*model.Indicator) string {
+	if len(hist) < 2 {
+		return ""
+	}
+	p, l := hist[len(hist)-2], hist[len(hist)-1]
+	switch {
+	case p.KDJ_J <= p.KDJ_D && l.KDJ_J > l.KDJ_D:
+		return "golden"
+	case p.KDJ_J >= p.KDJ_D && l.KDJ_J < l.KDJ_D:
+		return "dead"
+	}
+	return ""
+}
+
+//evalKdjSt fires when KdjSt score reaches the value, once a day.
+func evalKdjSt(rule *conf.AlertRule, codes []string) (alerts []*Alert) {
+	r := new(score.KdjSt).Get(codes, -1, false)
+	for _, it := range r.Items {
+		s := it.Profiles[new(score.KdjSt).Id()].Score
+		if s < rule.Value {
+			continue
+		}
+		alerts = append(alerts, &Alert{Code: it.Code, Key: time.Now().Format("2006-01-02"),
+			Msg: fmt.Sprintf("%s kdjst score %.2f reached %.2f", it.Name, s, rule.Value)})
+	}
+	return
+}
+
+//evalDiviReg fires once for each dividend whose registration date is due within value days.
+func evalDiviReg(rule *conf.AlertRule, codes []string) (alerts []*Alert) {
+	sql, e := dot.Raw("ALERT_DIVI_REG")
+	util.CheckErr(e, "failed to get ALERT_DIVI_REG sql")
+	now := time.Now()
+	var xdxrs []*model.Xdxr
+	_, e = dbmap.Select(&xdxrs, fmt.Sprintf(sql, util.Join(codes, ",", true)), now.Format("2006-01-02"),
+		now.AddDate(0, 0, int(rule.Value)).Format("2006-01-02"))
+	if e != nil && "sql: no rows in result set" != e.Error() {
+		log.Panicf("failed to query upcoming dividend registration: %+v", e)
+	}
+	for _, x := range xdxrs {
+		alerts = append(alerts, &Alert{Code: x.Code, Key: x.RegDate.String,
+			Msg: fmt.Sprintf("dividend of %.2f per 10 shares registered on %s", x.Divi.Float64, x.RegDate.String)})
+	}
+	return
+}
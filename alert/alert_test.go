@@ -0,0 +1,38 @@
+package alert
+
+import (
+	"testing"
+
+	"github.com/carusyte/stock/conf"
+	"github.com/carusyte/stock/model"
+)
+
+func TestKdjCross(t *testing.T) {
+	ind := func(k, d, j float64) *model.Indicator {
+		return &model.Indicator{KDJ_K: k, KDJ_D: d, KDJ_J: j}
+	}
+	for exp, hist := range map[string][]*model.Indicator{
+		"golden": {ind(20, 25, 10), ind(30, 27, 36)},
+		"dead":   {ind(80, 75, 90), ind(70, 74, 62)},
+		"":       {ind(80, 75, 90), ind(82, 77, 92)},
+	} {
+		if x := kdjCross(hist); x != exp {
+			t.Errorf("expecting %q cross, got %q", exp, x)
+		}
+	}
+	if x := kdjCross([]*model.Indicator{ind(1, 1, 1)}); x != "" {
+		t.Errorf("expecting no cross with insufficient history, got %q", x)
+	}
+}
+
+func TestSinkID(t *testing.T) {
+	for exp, sc := range map[string]conf.AlertSink{
+		"log:/tmp/alert.log":         {Kind: "log", Path: "/tmp/alert.log"},
+		"webhook:http://x/hook":      {Kind: "webhook", URL: "http://x/hook", Headers: map[string]string{"A": "b"}},
+		"smtp:mail:25/a@x.cn,b@x.cn": {Kind: "smtp", Addr: "mail:25", User: "u", To: []string{"a@x.cn", "b@x.cn"}},
+	} {
+		if id := sinkID(sc); id != exp {
+			t.Errorf("expecting sink id %s, got %s", exp, id)
+		}
+	}
+}
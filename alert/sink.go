@@ -0,0 +1,112 @@
+package alert
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/smtp"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/carusyte/stock/conf"
+	"github.com/pkg/errors"
+)
+
+//Sink sends alerts to somewhere.
+type Sink interface {
+	Send(alerts []*Alert) error
+}
+
+//NewSink creates the sink of the configuration, see conf.AlertSink.
+func NewSink(c conf.AlertSink) Sink {
+	switch c.Kind {
+	case "log":
+		return &LogSink{Path: c.Path}
+	case "webhook":
+		return &WebhookSink{URL: c.URL, Headers: c.Headers}
+	case "smtp":
+		return &SmtpSink{Addr: c.Addr, User: c.User, Password: c.Password, From: c.From, To: c.To}
+	default:
+		log.Panicf("unknown alert sink: %s", c.Kind)
+	}
+	return nil
+}
+
+//LogSink appends alerts to the file, one per line.
+type LogSink struct {
+	Path string
+}
+
+func (s *LogSink) Send(alerts []*Alert) error {
+	f, e := os.OpenFile(s.Path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
+	if e != nil {
+		return errors.Wrapf(e, "failed to open alert log %s", s.Path)
+	}
+	defer f.Close()
+	for _, a := range alerts {
+		if _, e = fmt.Fprintln(f, a); e != nil {
+			return errors.Wrapf(e, "failed to write alert log %s", s.Path)
+		}
+	}
+	return nil
+}
+
+//WebhookSink posts alerts to the URL in the form of {"alerts": [...]}.
+type WebhookSink struct {
+	URL     string
+	Headers map[string]string
+}
+
+func (s *WebhookSink) Send(alerts []*Alert) error {
+	j, e := json.Marshal(map[string]interface{}{"alerts": alerts})
+	if e != nil {
+		return errors.Wrap(e, "failed to marshal alerts")
+	}
+	req, e := http.NewRequest("POST", s.URL, bytes.NewReader(j))
+	if e != nil {
+		return errors.Wrapf(e, "invalid webhook %s", s.URL)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range s.Headers {
+		req.Header.Set(k, v)
+	}
+	res, e := (&http.Client{Timeout: 30 * time.Second}).Do(req)
+	if e != nil {
+		return errors.Wrapf(e, "failed to post alerts to %s", s.URL)
+	}
+	defer res.Body.Close()
+	if res.StatusCode/100 != 2 {
+		return errors.Errorf("webhook %s replied %s", s.URL, res.Status)
+	}
+	return nil
+}
+
+//SmtpSink mails alerts in one message.
+type SmtpSink struct {
+	Addr     string
+	User     string
+	Password string
+	From     string
+	To       []string
+}
+
+func (s *SmtpSink) Send(alerts []*Alert) error {
+	var auth smtp.Auth
+	if s.User != "" {
+		auth = smtp.PlainAuth("", s.User, s.Password, strings.Split(s.Addr, ":")[0])
+	}
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "From: %s\r\nTo: %s\r\nSubject: %d stock alerts\r\n", s.From, strings.Join(s.To, ", "),
+		len(alerts))
+	fmt.Fprintf(&b, "Content-Type: text/plain; charset=UTF-8\r\n\r\n")
+	for _, a := range alerts {
+		fmt.Fprintf(&b, "%s\r\n", a)
+	}
+	if e := smtp.SendMail(s.Addr, auth, s.From, s.To, b.Bytes()); e != nil {
+		return errors.Wrapf(e, "failed to mail alerts via %s", s.Addr)
+	}
+	return nil
+}
@@ -0,0 +1,131 @@
+package alert
+
+import (
+	"bufio"
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+var testAlerts = []*Alert{
+	{Rule: "r1", Kind: "price_above", Code: "600000", Key: "2018-10-19", Msg: "close 10.50",
+		Time: "2018-10-19 15:30:00"},
+	{Rule: "r2", Kind: "divi_reg", Code: "601398", Key: "2018-11-01", Msg: "dividend",
+		Time: "2018-10-19 15:30:00"},
+}
+
+func TestLogSink(t *testing.T) {
+	f, e := ioutil.TempFile("", "alert")
+	if e != nil {
+		t.Fatal(e)
+	}
+	f.Close()
+	defer os.Remove(f.Name())
+	s := &LogSink{Path: f.Name()}
+	for i := 0; i < 2; i++ {
+		if e = s.Send(testAlerts); e != nil {
+			t.Fatal(e)
+		}
+	}
+	b, _ := ioutil.ReadFile(f.Name())
+	lines := strings.Split(strings.TrimSpace(string(b)), "\n")
+	if len(lines) != 4 || lines[0] != "2018-10-19 15:30:00 [r1] 600000: close 10.50" {
+		t.Errorf("unexpected alert log:\n%s", b)
+	}
+}
+
+func TestWebhookSink(t *testing.T) {
+	var got struct {
+		Alerts []*Alert `json:"alerts"`
+	}
+	var token string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token = r.Header.Get("X-Token")
+		if e := json.NewDecoder(r.Body).Decode(&got); e != nil {
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+	defer srv.Close()
+	s := &WebhookSink{URL: srv.URL, Headers: map[string]string{"X-Token": "secret"}}
+	if e := s.Send(testAlerts); e != nil {
+		t.Fatal(e)
+	}
+	if token != "secret" || len(got.Alerts) != 2 || *got.Alerts[1] != *testAlerts[1] {
+		t.Errorf("unexpected webhook request, token: %s, alerts: %+v", token, got.Alerts)
+	}
+	nf := httptest.NewServer(http.NotFoundHandler())
+	defer nf.Close()
+	s.URL = nf.URL
+	if e := s.Send(testAlerts); e == nil {
+		t.Error("expecting error on non-2xx reply")
+	}
+}
+
+//smtpStandIn accepts one mail and sends the data it received to the channel.
+func smtpStandIn(t *testing.T) (addr string, data chan string) {
+	l, e := net.Listen("tcp", "127.0.0.1:0")
+	if e != nil {
+		t.Fatal(e)
+	}
+	data = make(chan string, 1)
+	go func() {
+		defer l.Close()
+		c, e := l.Accept()
+		if e != nil {
+			return
+		}
+		defer c.Close()
+		r := bufio.NewReader(c)
+		reply := func(s string) { c.Write([]byte(s + "\r\n")) }
+		reply("220 localhost ESMTP")
+		var body []string
+		inData := false
+		for {
+			line, e := r.ReadString('\n')
+			if e != nil {
+				return
+			}
+			line = strings.TrimRight(line, "\r\n")
+			if inData {
+				if line == "." {
+					inData = false
+					data <- strings.Join(body, "\n")
+					reply("250 OK")
+				} else {
+					body = append(body, line)
+				}
+				continue
+			}
+			switch cmd := strings.ToUpper(strings.SplitN(line, " ", 2)[0]); cmd {
+			case "EHLO", "HELO":
+				reply("250 localhost")
+			case "DATA":
+				inData = true
+				reply("354 go ahead")
+			case "QUIT":
+				reply("221 bye")
+				return
+			default:
+				reply("250 OK")
+			}
+		}
+	}()
+	return l.Addr().String(), data
+}
+
+func TestSmtpSink(t *testing.T) {
+	addr, data := smtpStandIn(t)
+	s := &SmtpSink{Addr: addr, From: "stock@localhost", To: []string{"team@localhost"}}
+	if e := s.Send(testAlerts); e != nil {
+		t.Fatal(e)
+	}
+	mail := <-data
+	if !strings.Contains(mail, "Subject: 2 stock alerts") || !strings.Contains(mail, "[r2] 601398: dividend") {
+		t.Errorf("unexpected mail:\n%s", mail)
+	}
+}
@@ -4,8 +4,11 @@ import (
 	"flag"
 	"fmt"
 	"github.com/carusyte/stock/advisor"
+	// evaluates watchlist alerts after data refresh
+	_ "github.com/carusyte/stock/alert"
 	"github.com/carusyte/stock/db"
 	"github.com/carusyte/stock/getd"
+	"github.com/carusyte/stock/metrics"
 	"github.com/carusyte/stock/util"
 	"gopkg.in/gorp.v2"
 	"io"
@@ -25,9 +28,17 @@ var (
 	versionFlag *bool = flag.Bool("v", false, "Print the version number.")
 	advisorId *string =flag.String("a", "", "The Adviser Id.")
 	refresh *bool = flag.Bool("r", false, "Refresh local data before providing any advice.")
+	codes *string = flag.String("codes", "", "Comma separated stock codes, for advisors accepting the codes parameter.")
+	sortBy *string = flag.String("sort", "", "Sort the advice by the column.")
+	desc *bool = flag.Bool("desc", false, "Sort in descending order.")
+	limit *int = flag.Int("limit", 0, "Maximum number of rows in the advice, no limit if not positive.")
+	format *string = flag.String("fmt", advisor.FMT_TABLE, "Output format: table, csv or json.")
+	list *bool = flag.Bool("l", false, "List the advisors and their parameters.")
+	params = paramFlag{}
 )
 
 func init() {
+	flag.Var(params, "p", "Advisor parameter in the form of name=value, repeatable.")
 	if _, err := os.Stat(LOGFILE); err == nil {
 		os.Remove(LOGFILE)
 	}
@@ -41,29 +52,82 @@ func init() {
 func main() {
 
 	flag.Parse() // Scan the arguments list
+	metrics.Serve()
 
 	if *versionFlag {
 		fmt.Println("Version:", APP_VERSION)
 		return
 	}
-	if advisorId == nil{
-		fmt.Println("Advisor Id is needed.")
+	if *list {
+		listAdvisors()
 		return
 	}
+	if *advisorId == "" {
+		fmt.Println("Advisor Id is needed.")
+		os.Exit(1)
+	}
+	if *codes != "" {
+		if acceptsCodes(*advisorId) {
+			params["codes"] = *codes
+		} else {
+			log.Printf("advisor %s doesn't accept the codes parameter, -codes ignored", *advisorId)
+		}
+	}
 	if *refresh{
 		getd.Get()
 	}
 
-	var t *advisor.Table
-	avr := advisor.New()
-	arg := *advisorId;
-	switch {
-	case strings.EqualFold("HiDivi", arg):
-		t = avr.HiDivi(25)
-
-	default:
+	t, e := advisor.New().Ask(*advisorId, params)
+	if e == nil && *sortBy != "" {
+		e = t.Sort(*sortBy, *desc)
+	}
+	if e != nil {
+		fmt.Println(e)
 		os.Exit(1)
 	}
+	t.Limit(*limit)
+	util.CheckErr(t.Write(os.Stdout, *format), "failed to output advice")
+}
+
+func listAdvisors() {
+	for _, s := range advisor.Specs() {
+		fmt.Printf("%s\t%s\n", s.Name, s.Desc)
+		for _, p := range s.Params {
+			fmt.Printf("\t%s (%s, default %q): %s\n", p.Name, p.Type, p.Default, p.Desc)
+		}
+	}
+}
+
+//acceptsCodes tells whether the advisor declares the codes parameter.
+func acceptsCodes(name string) bool {
+	s, ok := advisor.SpecOf(name)
+	if !ok {
+		return false
+	}
+	for _, p := range s.Params {
+		if p.Name == "codes" {
+			return true
+		}
+	}
+	return false
+}
 
-	fmt.Printf("%v", t)
+//paramFlag collects repeated name=value flags.
+type paramFlag map[string]string
+
+func (p paramFlag) String() string {
+	var kv []string
+	for k, v := range p {
+		kv = append(kv, k+"="+v)
+	}
+	return strings.Join(kv, ",")
+}
+
+func (p paramFlag) Set(s string) error {
+	kv := strings.SplitN(s, "=", 2)
+	if len(kv) != 2 || strings.TrimSpace(kv[0]) == "" {
+		return fmt.Errorf("expecting name=value: %s", s)
+	}
+	p[strings.TrimSpace(kv[0])] = kv[1]
+	return nil
 }
@@ -0,0 +1,88 @@
+package conf
+
+import (
+	"github.com/pkg/errors"
+)
+
+//AlertArgs watchlist alerting, evaluated after each data refresh, see alert.Run
+type AlertArgs struct {
+	//Watchlist codes the rules apply to unless the rule specifies its own
+	Watchlist []string    `mapstructure:"watchlist"`
+	Rules     []AlertRule `mapstructure:"rules"`
+	Sinks     []AlertSink `mapstructure:"sinks"`
+}
+
+//AlertRule an alerting rule, identified by Name. Kind is one of:
+// "price_above", "price_below": latest close crosses Value
+// "kdj_cross": J crosses D on Cytp (D, W or M) in Cross direction, "golden", "dead" or either if empty
+// "kdjst_above": KdjSt score reaches Value
+// "divi_reg": dividend registration date is due within Value days
+// Other kinds are left to the evaluators registered by alert.RegisterEvaluator, rules of unregistered kinds
+// are reported and skipped by alert.Run.
+type AlertRule struct {
+	Name  string   `mapstructure:"name"`
+	Kind  string   `mapstructure:"kind"`
+	Codes []string `mapstructure:"codes"`
+	Value float64  `mapstructure:"value"`
+	Cytp  string   `mapstructure:"cytp"`
+	Cross string   `mapstructure:"cross"`
+}
+
+//AlertSink destination of alerts. Kind is one of:
+// "log": appends to the file of Path
+// "webhook": posts alerts in JSON to URL with Headers
+// "smtp": mails alerts via SMTP server at Addr, authenticated by User and Password if specified
+type AlertSink struct {
+	Kind     string            `mapstructure:"kind"`
+	Path     string            `mapstructure:"path"`
+	URL      string            `mapstructure:"url"`
+	Headers  map[string]string `mapstructure:"headers"`
+	Addr     string            `mapstructure:"addr"`
+	User     string            `mapstructure:"user"`
+	Password string            `mapstructure:"password"`
+	From     string            `mapstructure:"from"`
+	To       []string          `mapstructure:"to"`
+}
+
+func (a *AlertArgs) validate() error {
+	names := make(map[string]bool)
+	for _, r := range a.Rules {
+		if r.Name == "" || names[r.Name] {
+			return errors.Errorf("alert rule name must be unique and not empty: %+v", r)
+		}
+		names[r.Name] = true
+		if len(r.Codes) == 0 && len(a.Watchlist) == 0 {
+			return errors.Errorf("alert rule %s applies to no code, specify codes or watchlist", r.Name)
+		}
+		switch r.Kind {
+		case "price_above", "price_below", "kdjst_above":
+		case "divi_reg":
+			if r.Value <= 0 {
+				return errors.Errorf("alert rule %s value must be positive days: %.0f", r.Name, r.Value)
+			}
+		case "kdj_cross":
+			switch r.Cytp {
+			case "D", "W", "M":
+			default:
+				return errors.Errorf("alert rule %s cytp must be one of D, W or M: %s", r.Name, r.Cytp)
+			}
+			switch r.Cross {
+			case "", "golden", "dead":
+			default:
+				return errors.Errorf("alert rule %s cross must be golden, dead or empty: %s", r.Name, r.Cross)
+			}
+		case "":
+			return errors.Errorf("alert rule %s must specify the kind", r.Name)
+		}
+	}
+	for _, s := range a.Sinks {
+		switch {
+		case s.Kind == "log" && s.Path != "":
+		case s.Kind == "webhook" && s.URL != "":
+		case s.Kind == "smtp" && s.Addr != "" && s.From != "" && len(s.To) > 0:
+		default:
+			return errors.Errorf("invalid alert sink: %+v", s)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,40 @@
+package conf
+
+import "testing"
+
+func TestAlertValidate(t *testing.T) {
+	a := AlertArgs{
+		Watchlist: []string{"600000"},
+		Rules: []AlertRule{
+			{Name: "breakout", Kind: "price_above", Value: 12},
+			{Name: "kdj", Kind: "kdj_cross", Cytp: "W", Cross: "golden"},
+			{Name: "divi", Kind: "divi_reg", Value: 7},
+		},
+		Sinks: []AlertSink{{Kind: "log", Path: "alert.log"}, {Kind: "smtp", Addr: "localhost:25",
+			From: "stock@localhost", To: []string{"team@localhost"}}},
+	}
+	if e := a.validate(); e != nil {
+		t.Fatal(e)
+	}
+	c := a
+	c.Rules = append([]AlertRule{{Name: "volume", Kind: "volume_above", Value: 2}}, a.Rules...)
+	if e := c.validate(); e != nil {
+		t.Errorf("expecting custom kind to be left to registered evaluator: %+v", e)
+	}
+	for _, mod := range []func(a *AlertArgs){
+		func(a *AlertArgs) { a.Rules[1].Name = "breakout" },
+		func(a *AlertArgs) { a.Rules[1].Cytp = "H" },
+		func(a *AlertArgs) { a.Rules[2].Value = 0 },
+		func(a *AlertArgs) { a.Rules[0].Kind = "" },
+		func(a *AlertArgs) { a.Watchlist = nil },
+		func(a *AlertArgs) { a.Sinks[1].To = nil },
+	} {
+		b := a
+		b.Rules = append([]AlertRule(nil), a.Rules...)
+		b.Sinks = append([]AlertSink(nil), a.Sinks...)
+		mod(&b)
+		if e := b.validate(); e == nil {
+			t.Errorf("expecting error on invalid alert args: %+v", b)
+		}
+	}
+}
@@ -1,12 +1,20 @@
 package conf
 
 import (
+	"sync/atomic"
+
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/viper"
 )
 
-// Args Global Application Arguments
-var Args Arguments
+//args holds the *Arguments in effect, replaced as a whole by Apply, see Args
+var args atomic.Value
+
+//Args returns the global application arguments in effect. They are shared among goroutines and must not be
+// modified, use Apply to replace them. Keep the returned pointer for a consistent view throughout a task.
+func Args() *Arguments {
+	return args.Load().(*Arguments)
+}
 
 // RunMode Running mode
 type RunMode string
@@ -25,20 +33,43 @@ const (
 //Arguments arguments struct type
 type Arguments struct {
 	//RPCServers rpc server address strings
-	RPCServers        []string `mapstructure:"rpc_servers"`
-	RunMode           RunMode  `mapstructure:"run_mode"`
-	Concurrency       int      `mapstructure:"concurrency"`
-	CPUUsageThreshold float64  `mapstructure:"cpu_usage_threshold"`
-	LogLevel          string   `mapstructure:"log_level"`
-	Kdjv              struct {
-		SampleSizeMin int `mapstructure:"sample_size_min"`
-		StatsRetroSpan int `mapstructure:"stats_retro_span"`
-	}
+	RPCServers []string `mapstructure:"rpc_servers"`
+	//RPCTimeout deadline in seconds for each rpc call, no deadline if <= 0
+	RPCTimeout int `mapstructure:"rpc_timeout"`
+	//RPCMaxIdle maximum number of idle connections kept for each rpc server
+	RPCMaxIdle int `mapstructure:"rpc_max_idle"`
+	//DistConcurrency number of jobs dispatched concurrently to each rpc server in distributed mode
+	DistConcurrency   int     `mapstructure:"dist_concurrency"`
+	RunMode           RunMode `mapstructure:"run_mode"`
+	Concurrency       int     `mapstructure:"concurrency"`
+	CPUUsageThreshold float64 `mapstructure:"cpu_usage_threshold"`
+	LogLevel          string  `mapstructure:"log_level"`
+	//MetricsAddress listening address of the prometheus metrics endpoint, disabled if empty
+	MetricsAddress string `mapstructure:"metrics_address"`
+	//WatchConfig whether to watch the config file and apply changes live, see Subscribe
+	WatchConfig bool `mapstructure:"watch_config"`
+	//ProxyPart portion of http requests made via the socks5 proxy, 0.6 = 3/5
+	ProxyPart float64 `mapstructure:"proxy_part"`
+	//ProxyAddr address of the socks5 proxy
+	ProxyAddr string `mapstructure:"proxy_addr"`
+	//Profile name of the scorer parameter profile, see Profiles
+	Profile string `mapstructure:"profile"`
+	//FeatSampling names of extra indicators to sample features for after KDJ, see indc.FeatIndcs. KDJ itself is
+	// sampled separately and not allowed here, see getd.SmpKdjFeat
+	FeatSampling []string `mapstructure:"feat_sampling"`
+	Kdjv         KdjvArgs
+	BlueChip     BlueChipArgs
+	HiD          HiDArgs
+	Exit         ExitArgs
+	Valuation    ValuationArgs
+	Alert        AlertArgs
 	//TODO logrus log to file
 }
 
 func init() {
-	setDefaults()
+	a := new(Arguments)
+	setDefaults(a)
+	args.Store(a)
 	viper.SetConfigName("stock") // name of config file (without extension)
 	viper.AddConfigPath("$GOPATH/bin")
 	viper.AddConfigPath(".") // optionally look for config in the working directory
@@ -48,13 +79,36 @@ func init() {
 		logrus.Errorf("config file error: %+v", err)
 		return
 	}
-	err = viper.Unmarshal(&Args)
+	// values set explicitly in config file take precedence over the profile
+	a = new(Arguments)
+	setDefaults(a)
+	err = a.UseProfile(viper.GetString("profile"))
+	if err != nil {
+		logrus.Panicf("config file error: %+v", err)
+	}
+	err = viper.Unmarshal(a)
 	if err != nil {
 		logrus.Errorf("config file error: %+v", err)
 		return
 	}
-	logrus.Printf("Configuration: %+v", Args)
-	switch Args.LogLevel {
+	if err = a.Validate(); err != nil {
+		logrus.Panicf("invalid configuration: %+v", err)
+	}
+	args.Store(a)
+	logrus.Printf("Configuration: %+v", *a)
+	setLogLevel(a.LogLevel)
+	Subscribe("log_level", func(old, new *Arguments) {
+		if old.LogLevel != new.LogLevel {
+			setLogLevel(new.LogLevel)
+		}
+	})
+	if a.WatchConfig {
+		Watch()
+	}
+}
+
+func setLogLevel(level string) {
+	switch level {
 	case "debug":
 		logrus.SetLevel(logrus.DebugLevel)
 	case "info":
@@ -68,17 +122,18 @@ func init() {
 	case "panic":
 		logrus.SetLevel(logrus.PanicLevel)
 	}
-	//viper.WatchConfig()
-	//viper.OnConfigChange(func(e fsnotify.Event) {
-	//	fmt.Println("Config file changed:", e.Name)
-	//})
 }
 
-func setDefaults() {
-	Args.RunMode = LOCAL
-	Args.Concurrency = 16
-	Args.LogLevel = "info"
-	Args.CPUUsageThreshold = 40
-	Args.Kdjv.SampleSizeMin = 5
-	Args.Kdjv.StatsRetroSpan = 600
+func setDefaults(a *Arguments) {
+	a.RunMode = LOCAL
+	a.Concurrency = 16
+	a.RPCTimeout = 600
+	a.RPCMaxIdle = 8
+	a.DistConcurrency = 2
+	a.LogLevel = "info"
+	a.CPUUsageThreshold = 40
+	a.ProxyAddr = "127.0.0.1:1080"
+	a.Kdjv.SampleSizeMin = 5
+	a.Kdjv.StatsRetroSpan = 600
+	a.UseProfile(DEFAULT_PROFILE)
 }
@@ -0,0 +1,250 @@
+package conf
+
+import (
+	"github.com/pkg/errors"
+)
+
+//DEFAULT_PROFILE name of the default scorer parameter profile
+const DEFAULT_PROFILE = "default"
+
+//KdjvArgs parameters of KdjV scorer and its feature data
+type KdjvArgs struct {
+	SampleSizeMin  int `mapstructure:"sample_size_min"`
+	StatsRetroSpan int `mapstructure:"stats_retro_span"`
+	//StatsExpvr, StatsMxrt, StatsMxhold sampling parameters of kdjv stats renewal
+	StatsExpvr  float64 `mapstructure:"stats_expvr"`
+	StatsMxrt   float64 `mapstructure:"stats_mxrt"`
+	StatsMxhold int     `mapstructure:"stats_mxhold"`
+	//WeightMonth, WeightWeek, WeightDay weights of scores in each kdj cycle
+	WeightMonth float64 `mapstructure:"weight_month"`
+	WeightWeek  float64 `mapstructure:"weight_week"`
+	WeightDay   float64 `mapstructure:"weight_day"`
+	//PrunePrec similarity above which kdj feature data are grouped into the same cluster
+	PrunePrec float64 `mapstructure:"prune_prec"`
+	//PruneRate clustering stops once the ratio of samples changing cluster in an iteration drops to this value
+	PruneRate float64 `mapstructure:"prune_rate"`
+	//LocalPruneThreshold feature data groups larger than this are pruned remotely in AUTO mode
+	LocalPruneThreshold int `mapstructure:"local_prune_threshold"`
+	//SimMetric similarity metric matching kdj history against feature data: devia, dtw or zed
+	SimMetric string `mapstructure:"sim_metric"`
+	//DtwWindow width of the dtw warping band in proportion to the longer data set
+	DtwWindow float64 `mapstructure:"dtw_window"`
+	//TopMatch number of most similar buy and sell feature data shown for each cycle, none if 0
+	TopMatch int `mapstructure:"top_match"`
+	//Version feature data version used for scoring, the latest ready version if empty, see getd.KdjFdVer
+	Version string `mapstructure:"version"`
+	//UpdateFd whether to update the feature data with new samples after each data refresh, see getd.Get
+	UpdateFd bool `mapstructure:"update_fd"`
+	//KeepVers number of latest ready feature data versions to keep when new versions are made ready, older ones
+	// are dropped unless pinned, see getd.PurgeKdjFdVers. Versions are never purged if 0.
+	KeepVers int `mapstructure:"keep_vers"`
+	//PinVers feature data versions never purged, e.g. those under A/B comparison, see score.CompareKdjV
+	PinVers []string `mapstructure:"pin_vers"`
+}
+
+//BlueChipArgs maximum score/penalty of each assessment aspect of BlueChip scorer
+type BlueChipArgs struct {
+	ScorePe     float64 `mapstructure:"score_pe"`
+	ScoreGeps   float64 `mapstructure:"score_geps"`
+	ScorePu     float64 `mapstructure:"score_pu"`
+	ScoreGudpps float64 `mapstructure:"score_gudpps"`
+	PenaltyDar  float64 `mapstructure:"penalty_dar"`
+}
+
+//HiDArgs maximum score/penalty of each assessment aspect of HiD scorer
+type HiDArgs struct {
+	//AvgGrHistSize number of years to evaluate average dividend growth
+	AvgGrHistSize  int     `mapstructure:"avg_gr_hist_size"`
+	ScoreDyrAvg    float64 `mapstructure:"score_dyr_avg"`
+	ScoreDyrGr     float64 `mapstructure:"score_dyr_gr"`
+	ScoreLatestDyr float64 `mapstructure:"score_latest_dyr"`
+	ScoreDyr2Dpr   float64 `mapstructure:"score_dyr2dpr"`
+	ScoreRegDate   float64 `mapstructure:"score_reg_date"`
+	PenaltyDpr     float64 `mapstructure:"penalty_dpr"`
+}
+
+//ExitArgs parameters of Exit advisor. Exit urgency of each aspect adds up to the score, on which the
+// action is decided by TrimLine and ExitLine.
+type ExitArgs struct {
+	//ScoreSellPtn maximum urgency of kdj sell pattern similarity
+	ScoreSellPtn float64 `mapstructure:"score_sell_ptn"`
+	//ScoreDrawdown maximum urgency of trailing drawdown, reached at MaxDrawdown
+	ScoreDrawdown float64 `mapstructure:"score_drawdown"`
+	//ScoreStopLoss maximum urgency of loss against cost, reached at StopLoss
+	ScoreStopLoss float64 `mapstructure:"score_stop_loss"`
+	//MaxDrawdown percentage of drop from the highest close in the last DrawdownSpan days
+	MaxDrawdown  float64 `mapstructure:"max_drawdown"`
+	DrawdownSpan int     `mapstructure:"drawdown_span"`
+	//StopLoss percentage of loss against cost
+	StopLoss float64 `mapstructure:"stop_loss"`
+	//DiviWindow days ahead of dividend registration within which urgency is relieved by DiviRelief
+	DiviWindow int     `mapstructure:"divi_window"`
+	DiviRelief float64 `mapstructure:"divi_relief"`
+	TrimLine   float64 `mapstructure:"trim_line"`
+	ExitLine   float64 `mapstructure:"exit_line"`
+}
+
+//ValuationArgs parameters of Valuation scorer. Score is the weighted average over the valuation metrics
+// of how cheap the latest value is within the trailing window, see getd.ValBands.
+type ValuationArgs struct {
+	//Years trailing window of valuation bands, one of getd.ValBandYears
+	Years int `mapstructure:"years"`
+	//MinSamples metrics with fewer valid samples in the window are not scored
+	MinSamples int `mapstructure:"min_samples"`
+	//WeightPe, WeightPb, WeightPs, WeightDyr weights of PE, PB, PS and dividend yield
+	WeightPe  float64 `mapstructure:"weight_pe"`
+	WeightPb  float64 `mapstructure:"weight_pb"`
+	WeightPs  float64 `mapstructure:"weight_ps"`
+	WeightDyr float64 `mapstructure:"weight_dyr"`
+}
+
+//Profiles named scorer parameter sets. Each profile is applied on top of the default one.
+var Profiles = map[string]func(a *Arguments){
+	DEFAULT_PROFILE: func(a *Arguments) {
+		a.Kdjv.StatsExpvr = 5
+		a.Kdjv.StatsMxrt = 2
+		a.Kdjv.StatsMxhold = 3
+		a.Kdjv.WeightMonth = 40
+		a.Kdjv.WeightWeek = 30
+		a.Kdjv.WeightDay = 30
+		a.Kdjv.PrunePrec = 0.99
+		a.Kdjv.PruneRate = 0.1
+		a.Kdjv.LocalPruneThreshold = 3000
+		a.Kdjv.SimMetric = "devia"
+		a.Kdjv.DtwWindow = 0.2
+		a.Kdjv.TopMatch = 3
+		a.BlueChip = BlueChipArgs{ScorePe: 20, ScoreGeps: 60, ScorePu: 10, ScoreGudpps: 10, PenaltyDar: 15}
+		a.HiD = HiDArgs{AvgGrHistSize: 5, ScoreDyrAvg: 35, ScoreDyrGr: 20, ScoreLatestDyr: 20,
+			ScoreDyr2Dpr: 15, ScoreRegDate: 10, PenaltyDpr: 25}
+		a.Exit = ExitArgs{ScoreSellPtn: 50, ScoreDrawdown: 30, ScoreStopLoss: 20, MaxDrawdown: 15,
+			DrawdownSpan: 60, StopLoss: 10, DiviWindow: 15, DiviRelief: 20, TrimLine: 40, ExitLine: 70}
+		a.Valuation = ValuationArgs{Years: 5, MinSamples: 250, WeightPe: 40, WeightPb: 30, WeightPs: 10,
+			WeightDyr: 20}
+	},
+	// favors long term trend, valuation and stable dividend, with heavier penalties
+	"conservative": func(a *Arguments) {
+		a.Kdjv.WeightMonth = 50
+		a.Kdjv.WeightWeek = 30
+		a.Kdjv.WeightDay = 20
+		a.BlueChip = BlueChipArgs{ScorePe: 30, ScoreGeps: 50, ScorePu: 10, ScoreGudpps: 10, PenaltyDar: 25}
+		a.HiD = HiDArgs{AvgGrHistSize: 5, ScoreDyrAvg: 40, ScoreDyrGr: 15, ScoreLatestDyr: 20,
+			ScoreDyr2Dpr: 15, ScoreRegDate: 10, PenaltyDpr: 35}
+		a.Exit.MaxDrawdown = 10
+		a.Exit.StopLoss = 7
+		a.Exit.TrimLine = 30
+		a.Exit.ExitLine = 60
+		a.Valuation = ValuationArgs{Years: 10, MinSamples: 500, WeightPe: 35, WeightPb: 35, WeightPs: 5,
+			WeightDyr: 25}
+	},
+	// favors short term trend and growth, with lighter penalties
+	"aggressive": func(a *Arguments) {
+		a.Kdjv.WeightMonth = 30
+		a.Kdjv.WeightWeek = 30
+		a.Kdjv.WeightDay = 40
+		a.BlueChip = BlueChipArgs{ScorePe: 10, ScoreGeps: 65, ScorePu: 5, ScoreGudpps: 20, PenaltyDar: 10}
+		a.HiD = HiDArgs{AvgGrHistSize: 3, ScoreDyrAvg: 25, ScoreDyrGr: 30, ScoreLatestDyr: 25,
+			ScoreDyr2Dpr: 10, ScoreRegDate: 10, PenaltyDpr: 15}
+		a.Exit.MaxDrawdown = 20
+		a.Exit.StopLoss = 15
+		a.Exit.TrimLine = 50
+		a.Exit.ExitLine = 80
+		a.Valuation = ValuationArgs{Years: 3, MinSamples: 250, WeightPe: 45, WeightPb: 20, WeightPs: 25,
+			WeightDyr: 10}
+	},
+}
+
+//UseProfile resets scorer parameters to the named profile, empty name stands for the default profile.
+func (a *Arguments) UseProfile(name string) error {
+	if name == "" {
+		name = DEFAULT_PROFILE
+	}
+	p, ok := Profiles[name]
+	if !ok {
+		return errors.Errorf("unknown profile: %s", name)
+	}
+	Profiles[DEFAULT_PROFILE](a)
+	p(a)
+	a.Profile = name
+	return nil
+}
+
+//Validate checks whether scorer parameters, concurrency and proxy settings are in valid range.
+func (a *Arguments) Validate() error {
+	if a.Concurrency <= 0 || a.DistConcurrency <= 0 {
+		return errors.Errorf("concurrency and dist_concurrency must be positive: %d, %d",
+			a.Concurrency, a.DistConcurrency)
+	}
+	if a.ProxyPart < 0 || a.ProxyPart > 1 {
+		return errors.Errorf("proxy_part must be in [0, 1]: %f", a.ProxyPart)
+	}
+	for _, n := range a.FeatSampling {
+		if n == "KDJ" {
+			return errors.New("feat_sampling must not contain KDJ, which is sampled separately")
+		}
+	}
+	k := a.Kdjv
+	if k.WeightMonth < 0 || k.WeightWeek < 0 || k.WeightDay < 0 || k.WeightMonth+k.WeightWeek+k.WeightDay <= 0 {
+		return errors.Errorf("kdjv weights must be non-negative with a positive sum: %.2f/%.2f/%.2f",
+			k.WeightMonth, k.WeightWeek, k.WeightDay)
+	}
+	if k.PrunePrec <= 0 || k.PrunePrec > 1 {
+		return errors.Errorf("kdjv prune_prec must be in (0, 1]: %f", k.PrunePrec)
+	}
+	if k.PruneRate <= 0 || k.PruneRate >= 1 {
+		return errors.Errorf("kdjv prune_rate must be in (0, 1): %f", k.PruneRate)
+	}
+	if k.LocalPruneThreshold <= 0 || k.StatsMxhold <= 0 || k.StatsExpvr <= 0 || k.StatsMxrt <= 0 ||
+		k.SampleSizeMin <= 0 || k.StatsRetroSpan <= 0 {
+		return errors.Errorf("kdjv parameters must be positive: %+v", k)
+	}
+	switch k.SimMetric {
+	case "devia", "dtw", "zed":
+	default:
+		return errors.Errorf("kdjv sim_metric must be one of devia, dtw or zed: %s", k.SimMetric)
+	}
+	if k.KeepVers < 0 {
+		return errors.Errorf("kdjv keep_vers must be non-negative: %d", k.KeepVers)
+	}
+	if k.DtwWindow < 0 || k.DtwWindow > 1 {
+		return errors.Errorf("kdjv dtw_window must be in [0, 1]: %f", k.DtwWindow)
+	}
+	if k.TopMatch < 0 {
+		return errors.Errorf("kdjv top_match must be non-negative: %d", k.TopMatch)
+	}
+	b := a.BlueChip
+	if b.ScorePe < 0 || b.ScoreGeps < 0 || b.ScorePu < 0 || b.ScoreGudpps < 0 || b.PenaltyDar < 0 {
+		return errors.Errorf("bluechip scores and penalties must be non-negative: %+v", b)
+	}
+	h := a.HiD
+	if h.AvgGrHistSize <= 0 {
+		return errors.Errorf("hid avg_gr_hist_size must be positive: %d", h.AvgGrHistSize)
+	}
+	if h.ScoreDyrAvg < 0 || h.ScoreDyrGr < 0 || h.ScoreLatestDyr < 0 || h.ScoreDyr2Dpr < 0 ||
+		h.ScoreRegDate < 0 || h.PenaltyDpr < 0 {
+		return errors.Errorf("hid scores and penalties must be non-negative: %+v", h)
+	}
+	x := a.Exit
+	if x.ScoreSellPtn < 0 || x.ScoreDrawdown < 0 || x.ScoreStopLoss < 0 || x.DiviRelief < 0 || x.DiviWindow < 0 {
+		return errors.Errorf("exit scores and relief must be non-negative: %+v", x)
+	}
+	if x.MaxDrawdown <= 0 || x.StopLoss <= 0 || x.DrawdownSpan <= 0 {
+		return errors.Errorf("exit max_drawdown, stop_loss and drawdown_span must be positive: %+v", x)
+	}
+	if x.TrimLine > x.ExitLine {
+		return errors.Errorf("exit trim_line must not exceed exit_line: %.2f, %.2f", x.TrimLine, x.ExitLine)
+	}
+	v := a.Valuation
+	switch v.Years {
+	case 3, 5, 10:
+	default:
+		return errors.Errorf("valuation years must be one of 3, 5 or 10: %d", v.Years)
+	}
+	if v.MinSamples <= 0 {
+		return errors.Errorf("valuation min_samples must be positive: %d", v.MinSamples)
+	}
+	if v.WeightPe < 0 || v.WeightPb < 0 || v.WeightPs < 0 || v.WeightDyr < 0 ||
+		v.WeightPe+v.WeightPb+v.WeightPs+v.WeightDyr <= 0 {
+		return errors.Errorf("valuation weights must be non-negative with a positive sum: %+v", v)
+	}
+	return a.Alert.validate()
+}
@@ -0,0 +1,103 @@
+package conf
+
+import (
+	"sync"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+//Listener is notified with the previous and the current arguments after the config file is reloaded.
+type Listener func(old, new *Arguments)
+
+type subscription struct {
+	id   int
+	name string
+	l    Listener
+}
+
+var (
+	subLock   sync.Mutex
+	subs      []subscription
+	subSeq    int
+	watchOnce sync.Once
+)
+
+//Subscribe registers a listener to be called, in the order of subscription, whenever a change of the
+// config file is applied. name is for logging purpose. Listeners should compare old and new arguments
+// and only reconfigure what's changed. The returned function cancels the subscription.
+func Subscribe(name string, l Listener) (cancel func()) {
+	subLock.Lock()
+	defer subLock.Unlock()
+	subSeq++
+	id := subSeq
+	subs = append(subs, subscription{id, name, l})
+	return func() {
+		subLock.Lock()
+		defer subLock.Unlock()
+		for i, s := range subs {
+			if s.id == id {
+				subs = append(subs[:i:i], subs[i+1:]...)
+				return
+			}
+		}
+	}
+}
+
+//Watch starts watching the config file. Upon change, the file is reloaded on top of the defaults
+// and the configured profile, then validated. Invalid configuration is logged and discarded, leaving
+// the current arguments intact. Otherwise the arguments are replaced and the subscribers are notified.
+// Arguments sampled at the start of a running task, e.g. concurrency or scorer parameters,
+// take effect on the next task.
+func Watch() {
+	watchOnce.Do(func() {
+		viper.WatchConfig()
+		viper.OnConfigChange(func(e fsnotify.Event) {
+			logrus.Infof("config file changed: %s %s", e.Name, e.Op)
+			Reload()
+		})
+	})
+}
+
+//Reload re-reads arguments from the config file and applies them if valid.
+func Reload() {
+	n := Arguments{}
+	setDefaults(&n)
+	if err := n.UseProfile(viper.GetString("profile")); err != nil {
+		logrus.Errorf("config change discarded: %+v", err)
+		return
+	}
+	if err := viper.Unmarshal(&n); err != nil {
+		logrus.Errorf("config change discarded: %+v", err)
+		return
+	}
+	if err := n.Validate(); err != nil {
+		logrus.Errorf("config change discarded, invalid configuration: %+v", err)
+		return
+	}
+	Apply(&n)
+}
+
+//Apply replaces the arguments in effect with n, which must not be modified afterwards, and notifies the
+// subscribers. Readers see either the old or the new arguments as a whole, see Args. Listeners may subscribe
+// or cancel subscriptions, which take effect on the next change.
+func Apply(n *Arguments) {
+	subLock.Lock()
+	old := Args()
+	args.Store(n)
+	ss := make([]subscription, len(subs))
+	copy(ss, subs)
+	subLock.Unlock()
+	logrus.Printf("Configuration reloaded: %+v", *n)
+	for _, s := range ss {
+		func() {
+			defer func() {
+				if r := recover(); r != nil {
+					logrus.Errorf("config listener %s failed: %+v", s.name, r)
+				}
+			}()
+			s.l(old, n)
+		}()
+	}
+}
@@ -0,0 +1,66 @@
+package conf
+
+import "testing"
+
+func TestApply(t *testing.T) {
+	saved := Args()
+	defer args.Store(saved)
+	n := *saved
+	n.Concurrency = saved.Concurrency + 1
+	n.RPCServers = []string{"127.0.0.1:45321"}
+	var calls []string
+	defer Subscribe("broken", func(old, new *Arguments) {
+		calls = append(calls, "broken")
+		panic("listener failure")
+	})()
+	defer Subscribe("test", func(old, new *Arguments) {
+		calls = append(calls, "test")
+		if old.Concurrency != saved.Concurrency || new.Concurrency != saved.Concurrency+1 {
+			t.Errorf("unexpected concurrency, old: %d, new: %d", old.Concurrency, new.Concurrency)
+		}
+	})()
+	Apply(&n)
+	if len(calls) != 2 || calls[1] != "test" {
+		t.Errorf("listeners should be called in order despite failures: %v", calls)
+	}
+	if a := Args(); a.Concurrency != n.Concurrency || len(a.RPCServers) != 1 || saved.Concurrency == n.Concurrency {
+		t.Errorf("arguments not applied: %+v", a)
+	}
+}
+
+func TestSubscribeCancel(t *testing.T) {
+	saved := Args()
+	defer args.Store(saved)
+	called := 0
+	cancel := Subscribe("cancelled", func(old, new *Arguments) {
+		called++
+	})
+	n := *saved
+	Apply(&n)
+	cancel()
+	cancel()
+	n2 := *saved
+	Apply(&n2)
+	if called != 1 {
+		t.Errorf("expecting 1 call before cancellation, got %d", called)
+	}
+}
+
+func TestListenerCancelSelf(t *testing.T) {
+	saved := Args()
+	defer args.Store(saved)
+	called := 0
+	var cancel func()
+	cancel = Subscribe("once", func(old, new *Arguments) {
+		called++
+		cancel()
+		defer Subscribe("nested", func(old, new *Arguments) {})()
+	})
+	n := *saved
+	Apply(&n)
+	n2 := *saved
+	Apply(&n2)
+	if called != 1 {
+		t.Errorf("expecting 1 call before self cancellation, got %d", called)
+	}
+}
@@ -11,14 +11,13 @@ import (
 	"github.com/carusyte/stock/global"
 	"database/sql"
 	"runtime"
+	"github.com/carusyte/stock/metrics"
 )
 
 const (
 	HIST_DATA_SIZE    = 200
 	JOB_CAPACITY      = global.JOB_CAPACITY
 	MAX_CONCURRENCY   = global.MAX_CONCURRENCY
-	KDJ_FD_PRUNE_PREC = 0.99
-	KDJ_PRUNE_RATE    = 0.1
 )
 
 var (
@@ -51,8 +50,6 @@ func CalcIndics(stocks *model.Stocks) (rstks *model.Stocks) {
 			log.Printf("Failed: %+v", skp)
 		}
 	}
-	//Pruning takes too long to complete, make it a separate process
-	//PruneKdjFeatDat(KDJ_FD_PRUNE_PREC, KDJ_FD_PRUNE_PASS)
 	return
 }
 
@@ -65,7 +62,6 @@ func doCalcIndices(chstk chan *model.Stock, wg *sync.WaitGroup, chrstk chan *mod
 		if lx != nil {
 			offd, offw, offm = -1, -1, -1
 		}
-		purgeKdjFeatDat(code)
 		calcDay(stock, offd)
 		calcWeek(stock, offw)
 		calcMonth(stock, offm)
@@ -98,7 +94,8 @@ func calcWeek(stk *model.Stock, offset int64) {
 
 	binsIndc(kdjw, "indicator_w")
 
-	SmpKdjFeat(code, model.WEEK, 5.0, 2.0, 2)
+	SmpKdjFeat(code, model.WEEK, KDJ_SMP_EXPVR, KDJ_SMP_MXRT, KDJ_SMP_MXHOLD)
+	smpFeats(code, model.WEEK)
 }
 
 func calcMonth(stk *model.Stock, offset int64) {
@@ -126,7 +123,8 @@ func calcMonth(stk *model.Stock, offset int64) {
 
 	binsIndc(kdjm, "indicator_m")
 
-	SmpKdjFeat(code, model.MONTH, 5.0, 2.0, 2)
+	SmpKdjFeat(code, model.MONTH, KDJ_SMP_EXPVR, KDJ_SMP_MXRT, KDJ_SMP_MXHOLD)
+	smpFeats(code, model.MONTH)
 }
 
 func calcDay(stk *model.Stock, offset int64) {
@@ -155,7 +153,8 @@ func calcDay(stk *model.Stock, offset int64) {
 
 	binsIndc(kdjd, "indicator_d")
 
-	SmpKdjFeat(code, model.DAY, 5.0, 2.0, 2)
+	SmpKdjFeat(code, model.DAY, KDJ_SMP_EXPVR, KDJ_SMP_MXRT, KDJ_SMP_MXHOLD)
+	smpFeats(code, model.DAY)
 }
 
 func binsIndc(indc []*model.Indicator, table string) (c int) {
@@ -198,6 +197,7 @@ func binsIndc(indc []*model.Indicator, table string) (c int) {
 			log.Panicf("%s failed to overwrite %s\n%+v", code, table, e)
 		}
 		c = len(indc)
+		metrics.RowsUpserted(table, c)
 	}
 	return
 }
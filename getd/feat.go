@@ -0,0 +1,292 @@
+package getd
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/carusyte/stock/conf"
+	"github.com/carusyte/stock/indc"
+	"github.com/carusyte/stock/metrics"
+	"github.com/carusyte/stock/model"
+	"github.com/carusyte/stock/util"
+	logr "github.com/sirupsen/logrus"
+)
+
+//SmpFeat samples buy and sell point features of the registered indicator, see indc.FeatIndc.
+// Each sample point is labeled the same way as SmpKdjFeat, and its feature window is delimited by
+// the anchor rule of the indicator. Previous samples of the stock and indicator in the cycle are replaced.
+// KDJ is not supported, as its versioned samples share the tables, see SmpKdjFeat.
+func SmpFeat(code string, cytp model.CYTP, name string, expvr, mxrt float64, mxhold int) {
+	if name == "KDJ" {
+		log.Panicf("KDJ features are sampled by SmpKdjFeat")
+	}
+	fi, ok := indc.FeatIndcOf(name)
+	if !ok {
+		log.Panicf("feature indicator not registered: %s", name)
+	}
+	_, ktab, minSize := smpTabs(cytp)
+	klhist := GetKlineDb(code, ktab, 0, false)
+	if len(klhist) < minSize {
+		log.Printf("%s %s insufficient data for %s sampling: %d", code, cytp, name, len(klhist))
+		saveFeat(code, fi.Name, cytp, nil, nil)
+		return
+	}
+	vals := fi.Calc(klhist)
+	if len(vals) != len(klhist) {
+		log.Panicf("%s %s %s values and %s does not match: %d:%d", code, cytp, name, ktab, len(vals),
+			len(klhist))
+	}
+	dt, tm := util.TimeStr()
+	feats := make([]*model.IndcFeatRaw, 0, 16)
+	fds := make([]*model.FeatDatRaw, 0, 16)
+	for _, bysl := range []string{"BY", "SL"} {
+		//usually skip the first buy sample under IPO halo
+		skip := bysl == "BY"
+		for i := 1; i < len(klhist)-1; i++ {
+			var (
+				mark  float64
+				tspan int
+				ok    bool
+			)
+			if bysl == "BY" {
+				mark, tspan, ok = markBY(klhist, i, mxrt, mxhold)
+				ok = ok && mark >= expvr
+			} else {
+				mark, tspan, ok = markSL(klhist, i, mxrt, mxhold)
+				ok = ok && mark <= -expvr
+			}
+			if ok && skip {
+				skip, ok = false, false
+			}
+			if !ok {
+				i += tspan
+				continue
+			}
+			if st, fnd := fi.Anchor(vals[:i+1]); fnd {
+				f := newIndcFeatRaw(code, fi.Name, cytp, bysl, klhist[st].Date, i-st+1, mark, tspan, dt, tm)
+				fid := f.GenFid()
+				feats = append(feats, f)
+				for j := st; j <= i; j++ {
+					v, e := json.Marshal(vals[j])
+					util.CheckErr(e, fmt.Sprintf("%s failed to marshal %s values: %+v", code, name, vals[j]))
+					fds = append(fds, &model.FeatDatRaw{Code: code, Indc: fi.Name, Fid: fid, Klid: klhist[j].Klid,
+						Vals: string(v), Udate: dt, Utime: tm})
+				}
+			}
+			i += tspan
+		}
+	}
+	saveFeat(code, fi.Name, cytp, feats, fds)
+}
+
+//smpFeats samples features of the indicators configured by 'feat_sampling'.
+func smpFeats(code string, cytp model.CYTP) {
+	for _, n := range conf.Args().FeatSampling {
+		SmpFeat(code, cytp, n, 5.0, 2.0, 2)
+	}
+}
+
+//smpTabs returns the indicator and kline tables of the cycle, and the minimum history size for sampling.
+func smpTabs(cytp model.CYTP) (itab, ktab model.DBTab, minSize int) {
+	switch cytp {
+	case model.DAY:
+		return model.INDICATOR_DAY, model.KLINE_DAY, 200
+	case model.WEEK:
+		return model.INDICATOR_WEEK, model.KLINE_WEEK, 30
+	case model.MONTH:
+		return model.INDICATOR_MONTH, model.KLINE_MONTH, 15
+	default:
+		log.Panicf("not supported cycle type: %+v", cytp)
+	}
+	return
+}
+
+//markBY labels the ith kline as a buy point if the next close is higher. The highest close reached before
+// a drawdown of mxrt percent or mxhold consecutive non-rising klines is taken, and the percentage gain
+// and the number of klines to reach it are returned.
+func markBY(klhist []*model.Quote, i int, mxrt float64, mxhold int) (mark float64, tspan int, ok bool) {
+	sc := klhist[i].Close
+	if sc >= klhist[i+1].Close {
+		return
+	}
+	hc := math.Inf(-1)
+	pc := klhist[i-1].Close
+	for w, j := 0, 0; i+j < len(klhist); j++ {
+		nc := klhist[i+j].Close
+		if nc > hc {
+			hc = nc
+			tspan = j
+		}
+		if pc >= nc {
+			rt := (hc - nc) / math.Abs(hc) * 100
+			if rt >= mxrt || w > mxhold {
+				break
+			}
+			if j > 0 {
+				w++
+			}
+		} else {
+			w = 0
+		}
+		pc = nc
+	}
+	if sc == 0 {
+		sc = 0.01
+		hc += 0.01
+	}
+	return (hc - sc) / math.Abs(sc) * 100, tspan, true
+}
+
+//markSL labels the ith kline as a sell point if the next close is not higher, the opposite of markBY.
+// The percentage loss returned is negative.
+func markSL(klhist []*model.Quote, i int, mxrt float64, mxhold int) (mark float64, tspan int, ok bool) {
+	sc := klhist[i].Close
+	if sc < klhist[i+1].Close {
+		return
+	}
+	lc := math.Inf(0)
+	pc := klhist[i-1].Close
+	for w, j := 0, 0; i+j < len(klhist); j++ {
+		nc := klhist[i+j].Close
+		if nc < lc {
+			lc = nc
+			tspan = j
+		}
+		if pc <= nc {
+			rt := (nc - lc) / math.Abs(lc) * 100
+			if rt >= mxrt || w > mxhold {
+				break
+			}
+			if j > 0 {
+				w++
+			}
+		} else {
+			w = 0
+		}
+		pc = nc
+	}
+	if sc == 0 {
+		sc = -0.01
+		lc -= 0.01
+	}
+	return (lc - sc) / math.Abs(sc) * 100, tspan, true
+}
+
+func newIndcFeatRaw(code, indc string, cytp model.CYTP, bysl, smpDate string, smpNum int, mark float64,
+	tspan int, dt, tm string) *model.IndcFeatRaw {
+	f := new(model.IndcFeatRaw)
+	f.Code = code
+	f.Udate = dt
+	f.Utime = tm
+	f.Bysl = bysl
+	f.Cytp = string(cytp)
+	f.Indc = indc
+	f.Mark = mark
+	f.SmpDate = smpDate
+	f.SmpNum = smpNum
+	f.Tspan = tspan
+	f.Mpt = mark / float64(tspan)
+	return f
+}
+
+//saveFeat replaces the generic feature samples of the stock and indicator in the cycle. Generic samples are
+// unversioned, leaving versioned samples of the same indicator intact.
+func saveFeat(code, indc string, cytp model.CYTP, feats []*model.IndcFeatRaw, fds []*model.FeatDatRaw) {
+	tran, e := dbmap.Begin()
+	util.CheckErr(e, "failed to begin new transaction")
+	// feature data goes first as it's joined with samples
+	for _, stmt := range []string{
+		"delete d from indc_feat_dat_raw d join indc_feat_raw r using (code, indc, fid) " +
+			"where r.code = ? and r.indc = ? and r.cytp = ? and r.ver = ''",
+		"delete from indc_feat_raw where code = ? and indc = ? and cytp = ? and ver = ''",
+	} {
+		if _, e = tran.Exec(stmt, code, indc, cytp); e != nil {
+			tran.Rollback()
+			log.Panicf("%s failed to purge %s samples of %s: %+v", code, cytp, indc, e)
+		}
+	}
+	if len(feats) == 0 {
+		tran.Commit()
+		return
+	}
+	valueStrings := make([]string, 0, len(feats))
+	valueArgs := make([]interface{}, 0, len(feats)*13)
+	for _, f := range feats {
+		valueStrings = append(valueStrings, "(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)")
+		valueArgs = append(valueArgs, f.Code, f.Indc, f.Cytp, f.Bysl, f.SmpDate, f.SmpNum, f.Fid, f.Mark,
+			f.Tspan, f.Mpt, f.Remarks, f.Udate, f.Utime)
+	}
+	stmt := fmt.Sprintf("INSERT INTO indc_feat_raw (code,indc,cytp,bysl,smp_date,smp_num,fid,mark,tspan,mpt,"+
+		"remarks,udate,utime) VALUES %s", strings.Join(valueStrings, ","))
+	if _, e = tran.Exec(stmt, valueArgs...); e != nil {
+		tran.Rollback()
+		log.Panicf("%s failed to bulk insert indc_feat_raw of %s: %+v", code, indc, e)
+	}
+	for bg := 0; bg < len(fds); bg += JOB_CAPACITY {
+		ed := int(math.Min(float64(bg+JOB_CAPACITY), float64(len(fds))))
+		valueStrings = make([]string, 0, ed-bg)
+		valueArgs = make([]interface{}, 0, (ed-bg)*7)
+		for _, f := range fds[bg:ed] {
+			valueStrings = append(valueStrings, "(?, ?, ?, ?, ?, ?, ?)")
+			valueArgs = append(valueArgs, f.Code, f.Indc, f.Fid, f.Klid, f.Vals, f.Udate, f.Utime)
+		}
+		stmt = fmt.Sprintf("INSERT INTO indc_feat_dat_raw (code,indc,fid,klid,vals,udate,utime) VALUES %s",
+			strings.Join(valueStrings, ","))
+		if _, e = tran.Exec(stmt, valueArgs...); e != nil {
+			tran.Rollback()
+			log.Panicf("%s failed to bulk insert indc_feat_dat_raw of %s: %+v", code, indc, e)
+		}
+	}
+	tran.Commit()
+	metrics.RowsUpserted("indc_feat_raw", len(feats))
+	metrics.RowsUpserted("indc_feat_dat_raw", len(fds))
+}
+
+//GetFeatDatRaw gets generic raw feature data of the indicator with the specified number of samples.
+func GetFeatDatRaw(indc string, cytp model.CYTP, buy bool, num int) []*model.FeatView {
+	bysl := "BY"
+	if !buy {
+		bysl = "SL"
+	}
+	start := time.Now()
+	sql, e := dot.Raw("FEAT_DAT_RAW")
+	util.CheckErr(e, "failed to get FEAT_DAT_RAW sql")
+	rows, e := dbmap.Query(sql, indc, cytp, bysl, num, indc)
+	if e != nil {
+		if "sql: no rows in result set" == e.Error() {
+			return make([]*model.FeatView, 0)
+		}
+		log.Panicf("failed to query feat dat raw, sql:\n%s\n%+v", sql, e)
+	}
+	defer rows.Close()
+	var (
+		code, fid, smpDate, vals string
+		pcode, pfid              string
+		smpNum, klid             int
+		fv                       *model.FeatView
+	)
+	fvs := make([]*model.FeatView, 0, 16)
+	for rows.Next() {
+		rows.Scan(&code, &fid, &smpDate, &smpNum, &klid, &vals)
+		if code != pcode || fid != pfid {
+			fv = &model.FeatView{Code: code, Indc: indc, Fid: fid, Cytp: cytp, Bysl: bysl, SmpDate: smpDate,
+				SmpNum: smpNum}
+			fvs = append(fvs, fv)
+		}
+		var v []float64
+		util.CheckErr(json.Unmarshal([]byte(vals), &v), fmt.Sprintf("%s %s invalid feature values: %s",
+			code, fid, vals))
+		fv.Add(klid, v)
+		pcode = code
+		pfid = fid
+	}
+	if err := rows.Err(); err != nil {
+		log.Panicln("failed to query feat dat raw.", err)
+	}
+	logr.Debugf("query indc_feat_dat_raw(%s,%s,%s,%d): %.2f", indc, cytp, bysl, num, time.Since(start).Seconds())
+	return fvs
+}
@@ -0,0 +1,24 @@
+package getd
+
+import (
+	"testing"
+
+	"github.com/carusyte/stock/model"
+	"github.com/carusyte/stock/util"
+)
+
+func TestSmpFeatCycles(t *testing.T) {
+	code := "601377"
+	for _, c := range []model.CYTP{model.DAY, model.WEEK} {
+		SmpFeat(code, c, "MACD", 5.0, 2.0, 2)
+	}
+	// sampling a cycle must not replace samples of the other
+	for _, c := range []model.CYTP{model.DAY, model.WEEK} {
+		n, e := dbmap.SelectInt("select count(*) from indc_feat_raw r join indc_feat_dat_raw d "+
+			"using (code, indc, fid) where r.code = ? and r.indc = 'MACD' and r.cytp = ? and r.ver = ''", code, c)
+		util.CheckErr(e, "failed to count MACD samples")
+		if n == 0 {
+			t.Errorf("expecting %s MACD samples of %s", c, code)
+		}
+	}
+}
@@ -0,0 +1,175 @@
+package getd
+
+import (
+	"crypto/sha1"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/carusyte/stock/conf"
+	"github.com/carusyte/stock/metrics"
+	"github.com/carusyte/stock/model"
+	"github.com/carusyte/stock/util"
+	logr "github.com/sirupsen/logrus"
+)
+
+const (
+	FEAT_VER_SMP      = "SMP"
+	FEAT_VER_FD       = "FD"
+	FEAT_VER_BUILDING = "BUILDING"
+	FEAT_VER_READY    = "READY"
+)
+
+var (
+	smpVers    = make(map[string]string)
+	smpVerLock = sync.Mutex{}
+)
+
+//KdjSmpVer returns the sampling version of kdj features taken with the parameters. The same parameters
+// always map to the same version, which is registered on first use.
+func KdjSmpVer(expvr, mxrt float64, mxhold int) string {
+	params := map[string]interface{}{"expvr": expvr, "mxrt": mxrt, "mxhold": mxhold,
+		"sample_size_min": conf.Args().Kdjv.SampleSizeMin}
+	j, e := json.Marshal(params)
+	util.CheckErr(e, "failed to marshal kdj sampling parameters")
+	smpVerLock.Lock()
+	defer smpVerLock.Unlock()
+	if v, ok := smpVers[string(j)]; ok {
+		return v
+	}
+	ver := fmt.Sprintf("KDJ-%s-%x", FEAT_VER_SMP, sha1.Sum(j))[:20]
+	d, t := util.TimeStr()
+	_, e = dbmap.Exec("insert ignore into feat_ver (ver, indc, kind, params, run_id, status, udate, utime) "+
+		"values (?, ?, ?, ?, ?, ?, ?, ?)", ver, "KDJ", FEAT_VER_SMP, string(j), metrics.RunID, FEAT_VER_READY, d, t)
+	util.CheckErr(e, "failed to register kdj sampling version "+ver)
+	smpVers[string(j)] = ver
+	return ver
+}
+
+//NewFeatVer registers a new version of indicator feature model in building state, derived from parent
+// if it's not empty. The version is tagged by indicator, kind and creation time, i.e. "KDJ-FD-20181019153000.000".
+func NewFeatVer(indc, kind, parent string, params map[string]interface{}) string {
+	j, e := json.Marshal(params)
+	util.CheckErr(e, "failed to marshal parameters of new feature version")
+	ver := fmt.Sprintf("%s-%s-%s", indc, kind, time.Now().Format("20060102150405.000"))
+	d, t := util.TimeStr()
+	_, e = dbmap.Exec("insert into feat_ver (ver, indc, kind, params, parent, run_id, status, udate, utime) "+
+		"values (?, ?, ?, ?, ?, ?, ?, ?, ?)", ver, indc, kind, string(j), parent, metrics.RunID,
+		FEAT_VER_BUILDING, d, t)
+	util.CheckErr(e, "failed to register feature version "+ver)
+	logr.WithFields(logr.Fields{"run": metrics.RunID, "parent": parent}).
+		Infof("new feature version %s: %s", ver, j)
+	return ver
+}
+
+//ReadyFeatVer marks the feature data version as ready for scoring, recording the sampling version of the raw
+// feature data clustered as lineage.
+func ReadyFeatVer(ver, smpVer string) {
+	d, t := util.TimeStr()
+	_, e := dbmap.Exec("update feat_ver set status = ?, smp_ver = ?, udate = ?, utime = ? where ver = ?",
+		FEAT_VER_READY, smpVer, d, t, ver)
+	util.CheckErr(e, "failed to mark feature version ready: "+ver)
+	log.Printf("feature version %s is ready", ver)
+}
+
+//LatestFeatVer returns the latest version of the indicator feature model in the specified kind and status,
+// or empty string if there's none.
+func LatestFeatVer(indc, kind, status string) string {
+	ver, e := dbmap.SelectStr("select ver from feat_ver where indc = ? and kind = ? and status = ? "+
+		"order by ver desc limit 1", indc, kind, status)
+	util.CheckErr(e, "failed to query latest feature version of "+indc)
+	return ver
+}
+
+//KdjFdVer resolves the kdj feature data version for scoring: the specified one if not empty, otherwise
+// the one in config file, or the latest ready version. Feature data pruned before versioning is
+// identified by empty string.
+func KdjFdVer(ver string) string {
+	if ver != "" {
+		return ver
+	}
+	if conf.Args().Kdjv.Version != "" {
+		return conf.Args().Kdjv.Version
+	}
+	ver = LatestFeatVer("KDJ", FEAT_VER_FD, FEAT_VER_READY)
+	if ver == "" {
+		logr.Warn("no ready kdj feature data version, using unversioned data")
+	}
+	return ver
+}
+
+//FeatVerRev returns the revision of the feature data version, i.e. the time it was last made ready, or empty
+// string if the version is not registered, e.g. unversioned feature data.
+func FeatVerRev(ver string) string {
+	rev, e := dbmap.SelectStr("select coalesce(concat(udate, ' ', utime), '') from feat_ver where ver = ?", ver)
+	util.CheckErr(e, "failed to query revision of feature version "+ver)
+	return rev
+}
+
+//fdSmpVer returns the sampling version of the raw feature data clustered as the feature data version, or that of
+// CalcIndics if unknown, see RawKdjSmpVer.
+func fdSmpVer(ver string) string {
+	smpVer, e := dbmap.SelectStr("select smp_ver from feat_ver where ver = ?", ver)
+	util.CheckErr(e, "failed to query sampling version of "+ver)
+	if smpVer == "" {
+		return RawKdjSmpVer()
+	}
+	return smpVer
+}
+
+//GetFeatVers returns all versions of the indicator feature model, latest first.
+func GetFeatVers(indc string) (vers []*model.FeatVer) {
+	_, e := dbmap.Select(&vers, "select * from feat_ver where indc = ? order by ver desc", indc)
+	if e != nil && "sql: no rows in result set" != e.Error() {
+		log.Panicf("failed to query feature versions of %s: %+v", indc, e)
+	}
+	return
+}
+
+//DropFeatVer removes the kdj feature data version along with its cluster members and kdjv stats.
+func DropFeatVer(ver string) {
+	tran, e := dbmap.Begin()
+	util.CheckErr(e, "failed to begin new transaction")
+	for _, t := range []string{"kdj_feat_dat", "indc_feat", "indc_feat_mbr", "kdjv_stats", "kdjv_stats_smp",
+		"feat_ver"} {
+		_, e = tran.Exec(fmt.Sprintf("delete from %s where ver = ?", t), ver)
+		if e != nil {
+			tran.Rollback()
+			log.Panicf("failed to drop version %s from %s: %+v", ver, t, e)
+		}
+	}
+	tran.Commit()
+	evictKdjFd(ver)
+	log.Printf("feature version %s dropped", ver)
+}
+
+//PurgeKdjFdVers drops the ready kdj feature data versions except the latest keep ones, does nothing if keep is
+// not positive. Versions derived by others, the one specified in config file and those pinned are always kept,
+// see DropFeatVer.
+func PurgeKdjFdVers(keep int) {
+	if keep <= 0 {
+		return
+	}
+	var vers, parents []string
+	_, e := dbmap.Select(&vers, "select ver from feat_ver where indc = 'KDJ' and kind = ? and status = ? "+
+		"order by ver desc", FEAT_VER_FD, FEAT_VER_READY)
+	if e != nil && "sql: no rows in result set" != e.Error() {
+		log.Panicf("failed to query kdj feature data versions: %+v", e)
+	}
+	_, e = dbmap.Select(&parents, "select distinct parent from feat_ver where indc = 'KDJ' and parent <> ''")
+	if e != nil && "sql: no rows in result set" != e.Error() {
+		log.Panicf("failed to query parents of kdj feature data versions: %+v", e)
+	}
+	kept := map[string]bool{conf.Args().Kdjv.Version: true}
+	for _, v := range append(parents, conf.Args().Kdjv.PinVers...) {
+		kept[v] = true
+	}
+	for i, v := range vers {
+		if i < keep || kept[v] {
+			continue
+		}
+		DropFeatVer(v)
+	}
+}
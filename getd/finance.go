@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"github.com/PuerkitoBio/goquery"
 	"github.com/carusyte/stock/global"
+	"github.com/carusyte/stock/metrics"
 	"github.com/carusyte/stock/model"
 	"github.com/carusyte/stock/util"
 	"golang.org/x/text/encoding/simplifiedchinese"
@@ -265,6 +266,10 @@ func calcDyrDpr(xdxrs []*model.Xdxr) {
 	}
 }
 
+//xdxrUnchanged condition of upsert that the event of xdxr stays the same
+const xdxrUnchanged = "divi<=>values(divi) and divi_atx<=>values(divi_atx) and shares_allot<=>values(shares_allot) " +
+	"and shares_cvt<=>values(shares_cvt) and xdxr_date<=>values(xdxr_date)"
+
 //update to database
 func saveXdxrs(xdxrs []*model.Xdxr) {
 	if len(xdxrs) > 0 {
@@ -306,7 +311,10 @@ func saveXdxrs(xdxrs []*model.Xdxr) {
 			"gms_date,impl_date,plan,divi,divi_atx,divi_end_date,shares_allot,shares_allot_date,shares_cvt,"+
 			"shares_cvt_date,reg_date,xdxr_date,payout_date,progress,dpr,"+
 			"dyr,divi_target,shares_base,end_trddate,udate,utime) VALUES %s "+
-			"on duplicate key update name=values(name),notice_date=values(notice_date),report_year=values"+
+			// update time changes only if the event itself changes, which tells derived data to recalculate.
+			// assignments take effect in order, so they go first to compare against the old values
+			"on duplicate key update utime=if("+xdxrUnchanged+", utime, values(utime)),"+
+			"udate=if("+xdxrUnchanged+", udate, values(udate)),name=values(name),notice_date=values(notice_date),report_year=values"+
 			"(report_year),board_date=values"+
 			"(board_date),gms_date=values(gms_date),impl_date=values(impl_date),plan=values(plan),"+
 			"divi=values(divi),divi_atx=values(divi_atx),divi_end_date=values"+
@@ -316,10 +324,11 @@ func saveXdxrs(xdxrs []*model.Xdxr) {
 			"xdxr_date=values"+
 			"(xdxr_date),payout_date=values(payout_date),progress=values(progress),dpr=values"+
 			"(dpr),dyr=values(dyr),divi_target=values(divi_target),"+
-			"shares_base=values(shares_base),end_trddate=values(end_trddate),udate=values(udate),utime=values(utime)",
+			"shares_base=values(shares_base),end_trddate=values(end_trddate)",
 			strings.Join(valueStrings, ","))
 		_, err := global.Dbmap.Exec(stmt, valueArgs...)
 		util.CheckErr(err, code+": failed to bulk update xdxr")
+		metrics.RowsUpserted("xdxr", len(xdxrs))
 	}
 }
 
@@ -495,6 +504,7 @@ func doParseFinPage(url string, code string) (ok, retry bool) {
 			strings.Join(valueStrings, ","))
 		_, err := global.Dbmap.Exec(stmt, valueArgs...)
 		util.CheckErr(err, code+": failed to bulk update finance")
+		metrics.RowsUpserted("finance", len(fins))
 	}
 	return true, false
 }
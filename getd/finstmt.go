@@ -0,0 +1,344 @@
+package getd
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/carusyte/stock/global"
+	"github.com/carusyte/stock/metrics"
+	"github.com/carusyte/stock/model"
+	"github.com/carusyte/stock/util"
+	"github.com/pkg/errors"
+)
+
+//finStmtPages 10jqka page names of the financial statements
+var finStmtPages = map[string]string{
+	model.STMT_BALANCE:  "debt",
+	model.STMT_INCOME:   "benefit",
+	model.STMT_CASHFLOW: "cash",
+}
+
+//finStmtItems normalized keys of the commonly used line items by title, which varies across industries
+// and report formats.
+var finStmtItems = map[string]map[string]string{
+	model.STMT_BALANCE: {
+		"货币资金":        "cash",
+		"交易性金融资产":     "trading_assets",
+		"应收票据及应收账款":   "notes_accts_rcv",
+		"应收票据":        "notes_rcv",
+		"应收账款":        "accts_rcv",
+		"预付款项":        "prepayments",
+		"其他应收款":       "other_rcv",
+		"存货":          "inventories",
+		"流动资产合计":      "total_cur_assets",
+		"固定资产":        "fixed_assets",
+		"固定资产合计":      "fixed_assets",
+		"在建工程":        "cip",
+		"在建工程合计":      "cip",
+		"无形资产":        "intangibles",
+		"商誉":          "goodwill",
+		"资产合计":        "total_assets",
+		"资产总计":        "total_assets",
+		"短期借款":        "st_borrow",
+		"应付票据及应付账款":   "notes_accts_pay",
+		"应付账款":        "accts_pay",
+		"预收款项":        "adv_receipts",
+		"一年内到期的非流动负债": "noncur_liab_1y",
+		"流动负债合计":      "total_cur_liab",
+		"长期借款":        "lt_borrow",
+		"应付债券":        "bonds_payable",
+		"负债合计":        "total_liab",
+		"未分配利润":       "undistributed",
+		"归属于母公司所有者权益合计":     "equity_parent",
+		"所有者权益（或股东权益）合计":    "total_equity",
+		"负债和所有者权益（或股东权益）合计": "total_liab_equity",
+	},
+	model.STMT_INCOME: {
+		"营业总收入":  "total_revenue",
+		"营业收入":   "revenue",
+		"营业总成本":  "total_cost",
+		"营业成本":   "cost",
+		"销售费用":   "sell_exp",
+		"管理费用":   "admin_exp",
+		"研发费用":   "rd_exp",
+		"财务费用":   "fin_exp",
+		"资产减值损失": "impairment",
+		"投资收益":   "invest_income",
+		"营业利润":   "op_profit",
+		"利润总额":   "total_profit",
+		"所得税费用":  "income_tax",
+		"净利润":    "net_profit",
+		"归属于母公司所有者的净利润": "np_parent",
+		"扣除非经常性损益后的净利润": "np_adn",
+		"基本每股收益":        "eps",
+		"稀释每股收益":        "eps_diluted",
+	},
+	model.STMT_CASHFLOW: {
+		"销售商品、提供劳务收到的现金":          "cash_sales",
+		"经营活动现金流入小计":              "opr_cash_in",
+		"支付给职工以及为职工支付的现金":         "staff_paid",
+		"支付的各项税费":                 "tax_paid",
+		"经营活动现金流出小计":              "opr_cash_out",
+		"经营活动产生的现金流量净额":           "ncf_opr",
+		"购建固定资产、无形资产和其他长期资产支付的现金": "capex",
+		"投资支付的现金":                 "invest_paid",
+		"投资活动产生的现金流量净额":           "ncf_inv",
+		"取得借款收到的现金":               "borrow_recv",
+		"偿还债务支付的现金":               "debt_repaid",
+		"分配股利、利润或偿付利息支付的现金":       "divi_int_paid",
+		"筹资活动产生的现金流量净额":           "ncf_fin",
+		"现金及现金等价物净增加额":            "ncf",
+		"期末现金及现金等价物余额":            "cash_end",
+	},
+}
+
+//titlePrefix numbering and annotation prefixes of line item titles, e.g. "*", "一、", "（一）", "减：", "其中："
+var titlePrefix = regexp.MustCompile(`^(\*|[一二三四五六七八九十]+、|（[一二三四五六七八九十]+）|[加减]：|其中：)+`)
+
+//GetFinStmts fetches the full quarterly balance sheet, income statement and cash flow statement of the stocks.
+func GetFinStmts(stocks *model.Stocks) (rstks *model.Stocks) {
+	log.Println("getting financial statements...")
+	var wg sync.WaitGroup
+	chstk := make(chan *model.Stock, global.JOB_CAPACITY)
+	chrstk := make(chan *model.Stock, global.JOB_CAPACITY)
+	rstks = new(model.Stocks)
+	wgr := collect(rstks, chrstk)
+	for i := 0; i < global.MAX_CONCURRENCY; i++ {
+		wg.Add(1)
+		go getFinStmts(chstk, &wg, chrstk)
+	}
+	for _, s := range stocks.List {
+		chstk <- s
+	}
+	close(chstk)
+	wg.Wait()
+	close(chrstk)
+	wgr.Wait()
+	log.Printf("%d financial statements updated", rstks.Size())
+	if stocks.Size() != rstks.Size() {
+		same, skp := stocks.Diff(rstks)
+		if !same {
+			log.Printf("Failed: %+v", skp)
+		}
+	}
+	return
+}
+
+func getFinStmts(chstk chan *model.Stock, wg *sync.WaitGroup, chrstk chan *model.Stock) {
+	defer wg.Done()
+	RETRIES := 5
+	for stock := range chstk {
+		ok := true
+		for _, stmt := range []string{model.STMT_BALANCE, model.STMT_INCOME, model.STMT_CASHFLOW} {
+			url := fmt.Sprintf(`http://basic.10jqka.com.cn/api/stock/finance/%s_%s.json`, stock.Code,
+				finStmtPages[stmt])
+			for rtCount := 0; rtCount <= RETRIES; rtCount++ {
+				var r bool
+				ok, r = doGetFinStmt(url, stock.Code, stmt)
+				if ok {
+					break
+				} else if r {
+					log.Printf("%s retrying %d...", stock.Code, rtCount+1)
+					time.Sleep(time.Second * 1)
+					continue
+				} else {
+					log.Printf("%s retried %d, giving up. restart the program to recover", stock.Code, rtCount+1)
+					break
+				}
+			}
+			if !ok {
+				break
+			}
+		}
+		if ok {
+			chrstk <- stock
+		}
+	}
+}
+
+func doGetFinStmt(url, code, stmt string) (ok, retry bool) {
+	body, e := util.HttpGetBytes(url)
+	if e != nil {
+		log.Printf("%s, http failed, giving up %s", code, url)
+		return false, false
+	}
+	items, vals, e := ParseFinStmt(code, stmt, body)
+	if e != nil {
+		log.Printf("%s failed to parse %s: %+v, retrying...", code, url, e)
+		return false, true
+	}
+	saveFinItems(items)
+	saveFinStmts(code, vals)
+	return true, false
+}
+
+//ParseFinStmt parses the 10jqka financial statement json, in which flashData holds another json of titles
+// and quarterly reports. Titles are normalized to item keys where known, see finStmtItems. Amounts are
+// converted to 100 million according to the unit of title or the suffix of value, while per share items
+// are kept as is. Missing values such as "--" are skipped.
+func ParseFinStmt(code, stmt string, body []byte) (items []*model.FinItem, vals []*model.FinStmt, e error) {
+	var page struct {
+		FlashData string `json:"flashData"`
+	}
+	if e = json.Unmarshal(body, &page); e != nil {
+		return nil, nil, errors.Wrap(e, "invalid page json")
+	}
+	var data struct {
+		Title  []interface{}   `json:"title"`
+		Report [][]interface{} `json:"report"`
+	}
+	if e = json.Unmarshal([]byte(page.FlashData), &data); e != nil {
+		return nil, nil, errors.Wrap(e, "invalid flashData json")
+	}
+	if len(data.Report) == 0 {
+		return nil, nil, errors.New("no report data")
+	}
+	var years []string
+	for _, y := range data.Report[0] {
+		s, _ := y.(string)
+		years = append(years, strings.TrimSpace(s))
+	}
+	seen := make(map[string]bool)
+	for i := 1; i < len(data.Title) && i < len(data.Report); i++ {
+		it := finItem(stmt, data.Title[i])
+		if it == nil || seen[it.Item] {
+			continue
+		}
+		seen[it.Item] = true
+		items = append(items, it)
+		for j, v := range data.Report[i] {
+			s, ok := v.(string)
+			if !ok || j >= len(years) || years[j] == "" {
+				continue
+			}
+			f := finStmtValue(it, s)
+			if !f.Valid {
+				continue
+			}
+			vals = append(vals, &model.FinStmt{Code: code, Year: years[j], Stmt: stmt, Item: it.Item, Value: f})
+		}
+	}
+	return
+}
+
+//finItem makes the line item of title, which is either a string or an array of title and unit.
+func finItem(stmt string, t interface{}) *model.FinItem {
+	it := &model.FinItem{Stmt: stmt}
+	switch v := t.(type) {
+	case string:
+		it.Title = v
+	case []interface{}:
+		if len(v) > 0 {
+			it.Title, _ = v[0].(string)
+		}
+		if len(v) > 1 {
+			it.Unit, _ = v[1].(string)
+		}
+	}
+	it.Title = strings.TrimSpace(it.Title)
+	it.Unit = strings.TrimSpace(it.Unit)
+	name := titlePrefix.ReplaceAllString(it.Title, "")
+	if name == "" {
+		return nil
+	}
+	if k, ok := finStmtItems[stmt][name]; ok {
+		it.Item = k
+	} else {
+		it.Item = name
+		if r := []rune(name); len(r) > 100 {
+			it.Item = string(r[:100])
+		}
+	}
+	return it
+}
+
+func finStmtValue(it *model.FinItem, s string) (f sql.NullFloat64) {
+	s = strings.Replace(strings.TrimSpace(s), ",", "", -1)
+	if strings.Contains(it.Title, "每股") {
+		return util.Str2Fnull(s)
+	}
+	switch it.Unit {
+	case "亿元", "亿":
+		return util.Str2FBilMod(s, 1)
+	case "万元", "万":
+		return util.Str2FBilMod(s, 0.0001)
+	case "元", "":
+		return util.Str2FBil(s)
+	}
+	return util.Str2Fnull(s)
+}
+
+func saveFinItems(items []*model.FinItem) {
+	if len(items) == 0 {
+		return
+	}
+	valueStrings := make([]string, 0, len(items))
+	valueArgs := make([]interface{}, 0, len(items)*4)
+	for _, it := range items {
+		valueStrings = append(valueStrings, "(?, ?, ?, ?)")
+		valueArgs = append(valueArgs, it.Stmt, it.Item, it.Title, it.Unit)
+	}
+	stmt := fmt.Sprintf("INSERT INTO fin_item (stmt,item,title,unit) VALUES %s "+
+		"on duplicate key update title=values(title),unit=values(unit)", strings.Join(valueStrings, ","))
+	_, e := dbmap.Exec(stmt, valueArgs...)
+	util.CheckErr(e, "failed to bulk update fin_item")
+}
+
+func saveFinStmts(code string, vals []*model.FinStmt) {
+	d, t := util.TimeStr()
+	for i := 0; i < len(vals); i += global.JOB_CAPACITY {
+		end := i + global.JOB_CAPACITY
+		if end > len(vals) {
+			end = len(vals)
+		}
+		valueStrings := make([]string, 0, end-i)
+		valueArgs := make([]interface{}, 0, (end-i)*7)
+		for _, v := range vals[i:end] {
+			valueStrings = append(valueStrings, "(?, ?, ?, ?, ?, ?, ?)")
+			valueArgs = append(valueArgs, v.Code, v.Year, v.Stmt, v.Item, v.Value, d, t)
+		}
+		stmt := fmt.Sprintf("INSERT INTO fin_stmt (code,year,stmt,item,value,udate,utime) VALUES %s "+
+			"on duplicate key update value=values(value),udate=values(udate),utime=values(utime)",
+			strings.Join(valueStrings, ","))
+		_, e := dbmap.Exec(stmt, valueArgs...)
+		util.CheckErr(e, code+": failed to bulk update fin_stmt")
+		metrics.RowsUpserted("fin_stmt", end-i)
+	}
+}
+
+//GetFinStmt returns the line items of the statement in the report periods between the years inclusively,
+// keyed by year and then item. Empty year means no bound.
+func GetFinStmt(code, stmt, from, to string) map[string]map[string]float64 {
+	var (
+		vals  []*model.FinStmt
+		conds = []string{"code = ?", "stmt = ?"}
+		args  = []interface{}{code, stmt}
+	)
+	if from != "" {
+		conds = append(conds, "year >= ?")
+		args = append(args, from)
+	}
+	if to != "" {
+		conds = append(conds, "year <= ?")
+		args = append(args, to)
+	}
+	_, e := dbmap.Select(&vals, fmt.Sprintf("select * from fin_stmt where %s", strings.Join(conds, " and ")),
+		args...)
+	if e != nil && "sql: no rows in result set" != e.Error() {
+		log.Panicf("%s failed to query financial statement %s: %+v", code, stmt, e)
+	}
+	r := make(map[string]map[string]float64)
+	for _, v := range vals {
+		if r[v.Year] == nil {
+			r[v.Year] = make(map[string]float64)
+		}
+		r[v.Year][v.Item] = v.Value.Float64
+	}
+	return r
+}
@@ -0,0 +1,52 @@
+package getd
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/carusyte/stock/model"
+)
+
+var update = flag.Bool("update", false, "update golden files")
+
+//TestParseFinStmt compares parsed statements against golden files, run with -update to regenerate them.
+func TestParseFinStmt(t *testing.T) {
+	for _, stmt := range []string{model.STMT_BALANCE, model.STMT_INCOME, model.STMT_CASHFLOW} {
+		base := filepath.Join("testdata", "finstmt", finStmtPages[stmt])
+		body, e := ioutil.ReadFile(base + ".json")
+		if e != nil {
+			t.Fatal(e)
+		}
+		items, vals, e := ParseFinStmt("600000", stmt, body)
+		if e != nil {
+			t.Fatalf("%s: %+v", stmt, e)
+		}
+		var b bytes.Buffer
+		for _, it := range items {
+			fmt.Fprintf(&b, "item %s %s %q %s\n", it.Stmt, it.Item, it.Title, it.Unit)
+		}
+		for _, v := range vals {
+			fmt.Fprintf(&b, "%s %s %s %s %.6f\n", v.Code, v.Year, v.Stmt, v.Item, v.Value.Float64)
+		}
+		golden := base + ".golden"
+		if *update {
+			if e = ioutil.WriteFile(golden, b.Bytes(), 0644); e != nil {
+				t.Fatal(e)
+			}
+		}
+		exp, e := ioutil.ReadFile(golden)
+		if e != nil {
+			t.Fatal(e)
+		}
+		if !bytes.Equal(exp, b.Bytes()) {
+			t.Errorf("%s mismatches %s:\n%s", stmt, golden, b.String())
+		}
+	}
+	if _, _, e := ParseFinStmt("600000", model.STMT_BALANCE, []byte(`{"flashData":""}`)); e == nil {
+		t.Error("expecting error on empty flashData")
+	}
+}
@@ -6,6 +6,11 @@ import (
 	"github.com/carusyte/stock/model"
 	"fmt"
 	"github.com/carusyte/stock/util"
+	"github.com/carusyte/stock/metrics"
+	"encoding/json"
+	"github.com/carusyte/stock/conf"
+	logr "github.com/sirupsen/logrus"
+	"strings"
 )
 
 func Get() {
@@ -19,6 +24,11 @@ func Get() {
 	stks := GetFinance(allstks)
 	stop("GET_FINANCE", stgfi)
 
+	// statements are supplementary, failing ones don't hold back the rest
+	stgfs := time.Now()
+	GetFinStmts(stks)
+	stop("GET_FIN_STMT", stgfs)
+
 	stgkdn := time.Now()
 	stks = GetKlines(stks, model.KLINE_DAY_NR)
 	stop("GET_KLINES_DN", stgkdn)
@@ -34,6 +44,12 @@ func Get() {
 	stidx := time.Now()
 	allIdx, sucIdx := GetIndices()
 	stop("GET_INDICES", stidx)
+
+	// constituents are supplementary, failing ones don't hold back the rest
+	stcst := time.Now()
+	GetIdxCsts(new(CsindexFetcher), IdxCstIndices...)
+	stop("GET_IDX_CST", stcst)
+
 	for _, idx := range allIdx {
 		allstks.Add(&model.Stock{Code: idx.Code, Name: idx.Name})
 	}
@@ -50,21 +66,119 @@ func Get() {
 	stks = CalcIndics(stks)
 	stop("CALC_INDICS", stci)
 
+	// full clustering is a separate process, see PruneKdjFeatDat
+	if conf.Args().Kdjv.UpdateFd {
+		stfd := time.Now()
+		UpdateKdjFeatDat(conf.Args().Kdjv.PrunePrec)
+		stop("UPD_KDJ_FD", stfd)
+	}
+
+	// analytics below are supplementary, failing ones don't hold back the rest
+	runSupplement("CALC_TR", func() {
+		CalcTotalReturn(stks)
+	})
+
+	runSupplement("CALC_VALUATION", func() {
+		CalcValuation(stks)
+	})
+
+	runSupplement("CALC_VAL_BANDS", func() {
+		CalcValBands(stks)
+	})
+
+	// sector indices go on with the existing mapping if new industries fail to be mapped
+	runSupplement("UPD_SECTOR_MAP", UpdSectorMap)
+	runSupplement("CALC_SECTOR_IDX", CalcSectorIdx)
+
 	finMark(stks)
 
 	rptFailed(allstks, stks)
+
+	runHooks()
+}
+
+//runSupplement runs the supplementary step of Get, whose failure is logged without holding back the rest.
+func runSupplement(name string, f func()) {
+	start := time.Now()
+	defer func() {
+		if r := recover(); r != nil {
+			logr.Errorf("%s failed: %+v", name, r)
+		}
+		stop(name, start)
+	}()
+	f()
+}
+
+//tryStock runs the task of the stock, returning false instead of panicking on failure, so that a failing
+// stock doesn't hold back the others processed by the same worker.
+func tryStock(code, task string, f func()) (ok bool) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("%s failed to %s: %+v", code, task, r)
+			ok = false
+		}
+	}()
+	f()
+	return true
+}
+
+type hook struct {
+	name string
+	f    func()
+}
+
+var hooks []hook
+
+//AfterGet registers a function to be called, in the order of registration, after each data refresh by Get.
+// name is for logging purpose.
+func AfterGet(name string, f func()) {
+	hooks = append(hooks, hook{name, f})
+}
+
+// runHooks calls the registered hooks, a failing one doesn't stop the rest.
+func runHooks() {
+	for _, h := range hooks {
+		func() {
+			defer func() {
+				if r := recover(); r != nil {
+					logr.Errorf("after get hook %s failed: %+v", h.name, r)
+				}
+			}()
+			start := time.Now()
+			h.f()
+			stop("HOOK_"+strings.ToUpper(h.name), start)
+		}()
+	}
 }
 
 func stop(code string, start time.Time) {
+	now := time.Now()
 	ss := start.Format("2006-01-02 15:04:05")
-	end := time.Now().Format("2006-01-02 15:04:05")
-	dur := time.Since(start).Seconds()
+	end := now.Format("2006-01-02 15:04:05")
+	dur := now.Sub(start).Seconds()
 	log.Printf("%s Complete. Time Elapsed: %f sec", code, dur)
+	metrics.Stage(code, start, now)
 	dbmap.Exec("insert into stats (code, start, end, dur) values (?, ?, ?, ?) "+
 		"on duplicate key update start=values(start), end=values(end), dur=values(dur)",
 		code, ss, end, dur)
 }
 
+//RecordParams logs and saves the effective parameters of the scope in current run, so that results can
+// be reproduced later with the same parameters.
+func RecordParams(scope string, params interface{}) {
+	j, e := json.Marshal(params)
+	util.CheckErr(e, "failed to marshal parameters of "+scope)
+	logr.WithFields(logr.Fields{"run": metrics.RunID, "scope": scope, "profile": conf.Args().Profile}).
+		Infof("effective parameters: %s", j)
+	d, t := util.TimeStr()
+	_, e = dbmap.Exec("insert into run_params (run_id, scope, profile, params, udate, utime) values "+
+		"(?, ?, ?, ?, ?, ?) on duplicate key update profile=values(profile), params=values(params), "+
+		"udate=values(udate), utime=values(utime)", metrics.RunID, scope, conf.Args().Profile, string(j), d, t)
+	if e != nil {
+		log.Printf("failed to save parameters of %s: %+v", scope, e)
+	}
+}
+
 //update xpriced flag in xdxr to mark that all price related data has been reinstated
 func finMark(stks *model.Stocks) *model.Stocks {
 	sql, e := dot.Raw("UPD_XPRICE")
@@ -0,0 +1,259 @@
+package getd
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/carusyte/stock/metrics"
+	"github.com/carusyte/stock/model"
+	"github.com/carusyte/stock/util"
+	"github.com/pkg/errors"
+)
+
+//IdxCstIndices indices of which constituents are tracked, see GetIdxCsts
+var IdxCstIndices = []string{"sh000016", "sh000300", "sh000905"}
+
+var stockCode = regexp.MustCompile(`^\d{6}$`)
+
+//IdxCstFetcher fetches the latest constituents snapshot of an index, all of the same effective date.
+type IdxCstFetcher interface {
+	Fetch(index string) ([]*model.IdxCst, error)
+}
+
+//CsindexFetcher fetches constituents and weights from China Securities Index.
+type CsindexFetcher struct{}
+
+func (f *CsindexFetcher) Fetch(index string) ([]*model.IdxCst, error) {
+	url := fmt.Sprintf("https://www.csindex.com.cn/csindex-home/index/weight/%s", strings.TrimLeft(index, "shz"))
+	body, e := util.HttpGetBytes(url)
+	if e != nil {
+		return nil, errors.Wrapf(e, "failed to get constituents of %s from %s", index, url)
+	}
+	return ParseCsindexWeights(index, body)
+}
+
+//ParseCsindexWeights parses constituents of the index from the csindex response body of the form
+// {"code": "200", "data": {"updateDate": "2018-06-29", "weightList": [{"securityCode": "600519",
+// "securityName": "贵州茅台", "weight": 5.23}, ...]}}.
+func ParseCsindexWeights(index string, body []byte) ([]*model.IdxCst, error) {
+	var r struct {
+		Code string
+		Msg  string
+		Data struct {
+			UpdateDate string
+			WeightList []struct {
+				SecurityCode string
+				SecurityName string
+				Weight       float64
+			}
+		}
+	}
+	if e := json.Unmarshal(body, &r); e != nil {
+		return nil, errors.Wrapf(e, "failed to parse constituents of %s", index)
+	}
+	if r.Code != "200" {
+		return nil, errors.Errorf("failed to get constituents of %s: %s %s", index, r.Code, r.Msg)
+	}
+	csts := make([]*model.IdxCst, 0, len(r.Data.WeightList))
+	for _, w := range r.Data.WeightList {
+		csts = append(csts, &model.IdxCst{Code: index, Date: r.Data.UpdateDate, Stock: w.SecurityCode,
+			Name: w.SecurityName, Weight: w.Weight})
+	}
+	return csts, nil
+}
+
+//GetIdxCsts fetches the latest constituents of the indices and saves them as snapshots of their effective date,
+// replacing the snapshot of the same date. Returns the indices successfully updated, those failing to be fetched
+// or saved don't hold back the rest.
+func GetIdxCsts(f IdxCstFetcher, indices ...string) (suc []string) {
+	csts, failed := fetchIdxCsts(f, indices)
+	for _, idx := range indices {
+		c, ok := csts[idx]
+		if !ok {
+			continue
+		}
+		if trySaveIdxCsts(idx, c) {
+			suc = append(suc, idx)
+		} else {
+			failed = append(failed, idx)
+		}
+	}
+	if len(failed) > 0 {
+		log.Printf("failed to get constituents of %d indices: %+v", len(failed), failed)
+	}
+	return
+}
+
+//fetchIdxCsts fetches and validates the constituents of the indices. A snapshot is rejected as a whole if it's
+// empty, of mixed or missing effective dates, or containing invalid or duplicate stock codes or negative weights.
+func fetchIdxCsts(f IdxCstFetcher, indices []string) (csts map[string][]*model.IdxCst, failed []string) {
+	csts = make(map[string][]*model.IdxCst)
+	for _, idx := range indices {
+		c, e := f.Fetch(idx)
+		if e == nil {
+			e = validateIdxCsts(idx, c)
+		}
+		if e != nil {
+			log.Printf("%+v", e)
+			failed = append(failed, idx)
+			continue
+		}
+		csts[idx] = c
+	}
+	return
+}
+
+func validateIdxCsts(index string, csts []*model.IdxCst) error {
+	if len(csts) == 0 {
+		return errors.Errorf("no constituents of %s", index)
+	}
+	date := csts[0].Date
+	if len(date) != 10 {
+		return errors.Errorf("invalid effective date of %s constituents: %s", index, date)
+	}
+	seen := make(map[string]bool, len(csts))
+	for _, c := range csts {
+		c.Code = index
+		if c.Date != date {
+			return errors.Errorf("mixed effective dates of %s constituents: %s, %s", index, date, c.Date)
+		}
+		if !stockCode.MatchString(c.Stock) || c.Weight < 0 {
+			return errors.Errorf("invalid constituent of %s: %+v", index, c)
+		}
+		if seen[c.Stock] {
+			return errors.Errorf("duplicate constituent of %s: %s", index, c.Stock)
+		}
+		seen[c.Stock] = true
+	}
+	return nil
+}
+
+//trySaveIdxCsts saves the constituents of the index, returning false instead of panicking on failure.
+func trySaveIdxCsts(index string, csts []*model.IdxCst) (ok bool) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("failed to save constituents of %s: %+v", index, r)
+			ok = false
+		}
+	}()
+	saveIdxCsts(index, csts)
+	return true
+}
+
+func saveIdxCsts(index string, csts []*model.IdxCst) {
+	d, t := util.TimeStr()
+	valueStrings := make([]string, 0, len(csts))
+	valueArgs := make([]interface{}, 0, len(csts)*7)
+	for _, c := range csts {
+		valueStrings = append(valueStrings, "(?, ?, ?, ?, ?, ?, ?)")
+		valueArgs = append(valueArgs, c.Code, c.Date, c.Stock, c.Name, c.Weight, d, t)
+	}
+	tran, e := dbmap.Begin()
+	util.CheckErr(e, "failed to begin new transaction")
+	_, e = tran.Exec("delete from idx_cst where code = ? and date = ?", index, csts[0].Date)
+	if e != nil {
+		tran.Rollback()
+		log.Panicf("%s failed to delete constituents of %s: %+v", index, csts[0].Date, e)
+	}
+	_, e = tran.Exec(fmt.Sprintf("insert into idx_cst (code, date, stock, name, weight, udate, utime) values %s",
+		strings.Join(valueStrings, ",")), valueArgs...)
+	if e != nil {
+		tran.Rollback()
+		log.Panicf("%s failed to save constituents of %s: %+v", index, csts[0].Date, e)
+	}
+	if e = tran.Commit(); e != nil {
+		log.Panicf("%s failed to commit constituents of %s: %+v", index, csts[0].Date, e)
+	}
+	metrics.RowsUpserted("idx_cst", len(csts))
+}
+
+//GetIdxCst returns the constituents of the index in the latest snapshot effective on or before the date, the
+// latest snapshot if date is empty. Constituents are in descending order of weight.
+func GetIdxCst(index, date string) (csts []*model.IdxCst) {
+	if date == "" {
+		date = "9999-12-31"
+	}
+	_, e := dbmap.Select(&csts, "select * from idx_cst where code = ? and date = (select max(date) from idx_cst "+
+		"where code = ? and date <= ?) order by weight desc, stock", index, index, date)
+	if e != nil && "sql: no rows in result set" != e.Error() {
+		log.Panicf("%s failed to query constituents as of %s: %+v", index, date, e)
+	}
+	return
+}
+
+//IdxMembers returns the codes of the index constituents as of the date, see GetIdxCst.
+func IdxMembers(index, date string) []string {
+	csts := GetIdxCst(index, date)
+	codes := make([]string, len(csts))
+	for i, c := range csts {
+		codes[i] = c.Stock
+	}
+	return codes
+}
+
+//IdxContrib returns the contribution of each constituent to the index return between the dates, based on the
+// constituents as of from and the closes of kline_d on or before the dates. Returns nil if constituents are
+// unknown as of from.
+func IdxContrib(index, from, to string) []*model.IdxContrib {
+	csts := GetIdxCst(index, from)
+	if len(csts) == 0 {
+		log.Printf("no constituents of %s as of %s", index, from)
+		return nil
+	}
+	codes := make([]string, len(csts))
+	for i, c := range csts {
+		codes[i] = c.Stock
+	}
+	return IdxContribs(csts, closesAsOf(codes, csts[0].Date), closesAsOf(codes, from), closesAsOf(codes, to),
+		from, to)
+}
+
+//closesAsOf returns the forward reinstated close of the stocks on the latest trading day on or before the date.
+func closesAsOf(codes []string, date string) map[string]float64 {
+	var qs []*model.Quote
+	_, e := dbmap.Select(&qs, fmt.Sprintf("select code, date, klid, close from kline_d k where code in (%s) "+
+		"and klid = (select max(klid) from kline_d where code = k.code and date <= ?)",
+		util.Join(codes, ",", true)), date)
+	if e != nil && "sql: no rows in result set" != e.Error() {
+		log.Panicf("failed to query closes as of %s: %+v", date, e)
+	}
+	r := make(map[string]float64, len(qs))
+	for _, q := range qs {
+		r[q.Code] = q.Close
+	}
+	return r
+}
+
+//IdxContribs calculates the contribution of the constituents to the index return from start to end, given their
+// closes as of the snapshot date, start and end. Weights of the snapshot are drifted by price to start and
+// normalized over the constituents having all closes, and the contribution is weight times return. Results
+// are in descending order of contribution, adding up to the index return in percentage.
+func IdxContribs(csts []*model.IdxCst, snap, start, end map[string]float64, from, to string) (
+	cs []*model.IdxContrib) {
+	sum := 0.
+	for _, c := range csts {
+		p0, p1, p2 := snap[c.Stock], start[c.Stock], end[c.Stock]
+		if p0 <= 0 || p1 <= 0 || p2 <= 0 {
+			continue
+		}
+		w := c.Weight * p1 / p0
+		sum += w
+		cs = append(cs, &model.IdxContrib{Code: c.Code, Stock: c.Stock, Name: c.Name, From: from, To: to,
+			Weight: w, Ret: (p2/p1 - 1) * 100})
+	}
+	if sum <= 0 {
+		return nil
+	}
+	for _, c := range cs {
+		c.Weight = c.Weight / sum * 100
+		c.Contrib = c.Weight * c.Ret / 100
+	}
+	sort.SliceStable(cs, func(i, j int) bool {
+		return cs[i].Contrib > cs[j].Contrib
+	})
+	return
+}
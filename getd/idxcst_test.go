@@ -0,0 +1,80 @@
+package getd
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/carusyte/stock/model"
+	"github.com/pkg/errors"
+)
+
+//standInFetcher serves canned constituents, or an error for indices not served.
+type standInFetcher map[string][]*model.IdxCst
+
+func (f standInFetcher) Fetch(index string) ([]*model.IdxCst, error) {
+	c, ok := f[index]
+	if !ok {
+		return nil, errors.Errorf("%s not available", index)
+	}
+	return c, nil
+}
+
+func TestFetchIdxCsts(t *testing.T) {
+	f := standInFetcher{
+		"sh000300": {{Date: "2018-06-29", Stock: "600519", Weight: 5.2}, {Date: "2018-06-29", Stock: "000001",
+			Weight: 1.1}},
+		"sh000016": {{Date: "2018-06-29", Stock: "600519", Weight: 8}, {Date: "2018-05-31", Stock: "601318",
+			Weight: 9}},
+		"sh000852": {{Date: "2018-06-29", Stock: "sz0001", Weight: 1}},
+		"sh000010": {},
+		"sh000903": {{Date: "2018-06-29", Stock: "600519", Weight: 3}, {Date: "2018-06-29", Stock: "600519",
+			Weight: 3}},
+	}
+	csts, failed := fetchIdxCsts(f, []string{"sh000300", "sh000016", "sh000852", "sh000010", "sh000905",
+		"sh000903"})
+	if len(csts) != 1 || len(csts["sh000300"]) != 2 || csts["sh000300"][1].Code != "sh000300" {
+		t.Errorf("unexpected constituents: %+v", csts)
+	}
+	if fmt.Sprint(failed) != "[sh000016 sh000852 sh000010 sh000905 sh000903]" {
+		t.Errorf("unexpected failed indices: %+v", failed)
+	}
+}
+
+func TestParseCsindexWeights(t *testing.T) {
+	body := []byte(`{"code": "200", "msg": "success", "data": {"indexCode": "000300", "updateDate": "2018-06-29",
+		"weightList": [{"securityCode": "600519", "securityName": "贵州茅台", "weight": 5.23},
+		{"securityCode": "000001", "securityName": "平安银行", "weight": 0.81}]}}`)
+	csts, e := ParseCsindexWeights("sh000300", body)
+	if e != nil {
+		t.Fatal(e)
+	}
+	if len(csts) != 2 || *csts[0] != (model.IdxCst{Code: "sh000300", Date: "2018-06-29", Stock: "600519",
+		Name: "贵州茅台", Weight: 5.23}) {
+		t.Errorf("unexpected constituents: %+v", csts)
+	}
+	if _, e = ParseCsindexWeights("sh000300", []byte(`{"code": "404", "msg": "not found"}`)); e == nil {
+		t.Error("expecting error on failed response")
+	}
+}
+
+func TestIdxContribs(t *testing.T) {
+	csts := []*model.IdxCst{
+		{Code: "sh000300", Stock: "600519", Name: "A", Weight: 60},
+		{Code: "sh000300", Stock: "000001", Name: "B", Weight: 40},
+		{Code: "sh000300", Stock: "300001", Name: "C", Weight: 10},
+	}
+	// A doubles from the snapshot to start, C has no close at end
+	snap := map[string]float64{"600519": 10, "000001": 10, "300001": 10}
+	start := map[string]float64{"600519": 20, "000001": 10, "300001": 10}
+	end := map[string]float64{"600519": 18, "000001": 12}
+	cs := IdxContribs(csts, snap, start, end, "2018-07-02", "2018-07-31")
+	if len(cs) != 2 {
+		t.Fatalf("expecting 2 contributions, got %d", len(cs))
+	}
+	exp := []string{"000001/25.00/20.00/5.00", "600519/75.00/-10.00/-7.50"}
+	for i, c := range cs {
+		if s := fmt.Sprintf("%s/%.2f/%.2f/%.2f", c.Stock, c.Weight, c.Ret, c.Contrib); s != exp[i] {
+			t.Errorf("expecting %s, got %s", exp[i], s)
+		}
+	}
+}
@@ -44,8 +44,8 @@ func GetIndices() (idxlst, suclst []*model.IdxLst) {
 		codes[i] = idx.Code
 		idxMap[idx.Code] = idx
 	}
-	chidx := make(chan *model.IdxLst, conf.Args.Concurrency)
-	rchs := make(chan string, conf.Args.Concurrency)
+	chidx := make(chan *model.IdxLst, conf.Args().Concurrency)
+	rchs := make(chan string, conf.Args().Concurrency)
 	wgr.Add(1)
 	go func() {
 		defer wgr.Done()
@@ -7,26 +7,34 @@ import (
 	"runtime"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/carusyte/stock/conf"
 	"github.com/carusyte/stock/indc"
+	"github.com/carusyte/stock/metrics"
 	"github.com/carusyte/stock/model"
-	rm "github.com/carusyte/rima/model"
 	"github.com/carusyte/stock/util"
+	"github.com/pkg/errors"
 	"github.com/satori/go.uuid"
 	logr "github.com/sirupsen/logrus"
 	"github.com/carusyte/stock/rpc"
 )
 
 const (
-	LOCAL_PRUNE_THRESHOLD = 3000
+	//KDJ_SMP_EXPVR, KDJ_SMP_MXRT, KDJ_SMP_MXHOLD sampling parameters of the raw kdj feature data taken in
+	// CalcIndics, which are clustered into feature data versions, see RawKdjSmpVer
+	KDJ_SMP_EXPVR  = 5.0
+	KDJ_SMP_MXRT   = 2.0
+	KDJ_SMP_MXHOLD = 2
 )
 
 var (
 	kdjFdrMap map[string][]*model.KDJfdrView = make(map[string][]*model.KDJfdrView)
 	kdjFdMap  map[string][]*model.KDJfdView  = make(map[string][]*model.KDJfdView)
-	lock                                     = sync.RWMutex{}
+	// versions of which all feature data are cached in kdjFdMap
+	kdjFdAll = make(map[string]bool)
+	lock     = sync.RWMutex{}
 )
 
 //GetKdjHist Find kdj history up to 'toDate', limited to 'retro' rows. If retro <= 0, no limit is set.
@@ -113,29 +121,16 @@ func GetKdjHist(code string, tab model.DBTab, retro int, toDate string) (indcs [
 	return
 }
 
+//RawKdjSmpVer returns the sampling version of the raw kdj feature data taken in CalcIndics, from which
+// feature data versions are clustered.
+func RawKdjSmpVer() string {
+	return KdjSmpVer(KDJ_SMP_EXPVR, KDJ_SMP_MXRT, KDJ_SMP_MXHOLD)
+}
+
 //SmpKdjFeat sample kdj features
 func SmpKdjFeat(code string, cytp model.CYTP, expvr, mxrt float64, mxhold int) {
 	//TODO tag cross?
-	var (
-		itab, ktab model.DBTab
-		minSize    int
-	)
-	switch cytp {
-	case model.DAY:
-		itab = model.INDICATOR_DAY
-		ktab = model.KLINE_DAY
-		minSize = 200
-	case model.WEEK:
-		itab = model.INDICATOR_WEEK
-		ktab = model.KLINE_WEEK
-		minSize = 30
-	case model.MONTH:
-		itab = model.INDICATOR_MONTH
-		ktab = model.KLINE_MONTH
-		minSize = 15
-	default:
-		log.Panicf("not supported cycle type: %+v", cytp)
-	}
+	itab, ktab, minSize := smpTabs(cytp)
 	hist := GetKdjHist(code, itab, 0, "")
 	klhist := GetKlineDb(code, ktab, 0, false)
 	if len(hist) != len(klhist) {
@@ -144,13 +139,14 @@ func SmpKdjFeat(code string, cytp model.CYTP, expvr, mxrt float64, mxhold int) {
 	}
 	if len(hist) < minSize {
 		log.Printf("%s %s insufficient data for sampling: %d", code, cytp, len(hist))
+		saveIndcFt(code, cytp, KdjSmpVer(expvr, mxrt, mxhold), nil, nil)
 		return
 	}
 	indf, kfds := smpKdjBY(code, cytp, hist, klhist, expvr, mxrt, mxhold)
 	indfSl, kfdsSl := smpKdjSL(code, cytp, hist, klhist, expvr, mxrt, mxhold)
 	indf = append(indf, indfSl...)
 	kfds = append(kfds, kfdsSl...)
-	saveIndcFt(code, cytp, indf, kfds)
+	saveIndcFt(code, cytp, KdjSmpVer(expvr, mxrt, mxhold), indf, kfds)
 }
 
 // sample KDJ sell point features
@@ -160,55 +156,16 @@ func smpKdjSL(code string, cytp model.CYTP, hist []*model.Indicator, klhist []*m
 	kfds = make([]*model.KDJfdRaw, 0, 16)
 	indf = make([]*model.IndcFeatRaw, 0, 16)
 	for i := 1; i < len(hist)-1; i++ {
-		kl := klhist[i]
-		sc := kl.Close
-		if sc < klhist[i+1].Close {
+		mark, tspan, ok := markSL(klhist, i, mxrt, mxhold)
+		if !ok {
 			continue
 		}
-		lc := math.Inf(0)
-		tspan := 0
-		pc := klhist[i-1].Close
-		for w, j := 0, 0; i+j < len(hist); j++ {
-			nc := klhist[i+j].Close
-			if nc < lc {
-				lc = nc
-				tspan = j
-			}
-			if pc <= nc {
-				rt := (nc - lc) / math.Abs(lc) * 100
-				if rt >= mxrt || w > mxhold {
-					break
-				}
-				if j > 0 {
-					w++
-				}
-			} else {
-				w = 0
-			}
-			pc = nc
-		}
-		if sc == 0 {
-			sc = -0.01
-			lc -= 0.01
-		}
-		mark := (lc - sc) / math.Abs(sc) * 100
 		if mark <= -expvr {
 			//sample backward and find the last J, D cross point
 			cross, fnd := ToLstJDCross(hist[:i+1])
 			if fnd {
 				samp := len(cross)
-				kft := new(model.IndcFeatRaw)
-				kft.Code = code
-				kft.Udate = dt
-				kft.Utime = tm
-				kft.Bysl = "SL"
-				kft.Cytp = string(cytp)
-				kft.Indc = "KDJ"
-				kft.Mark = mark
-				kft.SmpDate = hist[i-samp+1].Date
-				kft.SmpNum = samp
-				kft.Tspan = tspan
-				kft.Mpt = mark / float64(tspan)
+				kft := newIndcFeatRaw(code, "KDJ", cytp, "SL", hist[i-samp+1].Date, samp, mark, tspan, dt, tm)
 				fid := kft.GenFid()
 				indf = append(indf, kft)
 				for j := i - samp + 1; j <= i; j++ {
@@ -238,38 +195,10 @@ func smpKdjBY(code string, cytp model.CYTP, hist []*model.Indicator, klhist []*m
 	kfds = make([]*model.KDJfdRaw, 0, 16)
 	indf = make([]*model.IndcFeatRaw, 0, 16)
 	for i := 1; i < len(hist)-1; i++ {
-		kl := klhist[i]
-		sc := kl.Close
-		if sc >= klhist[i+1].Close {
+		mark, tspan, ok := markBY(klhist, i, mxrt, mxhold)
+		if !ok {
 			continue
 		}
-		hc := math.Inf(-1)
-		tspan := 0
-		pc := klhist[i-1].Close
-		for w, j := 0, 0; i+j < len(hist); j++ {
-			nc := klhist[i+j].Close
-			if nc > hc {
-				hc = nc
-				tspan = j
-			}
-			if pc >= nc {
-				rt := (hc - nc) / math.Abs(hc) * 100
-				if rt >= mxrt || w > mxhold {
-					break
-				}
-				if j > 0 {
-					w++
-				}
-			} else {
-				w = 0
-			}
-			pc = nc
-		}
-		if sc == 0 {
-			sc = 0.01
-			hc += 0.01
-		}
-		mark := (hc - sc) / math.Abs(sc) * 100
 		if mark >= expvr {
 			if skip {
 				skip = false
@@ -278,18 +207,7 @@ func smpKdjBY(code string, cytp model.CYTP, hist []*model.Indicator, klhist []*m
 				cross, fnd := ToLstJDCross(hist[:i+1])
 				if fnd {
 					samp := len(cross)
-					kft := new(model.IndcFeatRaw)
-					kft.Code = code
-					kft.Udate = dt
-					kft.Utime = tm
-					kft.Bysl = "BY"
-					kft.Cytp = string(cytp)
-					kft.Indc = "KDJ"
-					kft.Mark = mark
-					kft.SmpDate = hist[i-samp+1].Date
-					kft.SmpNum = samp
-					kft.Tspan = tspan
-					kft.Mpt = mark / float64(tspan)
+					kft := newIndcFeatRaw(code, "KDJ", cytp, "BY", hist[i-samp+1].Date, samp, mark, tspan, dt, tm)
 					fid := kft.GenFid()
 					indf = append(indf, kft)
 					for j := i - samp + 1; j <= i; j++ {
@@ -320,55 +238,65 @@ func ToLstJDCross(kdjs []*model.Indicator) (cross []*model.Indicator, found bool
 		j := kdjs[i].KDJ_J
 		d := kdjs[i].KDJ_D
 		if j == d {
-			if c < conf.Args.Kdjv.SampleSizeMin {
-				c = int(math.Min(float64(conf.Args.Kdjv.SampleSizeMin), float64(len(kdjs))))
+			if c < conf.Args().Kdjv.SampleSizeMin {
+				c = int(math.Min(float64(conf.Args().Kdjv.SampleSizeMin), float64(len(kdjs))))
 			}
 			cross = kdjs[len(kdjs)-c:]
-			return cross, len(cross) >= conf.Args.Kdjv.SampleSizeMin
+			return cross, len(cross) >= conf.Args().Kdjv.SampleSizeMin
 		}
 		pj := kdjs[i-1].KDJ_J
 		pd := kdjs[i-1].KDJ_D
 		c++
 		if pj == pd {
-			if c < conf.Args.Kdjv.SampleSizeMin {
-				c = int(math.Min(float64(conf.Args.Kdjv.SampleSizeMin), float64(len(kdjs))))
+			if c < conf.Args().Kdjv.SampleSizeMin {
+				c = int(math.Min(float64(conf.Args().Kdjv.SampleSizeMin), float64(len(kdjs))))
 			}
 			cross = kdjs[len(kdjs)-c:]
-			return cross, len(cross) >= conf.Args.Kdjv.SampleSizeMin
+			return cross, len(cross) >= conf.Args().Kdjv.SampleSizeMin
 		}
 		if (j < d && pj < pd) || (j > d && pj > pd) {
 			continue
 		}
-		if c < conf.Args.Kdjv.SampleSizeMin {
-			c = int(math.Min(float64(conf.Args.Kdjv.SampleSizeMin), float64(len(kdjs))))
+		if c < conf.Args().Kdjv.SampleSizeMin {
+			c = int(math.Min(float64(conf.Args().Kdjv.SampleSizeMin), float64(len(kdjs))))
 		}
 		cross = kdjs[len(kdjs)-c:]
-		return cross, len(cross) >= conf.Args.Kdjv.SampleSizeMin
+		return cross, len(cross) >= conf.Args().Kdjv.SampleSizeMin
 	}
 	return kdjs, false
 }
 
-//GetKdjFeatDatRaw get kdj raw feature data from cache, or database if not found.
+//GetKdjFeatDatRaw get kdj raw feature data of the sampling version returned by RawKdjSmpVer from cache,
+// or database if not found.
 func GetKdjFeatDatRaw(cytp model.CYTP, buy bool, num int) []*model.KDJfdrView {
 	bysl := "BY"
 	if !buy {
 		bysl = "SL"
 	}
-	mk := fmt.Sprintf("%s-%s-%d", cytp, bysl, num)
+	ver := RawKdjSmpVer()
+	mk := kdjFdrKey(ver, &fdKey{Cytp: string(cytp), Bysl: bysl, SmpNum: num})
 	lock.Lock()
 	defer lock.Unlock()
 	if fdvs, exists := kdjFdrMap[mk]; exists {
 		return fdvs
 	}
+	fdvs := queryKdjFeatDatRaw("KDJ_FEAT_DAT_RAW", ver, cytp, bysl, num)
+	kdjFdrMap[mk] = fdvs
+	return fdvs
+}
+
+//queryKdjFeatDatRaw queries kdj raw feature data of the sampling version with the named sql, bypassing cache.
+// Extra args of the sql, if any, follow the group identity.
+func queryKdjFeatDatRaw(sqlName, ver string, cytp model.CYTP, bysl string, num int,
+	args ...interface{}) []*model.KDJfdrView {
 	start := time.Now()
-	sql, e := dot.Raw("KDJ_FEAT_DAT_RAW")
-	util.CheckErr(e, "failed to get KDJ_FEAT_DAT_RAW sql")
-	rows, e := dbmap.Query(sql, string(cytp)+bysl+"%", cytp, bysl, num)
+	sql, e := dot.Raw(sqlName)
+	util.CheckErr(e, "failed to get "+sqlName+" sql")
+	rows, e := dbmap.Query(sql, append([]interface{}{string(cytp) + bysl + "%", ver, ver, cytp, bysl, num},
+		args...)...)
 	if e != nil {
 		if "sql: no rows in result set" == e.Error() {
-			fdvs := make([]*model.KDJfdrView, 0)
-			kdjFdrMap[mk] = fdvs
-			return fdvs
+			return make([]*model.KDJfdrView, 0)
 		} else {
 			log.Panicf("failed to query kdj feat dat raw, sql:\n%s\n%+v", sql, e)
 		}
@@ -385,7 +313,7 @@ func GetKdjFeatDatRaw(cytp model.CYTP, buy bool, num int) []*model.KDJfdrView {
 	for rows.Next() {
 		rows.Scan(&code, &fid, &smpDate, &smpNum, &klid, &k, &d, &j)
 		if code != pcode || fid != pfid {
-			kfv = newKDJfdrView(code, smpDate, smpNum)
+			kfv = newKDJfdrView(code, fid, smpDate, smpNum)
 			fdvs = append(fdvs, kfv)
 		}
 		kfv.Add(klid, k, d, j)
@@ -395,17 +323,17 @@ func GetKdjFeatDatRaw(cytp model.CYTP, buy bool, num int) []*model.KDJfdrView {
 	if err := rows.Err(); err != nil {
 		log.Fatal(err)
 	}
-	kdjFdrMap[mk] = fdvs
-	logr.Debugf("query kdj_feat_dat_raw(%s,%s,%d): %.2f", cytp, bysl, num, time.Since(start).Seconds())
+	logr.Debugf("query %s(%s,%s,%s,%d): %.2f", sqlName, ver, cytp, bysl, num, time.Since(start).Seconds())
 	return fdvs
 }
 
-func GetKdjFeatDat(cytp model.CYTP, buy bool, num int) []*model.KDJfdView {
+//GetKdjFeatDat get kdj feature data of the version from cache, or database if not found.
+func GetKdjFeatDat(ver string, cytp model.CYTP, buy bool, num int) []*model.KDJfdView {
 	bysl := "BY"
 	if !buy {
 		bysl = "SL"
 	}
-	mk := fmt.Sprintf("%s-%s-%d", cytp, bysl, num)
+	mk := model.KdjFdKey(ver, cytp, bysl, num)
 	lock.Lock()
 	defer lock.Unlock()
 	if fdvs, exists := kdjFdMap[mk]; exists {
@@ -414,7 +342,7 @@ func GetKdjFeatDat(cytp model.CYTP, buy bool, num int) []*model.KDJfdView {
 	start := time.Now()
 	sql, e := dot.Raw("KDJ_FEAT_DAT")
 	util.CheckErr(e, "failed to get KDJ_FEAT_DAT sql")
-	rows, e := dbmap.Query(sql, cytp, bysl, num)
+	rows, e := dbmap.Query(sql, ver, cytp, bysl, num)
 	if e != nil {
 		if "sql: no rows in result set" == e.Error() {
 			fdvs := make([]*model.KDJfdView, 0)
@@ -426,7 +354,7 @@ func GetKdjFeatDat(cytp model.CYTP, buy bool, num int) []*model.KDJfdView {
 	}
 	defer rows.Close()
 	var (
-		fid                string
+		fid, scode, sfid   string
 		pfid               string
 		smpNum, fdNum, seq int
 		weight, k, d, j    float64
@@ -434,9 +362,10 @@ func GetKdjFeatDat(cytp model.CYTP, buy bool, num int) []*model.KDJfdView {
 	)
 	fdvs := make([]*model.KDJfdView, 0, 16)
 	for rows.Next() {
-		rows.Scan(&fid, &smpNum, &fdNum, &weight, &seq, &k, &d, &j)
+		rows.Scan(&fid, &smpNum, &fdNum, &weight, &scode, &sfid, &seq, &k, &d, &j)
 		if fid != pfid {
 			kfv = newKDJfdView(fid, bysl, cytp, smpNum, fdNum, weight)
+			kfv.SrcCode, kfv.SrcFid = scode, sfid
 			fdvs = append(fdvs, kfv)
 		}
 		kfv.Add(k, d, j)
@@ -446,27 +375,71 @@ func GetKdjFeatDat(cytp model.CYTP, buy bool, num int) []*model.KDJfdView {
 		log.Panicln("failed to query kdj feat dat.", err)
 	}
 	kdjFdMap[mk] = fdvs
-	logr.Debugf("query kdj_feat_dat(%s,%s,%d): %.2f", cytp, bysl, num, time.Since(start).Seconds())
+	logr.Debugf("query kdj_feat_dat(%s): %.2f", mk, time.Since(start).Seconds())
 	return fdvs
 }
 
-func GetAllKdjFeatDat() (map[string][]*model.KDJfdView, int) {
+//FillKdjMatch fills the sample date, mark and time span of the matches to feature data of the version from their
+// source samples, taken in the sampling version of the feature data. Source samples are queried in batches of
+// JOB_CAPACITY stocks, so matches of many stocks are better filled in one call. Matches without a source
+// sample, i.e. those clustered before the source was recorded, are left untouched.
+func FillKdjMatch(ver string, matches ...*model.KdjMatch) {
+	var codes, fids []string
+	cset, fset := make(map[string]bool), make(map[string]bool)
+	for _, m := range matches {
+		if m.SrcCode == "" || m.SrcFid == "" {
+			continue
+		}
+		if !cset[m.SrcCode] {
+			cset[m.SrcCode] = true
+			codes = append(codes, m.SrcCode)
+		}
+		if !fset[m.SrcFid] {
+			fset[m.SrcFid] = true
+			fids = append(fids, m.SrcFid)
+		}
+	}
+	if len(codes) == 0 {
+		return
+	}
+	smpVer := fdSmpVer(ver)
+	fmap := make(map[string]*model.IndcFeatRaw, len(matches))
+	for bg := 0; bg < len(codes); bg += JOB_CAPACITY {
+		ed := int(math.Min(float64(bg+JOB_CAPACITY), float64(len(codes))))
+		var fs []*model.IndcFeatRaw
+		_, e := dbmap.Select(&fs, fmt.Sprintf("select * from indc_feat_raw where indc = 'KDJ' and ver = ? "+
+			"and code in (%s) and fid in (%s)", util.Join(codes[bg:ed], ",", true), util.Join(fids, ",", true)),
+			smpVer)
+		if e != nil && "sql: no rows in result set" != e.Error() {
+			log.Panicf("failed to query indc_feat_raw for kdj matches: %+v", e)
+		}
+		for _, f := range fs {
+			fmap[f.Code+":"+f.Fid] = f
+		}
+	}
+	for _, m := range matches {
+		if f, ok := fmap[m.SrcCode+":"+m.SrcFid]; ok {
+			m.SmpDate = f.SmpDate
+			m.Mark = f.Mark
+			m.Tspan = f.Tspan
+		}
+	}
+}
+
+//GetAllKdjFeatDat returns all kdj feature data of the version, keyed by model.KdjFdKey.
+func GetAllKdjFeatDat(ver string) (map[string][]*model.KDJfdView, int) {
 	lock.Lock()
 	defer lock.Unlock()
-	if len(kdjFdMap) > 0 {
-		count := 0
-		for _, fds := range kdjFdMap {
-			count += len(fds)
-		}
-		return kdjFdMap, count
+	if kdjFdAll[ver] {
+		return kdjFdOf(ver)
 	}
 	start := time.Now()
 	sql, e := dot.Raw("KDJ_FEAT_DAT_ALL")
 	util.CheckErr(e, "failed to get KDJ_FEAT_DAT_ALL sql")
-	rows, e := dbmap.Query(sql)
+	rows, e := dbmap.Query(sql, ver)
 	if e != nil {
 		if "sql: no rows in result set" == e.Error() {
-			return kdjFdMap, 0
+			return kdjFdOf(ver)
 		} else {
 			log.Panicf("failed to query kdj feat dat, sql:\n%s\n%+v", sql, e)
 		}
@@ -474,6 +447,7 @@ func GetAllKdjFeatDat() (map[string][]*model.KDJfdView, int) {
 	defer rows.Close()
 	var (
 		fid, bysl, cytp    string
+		scode, sfid        string
 		pfid, mk, pmk      string
 		smpNum, fdNum, seq int
 		count              = 0
@@ -482,14 +456,15 @@ func GetAllKdjFeatDat() (map[string][]*model.KDJfdView, int) {
 	)
 	fdvs := make([]*model.KDJfdView, 0, 16)
 	for rows.Next() {
-		rows.Scan(&fid, &bysl, &cytp, &smpNum, &fdNum, &weight, &seq, &k, &d, &j)
-		mk = fmt.Sprintf("%s-%s-%d", cytp, bysl, smpNum)
+		rows.Scan(&fid, &bysl, &cytp, &smpNum, &fdNum, &weight, &scode, &sfid, &seq, &k, &d, &j)
+		mk = model.KdjFdKey(ver, model.CYTP(cytp), bysl, smpNum)
 		if mk != pmk && pmk != "" {
 			kdjFdMap[pmk] = fdvs
 			fdvs = make([]*model.KDJfdView, 0, 16)
 		}
 		if fid != pfid {
 			kfv = newKDJfdView(fid, bysl, model.CYTP(cytp), smpNum, fdNum, weight)
+			kfv.SrcCode, kfv.SrcFid = scode, sfid
 			fdvs = append(fdvs, kfv)
 		}
 		kfv.Add(k, d, j)
@@ -497,16 +472,45 @@ func GetAllKdjFeatDat() (map[string][]*model.KDJfdView, int) {
 		pmk = mk
 		count++
 	}
-	kdjFdMap[mk] = fdvs
+	if mk != "" {
+		kdjFdMap[mk] = fdvs
+	}
 	if err := rows.Err(); err != nil {
 		log.Panicln("failed to query kdj feat dat.", err)
 	}
-	logr.Debugf("query all kdj_feat_dat: %d, mk: %d,  time: %.2f", count, len(kdjFdMap), time.Since(start).Seconds())
-	return kdjFdMap, count
+	kdjFdAll[ver] = true
+	fdm, _ := kdjFdOf(ver)
+	logr.Debugf("query all kdj_feat_dat of %s: %d, mk: %d,  time: %.2f", ver, count, len(fdm),
+		time.Since(start).Seconds())
+	return fdm, count
 }
 
-func newKDJfdrView(code, date string, num int) *model.KDJfdrView {
-	return &model.KDJfdrView{code, date, num, make([]int, 0, 16), make([]float64, 0, 16),
+//kdjFdOf returns the cached kdj feature data of the version and the total number of them.
+func kdjFdOf(ver string) (fdm map[string][]*model.KDJfdView, count int) {
+	fdm = make(map[string][]*model.KDJfdView)
+	for k, fds := range kdjFdMap {
+		if strings.HasPrefix(k, ver+":") {
+			fdm[k] = fds
+			count += len(fds)
+		}
+	}
+	return
+}
+
+//evictKdjFd removes the kdj feature data of the version from cache.
+func evictKdjFd(ver string) {
+	lock.Lock()
+	defer lock.Unlock()
+	for k := range kdjFdMap {
+		if strings.HasPrefix(k, ver+":") {
+			delete(kdjFdMap, k)
+		}
+	}
+	delete(kdjFdAll, ver)
+}
+
+func newKDJfdrView(code, fid, date string, num int) *model.KDJfdrView {
+	return &model.KDJfdrView{code, fid, date, num, make([]int, 0, 16), make([]float64, 0, 16),
 		make([]float64, 0, 16), make([]float64, 0, 16)}
 }
 
@@ -525,32 +529,50 @@ func newKDJfdView(fid, bysl string, cytp model.CYTP, smpNum, fdNum int, weight f
 	return v
 }
 
-func purgeKdjFeatDat(code string) {
+//saveIndcFt replaces raw kdj feature data of the stock in the cycle and sampling version with the samples.
+// Samples identical to the previous ones keep their update time, so that only members of purged or
+// re-sampled raw feature data are withdrawn from their clusters when a version is updated, see
+// UpdateKdjFeatDat. Clusters of existing versions are left intact.
+func saveIndcFt(code string, cytp model.CYTP, ver string, feats []*model.IndcFeatRaw, kfds []*model.KDJfdRaw) {
+	var (
+		pfeats []*model.IndcFeatRaw
+		pkfds  []*model.KDJfdRaw
+	)
+	_, e := dbmap.Select(&pfeats, "select * from indc_feat_raw where code = ? and indc = 'KDJ' and cytp = ? "+
+		"and ver = ?", code, cytp, ver)
+	if e != nil && "sql: no rows in result set" != e.Error() {
+		log.Panicf("%s failed to query indc_feat_raw: %+v", code, e)
+	}
+	_, e = dbmap.Select(&pkfds, "select k.code, k.fid, k.ver, k.klid, k.k, k.d, k.j, k.udate, k.utime "+
+		"from kdj_feat_dat_raw k join indc_feat_raw r using (code, ver, fid) where r.code = ? and "+
+		"r.indc = 'KDJ' and r.cytp = ? and r.ver = ? order by k.fid, k.klid", code, cytp, ver)
+	if e != nil && "sql: no rows in result set" != e.Error() {
+		log.Panicf("%s failed to query kdj_feat_dat_raw: %+v", code, e)
+	}
+	keepKdjFtStamps(pfeats, pkfds, feats, kfds)
 	tran, e := dbmap.Begin()
 	util.CheckErr(e, "failed to begin new transaction")
-	//purge data of this code before insertion
-	_, e = tran.Exec("delete from indc_feat_raw where code = ?", code)
+	//purge data of this code and cycle before insertion
+	_, e = tran.Exec("delete k from kdj_feat_dat_raw k join indc_feat_raw r using (code, ver, fid) "+
+		"where r.code = ? and r.indc = 'KDJ' and r.cytp = ? and r.ver = ?", code, cytp, ver)
 	if e != nil {
-		log.Printf("failed to purge indc_feat_raw, %s", code)
+		log.Printf("failed to purge kdj_feat_dat_raw, %s", code)
 		tran.Rollback()
 		log.Panicln(e)
 	}
-	_, e = tran.Exec("delete from kdj_feat_dat_raw where code = ?", code)
+	_, e = tran.Exec("delete from indc_feat_raw where code = ? and indc = 'KDJ' and cytp = ? and ver = ?",
+		code, cytp, ver)
 	if e != nil {
 		log.Printf("failed to purge indc_feat_raw, %s", code)
 		tran.Rollback()
 		log.Panicln(e)
 	}
-	tran.Commit()
-}
-
-func saveIndcFt(code string, cytp model.CYTP, feats []*model.IndcFeatRaw, kfds []*model.KDJfdRaw) {
 	if len(feats) > 0 && len(kfds) > 0 {
 		valueStrings := make([]string, 0, len(feats))
-		valueArgs := make([]interface{}, 0, len(feats)*13)
-		var code string
+		valueArgs := make([]interface{}, 0, len(feats)*14)
 		for _, f := range feats {
-			valueStrings = append(valueStrings, "(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)")
+			f.Ver = ver
+			valueStrings = append(valueStrings, "(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)")
 			valueArgs = append(valueArgs, f.Code)
 			valueArgs = append(valueArgs, f.Indc)
 			valueArgs = append(valueArgs, f.Cytp)
@@ -562,18 +584,15 @@ func saveIndcFt(code string, cytp model.CYTP, feats []*model.IndcFeatRaw, kfds [
 			valueArgs = append(valueArgs, f.Tspan)
 			valueArgs = append(valueArgs, f.Mpt)
 			valueArgs = append(valueArgs, f.Remarks)
+			valueArgs = append(valueArgs, f.Ver)
 			valueArgs = append(valueArgs, f.Udate)
 			valueArgs = append(valueArgs, f.Utime)
-			code = f.Code
 		}
 		stmt := fmt.Sprintf("INSERT INTO indc_feat_raw (code,indc,cytp,bysl,smp_date,smp_num,fid,mark,tspan,mpt,"+
-			"remarks,"+
+			"remarks,ver,"+
 			"udate,utime) VALUES %s on duplicate key update smp_num=values(smp_num),mark=values(mark),tspan=values"+
-			"(tspan),mpt=values(mpt),remarks=values(remarks),udate=values(udate),utime=values(utime)",
+			"(tspan),mpt=values(mpt),remarks=values(remarks),ver=values(ver),udate=values(udate),utime=values(utime)",
 			strings.Join(valueStrings, ","))
-
-		tran, e := dbmap.Begin()
-		util.CheckErr(e, "failed to begin new transaction")
 		_, err := tran.Exec(stmt, valueArgs...)
 		if err != nil {
 			log.Printf("%s failed to bulk insert indc_feat_raw", code)
@@ -582,11 +601,13 @@ func saveIndcFt(code string, cytp model.CYTP, feats []*model.IndcFeatRaw, kfds [
 		}
 
 		valueStrings = make([]string, 0, len(kfds))
-		valueArgs = make([]interface{}, 0, len(kfds)*8)
+		valueArgs = make([]interface{}, 0, len(kfds)*9)
 		for _, k := range kfds {
-			valueStrings = append(valueStrings, "(?, ?, ?, ?, ?, ?, ?, ?)")
+			k.Ver = ver
+			valueStrings = append(valueStrings, "(?, ?, ?, ?, ?, ?, ?, ?, ?)")
 			valueArgs = append(valueArgs, k.Code)
 			valueArgs = append(valueArgs, k.Fid)
+			valueArgs = append(valueArgs, k.Ver)
 			valueArgs = append(valueArgs, k.Klid)
 			valueArgs = append(valueArgs, k.K)
 			valueArgs = append(valueArgs, k.D)
@@ -594,7 +615,7 @@ func saveIndcFt(code string, cytp model.CYTP, feats []*model.IndcFeatRaw, kfds [
 			valueArgs = append(valueArgs, k.Udate)
 			valueArgs = append(valueArgs, k.Utime)
 		}
-		stmt = fmt.Sprintf("INSERT INTO kdj_feat_dat_raw (code,fid,klid,k,d,j,"+
+		stmt = fmt.Sprintf("INSERT INTO kdj_feat_dat_raw (code,fid,ver,klid,k,d,j,"+
 			"udate,utime) VALUES %s on duplicate key update k=values(k),d=values(d),"+
 			"j=values(j),udate=values(udate),utime=values(utime)",
 			strings.Join(valueStrings, ","))
@@ -604,184 +625,479 @@ func saveIndcFt(code string, cytp model.CYTP, feats []*model.IndcFeatRaw, kfds [
 			tran.Rollback()
 			log.Panicln(err)
 		}
+	}
+	if e = tran.Commit(); e != nil {
+		log.Panicf("%s failed to commit raw kdj feature data: %+v", code, e)
+	}
+	metrics.RowsUpserted("indc_feat_raw", len(feats))
+	metrics.RowsUpserted("kdj_feat_dat_raw", len(kfds))
+}
 
-		tran.Commit()
+//keepKdjFtStamps carries the update time of the previous samples over to the new ones of the same feature id
+// if their marks and kdj values remain the same.
+func keepKdjFtStamps(pfeats []*model.IndcFeatRaw, pkfds []*model.KDJfdRaw, feats []*model.IndcFeatRaw,
+	kfds []*model.KDJfdRaw) {
+	pfm := make(map[string]*model.IndcFeatRaw, len(pfeats))
+	for _, f := range pfeats {
+		pfm[f.Fid] = f
+	}
+	pkm := make(map[string][]*model.KDJfdRaw, len(pfeats))
+	for _, k := range pkfds {
+		pkm[k.Fid] = append(pkm[k.Fid], k)
+	}
+	km := make(map[string][]*model.KDJfdRaw, len(feats))
+	for _, k := range kfds {
+		km[k.Fid] = append(km[k.Fid], k)
+	}
+	for _, f := range feats {
+		p, ok := pfm[f.Fid]
+		if !ok || p.SmpDate != f.SmpDate || p.SmpNum != f.SmpNum || p.Mark != f.Mark || p.Tspan != f.Tspan {
+			continue
+		}
+		ks, pks := km[f.Fid], pkm[f.Fid]
+		if len(ks) != len(pks) {
+			continue
+		}
+		same := true
+		for i, k := range ks {
+			pk := pks[i]
+			if k.Klid != pk.Klid || k.K != pk.K || k.D != pk.D || k.J != pk.J {
+				same = false
+				break
+			}
+		}
+		if !same {
+			continue
+		}
+		f.Udate, f.Utime = p.Udate, p.Utime
+		for i, k := range ks {
+			k.Udate, k.Utime = pks[i].Udate, pks[i].Utime
+		}
 	}
 }
 
-//PruneKdjFeatDat Merge similar kdj feature data based on devia
-func PruneKdjFeatDat(prec float64, pruneRate float64, resume bool) {
+//PruneKdjFeatDat Groups similar raw kdj feature data into clusters as a new feature data version, leaving
+// existing versions intact. If resume is specified, the latest version still building is continued instead,
+// in which case only feature data groups without any cluster are processed. The medoid of each
+// cluster is saved as the pruned feature data, see indc.ClusterKdjFd. The version is left building if any group
+// fails to be pruned. Returns the version pruned.
+func PruneKdjFeatDat(prec float64, pruneRate float64, resume bool) (ver string) {
 	st := time.Now()
 	logr.Debugf("Pruning KDJ feature data. precision:%.3f, prune rate:%.2f, resume: %t", prec, pruneRate, resume)
+	params := map[string]interface{}{"prec": prec, "prune_rate": pruneRate, "resume": resume,
+		"run_mode": conf.Args().RunMode, "local_prune_threshold": conf.Args().Kdjv.LocalPruneThreshold,
+		"sim_metric": conf.Args().Kdjv.SimMetric, "dtw_window": conf.Args().Kdjv.DtwWindow}
+	RecordParams("KDJ_PRUNE", params)
+	if resume {
+		ver = LatestFeatVer("KDJ", FEAT_VER_FD, FEAT_VER_BUILDING)
+		if ver == "" {
+			log.Printf("no kdj feature data version to resume, pruning a new version")
+			resume = false
+		}
+	}
+	if !resume {
+		delete(params, "resume")
+		ver = NewFeatVer("KDJ", FEAT_VER_FD, "", params)
+	}
 	var fdks []*fdKey
 	var e error
+	smpVer := RawKdjSmpVer()
 	if resume {
 		// skip data already in indc_feat
 		sql, e := dot.Raw("KDJ_FEAT_DAT_RAW_UNPRUNED_COUNT")
 		util.CheckErr(e, "failed to get sql KDJ_FEAT_DAT_RAW_UNPRUNED_COUNT")
-		_, e = dbmap.Select(&fdks, sql)
+		_, e = dbmap.Select(&fdks, sql, smpVer, ver)
 	} else {
 		_, e = dbmap.Select(&fdks, "select cytp, bysl, smp_num, count(*) count from "+
-			"indc_feat_raw group by cytp, bysl, smp_num order by count")
+			"indc_feat_raw where indc = 'KDJ' and ver = ? group by cytp, bysl, smp_num order by count", smpVer)
 	}
-	if e != nil {
-		if "sql: no rows in result set" == e.Error() {
-			return
-		}
+	if e != nil && "sql: no rows in result set" != e.Error() {
 		log.Panicln("failed to query indc_feat_dat_raw", e)
-
-	}
-	if !resume {
-		_, e = dbmap.Exec("truncate table indc_feat")
-		util.CheckErr(e, "failed to truncate indc_feat")
-		_, e = dbmap.Exec("truncate table kdj_feat_dat")
-		util.CheckErr(e, "failed to truncate kdj_feat_dat")
 	}
-	var wg sync.WaitGroup
+	var (
+		wg   sync.WaitGroup
+		errs []error
+	)
 	chfdk := make(chan *fdKey, JOB_CAPACITY)
-	chfdks := make(chan *fdKey, JOB_CAPACITY)
-	sumbf := 0
 	for _, k := range fdks {
-		sumbf += k.Count
-		switch conf.Args.RunMode {
-		case conf.AUTO:
-			if k.Count > LOCAL_PRUNE_THRESHOLD {
-				chfdk <- k
-			} else {
-				chfdks <- k
-			}
+		switch conf.Args().RunMode {
+		case conf.AUTO, conf.DISTRIBUTED:
+			// run as jobs, see kdjPruneJobs
 		default:
 			chfdk <- k
 		}
 	}
-	//TODO realize asynchronous remote mode
-	switch conf.Args.RunMode {
+	switch conf.Args().RunMode {
 	case conf.AUTO:
-		// maybe we can steal jobs from remote channel if local task is done?
-		p, _ := rpc.Available(false)
-		for i := 0; i < p; i++ {
-			wg.Add(1)
-			go doPruneKdjFeatDat(chfdk, &wg, prec, pruneRate, conf.REMOTE)
-		}
-		p = int(float64(runtime.NumCPU()) * 0.7)
-		for i := 0; i < p; i++ {
-			wg.Add(1)
-			go doPruneKdjFeatDat(chfdks, &wg, prec, pruneRate, conf.LOCAL)
-		}
+		errs = rpc.Schedule(kdjPruneJobs(ver, fdks, prec, pruneRate))
 	case conf.REMOTE:
 		p, _ := rpc.Available(false)
 		for i := 0; i < p; i++ {
 			wg.Add(1)
-			go doPruneKdjFeatDat(chfdk, &wg, prec, pruneRate, conf.REMOTE)
+			go doPruneKdjFeatDat(ver, chfdk, &wg, prec, pruneRate, conf.REMOTE)
 		}
 	case conf.LOCAL:
 		p := int(float64(runtime.NumCPU()) * 0.7)
 		for i := 0; i < p; i++ {
 			wg.Add(1)
-			go doPruneKdjFeatDat(chfdk, &wg, prec, pruneRate, conf.LOCAL)
+			go doPruneKdjFeatDat(ver, chfdk, &wg, prec, pruneRate, conf.LOCAL)
 		}
 	case conf.DISTRIBUTED:
-		wg.Add(1)
-		go doPruneKdjFeatDat(chfdk, &wg, prec, pruneRate, conf.DISTRIBUTED)
+		errs = rpc.Distribute(kdjPruneJobs(ver, fdks, prec, pruneRate), int(float64(runtime.NumCPU())*0.7))
 	}
 	close(chfdk)
-	close(chfdks)
 	wg.Wait()
-	//FIXME this count is incorrect if run in resume mode
-	sumaf, e := dbmap.SelectInt("select count(*) from indc_feat")
+	if len(errs) > 0 {
+		// groups failed have no cluster, and are picked up by resuming
+		logr.Errorf("%d kdj feature data pruning jobs failed, resume to complete %s: %+v", len(errs), ver, errs)
+		return
+	}
+	ReadyFeatVer(ver, smpVer)
+	PurgeKdjFdVers(conf.Args().Kdjv.KeepVers)
+	// count the whole version, groups pruned before resuming included
+	sumbf, e := dbmap.SelectInt("select count(*) from indc_feat_mbr where ver = ? and indc = 'KDJ'", ver)
+	util.CheckErr(e, "failed to count indc_feat_mbr")
+	sumaf, e := dbmap.SelectInt("select count(*) from indc_feat where ver = ? and indc = 'KDJ'", ver)
 	util.CheckErr(e, "failed to count indc_feat")
-	prate := float64(sumbf-int(sumaf)) / float64(sumbf) * 100
-	log.Printf("raw kdj feature data pruned. before: %d, after: %d, rate: %.2f%%, time: %.2f",
-		sumbf, sumaf, prate, time.Since(st).Seconds())
+	prate := 0.
+	if sumbf > 0 {
+		prate = float64(sumbf-sumaf) / float64(sumbf) * 100
+	}
+	log.Printf("raw kdj feature data pruned as %s. before: %d, after: %d, rate: %.2f%%, time: %.2f",
+		ver, sumbf, sumaf, prate, time.Since(st).Seconds())
+	return
 }
 
-func doPruneKdjFeatDat(chfdk chan *fdKey, wg *sync.WaitGroup, prec float64, pruneRate float64, runMode conf.RunMode) {
+func doPruneKdjFeatDat(ver string, chfdk chan *fdKey, wg *sync.WaitGroup, prec float64, pruneRate float64,
+	runMode conf.RunMode) {
 	defer wg.Done()
 	for fdk := range chfdk {
-		st := time.Now()
-		fdrvs := GetKdjFeatDatRaw(model.CYTP(fdk.Cytp), fdk.Bysl == "BY", fdk.SmpNum)
-		nprec := prec * (1 - 1./math.Pow(math.E*math.Pi, math.E) * math.Pow(float64(fdk.SmpNum-2),
-			1+1./(math.Sqrt2*math.Pi)))
-		logr.Debugf("pruning: %s size: %d, nprec: %.3f", fdk.ID(), len(fdrvs), nprec)
-		fdvs := convert2Fdvs(fdk, fdrvs)
-		fdvs = smartPruneKdjFeatDat(fdk, fdvs, nprec, pruneRate, runMode)
-		for _, fdv := range fdvs {
-			fdv.Weight = float64(fdv.FdNum) / float64(len(fdrvs))
+		pruneKdjFdk(ver, fdk, prec, func(fdvs []*model.KDJfdView, nprec float64) ([]*model.KDJfdView, []int, error) {
+			cs, assign := smartPruneKdjFeatDat(fdk, fdvs, nprec, pruneRate, runMode)
+			return cs, assign, nil
+		})
+	}
+}
+
+//kdjPruneJobs creates a pruning job for each of the feature data groups. Small groups are left
+// to local power.
+func kdjPruneJobs(ver string, fdks []*fdKey, prec float64, pruneRate float64) []*rpc.Job {
+	jobs := make([]*rpc.Job, len(fdks))
+	for i, k := range fdks {
+		fdk := k
+		j := &rpc.Job{ID: fdk.ID()}
+		j.Local = func() error {
+			return pruneKdjFdk(ver, fdk, prec, func(fdvs []*model.KDJfdView, nprec float64) ([]*model.KDJfdView, []int, error) {
+				cs, assign := smartPruneKdjFeatDat(fdk, fdvs, nprec, pruneRate, conf.LOCAL)
+				return cs, assign, nil
+			})
+		}
+		if fdk.Count > 100 {
+			j.Remote = func(addr string) error {
+				return pruneKdjFdk(ver, fdk, prec, func(fdvs []*model.KDJfdView, nprec float64) ([]*model.KDJfdView, []int, error) {
+					return pruneKdjFeatDatRemote(fdk, fdvs, nprec, pruneRate, addr)
+				})
+			}
 		}
-		saveKdjFd(fdvs)
-		prate := float64(fdk.Count-len(fdvs)) / float64(fdk.Count) * 100
-		logr.Debugf("%s pruned and saved, before: %d, after: %d, rate: %.2f%%    time: %.2f",
-			fdk.ID(), fdk.Count, len(fdvs), prate, time.Since(st).Seconds())
+		jobs[i] = j
+	}
+	return jobs
+}
+
+//pruneKdjFdk clusters the raw feature data group identified by fdk with the specified prune function,
+// and saves the clusters along with their members as the version if pruning succeeds.
+func pruneKdjFdk(ver string, fdk *fdKey, prec float64,
+	prune func(fdvs []*model.KDJfdView, nprec float64) ([]*model.KDJfdView, []int, error)) error {
+	st := time.Now()
+	fdrvs := GetKdjFeatDatRaw(model.CYTP(fdk.Cytp), fdk.Bysl == "BY", fdk.SmpNum)
+	nprec := kdjFdPrec(fdk, prec)
+	logr.Debugf("pruning: %s size: %d, nprec: %.3f", fdk.ID(), len(fdrvs), nprec)
+	fdvs, assign, e := prune(convert2Fdvs(fdk, fdrvs), nprec)
+	if e != nil {
+		return e
+	}
+	weighKdjFd(fdvs)
+	saveKdjFd(ver, fdvs)
+	saveKdjFdMbr(ver, fdk, fdvs, assign, fdrvs)
+	prate := float64(fdk.Count-len(fdvs)) / float64(fdk.Count) * 100
+	logr.Debugf("%s pruned and saved, before: %d, after: %d, rate: %.2f%%    time: %.2f",
+		fdk.ID(), fdk.Count, len(fdvs), prate, time.Since(st).Seconds())
+	return nil
+}
+
+//kdjFdPrec returns the similarity precision of clustering, lowered for longer samples.
+func kdjFdPrec(fdk *fdKey, prec float64) float64 {
+	return prec * (1 - 1./math.Pow(math.E*math.Pi, math.E) * math.Pow(float64(fdk.SmpNum-2),
+		1+1./(math.Sqrt2*math.Pi)))
+}
+
+//weighKdjFd sets the weight of each cluster in the same group to its share of raw feature data.
+func weighKdjFd(fdvs []*model.KDJfdView) {
+	total := 0
+	for _, f := range fdvs {
+		total += f.FdNum
+	}
+	for _, f := range fdvs {
+		f.Weight = float64(f.FdNum) / float64(total)
 	}
 }
 
 func smartPruneKdjFeatDat(fdk *fdKey, fdvs []*model.KDJfdView, nprec float64,
-	pruneRate float64, runMode conf.RunMode) []*model.KDJfdView {
+	pruneRate float64, runMode conf.RunMode) (cs []*model.KDJfdView, assign []int) {
 	var e error
 	if len(fdvs) <= 100 {
-		return fdvs
+		return pruneKdjFeatDatLocal(fdk, fdvs, nprec, pruneRate)
 	}
 	switch runMode {
 	case conf.LOCAL:
-		fdvs = pruneKdjFeatDatLocal(fdk, fdvs, nprec, pruneRate)
+		cs, assign = pruneKdjFeatDatLocal(fdk, fdvs, nprec, pruneRate)
 	case conf.REMOTE:
-		fdvs, e = pruneKdjFeatDatRemote(fdk, fdvs, nprec, pruneRate)
+		cs, assign, e = pruneKdjFeatDatRemote(fdk, fdvs, nprec, pruneRate, "")
 	case conf.AUTO:
-		if len(fdvs) <= LOCAL_PRUNE_THRESHOLD {
-			fdvs = pruneKdjFeatDatLocal(fdk, fdvs, nprec, pruneRate)
+		if len(fdvs) <= conf.Args().Kdjv.LocalPruneThreshold {
+			cs, assign = pruneKdjFeatDatLocal(fdk, fdvs, nprec, pruneRate)
 		} else {
 			_, h := rpc.Available(false)
 			if h > 0 {
-				fdvs, e = pruneKdjFeatDatRemote(fdk, fdvs, nprec, pruneRate)
+				cs, assign, e = pruneKdjFeatDatRemote(fdk, fdvs, nprec, pruneRate, "")
 			} else {
 				logr.Warn("no available rpc servers, using local power")
-				fdvs = pruneKdjFeatDatLocal(fdk, fdvs, nprec, pruneRate)
+				cs, assign = pruneKdjFeatDatLocal(fdk, fdvs, nprec, pruneRate)
 			}
 		}
 	}
 	if e != nil {
 		logr.Warnf("remote processing failed, fall back to local power\n%+v", e)
-		fdvs = pruneKdjFeatDatLocal(fdk, fdvs, nprec, pruneRate)
+		cs, assign = pruneKdjFeatDatLocal(fdk, fdvs, nprec, pruneRate)
 	}
-	return fdvs
+	return
 }
 
-func pruneKdjFeatDatRemote(fdk *fdKey, fdvs []*model.KDJfdView, nprec float64, pruneRate float64) ([]*model.KDJfdView, error) {
+//pruneKdjFeatDatRemote clusters the feature data using rpc service, on the specified server
+// if addr is not empty.
+func pruneKdjFeatDatRemote(fdk *fdKey, fdvs []*model.KDJfdView, nprec float64, pruneRate float64,
+	addr string) ([]*model.KDJfdView, []int, error) {
 	stp := time.Now()
 	bfc := len(fdvs)
-	req := &rm.KdjPruneReq{fdk.ID(), nprec, pruneRate, fdvs}
-	var rep *rm.KdjPruneRep
-	e := rpc.Call("IndcScorer.PruneKdj", req, &rep, 3)
+	req := &model.KdjPruneReq{fdk.ID(), nprec, pruneRate, fdvs, conf.Args().Kdjv.SimMetric, conf.Args().Kdjv.DtwWindow}
+	var (
+		rep *model.KdjPruneRep
+		e   error
+	)
+	if addr == "" {
+		e = rpc.Call("IndcScorer.PruneKdj", req, &rep, 3)
+	} else {
+		e = rpc.CallOn(addr, "IndcScorer.PruneKdj", req, &rep)
+	}
 	if e != nil {
 		log.Printf("RPC service IndcScorer.PruneKdj failed\n%+v", e)
-		return fdvs, e
+		return nil, nil, e
 	}
-	fdvs = rep.Data
-	prate := float64(bfc-len(fdvs)) / float64(bfc) * 100
+	if len(rep.Assign) != bfc {
+		return nil, nil, errors.Errorf("%s invalid cluster assignment from rpc server, expected %d, got %d",
+			fdk.ID(), bfc, len(rep.Assign))
+	}
+	prate := float64(bfc-len(rep.Data)) / float64(bfc) * 100
 	logr.Debugf("%s pruned(remote), before: %d, after: %d, rate: %.2f%% time: %.2f",
-		fdk.ID(), bfc, len(fdvs), prate, time.Since(stp).Seconds())
-	return fdvs, nil
+		fdk.ID(), bfc, len(rep.Data), prate, time.Since(stp).Seconds())
+	return rep.Data, rep.Assign, nil
+}
+
+func pruneKdjFeatDatLocal(fdk *fdKey, fdvs []*model.KDJfdView, nprec float64, pruneRate float64) (
+	[]*model.KDJfdView, []int) {
+	return indc.ClusterKdjFd(fdk.ID(), fdvs, nprec, pruneRate, kdjFdSim())
+}
+
+//kdjFdSim returns the configured similarity measure of kdj feature data.
+func kdjFdSim() indc.KdjSim {
+	sim, e := indc.KdjSimOf(conf.Args().Kdjv.SimMetric, conf.Args().Kdjv.DtwWindow)
+	util.CheckErr(e, "invalid kdjv similarity metric")
+	return sim
 }
 
-func pruneKdjFeatDatLocal(fdk *fdKey, fdvs []*model.KDJfdView, nprec float64, pruneRate float64) []*model.KDJfdView {
-	for prate, p := 1.0, 0; prate > pruneRate; p++ {
-		stp := time.Now()
-		bfc := len(fdvs)
-		fdvs = passKdjFeatDatPrune(fdvs, nprec)
-		prate = float64(bfc-len(fdvs)) / float64(bfc)
-		logr.Debugf("%s pass %d, before: %d, after: %d, rate: %.2f%% time: %.2f",
-			fdk.ID(), p+1, bfc, len(fdvs), prate*100, time.Since(stp).Seconds())
+//UpdateKdjFeatDat derives a new feature data version from the latest ready one, or from the unversioned
+// feature data if there's none, leaving the parent intact. Members whose raw feature data have been purged
+// or re-sampled are withdrawn from their clusters, and raw kdj feature data not yet clustered are assigned
+// to the most similar existing cluster of the same group, or made new clusters, see indc.AssignKdjFd.
+// Groups without any cluster are clustered from scratch. Weights of all clusters are renewed afterwards.
+// Returns the new version.
+func UpdateKdjFeatDat(prec float64) (ver string) {
+	st := time.Now()
+	params := map[string]interface{}{"prec": prec, "prune_rate": conf.Args().Kdjv.PruneRate,
+		"sim_metric": conf.Args().Kdjv.SimMetric, "dtw_window": conf.Args().Kdjv.DtwWindow}
+	RecordParams("KDJ_UPDATE", params)
+	parent := LatestFeatVer("KDJ", FEAT_VER_FD, FEAT_VER_READY)
+	ver = NewFeatVer("KDJ", FEAT_VER_FD, parent, params)
+	copyKdjFd(parent, ver)
+	smpVer := RawKdjSmpVer()
+	logr.Debugf("%d stale members withdrawn from %s", withdrawKdjFdMbrs(ver, smpVer), ver)
+	var fdks []*fdKey
+	_, e := dbmap.Select(&fdks, "select cytp, bysl, smp_num, count(*) count from "+
+		"indc_feat_raw where indc = 'KDJ' and ver = ? group by cytp, bysl, smp_num order by count", smpVer)
+	if e != nil && "sql: no rows in result set" != e.Error() {
+		log.Panicln("failed to query indc_feat_raw", e)
 	}
-	return fdvs
+	var wg sync.WaitGroup
+	chfdk := make(chan *fdKey, JOB_CAPACITY)
+	var added int32
+	for i := 0; i < int(math.Max(1, float64(runtime.NumCPU())*0.7)); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for fdk := range chfdk {
+				atomic.AddInt32(&added, int32(updateKdjFdk(ver, smpVer, fdk, prec)))
+			}
+		}()
+	}
+	for _, k := range fdks {
+		chfdk <- k
+	}
+	close(chfdk)
+	wg.Wait()
+	_, e = dbmap.Exec("update indc_feat f join (select ver, indc, cytp, bysl, smp_num, sum(fd_num) total "+
+		"from indc_feat where ver = ? group by ver, indc, cytp, bysl, smp_num) t "+
+		"using (ver, indc, cytp, bysl, smp_num) set f.weight = f.fd_num / t.total", ver)
+	util.CheckErr(e, "failed to renew weights of indc_feat")
+	evictKdjFd(ver)
+	ReadyFeatVer(ver, smpVer)
+	PurgeKdjFdVers(conf.Args().Kdjv.KeepVers)
+	log.Printf("kdj feature data %s derived from %q, new samples: %d, time: %.2f", ver, parent, added,
+		time.Since(st).Seconds())
+	return
 }
 
-func saveKdjFd(fdvs []*model.KDJfdView) {
+//copyKdjFd copies the clusters and members of the parent version to the new version.
+func copyKdjFd(parent, ver string) {
+	tran, e := dbmap.Begin()
+	util.CheckErr(e, "failed to begin new transaction")
+	stmts := []string{
+		"insert into indc_feat (ver,indc,fid,cytp,bysl,smp_num,fd_num,weight,remarks,src_code,src_fid,udate,utime) " +
+			"select ?,indc,fid,cytp,bysl,smp_num,fd_num,weight,remarks,src_code,src_fid,udate,utime " +
+			"from indc_feat where ver = ? and indc = 'KDJ'",
+		"insert into kdj_feat_dat (ver,fid,seq,k,d,j,udate,utime) select ?,k.fid,k.seq,k.k,k.d,k.j,k.udate," +
+			"k.utime from kdj_feat_dat k join indc_feat f using (ver, fid) where f.ver = ? and f.indc = 'KDJ'",
+		"insert into indc_feat_mbr (ver,indc,code,rfid,fid,cytp,bysl,smp_num,udate,utime) " +
+			"select ?,indc,code,rfid,fid,cytp,bysl,smp_num,udate,utime from indc_feat_mbr " +
+			"where ver = ? and indc = 'KDJ'",
+	}
+	for _, stmt := range stmts {
+		if _, e = tran.Exec(stmt, ver, parent); e != nil {
+			tran.Rollback()
+			log.Panicf("failed to copy kdj feature data %s to %s: %+v", parent, ver, e)
+		}
+	}
+	tran.Commit()
+}
+
+//withdrawKdjFdMbrs withdraws members of the version whose raw feature data no longer exist in the sampling
+// version or have been re-sampled after assignment, see saveIndcFt. Clusters left empty are removed.
+// Returns the number of members withdrawn.
+func withdrawKdjFdMbrs(ver, smpVer string) (n int64) {
+	tran, e := dbmap.Begin()
+	util.CheckErr(e, "failed to begin new transaction")
+	stale := "from indc_feat_mbr m where m.ver = ? and m.indc = 'KDJ' and not exists (select 1 from " +
+		"indc_feat_raw r where r.ver = ? and r.indc = m.indc and r.code = m.code and r.fid = m.rfid and " +
+		"concat(r.udate, r.utime) <= concat(m.udate, m.utime))"
+	stmts := []string{
+		"update indc_feat f join (select m.fid, count(*) c " + stale + " group by m.fid) s using (fid) " +
+			"set f.fd_num = f.fd_num - s.c where f.ver = ? and f.indc = 'KDJ'",
+		"delete m " + stale,
+		"delete k from kdj_feat_dat k join indc_feat f using (ver, fid) where f.ver = ? and f.indc = 'KDJ' " +
+			"and f.fd_num <= 0",
+		"delete from indc_feat where ver = ? and indc = 'KDJ' and fd_num <= 0",
+	}
+	for i, stmt := range stmts {
+		args := []interface{}{ver}
+		if i < 2 {
+			args = append(args, smpVer)
+		}
+		if i == 0 {
+			args = append(args, ver)
+		}
+		r, e := tran.Exec(stmt, args...)
+		if e != nil {
+			tran.Rollback()
+			log.Panicf("failed to withdraw stale members of kdj feature data %s: %+v", ver, e)
+		}
+		if i == 1 {
+			n, _ = r.RowsAffected()
+		}
+	}
+	tran.Commit()
+	return
+}
+
+//updateKdjFdk assigns the raw feature data of the group in the sampling version not yet clustered in the version,
+// returns the number of samples assigned.
+func updateKdjFdk(ver, smpVer string, fdk *fdKey, prec float64) int {
+	cytp := model.CYTP(fdk.Cytp)
+	fdrvs := queryKdjFeatDatRaw("KDJ_FEAT_DAT_RAW_UNASSIGNED", smpVer, cytp, fdk.Bysl, fdk.SmpNum, ver)
+	if len(fdrvs) == 0 {
+		return 0
+	}
+	nprec := kdjFdPrec(fdk, prec)
+	mk := model.KdjFdKey(ver, cytp, fdk.Bysl, fdk.SmpNum)
+	lock.Lock()
+	delete(kdjFdMap, mk)
+	delete(kdjFdrMap, kdjFdrKey(smpVer, fdk))
+	lock.Unlock()
+	cs := GetKdjFeatDat(ver, cytp, fdk.Bysl == "BY", fdk.SmpNum)
+	var assign []int
+	if len(cs) == 0 {
+		cs, assign = pruneKdjFeatDatLocal(fdk, convert2Fdvs(fdk, fdrvs), nprec, conf.Args().Kdjv.PruneRate)
+	} else {
+		bfc := len(cs)
+		cs, assign = indc.AssignKdjFd(cs, convert2Fdvs(fdk, fdrvs), nprec, kdjFdSim())
+		logr.Debugf("%s new samples: %d, new clusters: %d", mk, len(fdrvs), len(cs)-bfc)
+	}
+	weighKdjFd(cs)
+	saveKdjFd(ver, cs)
+	saveKdjFdMbr(ver, fdk, cs, assign, fdrvs)
+	lock.Lock()
+	delete(kdjFdMap, mk)
+	lock.Unlock()
+	return len(fdrvs)
+}
+
+//saveKdjFdMbr saves the cluster of each raw feature data in the version.
+func saveKdjFdMbr(ver string, fdk *fdKey, cs []*model.KDJfdView, assign []int, fdrvs []*model.KDJfdrView) {
+	if len(fdrvs) == 0 {
+		return
+	}
+	dt, tm := util.TimeStr()
+	tran, e := dbmap.Begin()
+	util.CheckErr(e, "failed to begin new transaction")
+	for bg := 0; bg < len(fdrvs); bg += JOB_CAPACITY {
+		ed := int(math.Min(float64(bg+JOB_CAPACITY), float64(len(fdrvs))))
+		valueStrings := make([]string, 0, ed-bg)
+		valueArgs := make([]interface{}, 0, (ed-bg)*10)
+		for i := bg; i < ed; i++ {
+			valueStrings = append(valueStrings, "(?, ?, ?, ?, ?, ?, ?, ?, ?, ?)")
+			valueArgs = append(valueArgs, ver, "KDJ", fdrvs[i].Code, fdrvs[i].Fid, cs[assign[i]].Fid,
+				fdk.Cytp, fdk.Bysl, fdk.SmpNum, dt, tm)
+		}
+		stmt := fmt.Sprintf("INSERT INTO indc_feat_mbr (ver,indc,code,rfid,fid,cytp,bysl,smp_num,udate,utime) "+
+			"VALUES %s on duplicate key update fid=values(fid),udate=values(udate),utime=values(utime)",
+			strings.Join(valueStrings, ","))
+		_, e = tran.Exec(stmt, valueArgs...)
+		if e != nil {
+			tran.Rollback()
+			log.Panicln("failed to bulk insert indc_feat_mbr", e)
+		}
+	}
+	tran.Commit()
+	metrics.RowsUpserted("indc_feat_mbr", len(fdrvs))
+}
+
+func saveKdjFd(ver string, fdvs []*model.KDJfdView) {
 	if len(fdvs) > 0 {
+		fdc := 0
 		valueStrings := make([]string, 0, len(fdvs))
-		valueArgs := make([]interface{}, 0, len(fdvs)*10)
+		valueArgs := make([]interface{}, 0, len(fdvs)*13)
 		dt, tm := util.TimeStr()
 		for _, f := range fdvs {
-			valueStrings = append(valueStrings, "(?, ?, ?, ?, ?, ?, ?, ?, ?, ?)")
+			valueStrings = append(valueStrings, "(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)")
+			valueArgs = append(valueArgs, ver)
 			valueArgs = append(valueArgs, f.Indc)
 			valueArgs = append(valueArgs, f.Fid)
 			valueArgs = append(valueArgs, f.Cytp)
@@ -790,12 +1106,15 @@ func saveKdjFd(fdvs []*model.KDJfdView) {
 			valueArgs = append(valueArgs, f.FdNum)
 			valueArgs = append(valueArgs, f.Weight)
 			valueArgs = append(valueArgs, f.Remarks)
+			valueArgs = append(valueArgs, f.SrcCode)
+			valueArgs = append(valueArgs, f.SrcFid)
 			valueArgs = append(valueArgs, dt)
 			valueArgs = append(valueArgs, tm)
 		}
-		stmt := fmt.Sprintf("INSERT INTO indc_feat (indc,fid,cytp,bysl,smp_num,fd_num,weight,remarks,"+
-			"udate,utime) VALUES %s on duplicate key update fid=values(fid),fd_num=values(fd_num),weight=values"+
-			"(weight),remarks=values(remarks),udate=values(udate),utime=values(utime)",
+		stmt := fmt.Sprintf("INSERT INTO indc_feat (ver,indc,fid,cytp,bysl,smp_num,fd_num,weight,remarks,"+
+			"src_code,src_fid,udate,utime) VALUES %s on duplicate key update fid=values(fid),fd_num=values(fd_num),"+
+			"weight=values(weight),remarks=values(remarks),src_code=values(src_code),src_fid=values(src_fid),"+
+			"udate=values(udate),utime=values(utime)",
 			strings.Join(valueStrings, ","))
 		tran, e := dbmap.Begin()
 		util.CheckErr(e, "failed to begin new transaction")
@@ -807,9 +1126,10 @@ func saveKdjFd(fdvs []*model.KDJfdView) {
 
 		for _, f := range fdvs {
 			valueStrings = make([]string, 0, f.SmpNum)
-			valueArgs = make([]interface{}, 0, f.SmpNum*7)
+			valueArgs = make([]interface{}, 0, f.SmpNum*8)
 			for i := 0; i < f.SmpNum; i++ {
-				valueStrings = append(valueStrings, "(?, ?, ?, ?, ?, ?, ?)")
+				valueStrings = append(valueStrings, "(?, ?, ?, ?, ?, ?, ?, ?)")
+				valueArgs = append(valueArgs, ver)
 				valueArgs = append(valueArgs, f.Fid)
 				valueArgs = append(valueArgs, i)
 				valueArgs = append(valueArgs, f.K[i])
@@ -818,7 +1138,7 @@ func saveKdjFd(fdvs []*model.KDJfdView) {
 				valueArgs = append(valueArgs, dt)
 				valueArgs = append(valueArgs, tm)
 			}
-			stmt = fmt.Sprintf("INSERT INTO kdj_feat_dat (fid,seq,k,d,j,"+
+			stmt = fmt.Sprintf("INSERT INTO kdj_feat_dat (ver,fid,seq,k,d,j,"+
 				"udate,utime) VALUES %s on duplicate key update k=values(k),d=values(d),"+
 				"j=values(j),udate=values(udate),utime=values(utime)",
 				strings.Join(valueStrings, ","))
@@ -827,49 +1147,14 @@ func saveKdjFd(fdvs []*model.KDJfdView) {
 				tran.Rollback()
 				log.Panicln("failed to bulk insert kdj_feat_dat", err)
 			}
+			fdc += f.SmpNum
 		}
 		tran.Commit()
+		metrics.RowsUpserted("indc_feat", len(fdvs))
+		metrics.RowsUpserted("kdj_feat_dat", fdc)
 	}
 }
 
-func passKdjFeatDatPrune(fdvs []*model.KDJfdView, prec float64) []*model.KDJfdView {
-	for i := 0; i < len(fdvs)-1; i++ {
-		f1 := fdvs[i]
-		pend := make([]*model.KDJfdView, 0, 16)
-		for j := i + 1; j < len(fdvs); {
-			f2 := fdvs[j]
-			d := CalcKdjDevi(f1.K, f1.D, f1.J, f2.K, f2.D, f2.J)
-			if d >= prec {
-				if j < len(fdvs)-1 {
-					fdvs = append(fdvs[:j], fdvs[j+1:]...)
-				} else {
-					fdvs = fdvs[:j]
-				}
-				pend = append(pend, f2)
-			} else {
-				j++
-			}
-		}
-		//logr.Debugf("%s-%s-%d found %d similar", fdk.Cytp, fdk.Bysl, fdk.SmpNum, len(pend))
-		for _, p := range pend {
-			mergeKdjFd(f1, p)
-		}
-	}
-	return fdvs
-}
-
-func mergeKdjFd(to, fr *model.KDJfdView) {
-	tofn := float64(to.FdNum)
-	frfn := float64(fr.FdNum)
-	deno := tofn + frfn
-	for i := 0; i < to.SmpNum; i++ {
-		to.K[i] = (to.K[i]*tofn + fr.K[i]*frfn) / deno
-		to.D[i] = (to.D[i]*tofn + fr.D[i]*frfn) / deno
-		to.J[i] = (to.J[i]*tofn + fr.J[i]*frfn) / deno
-	}
-	to.FdNum += fr.FdNum
-}
-
 func convert2Fdvs(key *fdKey, fdrvs []*model.KDJfdrView) []*model.KDJfdView {
 	fdvs := make([]*model.KDJfdView, len(fdrvs))
 	for i := 0; i < len(fdrvs); i++ {
@@ -884,6 +1169,8 @@ func convert2Fdvs(key *fdKey, fdrvs []*model.KDJfdrView) []*model.KDJfdView {
 		copy(fdv.J, fdrv.J)
 		fdv.FdNum = 1
 		fdv.Indc = "KDJ"
+		fdv.SrcCode = fdrv.Code
+		fdv.SrcFid = fdrv.Fid
 		fdv.Fid = fmt.Sprintf("%s", uuid.NewV1())
 		fdv.Cytp = model.CYTP(key.Cytp)
 		fdv.Bysl = key.Bysl
@@ -903,13 +1190,7 @@ func (f *fdKey) ID() string {
 	return fmt.Sprintf("%s-%s-%d", f.Cytp, f.Bysl, f.SmpNum)
 }
 
-func CalcKdjDevi(sk, sd, sj, tk, td, tj []float64) float64 {
-	kcc, e := util.Devi(sk, tk)
-	util.CheckErr(e, fmt.Sprintf("failed to calculate kcc: %+v, %+v", sk, tk))
-	dcc, e := util.Devi(sd, td)
-	util.CheckErr(e, fmt.Sprintf("failed to calculate dcc: %+v, %+v", sd, td))
-	jcc, e := util.Devi(sj, tj)
-	util.CheckErr(e, fmt.Sprintf("failed to calculate jcc: %+v, %+v", sj, tj))
-	scc := (kcc*1.0 + dcc*4.0 + jcc*5.0) / 10.0
-	return -0.001*math.Pow(scc, math.E) + 1
+//kdjFdrKey key of the raw feature data group of the sampling version in kdjFdrMap.
+func kdjFdrKey(smpVer string, f *fdKey) string {
+	return smpVer + ":" + f.ID()
 }
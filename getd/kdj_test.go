@@ -13,6 +13,8 @@ import (
 	"github.com/montanaflynn/stats"
 	"math"
 	"github.com/carusyte/stock/conf"
+	"github.com/carusyte/stock/indc"
+	"github.com/carusyte/stock/util"
 )
 
 func TestConcurrentModifySlice(t *testing.T) {
@@ -124,7 +126,7 @@ func prune(fdvs []*model.KDJfdrView) (r []*model.KDJfdrView) {
 				j++
 				continue
 			}
-			d := CalcKdjDevi(f1.K, f1.D, f1.J, f2.K, f2.D, f2.J)
+			d := indc.CalcKdjDevi(f1.K, f1.D, f1.J, f2.K, f2.D, f2.J)
 			if d >= 0.99 {
 				pend = append(pend, f2)
 				if j < len(fdvs)-1 {
@@ -209,22 +211,99 @@ func TestUUID(t *testing.T) {
 
 func TestPruneKdjFeatDat(t *testing.T) {
 	logrus.SetLevel(logrus.DebugLevel)
-	PruneKdjFeatDat(KDJ_FD_PRUNE_PREC, KDJ_PRUNE_RATE, true)
+	PruneKdjFeatDat(conf.Args().Kdjv.PrunePrec, conf.Args().Kdjv.PruneRate, true)
+}
+
+func TestUpdateKdjFeatDat(t *testing.T) {
+	logrus.SetLevel(logrus.DebugLevel)
+	parent := LatestFeatVer("KDJ", FEAT_VER_FD, FEAT_VER_READY)
+	ver := UpdateKdjFeatDat(conf.Args().Kdjv.PrunePrec)
+	if ver == parent {
+		t.Fatalf("expecting a new version derived from %s", parent)
+	}
+	p, e := dbmap.SelectStr("select parent from feat_ver where ver = ?", ver)
+	util.CheckErr(e, "failed to query parent of "+ver)
+	if p != parent {
+		t.Errorf("expecting parent %s of %s, got %s", parent, ver, p)
+	}
+	// FdNum of clusters must add up to the number of clustered raw samples
+	n, e := dbmap.SelectInt("select count(*) from indc_feat_mbr where ver = ? and indc = 'KDJ'", ver)
+	util.CheckErr(e, "failed to count indc_feat_mbr")
+	fdn, e := dbmap.SelectInt("select coalesce(sum(fd_num), 0) from indc_feat where ver = ? and indc = 'KDJ'",
+		ver)
+	util.CheckErr(e, "failed to sum fd_num of indc_feat")
+	if n != fdn {
+		t.Errorf("inconsistent cluster members, raw: %d, fd_num: %d", n, fdn)
+	}
+}
+
+func TestUpdateKdjFeatDatUnchanged(t *testing.T) {
+	logrus.SetLevel(logrus.DebugLevel)
+	ver := UpdateKdjFeatDat(conf.Args().Kdjv.PrunePrec)
+	code, e := dbmap.SelectStr("select code from indc_feat_mbr where ver = ? and indc = 'KDJ' limit 1", ver)
+	util.CheckErr(e, "failed to query member of "+ver)
+	// re-sampling without new data must not make members stale
+	for _, c := range []model.CYTP{model.DAY, model.WEEK, model.MONTH} {
+		SmpKdjFeat(code, c, KDJ_SMP_EXPVR, KDJ_SMP_MXRT, KDJ_SMP_MXHOLD)
+	}
+	nver := NewFeatVer("KDJ", FEAT_VER_FD, ver, nil)
+	defer DropFeatVer(nver)
+	copyKdjFd(ver, nver)
+	if n := withdrawKdjFdMbrs(nver, RawKdjSmpVer()); n != 0 {
+		t.Errorf("expecting no member withdrawn without new data, got %d", n)
+	}
+}
+
+func TestKeepKdjFtStamps(t *testing.T) {
+	pfeats := []*model.IndcFeatRaw{
+		{Fid: "DBY20180102", SmpDate: "2018-01-02", SmpNum: 2, Mark: 5, Tspan: 3, Udate: "2018-06-01", Utime: "10:00:00"},
+		{Fid: "DBY20180301", SmpDate: "2018-03-01", SmpNum: 1, Mark: 6, Tspan: 2, Udate: "2018-06-01", Utime: "10:00:00"},
+	}
+	pkfds := []*model.KDJfdRaw{
+		{Fid: "DBY20180102", Klid: 1, K: 10, D: 20, J: 30, Udate: "2018-06-01", Utime: "10:00:00"},
+		{Fid: "DBY20180102", Klid: 2, K: 11, D: 21, J: 31, Udate: "2018-06-01", Utime: "10:00:00"},
+		{Fid: "DBY20180301", Klid: 40, K: 50, D: 60, J: 70, Udate: "2018-06-01", Utime: "10:00:00"},
+	}
+	// the second sample is restated, the third is new
+	feats := []*model.IndcFeatRaw{
+		{Fid: "DBY20180102", SmpDate: "2018-01-02", SmpNum: 2, Mark: 5, Tspan: 3, Udate: "2018-07-01", Utime: "09:00:00"},
+		{Fid: "DBY20180301", SmpDate: "2018-03-01", SmpNum: 1, Mark: 6, Tspan: 2, Udate: "2018-07-01", Utime: "09:00:00"},
+		{Fid: "DBY20180501", SmpDate: "2018-05-01", SmpNum: 1, Mark: 7, Tspan: 2, Udate: "2018-07-01", Utime: "09:00:00"},
+	}
+	kfds := []*model.KDJfdRaw{
+		{Fid: "DBY20180102", Klid: 1, K: 10, D: 20, J: 30, Udate: "2018-07-01", Utime: "09:00:00"},
+		{Fid: "DBY20180102", Klid: 2, K: 11, D: 21, J: 31, Udate: "2018-07-01", Utime: "09:00:00"},
+		{Fid: "DBY20180301", Klid: 40, K: 50.5, D: 60, J: 70, Udate: "2018-07-01", Utime: "09:00:00"},
+		{Fid: "DBY20180501", Klid: 80, K: 50, D: 60, J: 70, Udate: "2018-07-01", Utime: "09:00:00"},
+	}
+	keepKdjFtStamps(pfeats, pkfds, feats, kfds)
+	exp := []string{"2018-06-01", "2018-07-01", "2018-07-01"}
+	for i, f := range feats {
+		if f.Udate != exp[i] {
+			t.Errorf("expecting %s for %s, got %s", exp[i], f.Fid, f.Udate)
+		}
+	}
+	exp = []string{"2018-06-01", "2018-06-01", "2018-07-01", "2018-07-01"}
+	for i, k := range kfds {
+		if k.Udate != exp[i] {
+			t.Errorf("expecting %s for %s %d, got %s", exp[i], k.Fid, k.Klid, k.Udate)
+		}
+	}
 }
 
 func TestPruneKdjFeatDatRemote(t *testing.T) {
 	st := time.Now()
 	fdk := &fdKey{"D", "BY", 19, 587}
 	fdrvs := GetKdjFeatDatRaw(model.DAY, true, 19)
-	nprec := KDJ_FD_PRUNE_PREC * (1 - 1./math.Pow(math.E*math.Pi, math.E) * math.Pow(float64(19-2),
-		1+1./(math.Sqrt2*math.Pi)))
+	nprec := kdjFdPrec(fdk, conf.Args().Kdjv.PrunePrec)
 	logrus.Debugf("pruning: %s size: %d, nprec: %.3f", fdk.ID(), len(fdrvs), nprec)
-	fdvs := convert2Fdvs(fdk, fdrvs)
-	fdvs = smartPruneKdjFeatDat(fdk, fdvs, nprec, KDJ_PRUNE_RATE, conf.REMOTE)
-	for _, fdv := range fdvs {
-		fdv.Weight = float64(fdv.FdNum) / float64(len(fdrvs))
-	}
-	saveKdjFd(fdvs)
+	fdvs, assign := smartPruneKdjFeatDat(fdk, convert2Fdvs(fdk, fdrvs), nprec, conf.Args().Kdjv.PruneRate, conf.REMOTE)
+	weighKdjFd(fdvs)
+	ver := NewFeatVer("KDJ", FEAT_VER_FD, "", map[string]interface{}{"prec": conf.Args().Kdjv.PrunePrec,
+		"prune_rate": conf.Args().Kdjv.PruneRate, "run_mode": conf.REMOTE})
+	saveKdjFd(ver, fdvs)
+	saveKdjFdMbr(ver, fdk, fdvs, assign, fdrvs)
+	ReadyFeatVer(ver, RawKdjSmpVer())
 	prate := float64(fdk.Count-len(fdvs)) / float64(fdk.Count) * 100
 	logrus.Debugf("%s pruned and saved, before: %d, after: %d, rate: %.2f%%    time: %.2f",
 		fdk.ID(), fdk.Count, len(fdvs), prate, time.Since(st).Seconds())
@@ -14,6 +14,7 @@ import (
 	"sort"
 	"time"
 	"database/sql"
+	"github.com/carusyte/stock/metrics"
 )
 
 //Get various types of kline data for the given stocks. Returns the stocks that have been successfully processed.
@@ -627,6 +628,7 @@ func binsert(quotes []*model.Quote, table string, lklid int) (c int) {
 		}
 		c = len(quotes)
 		tran.Commit()
+		metrics.RowsUpserted(table, c)
 	}
 	return
 }
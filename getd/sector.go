@@ -0,0 +1,304 @@
+package getd
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/carusyte/stock/metrics"
+	"github.com/carusyte/stock/model"
+	"github.com/carusyte/stock/util"
+)
+
+//SECTOR_IDX_BASE value of sector indices on the first day
+const SECTOR_IDX_BASE = 1000.
+
+//stdSectors default standard sector of the industries in basics, new industries not listed here fall into
+// model.SECTOR_OTHER until reclassified in sector_map.
+var stdSectors = map[string][]string{
+	"金融": {"银行", "证券", "保险", "多元金融"},
+	"地产": {"全国地产", "区域地产", "房产服务", "园区开发"},
+	"消费": {"白酒", "啤酒", "红黄酒", "软饮料", "食品", "乳制品", "家用电器", "家居用品", "服饰", "纺织", "百货", "超市连锁", "商贸代理",
+		"其他商业", "商品城", "电器连锁", "批发业", "汽车整车", "汽车配件", "汽车服务", "摩托车", "旅游景点", "旅游服务", "酒店餐饮", "影视音像",
+		"出版业", "文教休闲", "日用化工"},
+	"农业": {"农业综合", "种植业", "渔业", "林业", "饲料", "农药化肥"},
+	"医药": {"化学制药", "生物制药", "中成药", "医药商业", "医疗保健"},
+	"科技": {"软件服务", "互联网", "IT设备", "通信设备", "电信运营", "元器件", "半导体"},
+	"工业": {"电器仪表", "电气设备", "机械基件", "专用机械", "工程机械", "化工机械", "农用机械", "轻工机械", "纺织机械", "机床制造", "运输设备",
+		"船舶", "航空", "建筑工程", "装修装饰", "环境保护", "广告包装"},
+	"材料": {"水泥", "玻璃", "陶瓷", "其他建材", "钢加工", "普钢", "特种钢", "铝", "铜", "铅锌", "黄金", "小金属", "矿物制品", "化工原料",
+		"化纤", "染料涂料", "塑料", "橡胶", "造纸"},
+	"能源":   {"石油开采", "石油加工", "石油贸易", "煤炭开采", "焦炭加工"},
+	"公用事业": {"新型电力", "火力发电", "水力发电", "供气供热", "水务"},
+	"交通运输": {"公路", "路桥", "铁路", "港口", "空运", "机场", "水运", "仓储物流", "公共交通"},
+	"综合":   {"综合类"},
+}
+
+//UpdSectorMap adds the industries of basics not yet in sector_map with their default standard sector. Existing
+// rows are kept intact, so that industries can be reclassified by updating sector along with udate and utime,
+// upon which the sector indices are rebuilt in the next run of CalcSectorIdx.
+func UpdSectorMap() {
+	inds := make(map[string]string)
+	for s, is := range stdSectors {
+		for _, i := range is {
+			inds[i] = s
+		}
+	}
+	var newInds []string
+	_, e := dbmap.Select(&newInds, "select distinct industry from basics where industry is not null "+
+		"and industry <> '' and industry not in (select industry from sector_map)")
+	if e != nil {
+		if "sql: no rows in result set" == e.Error() {
+			return
+		}
+		log.Panicf("failed to query new industries: %+v", e)
+	}
+	if len(newInds) == 0 {
+		return
+	}
+	d, t := util.TimeStr()
+	valueStrings := make([]string, 0, len(newInds))
+	valueArgs := make([]interface{}, 0, len(newInds)*4)
+	for _, i := range newInds {
+		s, ok := inds[i]
+		if !ok {
+			s = model.SECTOR_OTHER
+			log.Printf("industry %s classified as %s by default", i, s)
+		}
+		valueStrings = append(valueStrings, "(?, ?, ?, ?)")
+		valueArgs = append(valueArgs, i, s, d, t)
+	}
+	_, e = dbmap.Exec(fmt.Sprintf("insert ignore into sector_map (industry, sector, udate, utime) values %s",
+		strings.Join(valueStrings, ",")), valueArgs...)
+	util.CheckErr(e, "failed to save sector_map")
+	metrics.RowsUpserted("sector_map", len(newInds))
+}
+
+//CalcSectorIdx continues the daily indices of each sector and industry of the current basics members from the
+// last stored day, see model.SectorIdx. Daily returns of the members come from varate of kline_d, and cap
+// weights are the circulating market cap as of the previous close, derived from the latest circulating
+// market cap in basics disregarding changes of circulating shares. Sector indices are rebuilt if sector_map
+// is updated since.
+func CalcSectorIdx() {
+	for _, lv := range []string{model.SECTOR_LV_SECTOR, model.SECTOR_LV_INDUSTRY} {
+		last, e := dbmap.SelectNullStr("select max(date) from sector_idx where level = ?", lv)
+		util.CheckErr(e, "failed to query last date of sector_idx "+lv)
+		if lv == model.SECTOR_LV_SECTOR && last.Valid {
+			n, e := dbmap.SelectInt("select count(*) from sector_map where concat(udate, utime) > "+
+				"(select max(concat(udate, utime)) from sector_idx where level = ?)", lv)
+			util.CheckErr(e, "failed to check sector_map updates")
+			if n > 0 {
+				log.Printf("sector_map updated, rebuilding sector indices")
+				_, e = dbmap.Exec("delete from sector_idx where level = ?", lv)
+				util.CheckErr(e, "failed to delete sector_idx "+lv)
+				last.Valid = false
+			}
+		}
+		// the last day is recalculated in case of members fetched afterwards
+		from := ""
+		var prev []*model.SectorIdx
+		if last.Valid {
+			from = last.String
+			_, e = dbmap.Select(&prev, "select * from sector_idx s where level = ? and date = (select max(date) "+
+				"from sector_idx where level = s.level and name = s.name and date < ?)", lv, from)
+			if e != nil && "sql: no rows in result set" != e.Error() {
+				log.Panicf("failed to query previous sector_idx %s: %+v", lv, e)
+			}
+		}
+		var rets []*model.SectorIdx
+		_, e = dbmap.Select(&rets, fmt.Sprintf("select ? level, t.name, t.date, count(*) members, "+
+			"avg(t.varate) ew_ret, sum(t.pcap * t.varate) / sum(t.pcap) cw_ret, sum(t.cap) mktcap from ("+
+			"select %s name, k.date, k.varate, b.circmarval / b.price * k.close / (1 + k.varate / 100) pcap, "+
+			"b.circmarval / b.price * k.close cap from kline_d k inner join basics b using (code) "+
+			"left join sector_map m on b.industry = m.industry where k.date >= ? and k.varate is not null "+
+			"and b.price > 0 and b.circmarval > 0) t group by t.name, t.date order by t.name, t.date",
+			sectorExpr(lv)), lv, model.SECTOR_OTHER, from)
+		if e != nil && "sql: no rows in result set" != e.Error() {
+			log.Panicf("failed to aggregate sector returns %s: %+v", lv, e)
+		}
+		saveSectorIdx(lv, ChainSectorIdx(prev, rets))
+	}
+}
+
+//ChainSectorIdx calculates the index values of rets, which are in ascending order of date for each name,
+// continuing from the values of prev. An index starts at SECTOR_IDX_BASE if not in prev.
+func ChainSectorIdx(prev, rets []*model.SectorIdx) []*model.SectorIdx {
+	last := make(map[string]*model.SectorIdx)
+	for _, p := range prev {
+		last[p.Name] = p
+	}
+	for _, r := range rets {
+		r.EwRet, r.CwRet, r.MktCap = round4(r.EwRet), round4(r.CwRet), round4(r.MktCap)
+		if p, ok := last[r.Name]; ok {
+			r.Ew = round4(p.Ew * (1 + r.EwRet/100))
+			r.Cw = round4(p.Cw * (1 + r.CwRet/100))
+		} else {
+			r.Ew, r.Cw = SECTOR_IDX_BASE, SECTOR_IDX_BASE
+		}
+		last[r.Name] = r
+	}
+	return rets
+}
+
+func round4(f float64) float64 {
+	return math.Floor(f*1e4+0.5) / 1e4
+}
+
+func saveSectorIdx(level string, idxs []*model.SectorIdx) {
+	d, t := util.TimeStr()
+	for i := 0; i < len(idxs); i += JOB_CAPACITY {
+		end := i + JOB_CAPACITY
+		if end > len(idxs) {
+			end = len(idxs)
+		}
+		valueStrings := make([]string, 0, end-i)
+		valueArgs := make([]interface{}, 0, (end-i)*11)
+		for _, x := range idxs[i:end] {
+			valueStrings = append(valueStrings, "(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)")
+			valueArgs = append(valueArgs, x.Level, x.Name, x.Date, x.Members, x.EwRet, x.CwRet, x.Ew, x.Cw,
+				x.MktCap, d, t)
+		}
+		stmt := fmt.Sprintf("insert into sector_idx (level, name, date, members, ew_ret, cw_ret, ew, cw, mktcap, "+
+			"udate, utime) values %s on duplicate key update members=values(members), ew_ret=values(ew_ret), "+
+			"cw_ret=values(cw_ret), ew=values(ew), cw=values(cw), mktcap=values(mktcap), udate=values(udate), "+
+			"utime=values(utime)", strings.Join(valueStrings, ","))
+		_, e := dbmap.Exec(stmt, valueArgs...)
+		util.CheckErr(e, "failed to save sector_idx "+level)
+		metrics.RowsUpserted("sector_idx", end-i)
+	}
+	log.Printf("%d sector_idx %s updated", len(idxs), level)
+}
+
+//GetSectorIdx returns the daily indices of the level between the dates inclusively, in ascending order of
+// date for each name. Empty name means all, and empty date means no bound.
+func GetSectorIdx(level, name, from, to string) (idxs []*model.SectorIdx) {
+	var (
+		conds = []string{"level = ?"}
+		args  = []interface{}{level}
+	)
+	if name != "" {
+		conds = append(conds, "name = ?")
+		args = append(args, name)
+	}
+	if from != "" {
+		conds = append(conds, "date >= ?")
+		args = append(args, from)
+	}
+	if to != "" {
+		conds = append(conds, "date <= ?")
+		args = append(args, to)
+	}
+	_, e := dbmap.Select(&idxs, fmt.Sprintf("select * from sector_idx where %s order by name, date",
+		strings.Join(conds, " and ")), args...)
+	if e != nil && "sql: no rows in result set" != e.Error() {
+		log.Panicf("failed to query sector_idx: %+v", e)
+	}
+	return
+}
+
+//GetSectorOf returns the sector or industry of the stocks by code, all stocks of basics if codes is empty.
+func GetSectorOf(level string, codes ...string) map[string]string {
+	query := fmt.Sprintf("select b.code, %s sector from basics b left join sector_map m "+
+		"on b.industry = m.industry", sectorExpr(level))
+	if len(codes) > 0 {
+		query += fmt.Sprintf(" where b.code in (%s)", util.Join(codes, ",", true))
+	}
+	var rows []*stockSector
+	_, e := dbmap.Select(&rows, query, model.SECTOR_OTHER)
+	if e != nil && "sql: no rows in result set" != e.Error() {
+		log.Panicf("failed to query sectors of stocks: %+v", e)
+	}
+	r := make(map[string]string, len(rows))
+	for _, row := range rows {
+		r[row.Code] = row.Sector
+	}
+	return r
+}
+
+type stockSector struct {
+	Code   string
+	Sector string
+}
+
+//sectorExpr sql expression of the sector or industry of basics b joined with sector_map m, taking a parameter
+// for the unclassified.
+func sectorExpr(level string) string {
+	if level == model.SECTOR_LV_INDUSTRY {
+		return "ifnull(nullif(b.industry, ''), ?)"
+	}
+	return "ifnull(m.sector, ?)"
+}
+
+//SectorRotation ranks the sectors or industries of the level by relative strength over the last days against
+// the benchmark index, along with their ranks as of days ago, see SectorStrengths.
+func SectorRotation(level, bench string, days int) []*model.SectorStrength {
+	var quotes []*model.Quote
+	_, e := dbmap.Select(&quotes, "select * from (select code, date, klid, close from kline_d where code = ? "+
+		"order by klid desc limit ?) t order by klid", bench, days*2+1)
+	if e != nil && "sql: no rows in result set" != e.Error() {
+		log.Panicf("failed to query kline_d of %s: %+v", bench, e)
+	}
+	if len(quotes) < days+1 {
+		log.Printf("insufficient kline_d of benchmark %s: %d", bench, len(quotes))
+		return nil
+	}
+	return SectorStrengths(GetSectorIdx(level, "", quotes[0].Date, ""), quotes, days)
+}
+
+//SectorStrengths ranks the sector indices by relative strength over days as of the last of bench quotes, which
+// are in ascending order and span at least days+1 trading days. Previous ranks are evaluated as of days ago if
+// bench spans 2*days+1 trading days. Sectors without index on the last day are left out.
+func SectorStrengths(idxs []*model.SectorIdx, bench []*model.Quote, days int) (ss []*model.SectorStrength) {
+	if days <= 0 || len(bench) < days+1 {
+		return
+	}
+	byName := make(map[string][]*model.SectorIdx)
+	var names []string
+	for _, x := range idxs {
+		if _, ok := byName[x.Name]; !ok {
+			names = append(names, x.Name)
+		}
+		byName[x.Name] = append(byName[x.Name], x)
+	}
+	end := len(bench) - 1
+	ss = rankStrengths(byName, names, bench, end-days, end)
+	if end-2*days >= 0 {
+		prev := make(map[string]int)
+		for _, s := range rankStrengths(byName, names, bench, end-2*days, end-days) {
+			prev[s.Name] = s.Rank
+		}
+		for _, s := range ss {
+			if r, ok := prev[s.Name]; ok {
+				s.PrevRank = r
+				s.Shift = r - s.Rank
+			}
+		}
+	}
+	return
+}
+
+func rankStrengths(byName map[string][]*model.SectorIdx, names []string, bench []*model.Quote,
+	from, to int) (ss []*model.SectorStrength) {
+	fd, td := bench[from].Date, bench[to].Date
+	bret := (bench[to].Close/bench[from].Close - 1) * 100
+	for _, n := range names {
+		xs := byName[n]
+		t := sort.Search(len(xs), func(i int) bool { return xs[i].Date > td }) - 1
+		f := sort.Search(len(xs), func(i int) bool { return xs[i].Date > fd }) - 1
+		if t < 0 || xs[t].Date != td || f < 0 {
+			continue
+		}
+		ret := (xs[t].Cw/xs[f].Cw - 1) * 100
+		ss = append(ss, &model.SectorStrength{Level: xs[t].Level, Name: n, Date: td, Days: to - from, Ret: ret,
+			EwRet: (xs[t].Ew/xs[f].Ew - 1) * 100, BenchRet: bret, RS: ret - bret})
+	}
+	sort.SliceStable(ss, func(i, j int) bool {
+		return ss[i].RS > ss[j].RS
+	})
+	for i, s := range ss {
+		s.Rank = i + 1
+	}
+	return
+}
@@ -0,0 +1,59 @@
+package getd
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/carusyte/stock/model"
+)
+
+func TestChainSectorIdx(t *testing.T) {
+	prev := []*model.SectorIdx{{Name: "金融", Date: "2018-01-02", Ew: 1100, Cw: 1200}}
+	rets := []*model.SectorIdx{
+		{Name: "医药", Date: "2018-01-03", EwRet: 5, CwRet: 3},
+		{Name: "医药", Date: "2018-01-04", EwRet: 10, CwRet: -10},
+		{Name: "金融", Date: "2018-01-03", EwRet: -10, CwRet: 5},
+	}
+	idxs := ChainSectorIdx(prev, rets)
+	exp := []string{"1000.00/1000.00", "1100.00/900.00", "990.00/1260.00"}
+	for i, x := range idxs {
+		if s := fmt.Sprintf("%.2f/%.2f", x.Ew, x.Cw); s != exp[i] {
+			t.Errorf("expecting %s for %s on %s, got %s", exp[i], x.Name, x.Date, s)
+		}
+	}
+}
+
+func TestSectorStrengths(t *testing.T) {
+	var bench []*model.Quote
+	for i, c := range []float64{100, 100, 110, 110, 121} {
+		bench = append(bench, &model.Quote{Code: "sh000300", Klid: i, Date: fmt.Sprintf("2018-01-0%d", i+1),
+			Close: c})
+	}
+	var idxs []*model.SectorIdx
+	for n, cws := range map[string][]float64{
+		"A": {1000, 1000, 1200, 1200, 1200},
+		"B": {1000, 1000, 1000, 1100, 1320},
+		"C": {0, 0, 1000, 1000, 1050},
+	} {
+		for i, cw := range cws {
+			if cw > 0 {
+				idxs = append(idxs, &model.SectorIdx{Level: model.SECTOR_LV_SECTOR, Name: n, Date: bench[i].Date,
+					Ew: cw, Cw: cw})
+			}
+		}
+	}
+	ss := SectorStrengths(idxs, bench, 2)
+	if len(ss) != 3 {
+		t.Fatalf("expecting 3 sectors, got %d", len(ss))
+	}
+	// bench 10% over the last 2 days, A 0%, B 32%, C 5%; 2 days earlier A 20%, B 0%, C n/a
+	exp := []string{"B/22.00/1/2/1", "C/-5.00/2/0/0", "A/-10.00/3/1/-2"}
+	for i, s := range ss {
+		if r := fmt.Sprintf("%s/%.2f/%d/%d/%d", s.Name, s.RS, s.Rank, s.PrevRank, s.Shift); r != exp[i] {
+			t.Errorf("expecting %s, got %s", exp[i], r)
+		}
+	}
+	if ss := SectorStrengths(idxs, bench, 4); len(ss) != 2 || ss[0].Name != "B" || ss[0].PrevRank != 0 {
+		t.Errorf("unexpected strengths over 4 days: %+v", ss)
+	}
+}
@@ -3,6 +3,7 @@ package getd
 import (
 	"fmt"
 	"github.com/PuerkitoBio/goquery"
+	"github.com/carusyte/stock/metrics"
 	"github.com/carusyte/stock/model"
 	"github.com/carusyte/stock/util"
 	"golang.org/x/text/encoding/simplifiedchinese"
@@ -196,6 +197,7 @@ func overwrite(allstk []*model.Stock) {
 			log.Panicf("failed to bulk update basics %d\n%+v", len(allstk), e)
 		}
 		tran.Commit()
+		metrics.RowsUpserted("basics", len(allstk))
 		log.Printf("%d stocks info overwrite to basics", len(allstk))
 	}
 }
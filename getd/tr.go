@@ -0,0 +1,196 @@
+package getd
+
+import (
+	"fmt"
+	"log"
+	"runtime"
+	"strings"
+	"sync"
+
+	"github.com/carusyte/stock/metrics"
+	"github.com/carusyte/stock/model"
+	"github.com/carusyte/stock/util"
+)
+
+//CalcTotalReturn updates the daily total return index of the stocks and indices, see TotalReturn. Stocks are
+// based on non-reinstated klines with xdxr, indices on plain daily klines. Returns the ones updated, a failing
+// one doesn't hold back the rest.
+func CalcTotalReturn(stocks *model.Stocks) (rstks *model.Stocks) {
+	log.Println("calculating total return...")
+	idxlst, e := GetIdxLst()
+	util.CheckErr(e, "failed to query idxlst")
+	isIdx := make(map[string]bool)
+	for _, idx := range idxlst {
+		isIdx[idx.Code] = true
+	}
+	var wg sync.WaitGroup
+	chstk := make(chan *model.Stock, JOB_CAPACITY)
+	chrstk := make(chan *model.Stock, JOB_CAPACITY)
+	rstks = new(model.Stocks)
+	wgr := collect(rstks, chrstk)
+	for i := 0; i < int(float64(runtime.NumCPU())*0.7); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for s := range chstk {
+				if tryStock(s.Code, "calculate total return", func() {
+					calcTotalReturn(s.Code, isIdx[s.Code])
+				}) {
+					chrstk <- s
+				}
+			}
+		}()
+	}
+	for _, s := range stocks.List {
+		chstk <- s
+	}
+	close(chstk)
+	wg.Wait()
+	close(chrstk)
+	wgr.Wait()
+	log.Printf("%d total return updated", rstks.Size())
+	return
+}
+
+//calcTotalReturn continues the total return index from the last stored day, or rebuilds it if xdxr
+// up to that day has been updated since.
+func calcTotalReturn(code string, idx bool) {
+	var last *model.TotalReturn
+	e := dbmap.SelectOne(&last, "select * from kline_d_tr where code = ? order by klid desc limit 1", code)
+	if e != nil {
+		if "sql: no rows in result set" != e.Error() {
+			log.Panicf("%s failed to query last total return: %+v", code, e)
+		}
+		last = nil
+	}
+	if last != nil && !idx {
+		n, e := dbmap.SelectInt("select count(*) from xdxr where code = ? and xdxr_date <= ? "+
+			"and concat(udate, utime) > ?", code, last.Date, last.Udate+last.Utime)
+		util.CheckErr(e, code+" failed to check xdxr updates")
+		if n > 0 {
+			log.Printf("%s xdxr updated, rebuilding total return", code)
+			_, e = dbmap.Exec("delete from kline_d_tr where code = ?", code)
+			util.CheckErr(e, code+" failed to purge total return")
+			last = nil
+		}
+	}
+	tab, from := model.KLINE_DAY_NR, -1
+	if idx {
+		tab = model.KLINE_DAY
+	}
+	if last != nil {
+		from = last.Klid
+	}
+	var quotes []*model.Quote
+	_, e = dbmap.Select(&quotes, fmt.Sprintf("select code, date, klid, close from %s where code = ? "+
+		"and klid > ? order by klid", tab), code, from)
+	util.CheckErr(e, fmt.Sprintf("%s failed to query %s", code, tab))
+	if len(quotes) == 0 {
+		return
+	}
+	var xdxrs []*model.Xdxr
+	if !idx {
+		sdate := ""
+		if last != nil {
+			sdate = last.Date
+		}
+		_, e = dbmap.Select(&xdxrs, "select code, idx, divi, divi_atx as DiviAtx, shares_allot as SharesAllot, "+
+			"shares_cvt as SharesCvt, xdxr_date from xdxr where code = ? and xdxr_date > ? "+
+			"and (divi > 0 or shares_allot > 0 or shares_cvt > 0) order by xdxr_date", code, sdate)
+		if e != nil && "sql: no rows in result set" != e.Error() {
+			log.Panicf("%s failed to query xdxr: %+v", code, e)
+		}
+	}
+	saveTotalReturn(TotalReturn(quotes, xdxrs, last))
+}
+
+//TotalReturn calculates daily total return index of the quotes in ascending order, continuing from the last
+// one if not nil. Cash dividends are reinvested at close of the ex-date, or the first trading day after if
+// suspended on ex-date. Dividends are per share held before the share distribution of the same event.
+// After-tax dividend falls back to pre-tax if not available.
+func TotalReturn(quotes []*model.Quote, xdxrs []*model.Xdxr, last *model.TotalReturn) (trs []*model.TotalReturn) {
+	n, natx := 1., 1.
+	if last != nil && last.Close > 0 {
+		n, natx = last.Tri/last.Close, last.TriAtx/last.Close
+	}
+	x := 0
+	if last == nil && len(quotes) > 0 {
+		// events up to the first day are priced in already
+		for ; x < len(xdxrs) && xdxrs[x].XdxrDate.String <= quotes[0].Date; x++ {
+		}
+	}
+	for _, q := range quotes {
+		tr := &model.TotalReturn{Code: q.Code, Date: q.Date, Klid: q.Klid, Close: q.Close, Ratio: 1}
+		for ; x < len(xdxrs) && xdxrs[x].XdxrDate.String <= q.Date; x++ {
+			xd := xdxrs[x]
+			divi := xd.Divi.Float64 / 10
+			diviAtx := divi
+			if xd.DiviAtx.Valid {
+				diviAtx = xd.DiviAtx.Float64 / 10
+			}
+			ratio := 1 + (xd.SharesAllot.Float64+xd.SharesCvt.Float64)/10
+			tr.Divi += divi * tr.Ratio
+			tr.DiviAtx += diviAtx * tr.Ratio
+			tr.Ratio *= ratio
+		}
+		if q.Close > 0 {
+			n = n*tr.Ratio + n*tr.Divi/q.Close
+			natx = natx*tr.Ratio + natx*tr.DiviAtx/q.Close
+		}
+		tr.Tri, tr.TriAtx = n*q.Close, natx*q.Close
+		trs = append(trs, tr)
+	}
+	return
+}
+
+func saveTotalReturn(trs []*model.TotalReturn) {
+	if len(trs) == 0 {
+		return
+	}
+	code := trs[0].Code
+	d, t := util.TimeStr()
+	for i := 0; i < len(trs); i += JOB_CAPACITY {
+		end := i + JOB_CAPACITY
+		if end > len(trs) {
+			end = len(trs)
+		}
+		valueStrings := make([]string, 0, end-i)
+		valueArgs := make([]interface{}, 0, (end-i)*11)
+		for _, tr := range trs[i:end] {
+			valueStrings = append(valueStrings, "(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)")
+			valueArgs = append(valueArgs, tr.Code, tr.Date, tr.Klid, tr.Close, tr.Divi, tr.DiviAtx, tr.Ratio,
+				tr.Tri, tr.TriAtx, d, t)
+		}
+		stmt := fmt.Sprintf("insert into kline_d_tr (code, date, klid, close, divi, divi_atx, ratio, tri, "+
+			"tri_atx, udate, utime) values %s on duplicate key update date=values(date), close=values(close), "+
+			"divi=values(divi), divi_atx=values(divi_atx), ratio=values(ratio), tri=values(tri), "+
+			"tri_atx=values(tri_atx), udate=values(udate), utime=values(utime)",
+			strings.Join(valueStrings, ","))
+		_, e := dbmap.Exec(stmt, valueArgs...)
+		util.CheckErr(e, code+" failed to save total return")
+		metrics.RowsUpserted("kline_d_tr", end-i)
+	}
+}
+
+//GetTotalReturn returns the total return index of the stock between the dates inclusively, in ascending order.
+// Empty date means no bound.
+func GetTotalReturn(code, from, to string) (trs []*model.TotalReturn) {
+	var (
+		conds = []string{"code = ?"}
+		args  = []interface{}{code}
+	)
+	if from != "" {
+		conds = append(conds, "date >= ?")
+		args = append(args, from)
+	}
+	if to != "" {
+		conds = append(conds, "date <= ?")
+		args = append(args, to)
+	}
+	_, e := dbmap.Select(&trs, fmt.Sprintf("select * from kline_d_tr where %s order by klid",
+		strings.Join(conds, " and ")), args...)
+	if e != nil && "sql: no rows in result set" != e.Error() {
+		log.Panicf("%s failed to query total return: %+v", code, e)
+	}
+	return
+}
@@ -0,0 +1,42 @@
+package getd
+
+import (
+	"database/sql"
+	"fmt"
+	"testing"
+
+	"github.com/carusyte/stock/model"
+)
+
+func TestTotalReturn(t *testing.T) {
+	closes := []float64{10, 10, 9, 9}
+	quotes := make([]*model.Quote, len(closes))
+	for i, c := range closes {
+		quotes[i] = &model.Quote{Code: "600000", Klid: i, Date: fmt.Sprintf("2018-06-%02d", i+1), Close: c}
+	}
+	// 10 cash per 10 shares, 9 after tax, plus 5 bonus shares, ex-date on a suspended day
+	xdxrs := []*model.Xdxr{{Code: "600000", Idx: 1, XdxrDate: sql.NullString{String: "2018-06-03", Valid: true},
+		Divi: sql.NullFloat64{Float64: 10, Valid: true}, DiviAtx: sql.NullFloat64{Float64: 9, Valid: true},
+		SharesAllot: sql.NullFloat64{Float64: 5, Valid: true}}}
+	quotes[2].Date = "2018-06-04"
+	quotes[3].Date = "2018-06-05"
+	trs := TotalReturn(quotes, xdxrs, nil)
+	exp := []string{"10.00/10.00", "10.00/10.00", "14.50/14.40", "14.50/14.40"}
+	for i, tr := range trs {
+		if s := fmt.Sprintf("%.2f/%.2f", tr.Tri, tr.TriAtx); s != exp[i] {
+			t.Errorf("expecting %s on %s, got %s", exp[i], tr.Date, s)
+		}
+	}
+	if trs[2].Ratio != 1.5 || trs[2].Divi != 1 || trs[1].Ratio != 1 {
+		t.Errorf("unexpected ex-date: %+v", trs[2])
+	}
+	// continue from the second day
+	inc := TotalReturn(quotes[2:], xdxrs, trs[1])
+	if len(inc) != 2 || fmt.Sprintf("%.4f", inc[1].Tri) != fmt.Sprintf("%.4f", trs[3].Tri) {
+		t.Errorf("incremental result differs: %+v", inc)
+	}
+	// events up to the first day are priced in already
+	if trs = TotalReturn(quotes[2:], xdxrs, nil); trs[0].Tri != 9 || trs[1].Tri != 9 {
+		t.Errorf("unexpected result of events before the first day: %+v", trs[1])
+	}
+}
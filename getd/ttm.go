@@ -0,0 +1,389 @@
+package getd
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"math"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/carusyte/stock/metrics"
+	"github.com/carusyte/stock/model"
+	"github.com/carusyte/stock/util"
+)
+
+//CalcValuation updates the single quarter and TTM financial metrics of the stocks, and then their daily
+// valuation, see FinTTM and Valuate. Indices of known universe are aggregated after the stocks, see IdxUniverse.
+// Returns the ones updated, a failing one doesn't hold back the rest.
+func CalcValuation(stocks *model.Stocks) (rstks *model.Stocks) {
+	log.Println("calculating valuation...")
+	idxlst, e := GetIdxLst()
+	util.CheckErr(e, "failed to query idxlst")
+	isIdx := make(map[string]bool)
+	for _, idx := range idxlst {
+		isIdx[idx.Code] = true
+	}
+	var wg sync.WaitGroup
+	chstk := make(chan *model.Stock, JOB_CAPACITY)
+	chrstk := make(chan *model.Stock, JOB_CAPACITY)
+	rstks = new(model.Stocks)
+	wgr := collect(rstks, chrstk)
+	for i := 0; i < int(float64(runtime.NumCPU())*0.7); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for s := range chstk {
+				if tryStock(s.Code, "calculate valuation", func() {
+					calcFinTTM(s.Code)
+					calcValuation(s.Code)
+				}) {
+					chrstk <- s
+				}
+			}
+		}()
+	}
+	var idxs []*model.Stock
+	for _, s := range stocks.List {
+		if isIdx[s.Code] {
+			idxs = append(idxs, s)
+			continue
+		}
+		chstk <- s
+	}
+	close(chstk)
+	wg.Wait()
+	for _, s := range idxs {
+		if _, ok := IdxUniverse[s.Code]; ok && !tryStock(s.Code, "aggregate index valuation", func() {
+			calcIdxValuation(s.Code)
+		}) {
+			continue
+		}
+		chrstk <- s
+	}
+	close(chrstk)
+	wgr.Wait()
+	log.Printf("%d valuation updated", rstks.Size())
+	return
+}
+
+func calcFinTTM(code string) {
+	var fins []*model.Finance
+	_, e := dbmap.Select(&fins, "select code, year, eps, np, gr, navps, roe, ocfps from finance where code = ? "+
+		"order by year", code)
+	if e != nil && "sql: no rows in result set" != e.Error() {
+		log.Panicf("%s failed to query finance: %+v", code, e)
+	}
+	ttms := FinTTM(fins)
+	var saved []*model.FinTTM
+	_, e = dbmap.Select(&saved, "select * from fin_ttm where code = ?", code)
+	util.CheckErr(e, code+" failed to query fin_ttm")
+	old := make(map[string]*model.FinTTM)
+	for _, f := range saved {
+		old[f.Year] = f
+	}
+	// only the changed ones are saved, whose update time tells the valuation to recalculate
+	var chg []*model.FinTTM
+	for _, f := range ttms {
+		if o, ok := old[f.Year]; !ok || !sameTTM(o, f) {
+			chg = append(chg, f)
+		}
+	}
+	if len(chg) == 0 {
+		return
+	}
+	d, t := util.TimeStr()
+	valueStrings := make([]string, 0, len(chg))
+	valueArgs := make([]interface{}, 0, len(chg)*16)
+	for _, f := range chg {
+		valueStrings = append(valueStrings, "(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)")
+		valueArgs = append(valueArgs, f.Code, f.Year, f.EpsQ, f.EpsTtm, f.NpQ, f.NpTtm, f.GrQ, f.GrTtm, f.RoeQ,
+			f.RoeTtm, f.OcfpsQ, f.OcfpsTtm, f.Navps, f.Shares, d, t)
+	}
+	stmt := fmt.Sprintf("insert into fin_ttm (code, year, eps_q, eps_ttm, np_q, np_ttm, gr_q, gr_ttm, roe_q, "+
+		"roe_ttm, ocfps_q, ocfps_ttm, navps, shares, udate, utime) values %s on duplicate key update "+
+		"eps_q=values(eps_q), eps_ttm=values(eps_ttm), np_q=values(np_q), np_ttm=values(np_ttm), "+
+		"gr_q=values(gr_q), gr_ttm=values(gr_ttm), roe_q=values(roe_q), roe_ttm=values(roe_ttm), "+
+		"ocfps_q=values(ocfps_q), ocfps_ttm=values(ocfps_ttm), navps=values(navps), shares=values(shares), "+
+		"udate=values(udate), utime=values(utime)", strings.Join(valueStrings, ","))
+	_, e = dbmap.Exec(stmt, valueArgs...)
+	util.CheckErr(e, code+" failed to save fin_ttm")
+	metrics.RowsUpserted("fin_ttm", len(chg))
+}
+
+func sameTTM(a, b *model.FinTTM) bool {
+	return a.EpsQ == b.EpsQ && a.EpsTtm == b.EpsTtm && a.NpQ == b.NpQ && a.NpTtm == b.NpTtm && a.GrQ == b.GrQ &&
+		a.GrTtm == b.GrTtm && a.RoeQ == b.RoeQ && a.RoeTtm == b.RoeTtm && a.OcfpsQ == b.OcfpsQ &&
+		a.OcfpsTtm == b.OcfpsTtm && a.Navps == b.Navps && a.Shares == b.Shares
+}
+
+//FinTTM derives single quarter and TTM metrics from the year-to-date finance reports. Single quarter is the
+// difference from the previous quarter of the same year, TTM is the year-to-date plus the last annual report
+// less the same period of last year. Metrics lacking any of the reports required are invalid.
+func FinTTM(fins []*model.Finance) (ttms []*model.FinTTM) {
+	byYear := make(map[string]*model.Finance)
+	for _, f := range fins {
+		byYear[f.Year] = f
+	}
+	for _, f := range fins {
+		y, q := reportQuarter(f.Year)
+		if q == 0 {
+			continue
+		}
+		prev, annual, last := byYear[periodEnd(y, q-1)], byYear[periodEnd(y-1, 4)], byYear[periodEnd(y-1, q)]
+		t := &model.FinTTM{Code: f.Code, Year: f.Year, Navps: f.Navps}
+		metric := func(get func(f *model.Finance) sql.NullFloat64) (sq, ttm sql.NullFloat64) {
+			v := get(f)
+			if !v.Valid {
+				return
+			}
+			switch {
+			case q == 1:
+				sq = v
+			case prev != nil && get(prev).Valid:
+				sq = nullf(v.Float64 - get(prev).Float64)
+			}
+			switch {
+			case q == 4:
+				ttm = v
+			case annual != nil && last != nil && get(annual).Valid && get(last).Valid:
+				ttm = nullf(v.Float64 + get(annual).Float64 - get(last).Float64)
+			}
+			return
+		}
+		t.EpsQ, t.EpsTtm = metric(func(f *model.Finance) sql.NullFloat64 { return f.Eps })
+		t.NpQ, t.NpTtm = metric(func(f *model.Finance) sql.NullFloat64 { return f.Np })
+		t.GrQ, t.GrTtm = metric(func(f *model.Finance) sql.NullFloat64 { return f.Gr })
+		t.RoeQ, t.RoeTtm = metric(func(f *model.Finance) sql.NullFloat64 { return f.Roe })
+		t.OcfpsQ, t.OcfpsTtm = metric(func(f *model.Finance) sql.NullFloat64 { return f.Ocfps })
+		if f.Np.Valid && f.Eps.Valid && f.Eps.Float64 != 0 {
+			t.Shares = nullf(f.Np.Float64 / f.Eps.Float64)
+		}
+		ttms = append(ttms, t)
+	}
+	return
+}
+
+func nullf(f float64) sql.NullFloat64 {
+	return sql.NullFloat64{Float64: math.Floor(f*1e4+0.5) / 1e4, Valid: true}
+}
+
+//reportQuarter returns the year and quarter of report period, quarter being 0 if not a quarter end.
+func reportQuarter(year string) (y, q int) {
+	if len(year) != 10 {
+		return
+	}
+	y, e := strconv.Atoi(year[:4])
+	if e != nil {
+		return 0, 0
+	}
+	for q = 1; q <= 4; q++ {
+		if periodEnd(y, q) == year {
+			return
+		}
+	}
+	return y, 0
+}
+
+func periodEnd(y, q int) string {
+	if q == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%d-%s", y, []string{"03-31", "06-30", "09-30", "12-31"}[q-1])
+}
+
+//reportDue returns the statutory deadline of disclosing the report of the period, from which on the report is
+// taken into valuation regardless of actual disclosure to avoid look-ahead.
+func reportDue(year string) string {
+	y, q := reportQuarter(year)
+	switch q {
+	case 1:
+		return fmt.Sprintf("%d-04-30", y)
+	case 2:
+		return fmt.Sprintf("%d-08-31", y)
+	case 3:
+		return fmt.Sprintf("%d-10-31", y)
+	case 4:
+		return fmt.Sprintf("%d-04-30", y+1)
+	}
+	return ""
+}
+
+//calcValuation continues the daily valuation from the last stored day, or from the due date of the
+// earliest report updated since, or rebuilds it if xdxr has been updated since.
+func calcValuation(code string) {
+	var last *model.Valuation
+	e := dbmap.SelectOne(&last, "select * from valuation where code = ? order by klid desc limit 1", code)
+	if e != nil {
+		if "sql: no rows in result set" != e.Error() {
+			log.Panicf("%s failed to query last valuation: %+v", code, e)
+		}
+		last = nil
+	}
+	from := ""
+	if last != nil {
+		from = last.Date
+		lu := last.Udate.String + last.Utime.String
+		n, e := dbmap.SelectInt("select count(*) from xdxr where code = ? and concat(udate, utime) > ?", code, lu)
+		util.CheckErr(e, code+" failed to check xdxr updates")
+		if n > 0 {
+			from = ""
+		} else {
+			y, e := dbmap.SelectNullStr("select min(year) from fin_ttm where code = ? and concat(udate, utime) > ?",
+				code, lu)
+			util.CheckErr(e, code+" failed to check fin_ttm updates")
+			if d := reportDue(y.String); y.Valid && d < from {
+				from = d
+			}
+		}
+	}
+	var quotes []*model.Quote
+	_, e = dbmap.Select(&quotes, "select code, date, klid, close from kline_d_n where code = ? and date >= ? "+
+		"order by klid", code, from)
+	util.CheckErr(e, code+" failed to query kline_d_n")
+	if len(quotes) == 0 {
+		return
+	}
+	var ttms []*model.FinTTM
+	_, e = dbmap.Select(&ttms, "select * from fin_ttm where code = ? order by year", code)
+	util.CheckErr(e, code+" failed to query fin_ttm")
+	var xdxrs []*model.Xdxr
+	_, e = dbmap.Select(&xdxrs, "select code, idx, divi, shares_allot as SharesAllot, shares_cvt as SharesCvt, "+
+		"xdxr_date from xdxr where code = ? and xdxr_date is not null and xdxr_date <= ? "+
+		"and (divi > 0 or shares_allot > 0 or shares_cvt > 0) order by xdxr_date", code, quotes[len(quotes)-1].Date)
+	util.CheckErr(e, code+" failed to query xdxr")
+	saveValuation(code, Valuate(quotes, ttms, xdxrs))
+}
+
+//Valuate calculates the daily valuation of the non-reinstated quotes in ascending order. The latest report
+// due by the day applies, see reportDue. Per share metrics of the report are diluted by the share
+// distributions after the report period. Dividend yield sums up the cash dividends of the past 365 days
+// per share of the day.
+func Valuate(quotes []*model.Quote, ttms []*model.FinTTM, xdxrs []*model.Xdxr) (vals []*model.Valuation) {
+	sort.Slice(ttms, func(i, j int) bool {
+		return ttms[i].Year < ttms[j].Year
+	})
+	// cumulative share ratio after each event
+	cum := make([]float64, len(xdxrs))
+	r := 1.
+	for i, x := range xdxrs {
+		r *= 1 + (x.SharesAllot.Float64+x.SharesCvt.Float64)/10
+		cum[i] = r
+	}
+	ratioAt := func(date string) float64 {
+		i := sort.Search(len(xdxrs), func(i int) bool {
+			return xdxrs[i].XdxrDate.String > date
+		})
+		if i == 0 {
+			return 1
+		}
+		return cum[i-1]
+	}
+	var t *model.FinTTM
+	for _, q := range quotes {
+		v := &model.Valuation{Code: q.Code, Date: q.Date, Klid: q.Klid, Close: q.Close}
+		vals = append(vals, v)
+		for i := len(ttms) - 1; i >= 0; i-- {
+			if reportDue(ttms[i].Year) <= q.Date {
+				t = ttms[i]
+				break
+			}
+		}
+		if q.Close <= 0 {
+			continue
+		}
+		rq := ratioAt(q.Date)
+		if t != nil {
+			v.Year = t.Year
+			f := rq / ratioAt(t.Year)
+			if t.EpsTtm.Valid && t.EpsTtm.Float64 != 0 {
+				v.PeTtm = nullf(q.Close / (t.EpsTtm.Float64 / f))
+			}
+			if t.Navps.Valid && t.Navps.Float64 != 0 {
+				v.Pb = nullf(q.Close / (t.Navps.Float64 / f))
+			}
+			if t.Shares.Valid && t.Shares.Float64 > 0 {
+				v.MktCap = nullf(q.Close * t.Shares.Float64 * f)
+				if t.GrTtm.Valid && t.GrTtm.Float64 != 0 {
+					v.PsTtm = nullf(q.Close / (t.GrTtm.Float64 / t.Shares.Float64 / f))
+				}
+			}
+		}
+		start := yearAgo(q.Date)
+		divi := 0.
+		for i, x := range xdxrs {
+			xd := x.XdxrDate.String
+			if xd > q.Date {
+				break
+			}
+			if xd <= start || !x.Divi.Valid {
+				continue
+			}
+			// per share held before the distribution of the same event
+			before := 1.
+			if i > 0 {
+				before = cum[i-1]
+			}
+			divi += x.Divi.Float64 / 10 / (rq / before)
+		}
+		v.Dyr = math.Floor(divi/q.Close*1e6+0.5) / 1e4
+	}
+	return
+}
+
+func yearAgo(date string) string {
+	t, e := time.Parse("2006-01-02", date)
+	util.CheckErr(e, "invalid date: "+date)
+	return t.AddDate(0, 0, -365).Format("2006-01-02")
+}
+
+func saveValuation(code string, vals []*model.Valuation) {
+	d, t := util.TimeStr()
+	for i := 0; i < len(vals); i += JOB_CAPACITY {
+		end := i + JOB_CAPACITY
+		if end > len(vals) {
+			end = len(vals)
+		}
+		valueStrings := make([]string, 0, end-i)
+		valueArgs := make([]interface{}, 0, (end-i)*12)
+		for _, v := range vals[i:end] {
+			valueStrings = append(valueStrings, "(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)")
+			valueArgs = append(valueArgs, v.Code, v.Date, v.Klid, v.Close, util.Str2Snull(v.Year), v.PeTtm, v.Pb,
+				v.PsTtm, v.Dyr, v.MktCap, d, t)
+		}
+		stmt := fmt.Sprintf("insert into valuation (code, date, klid, close, year, pe_ttm, pb, ps_ttm, dyr, "+
+			"mktcap, udate, utime) values %s on duplicate key update date=values(date), close=values(close), "+
+			"year=values(year), pe_ttm=values(pe_ttm), pb=values(pb), ps_ttm=values(ps_ttm), dyr=values(dyr), "+
+			"mktcap=values(mktcap), udate=values(udate), utime=values(utime)", strings.Join(valueStrings, ","))
+		_, e := dbmap.Exec(stmt, valueArgs...)
+		util.CheckErr(e, code+" failed to save valuation")
+		metrics.RowsUpserted("valuation", end-i)
+	}
+}
+
+//GetValuation returns the daily valuation of the stock between the dates inclusively, in ascending order.
+// Empty date means no bound.
+func GetValuation(code, from, to string) (vals []*model.Valuation) {
+	var (
+		conds = []string{"code = ?"}
+		args  = []interface{}{code}
+	)
+	if from != "" {
+		conds = append(conds, "date >= ?")
+		args = append(args, from)
+	}
+	if to != "" {
+		conds = append(conds, "date <= ?")
+		args = append(args, to)
+	}
+	_, e := dbmap.Select(&vals, fmt.Sprintf("select * from valuation where %s order by klid",
+		strings.Join(conds, " and ")), args...)
+	if e != nil && "sql: no rows in result set" != e.Error() {
+		log.Panicf("%s failed to query valuation: %+v", code, e)
+	}
+	return
+}
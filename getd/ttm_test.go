@@ -0,0 +1,76 @@
+package getd
+
+import (
+	"database/sql"
+	"fmt"
+	"testing"
+
+	"github.com/carusyte/stock/model"
+)
+
+func nf(f float64) sql.NullFloat64 {
+	return sql.NullFloat64{Float64: f, Valid: true}
+}
+
+func TestFinTTM(t *testing.T) {
+	fins := []*model.Finance{
+		{Code: "600000", Year: "2016-09-30", Eps: nf(.6), Np: nf(6), Gr: nf(60)},
+		{Code: "600000", Year: "2016-12-31", Eps: nf(.8), Np: nf(8), Gr: nf(80)},
+		{Code: "600000", Year: "2017-03-31", Eps: nf(.25), Np: nf(2.5), Gr: nf(25)},
+		{Code: "600000", Year: "2017-06-30", Eps: nf(.5), Np: nf(5), Gr: nf(50)},
+		{Code: "600000", Year: "2017-09-30", Eps: nf(.7), Np: nf(7), Gr: nf(70), Navps: nf(5)},
+	}
+	ttms := FinTTM(fins)
+	if len(ttms) != len(fins) {
+		t.Fatalf("expecting %d, got %d", len(fins), len(ttms))
+	}
+	str := func(f sql.NullFloat64) string {
+		if !f.Valid {
+			return "-"
+		}
+		return fmt.Sprintf("%.2f", f.Float64)
+	}
+	exp := []string{"-/-/-", "0.20/0.80/80.00", "0.25/-/-", "0.25/-/-", "0.20/0.90/90.00"}
+	for i, f := range ttms {
+		if s := str(f.EpsQ) + "/" + str(f.EpsTtm) + "/" + str(f.GrTtm); s != exp[i] {
+			t.Errorf("expecting %s at %s, got %s", exp[i], f.Year, s)
+		}
+	}
+	if f := ttms[4]; str(f.NpQ) != "2.00" || str(f.NpTtm) != "9.00" || str(f.Shares) != "10.00" || str(f.RoeTtm) != "-" {
+		t.Errorf("unexpected ttm: %+v", f)
+	}
+	if reportDue("2017-12-31") != "2018-04-30" || reportDue("2017-06-30") != "2017-08-31" || reportDue("2017") != "" {
+		t.Error("unexpected report due dates")
+	}
+}
+
+func TestValuate(t *testing.T) {
+	ttms := []*model.FinTTM{{Code: "600000", Year: "2017-09-30", EpsTtm: nf(.9), Navps: nf(5), GrTtm: nf(90),
+		Shares: nf(10)}}
+	var quotes []*model.Quote
+	for i, q := range []struct {
+		date  string
+		close float64
+	}{{"2017-10-30", 9}, {"2017-10-31", 9}, {"2017-11-02", 5}, {"2018-11-02", 5}} {
+		quotes = append(quotes, &model.Quote{Code: "600000", Klid: i, Date: q.date, Close: q.close})
+	}
+	// 1 cash per share before 1 bonus share each
+	xdxrs := []*model.Xdxr{{Code: "600000", XdxrDate: sql.NullString{String: "2017-11-01", Valid: true},
+		Divi: nf(10), SharesAllot: nf(10)}}
+	vals := Valuate(quotes, ttms, xdxrs)
+	str := func(f sql.NullFloat64) string {
+		if !f.Valid {
+			return "-"
+		}
+		return fmt.Sprintf("%.2f", f.Float64)
+	}
+	exp := []string{"-/-/-/0.00", "10.00/1.80/1.00/0.00", "11.11/2.00/1.11/10.00", "11.11/2.00/1.11/0.00"}
+	for i, v := range vals {
+		if s := fmt.Sprintf("%s/%s/%s/%.2f", str(v.PeTtm), str(v.Pb), str(v.PsTtm), v.Dyr); s != exp[i] {
+			t.Errorf("expecting %s on %s, got %s", exp[i], v.Date, s)
+		}
+	}
+	if vals[0].Year != "" || vals[1].Year != "2017-09-30" {
+		t.Errorf("unexpected report periods: %s, %s", vals[0].Year, vals[1].Year)
+	}
+}
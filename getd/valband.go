@@ -0,0 +1,224 @@
+package getd
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"math"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/carusyte/stock/metrics"
+	"github.com/carusyte/stock/model"
+	"github.com/carusyte/stock/util"
+)
+
+//ValBandYears trailing windows in years of valuation bands
+var ValBandYears = []int{3, 5, 10}
+
+//IdxUniverse sql conditions on stock code selecting the members of composite indices, whose valuation is
+// aggregated from that of the members weighted by market cap.
+var IdxUniverse = map[string]string{
+	"sh000001": "code like '6%'",                     // 上证综指
+	"sz399106": "(code like '0%' or code like '3%')", // 深证综指
+	"sz399101": "code like '002%'",                   // 中小板综
+	"sz399102": "code like '300%'",                   // 创业板综
+}
+
+//calcIdxValuation continues the daily valuation of the index from the last stored day, or from the earliest
+// day of member valuation updated since. PE, PB and PS are total market cap over total earnings, book
+// value and revenue of the members having the metric, and invalid if the denominator is not positive.
+// Dividend yield is weighted by market cap.
+func calcIdxValuation(code string) {
+	cond := IdxUniverse[code]
+	var last *model.Valuation
+	e := dbmap.SelectOne(&last, "select * from valuation where code = ? order by klid desc limit 1", code)
+	if e != nil {
+		if "sql: no rows in result set" != e.Error() {
+			log.Panicf("%s failed to query last valuation: %+v", code, e)
+		}
+		last = nil
+	}
+	from := ""
+	if last != nil {
+		from = last.Date
+		d, e := dbmap.SelectNullStr(fmt.Sprintf("select min(date) from valuation where %s and date < ? "+
+			"and concat(udate, utime) > ?", cond), from, last.Udate.String+last.Utime.String)
+		util.CheckErr(e, code+" failed to check member valuation updates")
+		if d.Valid {
+			from = d.String
+		}
+	}
+	var vals []*model.Valuation
+	_, e = dbmap.Select(&vals, fmt.Sprintf("select k.code, k.date, k.klid, k.close, a.pe_ttm, a.pb, a.ps_ttm, "+
+		"a.dyr, a.mktcap from kline_d k inner join (select date, "+
+		"sum(if(pe_ttm is null, 0, mktcap)) / sum(mktcap / pe_ttm) pe_ttm, "+
+		"sum(if(pb is null, 0, mktcap)) / sum(mktcap / pb) pb, "+
+		"sum(if(ps_ttm is null, 0, mktcap)) / sum(mktcap / ps_ttm) ps_ttm, "+
+		"sum(mktcap * dyr) / sum(mktcap) dyr, sum(mktcap) mktcap "+
+		"from valuation where %s and mktcap > 0 and date >= ? group by date) a using (date) "+
+		"where k.code = ? and k.date >= ? order by k.klid", cond), from, code, from)
+	util.CheckErr(e, code+" failed to aggregate member valuation")
+	for _, v := range vals {
+		for _, f := range []*sql.NullFloat64{&v.PeTtm, &v.Pb, &v.PsTtm, &v.MktCap} {
+			if f.Valid && f.Float64 > 0 {
+				*f = nullf(f.Float64)
+			} else {
+				f.Valid = false
+			}
+		}
+		v.Dyr = math.Floor(v.Dyr*1e4+0.5) / 1e4
+	}
+	saveValuation(code, vals)
+}
+
+//CalcValBands updates the valuation bands of the stocks and indices for each of ValBandYears as of their
+// latest valuation. Returns the ones updated, a failing one doesn't hold back the rest.
+func CalcValBands(stocks *model.Stocks) (rstks *model.Stocks) {
+	log.Println("calculating valuation bands...")
+	maxy := 0
+	for _, y := range ValBandYears {
+		if y > maxy {
+			maxy = y
+		}
+	}
+	from := time.Now().AddDate(-maxy-1, 0, 0).Format("2006-01-02")
+	var wg sync.WaitGroup
+	chstk := make(chan *model.Stock, JOB_CAPACITY)
+	chrstk := make(chan *model.Stock, JOB_CAPACITY)
+	rstks = new(model.Stocks)
+	wgr := collect(rstks, chrstk)
+	for i := 0; i < int(float64(runtime.NumCPU())*0.7); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for s := range chstk {
+				if tryStock(s.Code, "calculate valuation bands", func() {
+					saveValBands(s.Code, ValBands(GetValuation(s.Code, from, ""), ValBandYears...))
+				}) {
+					chrstk <- s
+				}
+			}
+		}()
+	}
+	for _, s := range stocks.List {
+		chstk <- s
+	}
+	close(chstk)
+	wg.Wait()
+	close(chrstk)
+	wgr.Wait()
+	log.Printf("%d valuation bands updated", rstks.Size())
+	return
+}
+
+//ValBands calculates the bands of each valuation metric as of the last of vals in ascending order, within
+// the trailing windows of years. Non-positive PE, PB and PS are excluded from the samples.
+func ValBands(vals []*model.Valuation, years ...int) (bands []*model.ValBand) {
+	if len(vals) == 0 {
+		return
+	}
+	lv := vals[len(vals)-1]
+	end, e := time.Parse("2006-01-02", lv.Date)
+	util.CheckErr(e, "invalid date: "+lv.Date)
+	for _, m := range []string{model.VAL_PE, model.VAL_PB, model.VAL_PS, model.VAL_DYR} {
+		cur := valOf(lv, m)
+		for _, y := range years {
+			start := end.AddDate(-y, 0, 0).Format("2006-01-02")
+			var smp []float64
+			for i := len(vals) - 1; i >= 0 && vals[i].Date > start; i-- {
+				if v := valOf(vals[i], m); v.Valid {
+					smp = append(smp, v.Float64)
+				}
+			}
+			b := &model.ValBand{Code: lv.Code, Metric: m, Years: y, Date: lv.Date, Value: cur, Samples: len(smp)}
+			bands = append(bands, b)
+			if len(smp) == 0 {
+				continue
+			}
+			sort.Float64s(smp)
+			b.Min, b.Max = smp[0], smp[len(smp)-1]
+			b.P20, b.P50, b.P80 = quantile(smp, .2), quantile(smp, .5), quantile(smp, .8)
+			if cur.Valid {
+				b.Pct = sql.NullFloat64{Float64: percentile(smp, cur.Float64), Valid: true}
+			}
+		}
+	}
+	return
+}
+
+//valOf returns the metric of the valuation, invalid if not positive except for dividend yield.
+func valOf(v *model.Valuation, metric string) (f sql.NullFloat64) {
+	switch metric {
+	case model.VAL_PE:
+		f = v.PeTtm
+	case model.VAL_PB:
+		f = v.Pb
+	case model.VAL_PS:
+		f = v.PsTtm
+	case model.VAL_DYR:
+		return sql.NullFloat64{Float64: v.Dyr, Valid: true}
+	}
+	f.Valid = f.Valid && f.Float64 > 0
+	return
+}
+
+//quantile returns the value at the proportion p of the sorted samples by nearest rank.
+func quantile(sorted []float64, p float64) float64 {
+	return sorted[int(p*float64(len(sorted)-1)+0.5)]
+}
+
+//percentile returns the percentage of the sorted samples below v, counting half of those equal.
+func percentile(sorted []float64, v float64) float64 {
+	lo := sort.SearchFloat64s(sorted, v)
+	hi := sort.Search(len(sorted), func(i int) bool {
+		return sorted[i] > v
+	})
+	return math.Floor((float64(lo)+float64(hi-lo)/2)/float64(len(sorted))*1e4+0.5) / 100
+}
+
+func saveValBands(code string, bands []*model.ValBand) {
+	if len(bands) == 0 {
+		return
+	}
+	d, t := util.TimeStr()
+	valueStrings := make([]string, 0, len(bands))
+	valueArgs := make([]interface{}, 0, len(bands)*14)
+	for _, b := range bands {
+		valueStrings = append(valueStrings, "(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)")
+		valueArgs = append(valueArgs, b.Code, b.Metric, b.Years, b.Date, b.Value, b.Pct, b.Min, b.P20, b.P50,
+			b.P80, b.Max, b.Samples, d, t)
+	}
+	stmt := fmt.Sprintf("insert into val_band (code, metric, years, date, value, pct, min, p20, p50, p80, max, "+
+		"samples, udate, utime) values %s on duplicate key update date=values(date), value=values(value), "+
+		"pct=values(pct), min=values(min), p20=values(p20), p50=values(p50), p80=values(p80), max=values(max), "+
+		"samples=values(samples), udate=values(udate), utime=values(utime)", strings.Join(valueStrings, ","))
+	_, e := dbmap.Exec(stmt, valueArgs...)
+	util.CheckErr(e, code+" failed to save val_band")
+	metrics.RowsUpserted("val_band", len(bands))
+}
+
+//GetValBands returns the valuation bands of the window years, keyed by code and then metric. All stocks and
+// indices are returned if codes is empty.
+func GetValBands(years int, codes ...string) map[string]map[string]*model.ValBand {
+	var bands []*model.ValBand
+	query := "select * from val_band where years = ?"
+	if len(codes) > 0 {
+		query += fmt.Sprintf(" and code in (%s)", util.Join(codes, ",", true))
+	}
+	_, e := dbmap.Select(&bands, query, years)
+	if e != nil && "sql: no rows in result set" != e.Error() {
+		log.Panicf("failed to query valuation bands: %+v", e)
+	}
+	r := make(map[string]map[string]*model.ValBand)
+	for _, b := range bands {
+		if r[b.Code] == nil {
+			r[b.Code] = make(map[string]*model.ValBand)
+		}
+		r[b.Code][b.Metric] = b
+	}
+	return r
+}
@@ -0,0 +1,48 @@
+package getd
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/carusyte/stock/model"
+)
+
+func TestValBands(t *testing.T) {
+	var vals []*model.Valuation
+	for i, v := range []struct {
+		date    string
+		pe, dyr float64
+	}{{"2014-01-10", 10, 1}, {"2015-06-01", 20, 2}, {"2016-06-01", -5, 0}, {"2017-01-01", 30, 3},
+		{"2017-06-01", 20, 2}} {
+		vals = append(vals, &model.Valuation{Code: "600000", Date: v.date, Klid: i, PeTtm: nf(v.pe), Dyr: v.dyr})
+	}
+	bands := ValBands(vals, 3, 5)
+	if len(bands) != 8 {
+		t.Fatalf("expecting 8 bands, got %d", len(bands))
+	}
+	bm := make(map[string]*model.ValBand)
+	for _, b := range bands {
+		if b.Date != "2017-06-01" {
+			t.Errorf("unexpected date: %+v", b)
+		}
+		bm[fmt.Sprintf("%s%d", b.Metric, b.Years)] = b
+	}
+	for k, exp := range map[string]struct {
+		samples            int
+		pct                float64
+		min, p20, p50, max float64
+	}{
+		"PE3":  {3, 33.33, 20, 20, 20, 30},
+		"PE5":  {4, 50, 10, 20, 20, 30},
+		"DYR3": {4, 50, 0, 2, 2, 3},
+	} {
+		b := bm[k]
+		if b.Samples != exp.samples || !b.Pct.Valid || b.Pct.Float64 != exp.pct || b.Min != exp.min ||
+			b.P20 != exp.p20 || b.P50 != exp.p50 || b.Max != exp.max {
+			t.Errorf("%s expecting %+v, got %+v", k, exp, b)
+		}
+	}
+	if b := bm["PB5"]; b.Samples != 0 || b.Pct.Valid || b.Value.Valid {
+		t.Errorf("PB5 expecting no samples, got %+v", b)
+	}
+}
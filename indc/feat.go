@@ -0,0 +1,172 @@
+package indc
+
+import (
+	"log"
+	"sort"
+	"sync"
+
+	"github.com/carusyte/stock/conf"
+	"github.com/carusyte/stock/model"
+)
+
+//FeatIndc an indicator whose feature windows can be sampled at buy and sell points, see getd.SmpFeat.
+type FeatIndc struct {
+	//Name indicator name, stored in the indc column of feature tables
+	Name string
+	//Dims names of the value dimensions
+	Dims []string
+	//Calc calculates the values of all dimensions for each kline
+	Calc func(klhist []*model.Quote) [][]float64
+	//Anchor delimits the feature window ending at the last element
+	Anchor AnchorRule
+}
+
+//AnchorRule returns the start of the feature window ending at the last element of vals, and whether
+// a valid window is found.
+type AnchorRule func(vals [][]float64) (start int, found bool)
+
+var (
+	featIndcs = make(map[string]*FeatIndc)
+	featLock  = sync.RWMutex{}
+)
+
+func init() {
+	RegisterFeatIndc(&FeatIndc{
+		Name: "KDJ",
+		Dims: []string{"K", "D", "J"},
+		Calc: func(klhist []*model.Quote) [][]float64 {
+			kdj := DeftKDJ(klhist)
+			r := make([][]float64, len(kdj))
+			for i, k := range kdj {
+				r[i] = []float64{k.KDJ_K, k.KDJ_D, k.KDJ_J}
+			}
+			return r
+		},
+		Anchor: func(vals [][]float64) (int, bool) {
+			return MinSize(CrossAnchor(2, 1), conf.Args().Kdjv.SampleSizeMin)(vals)
+		},
+	})
+	RegisterFeatIndc(&FeatIndc{
+		Name: "MACD",
+		Dims: []string{"DIF", "DEA", "MACD"},
+		Calc: func(klhist []*model.Quote) [][]float64 {
+			dif, dea, macd := DeftMACD(closes(klhist))
+			r := make([][]float64, len(klhist))
+			for i := range r {
+				r[i] = []float64{dif[i], dea[i], macd[i]}
+			}
+			return r
+		},
+		Anchor: MinSize(ZeroCrossAnchor(2), 3),
+	})
+	RegisterFeatIndc(&FeatIndc{
+		Name: "RSI",
+		Dims: []string{"RSI"},
+		Calc: func(klhist []*model.Quote) [][]float64 {
+			rsi := DeftRSI(closes(klhist))
+			r := make([][]float64, len(klhist))
+			for i := range r {
+				r[i] = []float64{rsi[i]}
+			}
+			return r
+		},
+		Anchor: MinSize(LevelCrossAnchor(0, 30, 50, 70), 3),
+	})
+}
+
+//RegisterFeatIndc registers the feature indicator, replacing the previous one of the same name.
+func RegisterFeatIndc(fi *FeatIndc) {
+	if fi.Name == "" || fi.Calc == nil || fi.Anchor == nil {
+		log.Panicf("invalid feature indicator: %+v", fi)
+	}
+	featLock.Lock()
+	defer featLock.Unlock()
+	featIndcs[fi.Name] = fi
+}
+
+//FeatIndcOf returns the registered feature indicator of the name.
+func FeatIndcOf(name string) (*FeatIndc, bool) {
+	featLock.RLock()
+	defer featLock.RUnlock()
+	fi, ok := featIndcs[name]
+	return fi, ok
+}
+
+//FeatIndcs returns the names of all registered feature indicators in alphabetical order.
+func FeatIndcs() []string {
+	featLock.RLock()
+	defer featLock.RUnlock()
+	names := make([]string, 0, len(featIndcs))
+	for n := range featIndcs {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return names
+}
+
+//CrossAnchor anchors at the latest cross of dimension a and b, like getd.ToLstJDCross.
+// The window starts at the element right before the cross.
+func CrossAnchor(a, b int) AnchorRule {
+	return signChangeAnchor(func(v []float64) float64 { return v[a] - v[b] })
+}
+
+//ZeroCrossAnchor anchors at the latest time the dimension crosses zero.
+func ZeroCrossAnchor(dim int) AnchorRule {
+	return signChangeAnchor(func(v []float64) float64 { return v[dim] })
+}
+
+//LevelCrossAnchor anchors at the latest time the dimension crosses any of the levels.
+func LevelCrossAnchor(dim int, levels ...float64) AnchorRule {
+	return func(vals [][]float64) (int, bool) {
+		start, found := -1, false
+		for _, l := range levels {
+			s, f := signChangeAnchor(func(v []float64) float64 { return v[dim] - l })(vals)
+			if f && s > start {
+				start, found = s, true
+			}
+		}
+		if !found {
+			return 0, false
+		}
+		return start, true
+	}
+}
+
+// signChangeAnchor anchors at the latest sign change of the function, touching zero included.
+func signChangeAnchor(f func(v []float64) float64) AnchorRule {
+	return func(vals [][]float64) (int, bool) {
+		for i := len(vals) - 1; i > 0; i-- {
+			c, p := f(vals[i]), f(vals[i-1])
+			if c == 0 {
+				return i, true
+			}
+			if p == 0 || (c < 0) != (p < 0) {
+				return i - 1, true
+			}
+		}
+		return 0, false
+	}
+}
+
+//MinSize extends the window of the rule to at least min elements, and the window is only valid
+// if there are enough elements.
+func MinSize(rule AnchorRule, min int) AnchorRule {
+	return func(vals [][]float64) (int, bool) {
+		start, found := rule(vals)
+		if !found {
+			return start, false
+		}
+		if len(vals)-start < min {
+			start = imax(0, len(vals)-min)
+		}
+		return start, len(vals)-start >= min
+	}
+}
+
+func closes(klhist []*model.Quote) []float64 {
+	c := make([]float64, len(klhist))
+	for i, k := range klhist {
+		c[i] = k.Close
+	}
+	return c
+}
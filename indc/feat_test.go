@@ -0,0 +1,56 @@
+package indc
+
+import (
+	"math"
+	"testing"
+)
+
+func TestFeatAnchors(t *testing.T) {
+	vals := [][]float64{{1, 2}, {3, 2}, {4, 2}, {5, 2}, {1, 2}, {0, 2}}
+	if s, f := CrossAnchor(0, 1)(vals); !f || s != 3 {
+		t.Errorf("cross anchor should start right before the latest cross: %d, %v", s, f)
+	}
+	if s, f := MinSize(CrossAnchor(0, 1), 4)(vals); !f || s != 2 {
+		t.Errorf("window should be extended to the minimum size: %d, %v", s, f)
+	}
+	if _, f := MinSize(CrossAnchor(0, 1), 7)(vals); f {
+		t.Error("window shorter than the minimum size should be invalid")
+	}
+	if _, f := CrossAnchor(0, 1)(vals[1:4]); f {
+		t.Error("no cross should be found")
+	}
+	zv := [][]float64{{-1}, {0}, {2}, {3}}
+	if s, f := ZeroCrossAnchor(0)(zv); !f || s != 1 {
+		t.Errorf("zero touching should be anchored: %d, %v", s, f)
+	}
+	lv := [][]float64{{20}, {35}, {45}, {55}, {60}}
+	if s, f := LevelCrossAnchor(0, 30, 50, 70)(lv); !f || s != 2 {
+		t.Errorf("latest level cross should be anchored: %d, %v", s, f)
+	}
+}
+
+func TestMacdRsi(t *testing.T) {
+	src := make([]float64, 120)
+	for i := range src {
+		src[i] = 10 + math.Sin(float64(i)/8)
+	}
+	dif, dea, macd := DeftMACD(src)
+	for i := range src {
+		if math.Abs(macd[i]-2*(dif[i]-dea[i])) > 1e-12 {
+			t.Fatalf("macd should be twice of dif - dea at %d", i)
+		}
+	}
+	// rising prices have positive dif and rsi above 50
+	up := make([]float64, 60)
+	for i := range up {
+		up[i] = 10 + float64(i)*0.1
+	}
+	dif, _, _ = DeftMACD(up)
+	rsi := DeftRSI(up)
+	if dif[59] <= 0 || rsi[59] <= 50 || rsi[59] > 100 {
+		t.Errorf("unexpected macd and rsi of rising prices, dif: %f, rsi: %f", dif[59], rsi[59])
+	}
+	if f, ok := FeatIndcOf("MACD"); !ok || len(f.Dims) != 3 {
+		t.Error("MACD should be registered")
+	}
+}
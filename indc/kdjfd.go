@@ -0,0 +1,331 @@
+package indc
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/carusyte/stock/model"
+	"github.com/carusyte/stock/util"
+	"github.com/montanaflynn/stats"
+	logr "github.com/sirupsen/logrus"
+)
+
+const (
+	//KMEDOIDS_MAX_ITER maximum number of refinement iterations in ClusterKdjFd
+	KMEDOIDS_MAX_ITER = 10
+	//KMEDOIDS_CANDIDATES maximum number of members evaluated as the medoid of a cluster
+	KMEDOIDS_CANDIDATES = 64
+)
+
+//CalcKdjDevi calculates the KDJ DEVIA between the source and target KDJ data sets of the same length.
+func CalcKdjDevi(sk, sd, sj, tk, td, tj []float64) float64 {
+	kcc, e := util.Devi(sk, tk)
+	util.CheckErr(e, fmt.Sprintf("failed to calculate kcc: %+v, %+v", sk, tk))
+	dcc, e := util.Devi(sd, td)
+	util.CheckErr(e, fmt.Sprintf("failed to calculate dcc: %+v, %+v", sd, td))
+	jcc, e := util.Devi(sj, tj)
+	util.CheckErr(e, fmt.Sprintf("failed to calculate jcc: %+v, %+v", sj, tj))
+	scc := (kcc*1.0 + dcc*4.0 + jcc*5.0) / 10.0
+	return -0.001*math.Pow(scc, math.E) + 1
+}
+
+//BestKdjDevi Calculates the best match KDJ DEVIA, len(sk)==len(sd)==len(sj),
+// and len(sk) and len(tk) can vary.
+// DEVIA ranges from negative infinite to 1, with 1 indicating the most relevant KDJ data sets.
+func BestKdjDevi(sk, sd, sj, tk, td, tj []float64) float64 {
+	//should we also consider the len(x) to weigh the final result?
+	dif := len(sk) - len(tk)
+	if dif > 0 {
+		cc := -100.0
+		for i := 0; i <= dif; i++ {
+			e := len(sk) - dif + i
+			tcc := CalcKdjDevi(sk[i:e], sd[i:e], sj[i:e], tk, td, tj)
+			if tcc > cc {
+				cc = tcc
+			}
+		}
+		return cc
+	} else if dif < 0 {
+		cc := -100.0
+		dif *= -1
+		for i := 0; i <= dif; i++ {
+			e := len(tk) - dif + i
+			tcc := CalcKdjDevi(sk, sd, sj, tk[i:e], td[i:e], tj[i:e])
+			if tcc > cc {
+				cc = tcc
+			}
+		}
+		return cc
+	} else {
+		return CalcKdjDevi(sk, sd, sj, tk, td, tj)
+	}
+}
+
+//CalcKdjDI Evaluates KDJ DEVIA indicator against pruned feature data, returns the following result:
+// Ratio of high DEVIA, ratio of positive DEVIA, mean of positive DEVIA, and DEVIA indicator, ranging from 0 to 1.
+// DEVIA is measured by the specified similarity, BestKdjDevi if nil.
+func CalcKdjDI(hist []*model.Indicator, fdvs []*model.KDJfdView, sim KdjSim) (hdr, pdr, mpd, di float64) {
+	hdr, pdr, mpd, di, _ = MatchKdjDI(hist, fdvs, sim, 0)
+	return
+}
+
+//MatchKdjDI Evaluates KDJ DEVIA indicator like CalcKdjDI, and also returns up to top feature data with
+// positive DEVIA, the most similar first.
+func MatchKdjDI(hist []*model.Indicator, fdvs []*model.KDJfdView, sim KdjSim, top int) (hdr, pdr, mpd,
+	di float64, matches []*model.KdjMatch) {
+	if len(hist) == 0 {
+		return 0, 0, 0, 0, nil
+	}
+	code := hist[0].Code
+	hk := make([]float64, len(hist))
+	hd := make([]float64, len(hist))
+	hj := make([]float64, len(hist))
+	for i, h := range hist {
+		hk[i] = h.KDJ_K
+		hd[i] = h.KDJ_D
+		hj[i] = h.KDJ_J
+	}
+	if sim == nil {
+		sim = BestKdjDevi
+	}
+	pds := make([]float64, 0, 16)
+	for _, fd := range fdvs {
+		bkd := sim(hk, hd, hj, fd.K, fd.D, fd.J)
+		if bkd >= 0 {
+			pds = append(pds, bkd)
+			pdr += fd.Weight
+			if bkd >= 0.8 {
+				hdr += fd.Weight
+			}
+			if top > 0 {
+				matches = append(matches, &model.KdjMatch{Fid: fd.Fid, Cytp: fd.Cytp, Bysl: fd.Bysl,
+					SrcCode: fd.SrcCode, SrcFid: fd.SrcFid, Sim: bkd, Weight: fd.Weight, FdNum: fd.FdNum})
+			}
+		}
+	}
+	if len(matches) > 0 {
+		sort.SliceStable(matches, func(i, j int) bool {
+			if matches[i].Sim == matches[j].Sim {
+				return matches[i].Weight > matches[j].Weight
+			}
+			return matches[i].Sim > matches[j].Sim
+		})
+		if len(matches) > top {
+			matches = matches[:top]
+		}
+	}
+	var e error
+	if len(pds) > 0 {
+		mpd, e = stats.Mean(pds)
+		util.CheckErr(e, code+" failed to calculate mean of positive devia")
+	}
+	di = 0.5 * math.Min(1, math.Pow(hdr+0.92, 50))
+	di += 0.3 * math.Min(1, math.Pow(math.Log(pdr+1), 0.37)+0.4*math.Pow(pdr, math.Pi)+math.Pow(pdr, 0.476145))
+	di += 0.2 * math.Min(1, math.Pow(math.Log(math.Pow(mpd, math.E*math.Pi/1.1)+1), 0.06)+
+		math.E/1.25/math.Pi*math.Pow(mpd, math.E*math.Pi))
+	return
+}
+
+//ScoreKdj Scores the kdj history by assessing it against the buy and sell feature data.
+// Score ranges from 0 to 100. Detail of buy and sell evaluation is returned in the form of
+// [hdr, pdr, mpd, di], see CalcKdjDI, along with up to top most similar buy and sell feature data each,
+// see MatchKdjDI.
+func ScoreKdj(kdjhist []*model.Indicator, byfds, slfds []*model.KDJfdView, sim KdjSim, top int) (s float64,
+	bdet, sdet []float64, matches []*model.KdjMatch) {
+	hdr, pdr, mpd, bdi, bms := MatchKdjDI(kdjhist, byfds, sim, top)
+	bdet = []float64{hdr, pdr, mpd, bdi}
+	hdr, pdr, mpd, sdi, sms := MatchKdjDI(kdjhist, slfds, sim, top)
+	sdet = []float64{hdr, pdr, mpd, sdi}
+	matches = append(bms, sms...)
+	dirat := .0
+	if sdi == 0 {
+		dirat = bdi
+	} else {
+		dirat = (bdi - sdi) / math.Abs(sdi)
+	}
+	if dirat > 0 && dirat < 0.995 {
+		s = 30 * (0.0015 + 3.3609*dirat - 4.3302*math.Pow(dirat, 2.) + 2.5115*math.Pow(dirat, 3.) -
+			0.5449*math.Pow(dirat, 4.))
+	} else if dirat >= 0.995 {
+		s = 30
+	}
+	if bdi > 0.201 && bdi < 0.81 {
+		s += 70 * (0.0283 - 1.8257*bdi + 10.4231*math.Pow(bdi, 2.) - 10.8682*math.Pow(bdi, 3.) + 3.2234*math.Pow(bdi, 4.))
+	} else if bdi >= 0.81 {
+		s += 70
+	}
+	return
+}
+
+//ClusterKdjFd Groups kdj feature data of the same length into clusters by k-medoids. Initial medoids are
+// picked by a single leader pass, where a sample joins the most similar medoid if their similarity is no
+// less than prec, or becomes a new medoid otherwise. Medoids are then refined, and samples reassigned,
+// until the ratio of samples changing cluster in an iteration drops to stopRate or below.
+// A copy of each medoid is returned with FdNum being the sum of FdNum of its members, sorted by FdNum
+// in descending order, along with the cluster index of each sample. Similarity is measured by sim,
+// CalcKdjDevi if nil. id is for logging purpose.
+func ClusterKdjFd(id string, fdvs []*model.KDJfdView, prec, stopRate float64, sim KdjSim) (
+	medoids []*model.KDJfdView, assign []int) {
+	if len(fdvs) == 0 {
+		return
+	}
+	if sim == nil {
+		sim = CalcKdjDevi
+	}
+	st := time.Now()
+	n := len(fdvs)
+	order := make([]int, n)
+	for i := range order {
+		order[i] = i
+	}
+	// samples representing more raw data are more likely to be medoids
+	sort.SliceStable(order, func(a, b int) bool { return fdvs[order[a]].FdNum > fdvs[order[b]].FdNum })
+	assign = make([]int, n)
+	meds := make([]int, 0, 16)
+	for _, i := range order {
+		c, s := nearestKdjFd(fdvs, fdvs[i], meds, sim)
+		if s < prec {
+			meds = append(meds, i)
+			c = len(meds) - 1
+		}
+		assign[i] = c
+	}
+	logr.Debugf("%s seeded, samples: %d, clusters: %d, time: %.2f", id, n, len(meds), time.Since(st).Seconds())
+	for it := 0; it < KMEDOIDS_MAX_ITER; it++ {
+		st = time.Now()
+		members := make([][]int, len(meds))
+		for i, c := range assign {
+			members[c] = append(members[c], i)
+		}
+		isMed := make(map[int]bool, len(meds))
+		for c, ms := range members {
+			meds[c] = bestKdjMedoid(fdvs, ms, sim)
+			isMed[meds[c]] = true
+		}
+		changed := 0
+		for i := range fdvs {
+			if isMed[i] {
+				continue
+			}
+			c, s := nearestKdjFd(fdvs, fdvs[i], meds, sim)
+			if s < prec {
+				meds = append(meds, i)
+				isMed[i] = true
+				c = len(meds) - 1
+			}
+			if c != assign[i] {
+				changed++
+				assign[i] = c
+			}
+		}
+		for c, m := range meds {
+			assign[m] = c
+		}
+		rate := float64(changed) / float64(n)
+		logr.Debugf("%s iteration %d, clusters: %d, changed: %d, rate: %.2f%% time: %.2f",
+			id, it+1, len(meds), changed, rate*100, time.Since(st).Seconds())
+		if rate <= stopRate {
+			break
+		}
+	}
+	return kdjClusters(fdvs, meds, assign)
+}
+
+// kdjClusters copies the medoids of non-empty clusters and sums up FdNum of their members, remapping
+// assign to the returned clusters sorted by FdNum in descending order.
+func kdjClusters(fdvs []*model.KDJfdView, meds []int, assign []int) ([]*model.KDJfdView, []int) {
+	fdn := make([]int, len(meds))
+	for i, c := range assign {
+		fdn[c] += fdvs[i].FdNum
+	}
+	cs := make([]int, 0, len(meds))
+	for c := range meds {
+		if fdn[c] > 0 {
+			cs = append(cs, c)
+		}
+	}
+	sort.SliceStable(cs, func(a, b int) bool { return fdn[cs[a]] > fdn[cs[b]] })
+	idx := make([]int, len(meds))
+	medoids := make([]*model.KDJfdView, len(cs))
+	for i, c := range cs {
+		idx[c] = i
+		m := *fdvs[meds[c]]
+		m.FdNum = fdn[c]
+		medoids[i] = &m
+	}
+	for i, c := range assign {
+		assign[i] = idx[c]
+	}
+	return medoids, assign
+}
+
+// nearestKdjFd returns the index of the most similar medoid to f and their similarity,
+// -1 and negative infinity if there's no medoid.
+func nearestKdjFd(fdvs []*model.KDJfdView, f *model.KDJfdView, meds []int, sim KdjSim) (c int, s float64) {
+	c, s = -1, math.Inf(-1)
+	for i, m := range meds {
+		md := fdvs[m]
+		if v := sim(f.K, f.D, f.J, md.K, md.D, md.J); v > s {
+			c, s = i, v
+		}
+	}
+	return
+}
+
+// bestKdjMedoid returns the member with the least FdNum weighted dissimilarity to the others.
+// For large clusters only KMEDOIDS_CANDIDATES evenly spaced members are considered as candidates.
+func bestKdjMedoid(fdvs []*model.KDJfdView, members []int, sim KdjSim) int {
+	if len(members) < 3 {
+		return members[0]
+	}
+	step := 1
+	if len(members) > KMEDOIDS_CANDIDATES {
+		step = len(members) / KMEDOIDS_CANDIDATES
+	}
+	best, bcost := members[0], math.Inf(1)
+	for i := 0; i < len(members); i += step {
+		f := fdvs[members[i]]
+		cost := .0
+		for _, j := range members {
+			t := fdvs[j]
+			cost += (1 - sim(f.K, f.D, f.J, t.K, t.D, t.J)) * float64(t.FdNum)
+			if cost >= bcost {
+				break
+			}
+		}
+		if cost < bcost {
+			best, bcost = members[i], cost
+		}
+	}
+	return best
+}
+
+//AssignKdjFd Incrementally assigns new kdj feature data to the most similar existing cluster whose similarity
+// is no less than prec, in which case FdNum of the cluster is increased by that of the sample. Otherwise the
+// sample becomes a new cluster, appended to the returned clusters. The cluster index of each sample is
+// returned as well. Similarity is measured by sim, CalcKdjDevi if nil.
+func AssignKdjFd(clusters, fdvs []*model.KDJfdView, prec float64, sim KdjSim) ([]*model.KDJfdView, []int) {
+	if sim == nil {
+		sim = CalcKdjDevi
+	}
+	assign := make([]int, len(fdvs))
+	for i, f := range fdvs {
+		c, s := -1, math.Inf(-1)
+		for j, cl := range clusters {
+			if v := sim(f.K, f.D, f.J, cl.K, cl.D, cl.J); v > s {
+				c, s = j, v
+			}
+		}
+		if s >= prec {
+			clusters[c].FdNum += f.FdNum
+		} else {
+			nc := *f
+			clusters = append(clusters, &nc)
+			c = len(clusters) - 1
+		}
+		assign[i] = c
+	}
+	return clusters, assign
+}
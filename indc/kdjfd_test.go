@@ -0,0 +1,93 @@
+package indc
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/carusyte/stock/model"
+)
+
+// noisyKdjFd generates n samples around the specified number of random prototypes.
+func noisyKdjFd(r *rand.Rand, n, protos, length int) []*model.KDJfdView {
+	ps := make([][3][]float64, protos)
+	for i := range ps {
+		ps[i][0], ps[i][1], ps[i][2] = randKdj(r, length)
+	}
+	fdvs := make([]*model.KDJfdView, n)
+	for i := range fdvs {
+		p := ps[r.Intn(protos)]
+		f := &model.KDJfdView{SmpNum: length, FdNum: 1}
+		for x := 0; x < length; x++ {
+			e := r.NormFloat64() * 1.5
+			f.Add(p[0][x]+e, p[1][x]+e*.5, p[2][x]+e*2)
+		}
+		fdvs[i] = f
+	}
+	return fdvs
+}
+
+func TestClusterKdjFd(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	fdvs := noisyKdjFd(r, 1000, 20, 6)
+	cs, assign := ClusterKdjFd("test", fdvs, 0.95, 0.01, nil)
+	if len(cs) == 0 || len(cs) >= len(fdvs) || len(assign) != len(fdvs) {
+		t.Fatalf("unexpected clusters: %d, assignment: %d", len(cs), len(assign))
+	}
+	cnt := make([]int, len(cs))
+	for _, c := range assign {
+		cnt[c]++
+	}
+	for i, c := range cs {
+		if c.FdNum != cnt[i] {
+			t.Errorf("cluster %d has %d members, but FdNum is %d", i, cnt[i], c.FdNum)
+		}
+		if i > 0 && c.FdNum > cs[i-1].FdNum {
+			t.Errorf("clusters should be sorted by FdNum in descending order")
+		}
+	}
+	for i, f := range fdvs {
+		c := cs[assign[i]]
+		if s := CalcKdjDevi(f.K, f.D, f.J, c.K, c.D, c.J); s < 0.95 {
+			t.Errorf("sample %d is assigned to a dissimilar cluster: %f", i, s)
+		}
+	}
+
+	nfdvs := noisyKdjFd(r, 200, 30, 6)
+	bfc := len(cs)
+	cs, assign = AssignKdjFd(cs, nfdvs, 0.95, nil)
+	total := 0
+	for _, c := range cs {
+		total += c.FdNum
+	}
+	if total != len(fdvs)+len(nfdvs) || len(assign) != len(nfdvs) {
+		t.Errorf("FdNum should add up to %d after assignment, got %d", len(fdvs)+len(nfdvs), total)
+	}
+	t.Logf("clusters: %d, after assignment: %d", bfc, len(cs))
+}
+
+func TestMatchKdjDI(t *testing.T) {
+	r := rand.New(rand.NewSource(2))
+	fdvs := noisyKdjFd(r, 50, 5, 6)
+	for i, f := range fdvs {
+		f.Fid = string(rune('a' + i%26))
+		f.Weight = 1. / float64(len(fdvs))
+	}
+	h := fdvs[0]
+	hist := make([]*model.Indicator, len(h.K))
+	for i := range hist {
+		hist[i] = &model.Indicator{Code: "test", KDJ_K: h.K[i], KDJ_D: h.D[i], KDJ_J: h.J[i]}
+	}
+	hdr, pdr, mpd, di := CalcKdjDI(hist, fdvs, nil)
+	mhdr, mpdr, mmpd, mdi, ms := MatchKdjDI(hist, fdvs, nil, 3)
+	if hdr != mhdr || pdr != mpdr || mpd != mmpd || di != mdi {
+		t.Errorf("matching should not change the DEVIA indicator")
+	}
+	if len(ms) != 3 || ms[0].Sim != 1 || ms[0].Fid != h.Fid {
+		t.Fatalf("the identical feature data should be matched first: %+v", ms)
+	}
+	for i := 1; i < len(ms); i++ {
+		if ms[i].Sim > ms[i-1].Sim || ms[i].Sim < 0 {
+			t.Errorf("matches should be positive and sorted by similarity: %+v", ms)
+		}
+	}
+}
@@ -0,0 +1,33 @@
+package indc
+
+//EMA exponential moving average of n periods.
+func EMA(src []float64, n int) []float64 {
+	r := make([]float64, len(src))
+	for i, v := range src {
+		if i == 0 {
+			r[i] = v
+		} else {
+			r[i] = (2*v + float64(n-1)*r[i-1]) / float64(n+1)
+		}
+	}
+	return r
+}
+
+//MACD calculates DIF, DEA and the MACD histogram, which is 2*(DIF-DEA).
+func MACD(src []float64, short, long, mid int) (dif, dea, macd []float64) {
+	es, el := EMA(src, short), EMA(src, long)
+	dif = make([]float64, len(src))
+	for i := range src {
+		dif[i] = es[i] - el[i]
+	}
+	dea = EMA(dif, mid)
+	macd = make([]float64, len(src))
+	for i := range src {
+		macd[i] = 2 * (dif[i] - dea[i])
+	}
+	return
+}
+
+func DeftMACD(src []float64) (dif, dea, macd []float64) {
+	return MACD(src, 12, 26, 9)
+}
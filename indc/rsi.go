@@ -0,0 +1,28 @@
+package indc
+
+import "math"
+
+//RSI relative strength index of n periods, ranging from 0 to 100.
+func RSI(src []float64, n int) []float64 {
+	up := make([]float64, len(src))
+	abs := make([]float64, len(src))
+	for i := 1; i < len(src); i++ {
+		d := src[i] - src[i-1]
+		up[i] = math.Max(d, 0)
+		abs[i] = math.Abs(d)
+	}
+	a, b := SMA(up, n, 1), SMA(abs, n, 1)
+	r := make([]float64, len(src))
+	for i := range r {
+		if b[i] != 0 {
+			r[i] = a[i] / b[i] * 100
+		} else {
+			r[i] = 50
+		}
+	}
+	return r
+}
+
+func DeftRSI(src []float64) []float64 {
+	return RSI(src, 14)
+}
@@ -0,0 +1,248 @@
+package indc
+
+import (
+	"math"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	//SIM_DEVIA sliding fixed-length deviation, see BestKdjDevi
+	SIM_DEVIA = "devia"
+	//SIM_DTW dynamic time warping constrained by a Sakoe-Chiba band, see KdjDtw
+	SIM_DTW = "dtw"
+	//SIM_ZED sliding z-normalised euclidean distance, see BestKdjZed
+	SIM_ZED = "zed"
+)
+
+// weights of K, D and J in the combined similarity, same as CalcKdjDevi
+var kdjWeights = [3]float64{.1, .4, .5}
+
+// maximum combined deviation with non-negative DEVIA, see devia
+var maxPosScc = math.Pow(1000, 1/math.E)
+
+//KdjSim measures the similarity between the source and target KDJ data sets, whose lengths may vary.
+// The result ranges from negative infinite to 1 on the DEVIA scale, with 1 indicating identical data sets
+// and negative values irrelevant ones.
+type KdjSim func(sk, sd, sj, tk, td, tj []float64) float64
+
+//KdjSimOf returns the KDJ similarity of the named metric. window is the width of the warping band
+// in proportion to the longer data set, and only applies to SIM_DTW. Empty name stands for SIM_DEVIA.
+func KdjSimOf(metric string, window float64) (KdjSim, error) {
+	switch metric {
+	case "", SIM_DEVIA:
+		return BestKdjDevi, nil
+	case SIM_DTW:
+		return KdjDtw(window), nil
+	case SIM_ZED:
+		return BestKdjZed, nil
+	}
+	return nil, errors.Errorf("unsupported similarity metric: %s", metric)
+}
+
+// devia maps the weighted deviation to the DEVIA scale.
+func devia(scc float64) float64 {
+	return -0.001*math.Pow(scc, math.E) + 1
+}
+
+//KdjDtw returns the KDJ similarity based on dynamic time warping, so a pattern stretched over more
+// or fewer bars is still matched. Each of K, D and J is warped independently within a Sakoe-Chiba band
+// of the specified width, and the root mean squared cost of each is combined into DEVIA like CalcKdjDevi.
+// Candidates are pruned by LB_Keogh and early abandoning once the similarity is bound to be negative,
+// in which case a negative value no less than the exact similarity is returned.
+func KdjDtw(window float64) KdjSim {
+	return func(sk, sd, sj, tk, td, tj []float64) float64 {
+		src := [3][]float64{sk, sd, sj}
+		tgt := [3][]float64{tk, td, tj}
+		n, m := len(sk), len(tk)
+		if n == 0 || m == 0 {
+			return devia(math.Inf(1))
+		}
+		r := dtwBand(n, m, window)
+		l := float64(imax(n, m))
+		var lbs [3]float64
+		lbScc := .0
+		for c := range src {
+			lbs[c] = math.Sqrt(lbKeogh(src[c], tgt[c], r) / l)
+			lbScc += kdjWeights[c] * lbs[c]
+		}
+		if lbScc > maxPosScc {
+			return devia(lbScc)
+		}
+		// exact cost of each channel, heaviest first, replacing its lower bound in the running total
+		scc := lbScc
+		for c := 2; c >= 0; c-- {
+			budget := (maxPosScc-scc)/kdjWeights[c] + lbs[c]
+			d, _ := dtw(src[c], tgt[c], r, budget*budget*l)
+			scc += kdjWeights[c] * (math.Sqrt(d/l) - lbs[c])
+			if scc > maxPosScc {
+				return devia(scc)
+			}
+		}
+		return devia(scc)
+	}
+}
+
+// dtwBand returns the half width of the warping band, in number of source elements around the diagonal
+// scaled to the lengths. The band is widened if needed so the last elements of both are reachable.
+func dtwBand(n, m int, window float64) int {
+	r := int(math.Ceil(window * float64(imax(n, m))))
+	if m == 1 {
+		return imax(r, n)
+	}
+	return imax(r, int(math.Ceil(float64(n-1)/float64(m-1))), 1)
+}
+
+// bandOf returns the range of source indices allowed to be aligned with the jth target element.
+func bandOf(j, n, m, r int) (lo, hi int) {
+	c := .0
+	if m > 1 {
+		c = float64(j) * float64(n-1) / float64(m-1)
+	}
+	lo = imax(0, int(math.Ceil(c-float64(r))))
+	hi = imin(n-1, int(math.Floor(c+float64(r))))
+	return
+}
+
+// lbKeogh returns the LB_Keogh lower bound of the squared dtw cost between s and t: the squared distance
+// of each target element to the envelope of source elements within its band.
+func lbKeogh(s, t []float64, r int) (lb float64) {
+	n, m := len(s), len(t)
+	for j, v := range t {
+		lo, hi := bandOf(j, n, m, r)
+		u, l := s[lo], s[lo]
+		for i := lo + 1; i <= hi; i++ {
+			u = math.Max(u, s[i])
+			l = math.Min(l, s[i])
+		}
+		if v > u {
+			lb += (v - u) * (v - u)
+		} else if v < l {
+			lb += (l - v) * (l - v)
+		}
+	}
+	return
+}
+
+// dtw returns the squared cost of the optimal warping path between s and t within the band.
+// The calculation is abandoned as soon as the cost is bound to exceed the budget, in which case
+// the cost returned is a lower bound exceeding the budget.
+func dtw(s, t []float64, r int, budget float64) (cost float64, abandoned bool) {
+	n, m := len(s), len(t)
+	inf := math.Inf(1)
+	prev := make([]float64, n)
+	cur := make([]float64, n)
+	for i := range prev {
+		prev[i] = inf
+	}
+	for j := 0; j < m; j++ {
+		for i := range cur {
+			cur[i] = inf
+		}
+		lo, hi := bandOf(j, n, m, r)
+		rmin := inf
+		for i := lo; i <= hi; i++ {
+			best := inf
+			if j == 0 && i == 0 {
+				best = 0
+			}
+			if j > 0 {
+				best = math.Min(best, prev[i])
+				if i > 0 {
+					best = math.Min(best, prev[i-1])
+				}
+			}
+			if i > 0 {
+				best = math.Min(best, cur[i-1])
+			}
+			d := s[i] - t[j]
+			cur[i] = best + d*d
+			rmin = math.Min(rmin, cur[i])
+		}
+		if rmin > budget {
+			return rmin, true
+		}
+		prev, cur = cur, prev
+	}
+	return prev[n-1], false
+}
+
+//BestKdjZed Calculates the best match similarity of z-normalised K, D and J, sliding the shorter data set
+// along the longer one like BestKdjDevi. Offset and amplitude of the patterns are ignored, so the
+// similarity of each line equals their Pearson correlation, ranging from -1 to 1.
+func BestKdjZed(sk, sd, sj, tk, td, tj []float64) float64 {
+	if len(sk) == 0 || len(tk) == 0 {
+		return -1
+	}
+	src := [3][]float64{sk, sd, sj}
+	tgt := [3][]float64{tk, td, tj}
+	if len(sk) < len(tk) {
+		src, tgt = tgt, src
+	}
+	w := len(tgt[0])
+	best := -1.0
+	for i := 0; i+w <= len(src[0]); i++ {
+		sim := .0
+		for c := range src {
+			sim += kdjWeights[c] * zedSim(src[c][i:i+w], tgt[c])
+		}
+		best = math.Max(best, sim)
+	}
+	return best
+}
+
+// zedSim returns 1 - d²/2n, where d is the euclidean distance of the z-normalised a and b, i.e. their
+// Pearson correlation. Flat data sets are only similar to flat ones.
+func zedSim(a, b []float64) float64 {
+	za, fa := znorm(a)
+	zb, fb := znorm(b)
+	if fa || fb {
+		if fa && fb {
+			return 1
+		}
+		return 0
+	}
+	d := .0
+	for i := range za {
+		d += (za[i] - zb[i]) * (za[i] - zb[i])
+	}
+	return 1 - d/2/float64(len(za))
+}
+
+// znorm returns the z-normalised a, and whether a is flat.
+func znorm(a []float64) (z []float64, flat bool) {
+	mean := .0
+	for _, v := range a {
+		mean += v
+	}
+	mean /= float64(len(a))
+	sd := .0
+	for _, v := range a {
+		sd += (v - mean) * (v - mean)
+	}
+	sd = math.Sqrt(sd / float64(len(a)))
+	if sd < 1e-9 {
+		return nil, true
+	}
+	z = make([]float64, len(a))
+	for i, v := range a {
+		z[i] = (v - mean) / sd
+	}
+	return z, false
+}
+
+func imax(a int, b ...int) int {
+	for _, v := range b {
+		if v > a {
+			a = v
+		}
+	}
+	return a
+}
+
+func imin(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,141 @@
+package indc
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/carusyte/stock/model"
+)
+
+// kdjPattern samples a golden cross like kdj pattern at n evenly spaced points, with the specified
+// offset and amplitude.
+func kdjPattern(n int, offset, amp float64) (k, d, j []float64) {
+	k, d, j = make([]float64, n), make([]float64, n), make([]float64, n)
+	for i := 0; i < n; i++ {
+		x := float64(i) / float64(n-1)
+		k[i] = offset + amp*math.Sin(math.Pi*(x-0.5))
+		d[i] = offset + 0.8*amp*math.Sin(math.Pi*(x-0.65))
+		j[i] = 3*k[i] - 2*d[i]
+	}
+	return
+}
+
+func randKdj(r *rand.Rand, n int) (k, d, j []float64) {
+	k, d, j = make([]float64, n), make([]float64, n), make([]float64, n)
+	k[0], d[0] = r.Float64()*100, r.Float64()*100
+	for i := 0; i < n; i++ {
+		if i > 0 {
+			k[i] = math.Min(100, math.Max(0, k[i-1]+r.NormFloat64()*10))
+			d[i] = 2./3.*d[i-1] + 1./3.*k[i]
+		}
+		j[i] = 3*k[i] - 2*d[i]
+	}
+	return
+}
+
+func TestKdjSimStretched(t *testing.T) {
+	sk, sd, sj := kdjPattern(8, 50, 30)
+	tk, td, tj := kdjPattern(12, 50, 30)
+	dv := BestKdjDevi(sk, sd, sj, tk, td, tj)
+	dt := KdjDtw(0.2)(sk, sd, sj, tk, td, tj)
+	t.Logf("stretched pattern, devia: %f, dtw: %f", dv, dt)
+	if dt < 0.8 || dt <= dv {
+		t.Errorf("dtw should match the stretched pattern better than devia, devia: %f, dtw: %f", dv, dt)
+	}
+	if s := KdjDtw(0.2)(sk, sd, sj, sk, sd, sj); s != 1 {
+		t.Errorf("dtw similarity of identical data should be 1: %f", s)
+	}
+	// same shape at lower level and smaller amplitude
+	tk, td, tj = kdjPattern(8, 30, 15)
+	dv = BestKdjDevi(sk, sd, sj, tk, td, tj)
+	zd := BestKdjZed(sk, sd, sj, tk, td, tj)
+	t.Logf("scaled pattern, devia: %f, zed: %f", dv, zd)
+	if zd < 0.99 || zd <= dv {
+		t.Errorf("zed should match the scaled pattern better than devia, devia: %f, zed: %f", dv, zd)
+	}
+}
+
+func TestLbKeogh(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 500; i++ {
+		n, m := 3+r.Intn(10), 3+r.Intn(10)
+		s, _, _ := randKdj(r, n)
+		q, _, _ := randKdj(r, m)
+		w := dtwBand(n, m, r.Float64()*0.5)
+		d, ab := dtw(s, q, w, math.Inf(1))
+		if ab || math.IsInf(d, 1) {
+			t.Fatalf("no warping path within band %d, n: %d, m: %d", w, n, m)
+		}
+		if lb := lbKeogh(s, q, w); lb > d+1e-9 {
+			t.Fatalf("lower bound %f exceeds dtw cost %f, n: %d, m: %d, band: %d", lb, d, n, m, w)
+		}
+		if c, ab := dtw(s, q, w, d/2); ab && c <= d/2 {
+			t.Fatalf("abandoned cost %f should exceed the budget %f", c, d/2)
+		}
+	}
+}
+
+func TestKdjDtwPruning(t *testing.T) {
+	r := rand.New(rand.NewSource(2))
+	for i := 0; i < 500; i++ {
+		sk, sd, sj := randKdj(r, 5+r.Intn(5))
+		tk, td, tj := randKdj(r, 5+r.Intn(5))
+		pruned := KdjDtw(0.2)(sk, sd, sj, tk, td, tj)
+		// exact similarity without any pruning
+		w := dtwBand(len(sk), len(tk), 0.2)
+		l := float64(imax(len(sk), len(tk)))
+		scc := .0
+		for c, p := range [][2][]float64{{sk, tk}, {sd, td}, {sj, tj}} {
+			d, _ := dtw(p[0], p[1], w, math.Inf(1))
+			scc += kdjWeights[c] * math.Sqrt(d/l)
+		}
+		exact := devia(scc)
+		if exact >= 0 && math.Abs(pruned-exact) > 1e-9 {
+			t.Fatalf("positive similarity should be exact, pruned: %f, exact: %f", pruned, exact)
+		}
+		if exact < 0 && (pruned >= 0 || pruned < exact-1e-9) {
+			t.Fatalf("pruned similarity should be negative and no less than the exact one, "+
+				"pruned: %f, exact: %f", pruned, exact)
+		}
+	}
+}
+
+func benchKdjSim(b *testing.B, sim KdjSim) {
+	r := rand.New(rand.NewSource(3))
+	hk, hd, hj := randKdj(r, 8)
+	hist := make([]*model.Indicator, len(hk))
+	for i := range hist {
+		hist[i] = &model.Indicator{Code: "bench", KDJ_K: hk[i], KDJ_D: hd[i], KDJ_J: hj[i]}
+	}
+	fdvs := make([]*model.KDJfdView, 1000)
+	for i := range fdvs {
+		f := &model.KDJfdView{Weight: 1. / float64(len(fdvs))}
+		f.K, f.D, f.J = randKdj(r, 6+r.Intn(5))
+		fdvs[i] = f
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		CalcKdjDI(hist, fdvs, sim)
+	}
+}
+
+func BenchmarkKdjSimDevia(b *testing.B) { benchKdjSim(b, BestKdjDevi) }
+
+func BenchmarkKdjSimZed(b *testing.B) { benchKdjSim(b, BestKdjZed) }
+
+func BenchmarkKdjSimDtw(b *testing.B) { benchKdjSim(b, KdjDtw(0.2)) }
+
+// dtw without lower bound pruning nor early abandoning, as the baseline of BenchmarkKdjSimDtw
+func BenchmarkKdjSimDtwUnpruned(b *testing.B) {
+	benchKdjSim(b, func(sk, sd, sj, tk, td, tj []float64) float64 {
+		w := dtwBand(len(sk), len(tk), 0.2)
+		l := float64(imax(len(sk), len(tk)))
+		scc := .0
+		for c, p := range [][2][]float64{{sk, tk}, {sd, td}, {sj, tj}} {
+			d, _ := dtw(p[0], p[1], w, math.Inf(1))
+			scc += kdjWeights[c] * math.Sqrt(d/l)
+		}
+		return devia(scc)
+	})
+}
@@ -0,0 +1,145 @@
+package metrics
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/carusyte/stock/conf"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/satori/go.uuid"
+	logr "github.com/sirupsen/logrus"
+)
+
+const NAMESPACE = "stock"
+
+var (
+	//RunID identifies the current process run in structured logs
+	RunID = fmt.Sprintf("%s", uuid.NewV1())
+
+	httpReqs = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: NAMESPACE,
+		Subsystem: "http",
+		Name:      "requests_total",
+		Help:      "Number of http requests per source and status.",
+	}, []string{"source", "status"})
+	httpLatency = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: NAMESPACE,
+		Subsystem: "http",
+		Name:      "request_duration_seconds",
+		Help:      "Latency of http requests per source.",
+		Buckets:   prometheus.ExponentialBuckets(0.05, 2, 12),
+	}, []string{"source"})
+	httpRetries = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: NAMESPACE,
+		Subsystem: "http",
+		Name:      "retries_total",
+		Help:      "Number of http request retries per source.",
+	}, []string{"source"})
+	rowsUpserted = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: NAMESPACE,
+		Subsystem: "db",
+		Name:      "rows_upserted_total",
+		Help:      "Number of rows inserted or updated per table.",
+	}, []string{"table"})
+	stageDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: NAMESPACE,
+		Subsystem: "stage",
+		Name:      "duration_seconds",
+		Help:      "Time elapsed for each processing stage.",
+		Buckets:   prometheus.ExponentialBuckets(1, 2, 16),
+	}, []string{"stage"})
+	rpcLatency = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: NAMESPACE,
+		Subsystem: "rpc",
+		Name:      "call_duration_seconds",
+		Help:      "Latency of rpc calls per server and service.",
+		Buckets:   prometheus.ExponentialBuckets(0.01, 2, 16),
+	}, []string{"server", "service"})
+	rpcFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: NAMESPACE,
+		Subsystem: "rpc",
+		Name:      "failures_total",
+		Help:      "Number of failed rpc calls per server and service.",
+	}, []string{"server", "service"})
+	scorerDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: NAMESPACE,
+		Subsystem: "scorer",
+		Name:      "duration_seconds",
+		Help:      "Execution time of each scorer.",
+		Buckets:   prometheus.ExponentialBuckets(0.1, 2, 16),
+	}, []string{"scorer"})
+)
+
+func init() {
+	prometheus.MustRegister(httpReqs, httpLatency, httpRetries, rowsUpserted, stageDuration,
+		rpcLatency, rpcFailures, scorerDuration)
+}
+
+// Serve exposes the /metrics endpoint at metrics_address configured in stock.toml.
+// Nothing is served if the address is not set.
+func Serve() {
+	addr := conf.Args().MetricsAddress
+	if addr == "" {
+		return
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+	go func() {
+		if e := http.ListenAndServe(addr, mux); e != nil {
+			logr.Errorf("metrics endpoint at %s stopped\n%+v", addr, e)
+		}
+	}()
+	logr.WithField("run", RunID).Infof("metrics endpoint listening at %s/metrics", addr)
+}
+
+// HttpRequest records a completed http request against the source host. Status 0 denotes
+// a transport error without http response.
+func HttpRequest(source string, status int, start time.Time) {
+	sts := "error"
+	if status > 0 {
+		sts = strconv.Itoa(status)
+	}
+	httpReqs.WithLabelValues(source, sts).Inc()
+	httpLatency.WithLabelValues(source).Observe(time.Since(start).Seconds())
+}
+
+// HttpRetry records a retry of http request against the source host.
+func HttpRetry(source string) {
+	httpRetries.WithLabelValues(source).Inc()
+}
+
+// RowsUpserted records the number of rows inserted or updated for the table.
+func RowsUpserted(table string, n int) {
+	if n > 0 {
+		rowsUpserted.WithLabelValues(table).Add(float64(n))
+	}
+}
+
+// Stage records the duration of the processing stage and logs it as structured run telemetry.
+func Stage(stage string, start, end time.Time) {
+	dur := end.Sub(start).Seconds()
+	stageDuration.WithLabelValues(stage).Observe(dur)
+	logr.WithFields(logr.Fields{
+		"run":   RunID,
+		"stage": stage,
+		"start": start.Format("2006-01-02 15:04:05"),
+		"end":   end.Format("2006-01-02 15:04:05"),
+		"dur":   dur,
+	}).Info("stage complete")
+}
+
+// RpcCall records the latency and the outcome of a rpc call.
+func RpcCall(server, service string, start time.Time, e error) {
+	rpcLatency.WithLabelValues(server, service).Observe(time.Since(start).Seconds())
+	if e != nil {
+		rpcFailures.WithLabelValues(server, service).Inc()
+	}
+}
+
+// ScorerTime records the execution time of the scorer. Use it in defer statement.
+func ScorerTime(scorer string, start time.Time) {
+	scorerDuration.WithLabelValues(scorer).Observe(time.Since(start).Seconds())
+}
@@ -0,0 +1,48 @@
+package metrics
+
+import (
+	"io/ioutil"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+func TestExposition(t *testing.T) {
+	st := time.Now()
+	HttpRequest("basic.10jqka.com.cn", 200, st)
+	HttpRequest("basic.10jqka.com.cn", 0, st)
+	HttpRetry("basic.10jqka.com.cn")
+	RowsUpserted("kline_d", 20)
+	Stage("GET_FINANCE", st, time.Now())
+	RpcCall("localhost:45321", "IndcScorer.ScoreKdj", st, errors.New("test"))
+	ScorerTime("KDJV", st)
+
+	srv := httptest.NewServer(promhttp.Handler())
+	defer srv.Close()
+	res, e := srv.Client().Get(srv.URL)
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer res.Body.Close()
+	body, e := ioutil.ReadAll(res.Body)
+	if e != nil {
+		t.Fatal(e)
+	}
+	for _, m := range []string{
+		`stock_http_requests_total{source="basic.10jqka.com.cn",status="200"} 1`,
+		`stock_http_requests_total{source="basic.10jqka.com.cn",status="error"} 1`,
+		`stock_http_retries_total{source="basic.10jqka.com.cn"} 1`,
+		`stock_db_rows_upserted_total{table="kline_d"} 20`,
+		`stock_stage_duration_seconds_count{stage="GET_FINANCE"} 1`,
+		`stock_rpc_failures_total{server="localhost:45321",service="IndcScorer.ScoreKdj"} 1`,
+		`stock_scorer_duration_seconds_count{scorer="KDJV"} 1`,
+	} {
+		if !strings.Contains(string(body), m) {
+			t.Errorf("metric not found: %s", m)
+		}
+	}
+}
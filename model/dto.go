@@ -4,6 +4,7 @@ import (
 	"database/sql"
 	"encoding/json"
 	"fmt"
+	"github.com/carusyte/stock/metrics"
 	"github.com/carusyte/stock/util"
 	"log"
 	"strings"
@@ -327,6 +328,128 @@ type Finance struct {
 	Utime sql.NullString
 }
 
+//FinTTM single quarter (Q) and trailing twelve months (TTM) metrics derived from the year-to-date Finance
+// of the report period, see getd.FinTTM. Roe of TTM and single quarter is approximated in the same way as
+// the other metrics. Shares in 100 million is derived from Np / Eps of the period.
+type FinTTM struct {
+	Code     string
+	Year     string
+	EpsQ     sql.NullFloat64 `db:"eps_q"`
+	EpsTtm   sql.NullFloat64 `db:"eps_ttm"`
+	NpQ      sql.NullFloat64 `db:"np_q"`
+	NpTtm    sql.NullFloat64 `db:"np_ttm"`
+	GrQ      sql.NullFloat64 `db:"gr_q"`
+	GrTtm    sql.NullFloat64 `db:"gr_ttm"`
+	RoeQ     sql.NullFloat64 `db:"roe_q"`
+	RoeTtm   sql.NullFloat64 `db:"roe_ttm"`
+	OcfpsQ   sql.NullFloat64 `db:"ocfps_q"`
+	OcfpsTtm sql.NullFloat64 `db:"ocfps_ttm"`
+	Navps    sql.NullFloat64
+	Shares   sql.NullFloat64
+	Udate    sql.NullString
+	Utime    sql.NullString
+}
+
+//Valuation daily valuation at non-reinstated close, based on the latest FinTTM due by the date, see getd.Valuate.
+// Dyr is the trailing twelve months pre-tax dividend yield in percentage. Valuation of composite indices
+// aggregates that of the member stocks weighted by market cap, see getd.IdxUniverse.
+type Valuation struct {
+	Code  string
+	Date  string
+	Klid  int
+	Close float64
+	Year  string
+	PeTtm sql.NullFloat64 `db:"pe_ttm"`
+	Pb    sql.NullFloat64
+	PsTtm sql.NullFloat64 `db:"ps_ttm"`
+	Dyr   float64
+	//MktCap market cap in 100 million
+	MktCap sql.NullFloat64 `db:"mktcap"`
+	Udate  sql.NullString
+	Utime  sql.NullString
+}
+
+//valuation metrics
+const (
+	VAL_PE  = "PE"
+	VAL_PB  = "PB"
+	VAL_PS  = "PS"
+	VAL_DYR = "DYR"
+)
+
+//ValBand percentile and band of a valuation metric on Date within the trailing window of Years, see
+// getd.ValBands. Pct is the percentile of Value among the samples, invalid if Value is not positive
+// for PE, PB and PS. P20, P50 and P80 are the 20th, 50th and 80th percentile values.
+type ValBand struct {
+	Code    string
+	Metric  string
+	Years   int
+	Date    string
+	Value   sql.NullFloat64
+	Pct     sql.NullFloat64
+	Min     float64
+	P20     float64
+	P50     float64
+	P80     float64
+	Max     float64
+	Samples int
+	Udate   sql.NullString
+	Utime   sql.NullString
+}
+
+//sector hierarchy levels
+const (
+	SECTOR_LV_SECTOR   = "S" // standard sector, see SectorMap
+	SECTOR_LV_INDUSTRY = "I" // industry of basics
+)
+
+//SECTOR_OTHER sector of stocks without industry, or of industries not classified
+const SECTOR_OTHER = "其他"
+
+//SectorMap classifies an industry of basics into a standard sector, see getd.UpdSectorMap.
+type SectorMap struct {
+	Industry string
+	Sector   string
+	Udate    sql.NullString
+	Utime    sql.NullString
+}
+
+//SectorIdx daily index of a sector or industry, see getd.CalcSectorIdx. Ew and Cw are the equal weighted and
+// circulating market cap weighted index based at 1000, EwRet and CwRet are their daily returns in percentage.
+type SectorIdx struct {
+	Level   string
+	Name    string
+	Date    string
+	Members int
+	EwRet   float64 `db:"ew_ret"`
+	CwRet   float64 `db:"cw_ret"`
+	Ew      float64
+	Cw      float64
+	//MktCap circulating market cap of the members in 100 million
+	MktCap float64 `db:"mktcap"`
+	Udate  sql.NullString
+	Utime  sql.NullString
+}
+
+//SectorStrength relative strength of a sector or industry over Days against the benchmark index as of Date,
+// see getd.SectorStrengths. Returns are in percentage, based on the cap weighted index unless stated.
+type SectorStrength struct {
+	Level    string
+	Name     string
+	Date     string
+	Days     int
+	Ret      float64
+	EwRet    float64
+	BenchRet float64
+	//RS Ret in excess of BenchRet in percentage points
+	RS   float64
+	Rank int
+	//PrevRank rank by RS as of Days ago, 0 if unavailable
+	PrevRank int
+	//Shift PrevRank - Rank, positive if rotating into strength
+	Shift int
+}
+
 type FinReport struct {
 	Items []*Finance
 }
@@ -480,6 +603,34 @@ func (fin *FinReport) UnmarshalJSON(b []byte) error {
 	return nil
 }
 
+//financial statements
+const (
+	STMT_BALANCE  = "BS" // balance sheet
+	STMT_INCOME   = "IS" // income statement
+	STMT_CASHFLOW = "CF" // cash flow statement
+)
+
+//FinStmt a line item of financial statement in the report period, linked to Finance by code and year.
+// Amounts are in 100 million (亿) as in Finance, per share items in yuan.
+type FinStmt struct {
+	Code  string
+	Year  string
+	Stmt  string
+	Item  string
+	Value sql.NullFloat64
+	Udate sql.NullString
+	Utime sql.NullString
+}
+
+//FinItem describes a line item of financial statement. Item is the normalized key of the original
+// title, or the title itself if not normalized, see getd.ParseFinStmt.
+type FinItem struct {
+	Stmt  string
+	Item  string
+	Title string
+	Unit  string
+}
+
 type Quote struct {
 	Code   string `db:",size:6"`
 	Date   string `db:",size:10"`
@@ -509,6 +660,24 @@ func (q *Quote) String() string {
 	return fmt.Sprintf("%v", string(j))
 }
 
+//TotalReturn daily total return index with dividends reinvested at close of ex-date, see getd.TotalReturn.
+// Tri equals Close on the first day, and grows with Close thereafter as if the cash dividends, pre-tax
+// for Tri and after-tax for TriAtx, were spent on more shares. Divi, DiviAtx and Ratio are the per share
+// dividends and share multiplier of the ex-date.
+type TotalReturn struct {
+	Code    string
+	Date    string
+	Klid    int
+	Close   float64
+	Divi    float64
+	DiviAtx float64 `db:"divi_atx"`
+	Ratio   float64
+	Tri     float64
+	TriAtx  float64 `db:"tri_atx"`
+	Udate   string
+	Utime   string
+}
+
 type K60MinList struct {
 	Quotes []*Quote
 }
@@ -686,8 +855,10 @@ type IndcFeatRaw struct {
 	Tspan   int
 	Mpt     float64
 	Remarks sql.NullString
-	Udate   string
-	Utime   string
+	//Ver sampling version, see FeatVer
+	Ver   string
+	Udate string
+	Utime string
 }
 
 func (indf *IndcFeatRaw) GenFid() string {
@@ -700,6 +871,7 @@ func (indf *IndcFeatRaw) String() string {
 }
 
 type IndcFeat struct {
+	Ver     string
 	Indc    string
 	Fid     string
 	Cytp    string
@@ -713,6 +885,7 @@ type IndcFeat struct {
 }
 
 type KDJfd struct {
+	Ver   string
 	Fid   string
 	Seq   int
 	K     float64
@@ -730,6 +903,25 @@ type KDJfdView struct {
 	K                        []float64
 	D                        []float64
 	J                        []float64
+	//SrcCode, SrcFid the raw sample this feature data is taken from, i.e. the medoid of a cluster
+	SrcCode, SrcFid string
+}
+
+//KdjMatch a feature data matched by kdj history, along with its source sample. SmpDate, Mark and Tspan
+// are filled from the source sample, see getd.FillKdjMatch.
+type KdjMatch struct {
+	Fid     string
+	Cytp    CYTP
+	Bysl    string
+	SrcCode string
+	SrcFid  string
+	SmpDate string
+	Mark    float64
+	Tspan   int
+	//Sim similarity between the kdj history and the feature data
+	Sim    float64
+	Weight float64
+	FdNum  int
 }
 
 func (kfv *KDJfdView) Add(k, d, j float64) {
@@ -747,8 +939,10 @@ func (v *KDJfdView) String() string {
 }
 
 type KDJfdRaw struct {
-	Code  string
-	Fid   string
+	Code string
+	Fid  string
+	//Ver sampling version, see FeatVer
+	Ver   string
 	Klid  int
 	K     float64
 	D     float64
@@ -758,8 +952,44 @@ type KDJfdRaw struct {
 	Feat  *IndcFeatRaw
 }
 
+//FeatDatRaw a step of generic indicator feature window, Vals holds the values of all dimensions in JSON array.
+type FeatDatRaw struct {
+	Code  string
+	Indc  string
+	Fid   string
+	Klid  int
+	Vals  string
+	Udate string
+	Utime string
+}
+
+//FeatView generic indicator feature window, Vals[i] holds the values of all dimensions at Klid[i].
+type FeatView struct {
+	Code, Indc, Fid, Bysl string
+	Cytp                  CYTP
+	SmpDate               string
+	SmpNum                int
+	Klid                  []int
+	Vals                  [][]float64
+}
+
+func (fv *FeatView) Add(klid int, vals []float64) {
+	fv.Klid = append(fv.Klid, klid)
+	fv.Vals = append(fv.Vals, vals)
+}
+
+//Dim returns the values of the ith dimension across the window.
+func (fv *FeatView) Dim(i int) []float64 {
+	d := make([]float64, len(fv.Vals))
+	for j, v := range fv.Vals {
+		d[j] = v[i]
+	}
+	return d
+}
+
 type KDJfdrView struct {
 	Code    string
+	Fid     string
 	SmpDate string
 	SmpNum  int
 	Klid    []int
@@ -776,9 +1006,107 @@ func (kfv *KDJfdrView) Add(klid int, k, d, j float64) {
 }
 
 type KDJVStat struct {
-	Code, Frmdt, Todt, Udate, Utime             string
+	Code, Ver, Frmdt, Todt, Udate, Utime        string
 	Dod, Sl, Sh, Bl, Bh, Sor, Bor, Smean, Bmean float64
 	Scnt, Bcnt                                  int
+	//Pkey key of the scoring parameters and feature data of the sample points
+	Pkey string
+}
+
+//KDJVStatSmp score of a buy or sell sample point of kdjv stats, null if disqualified for scoring.
+type KDJVStatSmp struct {
+	Code, Ver, Bysl, Date string
+	Klid                  int
+	Score                 sql.NullFloat64
+	Udate, Utime          string
+}
+
+//FeatVer a version of indicator feature model. Kind is either "SMP", the raw samples taken with the
+// parameters, or "FD", the feature data pruned from the raw samples of SmpVer and derived from Parent if
+// updated incrementally. Only READY versions are used for scoring.
+type FeatVer struct {
+	Ver     string
+	Indc    string
+	Kind    string
+	Params  string
+	Parent  string
+	SmpVer  string `db:"smp_ver"`
+	RunID   string `db:"run_id"`
+	Status  string
+	Remarks sql.NullString
+	Udate   string
+	Utime   string
+}
+
+//KdjFdKey returns the key of kdj feature data group of the version, in the form of "<ver>:<cytp>-<bysl>-<num>".
+func KdjFdKey(ver string, cytp CYTP, bysl string, num int) string {
+	return fmt.Sprintf("%s:%s-%s-%d", ver, cytp, bysl, num)
+}
+
+//PfAccount portfolio account.
+type PfAccount struct {
+	Acct  string
+	Name  sql.NullString
+	Udate string
+	Utime string
+}
+
+//PfTrade a cash flow or trade of portfolio account. Amount is the signed change of cash. For DEPOSIT and
+// WITHDRAW, Price is the sum of cash. For DIVI, Qty is the shares registered and Price the dividend per share;
+// for BONUS, Qty is the shares allotted or converted.
+// Xdxr is the idx of the xdxr event that the DIVI or BONUS trade derives from.
+type PfTrade struct {
+	ID      int64 `db:"id"`
+	Acct    string
+	Code    string
+	Date    string
+	Kind    string
+	Qty     float64
+	Price   float64
+	Fee     float64
+	Amount  float64
+	Xdxr    sql.NullInt64 `db:"xdxr_idx"`
+	Remarks sql.NullString
+	Udate   string
+	Utime   string
+}
+
+//PfPosition a holding of portfolio account. Cost is the total cost basis of the shares held, Realized
+// accumulates gains of sold shares and cash dividends. Price and Unrealized are valuated on demand.
+type PfPosition struct {
+	Acct       string
+	Code       string
+	Qty        float64
+	Cost       float64
+	Realized   float64
+	Price      float64 `db:"-"`
+	Unrealized float64 `db:"-"`
+	Udate      string
+	Utime      string
+}
+
+//AvgCost returns cost basis per share.
+func (p *PfPosition) AvgCost() float64 {
+	if p.Qty == 0 {
+		return 0
+	}
+	return p.Cost / p.Qty
+}
+
+//PfNav daily net asset value of portfolio account. Units are issued and redeemed at the nav of the day
+// on deposit and withdrawal, so that nav reflects the return of investment only.
+type PfNav struct {
+	Acct       string
+	Date       string
+	Cash       float64
+	MktVal     float64 `db:"mkt_val"`
+	Total      float64
+	Units      float64
+	Nav        float64
+	Realized   float64
+	Unrealized float64
+	Udate      string
+	Utime      string
 }
 
 type XQJson struct {
@@ -828,6 +1156,7 @@ func (xqj *XQJson) Save(dbmap *gorp.DbMap, sklid int, table string) {
 			table, strings.Join(valueStrings, ","))
 		_, err := dbmap.Exec(stmt, valueArgs...)
 		util.CheckErr(err, code+" failed to bulk insert "+table)
+		metrics.RowsUpserted(table, len(xqj.Chartlist))
 	}
 }
 
@@ -932,6 +1261,7 @@ func (qj *QQJson) Save(dbmap *gorp.DbMap, table string) {
 			table, strings.Join(valueStrings, ","))
 		_, err := dbmap.Exec(stmt, valueArgs...)
 		util.CheckErr(err, qj.Code+" failed to bulk insert "+table)
+		metrics.RowsUpserted(table, len(qj.Quotes))
 	}
 }
 
@@ -939,3 +1269,31 @@ func (qj *QQJson) Save(dbmap *gorp.DbMap, table string) {
 type IdxLst struct {
 	Code, Name, Src string
 }
+
+//IdxCst constituent Stock of index Code and its weight in percentage in the snapshot effective on Date, until
+// the next snapshot of the index, see getd.GetIdxCsts.
+type IdxCst struct {
+	Code   string
+	Date   string
+	Stock  string
+	Name   string
+	Weight float64
+	Udate  sql.NullString
+	Utime  sql.NullString
+}
+
+//IdxContrib contribution of a constituent Stock to the return of index Code between From and To, see
+// getd.IdxContribs.
+type IdxContrib struct {
+	Code  string
+	Stock string
+	Name  string
+	From  string
+	To    string
+	//Weight as of From in percentage, drifted by price from the latest snapshot before
+	Weight float64
+	//Ret return of the stock in percentage
+	Ret float64
+	//Contrib Weight * Ret in percentage points of the index return
+	Contrib float64
+}
@@ -0,0 +1,56 @@
+package model
+
+// Request and reply types of the rpc services. Field names are part of the wire format (gob)
+// and must be kept in line with whatever rpc servers are deployed.
+
+//KdjSeries kdj history of a sample point in day, week and month cycle, identified by RowId.
+type KdjSeries struct {
+	RowId string
+	KdjDy []*Indicator
+	KdjWk []*Indicator
+	KdjMo []*Indicator
+}
+
+//KdjScoreReq request of IndcScorer.ScoreKdj, weights are applied to scores of each cycle.
+// SimMetric and DtwWindow select the similarity measure, see indc.KdjSimOf.
+// TopMatch number of most similar buy and sell feature data to be returned for each cycle.
+// Ver the feature data version to score against, which must have been synchronized.
+type KdjScoreReq struct {
+	Data      []*KdjSeries
+	WgtDay    float64
+	WgtWeek   float64
+	WgtMonth  float64
+	SimMetric string
+	DtwWindow float64
+	TopMatch  int
+	Ver       string
+}
+
+//KdjScoreRep reply of IndcScorer.ScoreKdj. Detail holds hdr/pdr/mpd/di of each cycle,
+// keyed by "<cytp>.<b|s><name>", i.e. "D.bhdr" or "M.sdi". Matches holds the most similar
+// feature data of all cycles.
+type KdjScoreRep struct {
+	RowIds  []string
+	Scores  []float64
+	Detail  []map[string]interface{}
+	Matches [][]*KdjMatch
+}
+
+//KdjPruneReq request of IndcScorer.PruneKdj. SimMetric and DtwWindow select the similarity measure
+// of clustering, see indc.KdjSimOf.
+type KdjPruneReq struct {
+	ID        string
+	Prec      float64
+	PruneRate float64
+	Data      []*KDJfdView
+	SimMetric string
+	DtwWindow float64
+}
+
+//KdjPruneRep reply of IndcScorer.PruneKdj. Data holds the clusters, and Assign the cluster index
+// of each feature data in request.
+type KdjPruneRep struct {
+	ID     string
+	Data   []*KDJfdView
+	Assign []int
+}
@@ -0,0 +1,139 @@
+//
+// Manages portfolio accounts: books trades and cash flows, applies dividends and bonus shares from xdxr,
+// rebuilds daily nav and shows holdings with P&L. Holdings can be assessed by the exit advisor.
+//
+// e.g.
+//   pf -acct main -new "Main Account" -cash 1000000
+//   pf -acct main -buy 600000:1000@10.52 -fee 5 -date 2018-10-19
+//   pf -acct main -xdxr -nav -exit
+//
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/carusyte/stock/metrics"
+	"github.com/carusyte/stock/model"
+	"github.com/carusyte/stock/portfolio"
+	"github.com/carusyte/stock/score"
+	"github.com/carusyte/stock/util"
+	"github.com/olekukonko/tablewriter"
+	"github.com/pkg/errors"
+)
+
+const APP_VERSION = "0.1"
+
+var (
+	versionFlag *bool    = flag.Bool("v", false, "Print the version number.")
+	acct        *string  = flag.String("acct", "", "The portfolio account.")
+	newAcct     *string  = flag.String("new", "", "Create the account with the specified name.")
+	date        *string  = flag.String("date", time.Now().Format("2006-01-02"), "Date of the trade or cash flow.")
+	cash        *float64 = flag.Float64("cash", 0, "Initial cash of the new account.")
+	deposit     *float64 = flag.Float64("deposit", 0, "Deposit cash into the account.")
+	withdraw    *float64 = flag.Float64("withdraw", 0, "Withdraw cash from the account.")
+	buy         *string  = flag.String("buy", "", "Buy stock, in the form of <code>:<qty>@<price>.")
+	sell        *string  = flag.String("sell", "", "Sell stock, in the form of <code>:<qty>@<price>.")
+	fee         *float64 = flag.Float64("fee", 0, "Fee and tax of the trade.")
+	xdxr        *bool    = flag.Bool("xdxr", false, "Book dividends and bonus shares from xdxr.")
+	nav         *bool    = flag.Bool("nav", false, "Rebuild daily nav and show the latest ones.")
+	exit        *bool    = flag.Bool("exit", false, "Assess holdings with the exit advisor.")
+)
+
+func main() {
+	flag.Parse() // Scan the arguments list
+	metrics.Serve()
+
+	if *versionFlag {
+		fmt.Println("Version:", APP_VERSION)
+		return
+	}
+	if *acct == "" {
+		fmt.Println("Portfolio account is needed.")
+		return
+	}
+	if *newAcct != "" {
+		util.CheckErr(portfolio.NewAccount(*acct, *newAcct, *date, *cash), "failed to create account")
+	}
+	var trades []*model.PfTrade
+	if *deposit > 0 {
+		trades = append(trades, &model.PfTrade{Acct: *acct, Date: *date, Kind: portfolio.DEPOSIT, Price: *deposit})
+	}
+	if *withdraw > 0 {
+		trades = append(trades, &model.PfTrade{Acct: *acct, Date: *date, Kind: portfolio.WITHDRAW,
+			Price: *withdraw})
+	}
+	for _, ks := range [][]string{{portfolio.BUY, *buy}, {portfolio.SELL, *sell}} {
+		if ks[1] == "" {
+			continue
+		}
+		t, e := parseTrade(ks[0], ks[1])
+		util.CheckErr(e, "invalid trade")
+		trades = append(trades, t)
+	}
+	util.CheckErr(portfolio.Record(trades...), "failed to record trades")
+	if *xdxr {
+		log.Printf("%d xdxr trades booked", portfolio.ApplyXdxr(*acct))
+	}
+	if *nav {
+		navs := portfolio.UpdateNav(*acct)
+		if len(navs) > 10 {
+			navs = navs[len(navs)-10:]
+		}
+		fmt.Println(navTable(navs))
+	}
+	fmt.Println(holdingTable(portfolio.Holdings(*acct)))
+	if *exit {
+		fmt.Printf("%+v", (&score.Exit{Account: *acct}).Geta())
+	}
+}
+
+func parseTrade(kind, s string) (t *model.PfTrade, e error) {
+	cq := strings.SplitN(s, ":", 2)
+	if len(cq) != 2 {
+		return nil, errors.Errorf("expecting <code>:<qty>@<price>: %s", s)
+	}
+	qp := strings.SplitN(cq[1], "@", 2)
+	if len(qp) != 2 {
+		return nil, errors.Errorf("expecting <code>:<qty>@<price>: %s", s)
+	}
+	t = &model.PfTrade{Acct: *acct, Code: cq[0], Date: *date, Kind: kind, Fee: *fee}
+	if t.Qty, e = strconv.ParseFloat(qp[0], 64); e != nil {
+		return nil, errors.Wrapf(e, "invalid quantity: %s", qp[0])
+	}
+	if t.Price, e = strconv.ParseFloat(qp[1], 64); e != nil {
+		return nil, errors.Wrapf(e, "invalid price: %s", qp[1])
+	}
+	return
+}
+
+func holdingTable(pos []*model.PfPosition) string {
+	var bytes bytes.Buffer
+	table := tablewriter.NewWriter(&bytes)
+	table.SetHeader([]string{"Code", "Qty", "Avg Cost", "Price", "Mkt Val", "Unrealized", "Realized"})
+	for _, p := range pos {
+		table.Append([]string{p.Code, fmt.Sprintf("%.0f", p.Qty), fmt.Sprintf("%.3f", p.AvgCost()),
+			fmt.Sprintf("%.2f", p.Price), fmt.Sprintf("%.2f", p.Price*p.Qty), fmt.Sprintf("%.2f", p.Unrealized),
+			fmt.Sprintf("%.2f", p.Realized)})
+	}
+	table.Render()
+	return bytes.String()
+}
+
+func navTable(navs []*model.PfNav) string {
+	var bytes bytes.Buffer
+	table := tablewriter.NewWriter(&bytes)
+	table.SetHeader([]string{"Date", "Cash", "Mkt Val", "Total", "Nav", "Realized", "Unrealized"})
+	for _, n := range navs {
+		table.Append([]string{n.Date, fmt.Sprintf("%.2f", n.Cash), fmt.Sprintf("%.2f", n.MktVal),
+			fmt.Sprintf("%.2f", n.Total), fmt.Sprintf("%.4f", n.Nav), fmt.Sprintf("%.2f", n.Realized),
+			fmt.Sprintf("%.2f", n.Unrealized)})
+	}
+	table.Render()
+	return bytes.String()
+}
@@ -0,0 +1,166 @@
+package portfolio
+
+import (
+	"math"
+	"sort"
+
+	"github.com/carusyte/stock/model"
+	"github.com/pkg/errors"
+)
+
+const (
+	DEPOSIT  = "DEPOSIT"
+	WITHDRAW = "WITHDRAW"
+	BUY      = "BUY"
+	SELL     = "SELL"
+	DIVI     = "DIVI"
+	BONUS    = "BONUS"
+)
+
+//quantities below this are treated as zero
+const qtyEps = 1e-6
+
+//Ledger replays trades of an account in memory, keeping cash, cost basis and realized P&L by average cost.
+// Cash dividends are realized gains and leave cost basis intact, while bonus shares dilute the average cost.
+type Ledger struct {
+	Acct      string
+	Cash      float64
+	Realized  float64
+	Positions map[string]*model.PfPosition
+}
+
+func NewLedger(acct string) *Ledger {
+	return &Ledger{Acct: acct, Positions: make(map[string]*model.PfPosition)}
+}
+
+//Amount returns the signed cash change of the trade.
+func Amount(t *model.PfTrade) float64 {
+	switch t.Kind {
+	case DEPOSIT:
+		return t.Price
+	case WITHDRAW:
+		return -t.Price
+	case BUY:
+		return -(t.Qty*t.Price + t.Fee)
+	case SELL, DIVI:
+		return t.Qty*t.Price - t.Fee
+	default:
+		return 0
+	}
+}
+
+//Apply books the trade, filling its Amount. The ledger is left untouched if the trade is invalid,
+// i.e. selling more than held or spending more cash than available.
+func (l *Ledger) Apply(t *model.PfTrade) error {
+	if t.Qty < 0 || t.Price < 0 || t.Fee < 0 {
+		return errors.Errorf("negative quantity, price or fee: %+v", t)
+	}
+	amt := Amount(t)
+	if l.Cash+amt < -qtyEps {
+		return errors.Errorf("%s insufficient cash %.2f for %s %s of %.2f", t.Date, l.Cash, t.Kind, t.Code, -amt)
+	}
+	if t.Kind == DEPOSIT || t.Kind == WITHDRAW {
+		t.Amount = amt
+		l.Cash += amt
+		return nil
+	}
+	if t.Code == "" {
+		return errors.Errorf("stock code is required for %s", t.Kind)
+	}
+	p, ok := l.Positions[t.Code]
+	if !ok {
+		p = &model.PfPosition{Acct: l.Acct, Code: t.Code}
+	}
+	switch t.Kind {
+	case BUY:
+		p.Qty += t.Qty
+		p.Cost -= amt
+	case SELL:
+		if t.Qty > p.Qty+qtyEps {
+			return errors.Errorf("%s selling %.0f shares of %s, only %.0f held", t.Date, t.Qty, t.Code, p.Qty)
+		}
+		basis := p.Cost * t.Qty / p.Qty
+		p.Qty -= t.Qty
+		p.Cost -= basis
+		if p.Qty < qtyEps {
+			p.Qty, p.Cost = 0, 0
+		}
+		p.Realized += amt - basis
+		l.Realized += amt - basis
+	case DIVI:
+		p.Realized += amt
+		l.Realized += amt
+	case BONUS:
+		p.Qty += t.Qty
+	default:
+		return errors.Errorf("unknown trade kind: %s", t.Kind)
+	}
+	t.Amount = amt
+	l.Cash += amt
+	l.Positions[t.Code] = p
+	return nil
+}
+
+//Held returns the codes currently held, in ascending order.
+func (l *Ledger) Held() (codes []string) {
+	for c, p := range l.Positions {
+		if p.Qty > 0 {
+			codes = append(codes, c)
+		}
+	}
+	sort.Strings(codes)
+	return
+}
+
+//Valuate prices the holdings with the closes, returning market value and unrealized P&L. Holdings without
+// price are valuated at cost.
+func (l *Ledger) Valuate(closes map[string]float64) (mktVal, unrealized float64) {
+	for c, p := range l.Positions {
+		if p.Qty == 0 {
+			p.Price, p.Unrealized = 0, 0
+			continue
+		}
+		if px, ok := closes[c]; ok {
+			p.Price = px
+		} else if p.Price == 0 {
+			p.Price = p.AvgCost()
+		}
+		p.Unrealized = p.Price*p.Qty - p.Cost
+		mktVal += p.Price * p.Qty
+		unrealized += p.Unrealized
+	}
+	return
+}
+
+//Nav converts the trades and daily closes into nav series on each of the dates. Trades must be sorted by
+// date, and closes are keyed by date then code. The first deposit issues units at nav of 1, subsequent
+// deposits and withdrawals issue or redeem units at the nav before the cash flow.
+func Nav(acct string, trades []*model.PfTrade, dates []string, closes map[string]map[string]float64) (
+	navs []*model.PfNav, e error) {
+	l := NewLedger(acct)
+	units, nav := 0., 1.
+	i := 0
+	for _, d := range dates {
+		for ; i < len(trades) && trades[i].Date <= d; i++ {
+			t := trades[i]
+			if t.Kind == DEPOSIT || t.Kind == WITHDRAW {
+				mv, _ := l.Valuate(closes[d])
+				if units > 0 && l.Cash+mv > 0 {
+					nav = (l.Cash + mv) / units
+				}
+				units += Amount(t) / nav
+			}
+			if e = l.Apply(t); e != nil {
+				return
+			}
+		}
+		mv, ur := l.Valuate(closes[d])
+		total := l.Cash + mv
+		if units > 0 && math.Abs(total) > qtyEps {
+			nav = total / units
+		}
+		navs = append(navs, &model.PfNav{Acct: acct, Date: d, Cash: l.Cash, MktVal: mv, Total: total,
+			Units: units, Nav: nav, Realized: l.Realized, Unrealized: ur})
+	}
+	return
+}
@@ -0,0 +1,98 @@
+package portfolio
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/carusyte/stock/model"
+)
+
+func TestLedgerApply(t *testing.T) {
+	l := NewLedger("T")
+	trades := []*model.PfTrade{
+		{Date: "2018-01-02", Kind: DEPOSIT, Price: 20000},
+		{Date: "2018-01-02", Kind: BUY, Code: "600000", Qty: 500, Price: 10, Fee: 5},
+		{Date: "2018-01-03", Kind: BUY, Code: "600000", Qty: 500, Price: 12, Fee: 5},
+		{Date: "2018-01-04", Kind: SELL, Code: "600000", Qty: 400, Price: 13, Fee: 4},
+		{Date: "2018-01-05", Kind: DIVI, Code: "600000", Qty: 600, Price: 0.5},
+		{Date: "2018-01-05", Kind: BONUS, Code: "600000", Qty: 300},
+	}
+	for _, tr := range trades {
+		if e := l.Apply(tr); e != nil {
+			t.Fatal(e)
+		}
+	}
+	p := l.Positions["600000"]
+	// cost 11010, 40% sold with basis 4404 for 5196, leaving 6606 over 600+300 shares
+	if p.Qty != 900 || fmt.Sprintf("%.2f", p.Cost) != "6606.00" {
+		t.Errorf("unexpected position: %+v", p)
+	}
+	if fmt.Sprintf("%.2f", p.Realized) != "1092.00" || fmt.Sprintf("%.2f", l.Cash) != "14486.00" {
+		t.Errorf("unexpected realized %.2f or cash %.2f", p.Realized, l.Cash)
+	}
+	if trades[1].Amount != -5005 {
+		t.Errorf("unexpected amount of buy: %.2f", trades[1].Amount)
+	}
+	mv, ur := l.Valuate(map[string]float64{"600000": 8})
+	if mv != 7200 || fmt.Sprintf("%.2f", ur) != "594.00" {
+		t.Errorf("unexpected valuation %.2f, %.2f", mv, ur)
+	}
+	for _, tr := range []*model.PfTrade{
+		{Date: "2018-01-06", Kind: SELL, Code: "600000", Qty: 1000, Price: 8},
+		{Date: "2018-01-06", Kind: BUY, Code: "600036", Qty: 1000, Price: 30},
+	} {
+		if e := l.Apply(tr); e == nil {
+			t.Errorf("expecting error on %+v", tr)
+		}
+	}
+	if p.Qty != 900 || len(l.Held()) != 1 {
+		t.Errorf("ledger changed by invalid trade: %+v", p)
+	}
+}
+
+func TestNav(t *testing.T) {
+	trades := []*model.PfTrade{
+		{Date: "2018-01-02", Kind: DEPOSIT, Price: 1000},
+		{Date: "2018-01-02", Kind: BUY, Code: "600000", Qty: 100, Price: 10},
+		{Date: "2018-01-04", Kind: DEPOSIT, Price: 1200},
+	}
+	dates := []string{"2018-01-02", "2018-01-03", "2018-01-04", "2018-01-05"}
+	closes := map[string]map[string]float64{
+		"2018-01-02": {"600000": 10},
+		"2018-01-03": {"600000": 11},
+		"2018-01-04": {"600000": 12},
+		// suspended on 2018-01-05, valuated at the last close
+	}
+	navs, e := Nav("T", trades, dates, closes)
+	if e != nil {
+		t.Fatal(e)
+	}
+	exp := []string{"1.0000", "1.1000", "1.2000", "1.2000"}
+	for i, n := range navs {
+		if fmt.Sprintf("%.4f", n.Nav) != exp[i] {
+			t.Errorf("expecting nav %s on %s, got %.4f", exp[i], n.Date, n.Nav)
+		}
+	}
+	// deposit of 1200 at nav 1.2 issues 1000 units
+	if fmt.Sprintf("%.2f", navs[3].Units) != "2000.00" || navs[3].Total != 2400 || navs[3].Unrealized != 200 {
+		t.Errorf("unexpected nav: %+v", navs[3])
+	}
+}
+
+func TestHeldAt(t *testing.T) {
+	trades := []*model.PfTrade{
+		{Date: "2018-01-02", Kind: BUY, Code: "600000", Qty: 100},
+		{Date: "2018-01-03", Kind: BUY, Code: "600036", Qty: 100},
+		{Date: "2018-01-05", Kind: SELL, Code: "600000", Qty: 40},
+		{Date: "2018-01-06", Kind: BONUS, Code: "600000", Qty: 30},
+	}
+	for _, c := range []struct {
+		date string
+		incl bool
+		qty  float64
+	}{{"2018-01-05", false, 100}, {"2018-01-05", true, 60}, {"2018-01-06", true, 90}, {"2018-01-01", true, 0}} {
+		if q := HeldAt(trades, "600000", c.date, c.incl); q != c.qty {
+			t.Errorf("expecting %.0f held at %s (%v), got %.0f", c.qty, c.date, c.incl, q)
+		}
+	}
+}
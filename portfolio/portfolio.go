@@ -0,0 +1,342 @@
+//
+// Portfolio accounts of the team, with trades, positions, P&L and daily nav. Trades are the only source of
+// truth, positions and navs are derived by replaying them through the Ledger and stored for reporting.
+// Cash dividends and bonus shares are booked automatically from xdxr, see ApplyXdxr.
+//
+package portfolio
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/carusyte/stock/global"
+	"github.com/carusyte/stock/metrics"
+	"github.com/carusyte/stock/model"
+	"github.com/carusyte/stock/util"
+	"github.com/pkg/errors"
+	logr "github.com/sirupsen/logrus"
+)
+
+var (
+	dbmap = global.Dbmap
+	dot   = global.Dot
+)
+
+//NewAccount registers the portfolio account, depositing the initial cash if it's positive.
+func NewAccount(acct, name, date string, cash float64) error {
+	d, t := util.TimeStr()
+	_, e := dbmap.Exec("insert into pf_account (acct, name, udate, utime) values (?, ?, ?, ?)", acct, name, d, t)
+	if e != nil {
+		return errors.Wrapf(e, "failed to create account %s", acct)
+	}
+	if cash > 0 {
+		return Record(&model.PfTrade{Acct: acct, Date: date, Kind: DEPOSIT, Price: cash})
+	}
+	return nil
+}
+
+//Accounts returns all the portfolio accounts.
+func Accounts() (accts []*model.PfAccount) {
+	_, e := dbmap.Select(&accts, "select * from pf_account order by acct")
+	if e != nil && "sql: no rows in result set" != e.Error() {
+		log.Panicf("failed to query portfolio accounts: %+v", e)
+	}
+	return
+}
+
+//Trades returns all the trades of the account in booking order.
+func Trades(acct string) (trades []*model.PfTrade) {
+	_, e := dbmap.Select(&trades, "select * from pf_trade where acct = ? order by date, id", acct)
+	if e != nil && "sql: no rows in result set" != e.Error() {
+		log.Panicf("%s failed to query trades: %+v", acct, e)
+	}
+	return
+}
+
+//Record books the trades of an account after validating them against the whole trade history, so that
+// backdated trades can't oversell or overdraw at any point of time. Positions are refreshed accordingly.
+func Record(trades ...*model.PfTrade) error {
+	if len(trades) == 0 {
+		return nil
+	}
+	acct := trades[0].Acct
+	for _, t := range trades {
+		if t.Acct != acct {
+			return errors.Errorf("trades of different accounts: %s, %s", acct, t.Acct)
+		}
+		if _, e := time.Parse("2006-01-02", t.Date); e != nil {
+			return errors.Wrapf(e, "invalid trade date: %s", t.Date)
+		}
+	}
+	all := append(Trades(acct), trades...)
+	sort.SliceStable(all, func(i, j int) bool {
+		return all[i].Date < all[j].Date
+	})
+	l := NewLedger(acct)
+	for _, t := range all {
+		if e := l.Apply(t); e != nil {
+			return e
+		}
+	}
+	saveTrades(trades)
+	savePositions(l)
+	return nil
+}
+
+func saveTrades(trades []*model.PfTrade) {
+	d, t := util.TimeStr()
+	valueStrings := make([]string, 0, len(trades))
+	valueArgs := make([]interface{}, 0, len(trades)*13)
+	for _, tr := range trades {
+		valueStrings = append(valueStrings, "(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)")
+		valueArgs = append(valueArgs, tr.Acct, tr.Code, tr.Date, tr.Kind, tr.Qty, tr.Price, tr.Fee, tr.Amount,
+			tr.Xdxr, tr.Remarks, d, t)
+	}
+	stmt := fmt.Sprintf("insert ignore into pf_trade (acct, code, date, kind, qty, price, fee, amount, "+
+		"xdxr_idx, remarks, udate, utime) values %s", strings.Join(valueStrings, ","))
+	_, e := dbmap.Exec(stmt, valueArgs...)
+	util.CheckErr(e, trades[0].Acct+" failed to save trades")
+	metrics.RowsUpserted("pf_trade", len(trades))
+}
+
+func savePositions(l *Ledger) {
+	if len(l.Positions) == 0 {
+		return
+	}
+	d, t := util.TimeStr()
+	valueStrings := make([]string, 0, len(l.Positions))
+	valueArgs := make([]interface{}, 0, len(l.Positions)*7)
+	for _, p := range l.Positions {
+		valueStrings = append(valueStrings, "(?, ?, ?, ?, ?, ?, ?)")
+		valueArgs = append(valueArgs, l.Acct, p.Code, p.Qty, p.Cost, p.Realized, d, t)
+	}
+	stmt := fmt.Sprintf("insert into pf_position (acct, code, qty, cost, realized, udate, utime) values %s "+
+		"on duplicate key update qty=values(qty), cost=values(cost), realized=values(realized), "+
+		"udate=values(udate), utime=values(utime)", strings.Join(valueStrings, ","))
+	_, e := dbmap.Exec(stmt, valueArgs...)
+	util.CheckErr(e, l.Acct+" failed to save positions")
+	metrics.RowsUpserted("pf_position", len(l.Positions))
+}
+
+//Load replays all the trades of the account into ledger.
+func Load(acct string) *Ledger {
+	l := NewLedger(acct)
+	for _, t := range Trades(acct) {
+		if e := l.Apply(t); e != nil {
+			log.Panicf("%s corrupted trade history: %+v", acct, e)
+		}
+	}
+	return l
+}
+
+//Holdings returns the positions currently held by the account, valuated at latest closes of kline_d_n.
+func Holdings(acct string) (pos []*model.PfPosition) {
+	l := Load(acct)
+	codes := l.Held()
+	l.Valuate(latestCloses(codes))
+	for _, c := range codes {
+		pos = append(pos, l.Positions[c])
+	}
+	return
+}
+
+//CostMap returns average cost of the stocks currently held by the account, keyed by code. It can be fed
+// to the scorers taking held positions, see score.Exit.
+func CostMap(acct string) map[string]float64 {
+	cm := make(map[string]float64)
+	l := Load(acct)
+	for _, c := range l.Held() {
+		cm[c] = l.Positions[c].AvgCost()
+	}
+	return cm
+}
+
+func latestCloses(codes []string) (closes map[string]float64) {
+	closes = make(map[string]float64)
+	if len(codes) == 0 {
+		return
+	}
+	sql, e := dot.Raw("PF_LATEST_CLOSE")
+	util.CheckErr(e, "failed to get PF_LATEST_CLOSE sql")
+	var qs []*struct {
+		Code  string
+		Close float64
+	}
+	_, e = dbmap.Select(&qs, fmt.Sprintf(sql, util.Join(codes, ",", true)))
+	if e != nil && "sql: no rows in result set" != e.Error() {
+		log.Panicf("failed to query latest closes: %+v", e)
+	}
+	for _, q := range qs {
+		closes[q.Code] = q.Close
+	}
+	return
+}
+
+//ApplyXdxr books cash dividends and bonus shares of the account from xdxr events since the stock was first
+// traded, up to today. Shares registered are those held by the end of registration date, or before xdxr date
+// if registration date is missing. Dividends are booked before tax. Events already booked are skipped,
+// so it's safe to be called repeatedly, i.e. after each data update. Returns the number of trades booked.
+func ApplyXdxr(acct string) int {
+	trades := Trades(acct)
+	booked := make(map[string]bool)
+	first := make(map[string]string)
+	for _, t := range trades {
+		if t.Xdxr.Valid {
+			booked[fmt.Sprintf("%s-%d-%s", t.Code, t.Xdxr.Int64, t.Kind)] = true
+		}
+		if t.Code != "" {
+			if _, ok := first[t.Code]; !ok {
+				first[t.Code] = t.Date
+			}
+		}
+	}
+	sql, e := dot.Raw("PF_XDXR")
+	util.CheckErr(e, "failed to get PF_XDXR sql")
+	today := time.Now().Format("2006-01-02")
+	var nts []*model.PfTrade
+	for code, since := range first {
+		var xdxrs []*model.Xdxr
+		_, e = dbmap.Select(&xdxrs, sql, code, since, today)
+		if e != nil && "sql: no rows in result set" != e.Error() {
+			log.Panicf("%s failed to query xdxr: %+v", code, e)
+		}
+		for _, x := range xdxrs {
+			held := append(trades, nts...)
+			nts = append(nts, xdxrTrades(acct, x, booked, held)...)
+		}
+	}
+	if len(nts) == 0 {
+		return 0
+	}
+	if e = Record(nts...); e != nil {
+		log.Panicf("%s failed to book xdxr: %+v", acct, e)
+	}
+	logr.Infof("%s %d xdxr trades booked", acct, len(nts))
+	return len(nts)
+}
+
+//xdxrTrades derives the dividend and bonus share trades of the xdxr event, with respect to the shares
+// registered in trades.
+func xdxrTrades(acct string, x *model.Xdxr, booked map[string]bool, trades []*model.PfTrade) (nts []*model.PfTrade) {
+	cutoff := x.XdxrDate.String
+	incl := false
+	if x.RegDate.Valid && x.RegDate.String != "" {
+		cutoff, incl = x.RegDate.String, true
+	}
+	qty := HeldAt(trades, x.Code, cutoff, incl)
+	if qty <= 0 {
+		return
+	}
+	xi := sql.NullInt64{Int64: int64(x.Idx), Valid: true}
+	if x.Divi.Valid && x.Divi.Float64 > 0 && !booked[fmt.Sprintf("%s-%d-%s", x.Code, x.Idx, DIVI)] {
+		date := x.XdxrDate.String
+		if x.PayoutDate.Valid && x.PayoutDate.String >= date {
+			date = x.PayoutDate.String
+		}
+		nts = append(nts, &model.PfTrade{Acct: acct, Code: x.Code, Date: date, Kind: DIVI, Qty: qty,
+			Price: x.Divi.Float64 / 10, Xdxr: xi})
+	}
+	bonus := (x.SharesAllot.Float64 + x.SharesCvt.Float64) / 10
+	if bonus > 0 && !booked[fmt.Sprintf("%s-%d-%s", x.Code, x.Idx, BONUS)] {
+		nts = append(nts, &model.PfTrade{Acct: acct, Code: x.Code, Date: x.XdxrDate.String, Kind: BONUS,
+			Qty: qty * bonus, Xdxr: xi})
+	}
+	return
+}
+
+//HeldAt returns the shares of the stock held by the end of date, or right before date if not inclusive.
+func HeldAt(trades []*model.PfTrade, code, date string, inclusive bool) (qty float64) {
+	for _, t := range trades {
+		if t.Code != code || t.Date > date || (!inclusive && t.Date == date) {
+			continue
+		}
+		switch t.Kind {
+		case BUY, BONUS:
+			qty += t.Qty
+		case SELL:
+			qty -= t.Qty
+		}
+	}
+	return
+}
+
+//UpdateNav rebuilds the daily nav series of the account from its first trade, on the trading days of the
+// stocks ever held, and saves it into pf_nav.
+func UpdateNav(acct string) (navs []*model.PfNav) {
+	trades := Trades(acct)
+	if len(trades) == 0 {
+		return
+	}
+	start := trades[0].Date
+	var codes []string
+	seen := make(map[string]bool)
+	for _, t := range trades {
+		if t.Code != "" && !seen[t.Code] {
+			seen[t.Code] = true
+			codes = append(codes, t.Code)
+		}
+	}
+	dates, closes := dailyCloses(codes, start)
+	if len(dates) == 0 || dates[0] > start {
+		dates = append([]string{start}, dates...)
+	}
+	navs, e := Nav(acct, trades, dates, closes)
+	if e != nil {
+		log.Panicf("%s corrupted trade history: %+v", acct, e)
+	}
+	saveNavs(acct, navs)
+	return
+}
+
+//dailyCloses returns the trading days since start and the non-reinstated closes of the stocks keyed by date.
+func dailyCloses(codes []string, start string) (dates []string, closes map[string]map[string]float64) {
+	closes = make(map[string]map[string]float64)
+	if len(codes) == 0 {
+		return
+	}
+	var qs []*model.Quote
+	_, e := dbmap.Select(&qs, fmt.Sprintf("select code, date, close from kline_d_n where code in (%s) "+
+		"and date >= ? order by date", util.Join(codes, ",", true)), start)
+	if e != nil && "sql: no rows in result set" != e.Error() {
+		log.Panicf("failed to query kline_d_n: %+v", e)
+	}
+	for _, q := range qs {
+		m, ok := closes[q.Date]
+		if !ok {
+			m = make(map[string]float64)
+			closes[q.Date] = m
+			dates = append(dates, q.Date)
+		}
+		m[q.Code] = q.Close
+	}
+	return
+}
+
+func saveNavs(acct string, navs []*model.PfNav) {
+	d, t := util.TimeStr()
+	for i := 0; i < len(navs); i += global.JOB_CAPACITY {
+		end := i + global.JOB_CAPACITY
+		if end > len(navs) {
+			end = len(navs)
+		}
+		valueStrings := make([]string, 0, end-i)
+		valueArgs := make([]interface{}, 0, (end-i)*11)
+		for _, n := range navs[i:end] {
+			valueStrings = append(valueStrings, "(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)")
+			valueArgs = append(valueArgs, acct, n.Date, n.Cash, n.MktVal, n.Total, n.Units, n.Nav, n.Realized,
+				n.Unrealized, d, t)
+		}
+		stmt := fmt.Sprintf("insert into pf_nav (acct, date, cash, mkt_val, total, units, nav, realized, "+
+			"unrealized, udate, utime) values %s on duplicate key update cash=values(cash), "+
+			"mkt_val=values(mkt_val), total=values(total), units=values(units), nav=values(nav), "+
+			"realized=values(realized), unrealized=values(unrealized), udate=values(udate), "+
+			"utime=values(utime)", strings.Join(valueStrings, ","))
+		_, e := dbmap.Exec(stmt, valueArgs...)
+		util.CheckErr(e, acct+" failed to save nav")
+		metrics.RowsUpserted("pf_nav", end-i)
+	}
+}
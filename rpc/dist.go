@@ -0,0 +1,140 @@
+package rpc
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"github.com/carusyte/stock/conf"
+	"github.com/pkg/errors"
+	logr "github.com/sirupsen/logrus"
+)
+
+const (
+	//MAX_DIST_RETRY number of remote failures after which a job is left to local workers only
+	MAX_DIST_RETRY = 3
+)
+
+//Job is a unit of work which can be run either on a rpc server or with local power.
+type Job struct {
+	//ID identifies the job in logs
+	ID string
+	//Remote runs the job on the rpc server at addr. Nil if the job can only be run locally.
+	Remote func(addr string) error
+	//Local runs the job with local power.
+	Local func() error
+	fails int
+}
+
+// jobQueue is shared by all workers of a distribution. Jobs failed remotely are put back
+// to the queue until they're done by some other worker.
+type jobQueue struct {
+	lock    sync.Mutex
+	cond    *sync.Cond
+	jobs    []*Job
+	pending int
+}
+
+// take a job from the queue, blocks until one is available or all jobs are done, in which case
+// nil is returned. Remote workers only take jobs that can be run remotely.
+func (q *jobQueue) take(remote bool) *Job {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	for q.pending > 0 {
+		for i, j := range q.jobs {
+			if !remote || (j.Remote != nil && j.fails < MAX_DIST_RETRY) {
+				q.jobs = append(q.jobs[:i], q.jobs[i+1:]...)
+				return j
+			}
+		}
+		q.cond.Wait()
+	}
+	return nil
+}
+
+// put the job back to the queue.
+func (q *jobQueue) put(j *Job) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	q.jobs = append(q.jobs, j)
+	q.cond.Broadcast()
+}
+
+// done marks a job as completed, wakes up all waiting workers once there's no pending job.
+func (q *jobQueue) done() {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	q.pending--
+	if q.pending == 0 {
+		q.cond.Broadcast()
+	}
+}
+
+//Distribute runs the jobs on the reachable rpc servers in the pool together with the local machine.
+// Each node pulls jobs from a shared queue, so a faster node takes on more work than a slow one.
+// Every rpc server gets dist_concurrency workers and the local machine gets the specified number of
+// workers, at least 1. When a job fails on a rpc server, the server is withdrawn from this distribution
+// and the job is rescheduled to the other nodes. Errors of jobs failed locally are returned, prefixed by job ID.
+func Distribute(jobs []*Job, local int) (errs []error) {
+	if len(jobs) == 0 {
+		return
+	}
+	if local < 1 {
+		local = 1
+	}
+	q := &jobQueue{jobs: make([]*Job, len(jobs)), pending: len(jobs)}
+	copy(q.jobs, jobs)
+	q.cond = sync.NewCond(&q.lock)
+	var (
+		wg    sync.WaitGroup
+		elock sync.Mutex
+		nodes int
+	)
+	for _, srv := range snapshot() {
+		if e := srv.probe(); e != nil {
+			srv.mark(e)
+			logr.Warnf("rpc server %s is inaccessible, excluded from distribution\n%+v", srv.addr, e)
+			continue
+		}
+		nodes++
+		withdrawn := new(int32)
+		for i := 0; i < conf.Args().DistConcurrency; i++ {
+			wg.Add(1)
+			go func(addr string) {
+				defer wg.Done()
+				for atomic.LoadInt32(withdrawn) == 0 {
+					j := q.take(true)
+					if j == nil {
+						return
+					}
+					if e := j.Remote(addr); e != nil {
+						atomic.StoreInt32(withdrawn, 1)
+						j.fails++
+						logr.Warnf("job %s failed on %s, withdrawing the server and rescheduling the job\n%+v",
+							j.ID, addr, e)
+						q.put(j)
+						return
+					}
+					q.done()
+				}
+			}(srv.addr)
+		}
+	}
+	logr.Debugf("distributing %d jobs to %d rpc servers and %d local workers", len(jobs), nodes, local)
+	for i := 0; i < local; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := q.take(false); j != nil; j = q.take(false) {
+				if e := j.Local(); e != nil {
+					logr.Errorf("job %s failed locally\n%+v", j.ID, e)
+					elock.Lock()
+					errs = append(errs, errors.Wrap(e, j.ID))
+					elock.Unlock()
+				}
+				q.done()
+			}
+		}()
+	}
+	wg.Wait()
+	return
+}
@@ -0,0 +1,70 @@
+package rpc
+
+import (
+	"fmt"
+	"sync/atomic"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func TestDistribute(t *testing.T) {
+	good, _ := startEchoServer(t)
+	bad, _ := startEchoServer(t)
+	SetServers([]string{good, bad})
+	var remote, local, onBad int32
+	runs := make([]int32, 100)
+	jobs := make([]*Job, len(runs))
+	for i := range jobs {
+		idx := i
+		jobs[i] = &Job{ID: fmt.Sprintf("job-%d", i)}
+		jobs[i].Remote = func(addr string) error {
+			if addr == bad {
+				atomic.AddInt32(&onBad, 1)
+				return errors.Errorf("%s is broken", addr)
+			}
+			var rep string
+			if e := CallOn(addr, "Echo.Say", jobs[idx].ID, &rep); e != nil {
+				return e
+			}
+			atomic.AddInt32(&remote, 1)
+			atomic.AddInt32(&runs[idx], 1)
+			return nil
+		}
+		jobs[i].Local = func() error {
+			atomic.AddInt32(&local, 1)
+			atomic.AddInt32(&runs[idx], 1)
+			return nil
+		}
+	}
+	if errs := Distribute(jobs, 2); len(errs) != 0 {
+		t.Fatalf("unexpected errors: %+v", errs)
+	}
+	for i, r := range runs {
+		if r != 1 {
+			t.Errorf("job %d was done %d times", i, r)
+		}
+	}
+	if remote == 0 {
+		t.Error("no job was done remotely")
+	}
+	if onBad > 2 {
+		t.Errorf("broken server should be withdrawn after its workers fail, got %d failures", onBad)
+	}
+	t.Logf("remote: %d, local: %d, failures: %d", remote, local, onBad)
+}
+
+func TestDistributeLocalOnly(t *testing.T) {
+	SetServers(nil)
+	var done int32
+	jobs := []*Job{
+		{ID: "a", Local: func() error { atomic.AddInt32(&done, 1); return nil }},
+		{ID: "b", Local: func() error { return errors.New("failed") }},
+	}
+	if errs := Distribute(jobs, 0); len(errs) != 1 || errs[0].Error() != "b: failed" {
+		t.Errorf("expected 1 error of job b, got %+v", errs)
+	}
+	if done != 1 {
+		t.Errorf("expected local job to be done once, got %d", done)
+	}
+}
@@ -0,0 +1,330 @@
+package rpc
+
+import (
+	"io"
+	"math"
+	"net"
+	"net/rpc"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/carusyte/stock/conf"
+	"github.com/carusyte/stock/metrics"
+	"github.com/felixge/tcpkeepalive"
+	"github.com/pkg/errors"
+	logr "github.com/sirupsen/logrus"
+)
+
+const (
+	DIAL_TIMEOUT = time.Second * 10
+	PING_TIMEOUT = time.Second * 10
+	INIT_BACKOFF = time.Second * 30
+	MAX_BACKOFF  = time.Minute * 15
+)
+
+var (
+	srvLock = sync.RWMutex{}
+	servers []*server
+)
+
+func init() {
+	SetServers(conf.Args().RPCServers)
+	conf.Subscribe("rpc_servers", func(old, new *conf.Arguments) {
+		if !sameAddrs(old.RPCServers, new.RPCServers) {
+			logr.Infof("rpc servers changed: %v -> %v", old.RPCServers, new.RPCServers)
+			SetServers(new.RPCServers)
+		}
+		if new.RPCMaxIdle < old.RPCMaxIdle {
+			for _, s := range snapshot() {
+				s.trim(new.RPCMaxIdle)
+			}
+		}
+	})
+}
+
+func sameAddrs(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// server holds the persistent connections to a rpc server, along with its load and health marks.
+type server struct {
+	addr     string
+	inflight int64
+	lock     sync.Mutex
+	idle     []*rpc.Client
+	dead     bool
+	retryAt  time.Time
+	backoff  time.Duration
+}
+
+//SetServers replaces the rpc server pool with the specified addresses. Connections to servers
+// remaining in the pool are kept, others are closed.
+func SetServers(addrs []string) {
+	srvLock.Lock()
+	defer srvLock.Unlock()
+	old := make(map[string]*server)
+	for _, s := range servers {
+		old[s.addr] = s
+	}
+	nsrvs := make([]*server, 0, len(addrs))
+	for _, a := range addrs {
+		if s, ok := old[a]; ok {
+			nsrvs = append(nsrvs, s)
+			delete(old, a)
+		} else {
+			nsrvs = append(nsrvs, &server{addr: a})
+		}
+	}
+	for _, s := range old {
+		s.close()
+	}
+	servers = nsrvs
+}
+
+//Servers returns the addresses of rpc servers currently in the pool.
+func Servers() (addrs []string) {
+	for _, s := range snapshot() {
+		addrs = append(addrs, s.addr)
+	}
+	return
+}
+
+func snapshot() []*server {
+	srvLock.RLock()
+	defer srvLock.RUnlock()
+	srvs := make([]*server, len(servers))
+	copy(srvs, servers)
+	return srvs
+}
+
+// pick the healthy server with the least in-flight calls. If all servers are marked broken,
+// the one due to be retried earliest is returned.
+func pick() (p *server) {
+	srvs := snapshot()
+	var (
+		minLoad int64 = math.MaxInt64
+		due     time.Time
+		fb      *server
+	)
+	for _, s := range srvs {
+		ok, rt := s.health()
+		if ok {
+			if l := atomic.LoadInt64(&s.inflight); l < minLoad {
+				minLoad = l
+				p = s
+			}
+		} else if fb == nil || rt.Before(due) {
+			fb = s
+			due = rt
+		}
+	}
+	if p == nil {
+		return fb
+	}
+	return
+}
+
+func (s *server) health() (ok bool, retryAt time.Time) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return !s.dead || time.Now().After(s.retryAt), s.retryAt
+}
+
+// mark the server healthy if e is nil, otherwise broken for an exponential backoff period.
+func (s *server) mark(e error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if e == nil {
+		s.dead = false
+		s.backoff = 0
+		return
+	}
+	s.dead = true
+	if s.backoff == 0 {
+		s.backoff = INIT_BACKOFF
+	} else {
+		s.backoff = time.Duration(math.Min(float64(s.backoff*2), float64(MAX_BACKOFF)))
+	}
+	s.retryAt = time.Now().Add(s.backoff)
+}
+
+func (s *server) load() int64 {
+	return atomic.LoadInt64(&s.inflight)
+}
+
+func (s *server) dial() (*rpc.Client, error) {
+	conn, err := net.DialTimeout("tcp", s.addr, DIAL_TIMEOUT)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to connect rpc server: %s", s.addr)
+	}
+	err = tcpkeepalive.SetKeepAlive(conn, time.Second*60, 2048, time.Second*45)
+	if err != nil {
+		conn.Close()
+		return nil, errors.Wrapf(err, "failed to set tcp keep-alive for connection to %s", s.addr)
+	}
+	return rpc.NewClient(conn), nil
+}
+
+// get an idle client from the pool, or dial a new one if there's none.
+func (s *server) get() (c *rpc.Client, reused bool, e error) {
+	s.lock.Lock()
+	if n := len(s.idle); n > 0 {
+		c = s.idle[n-1]
+		s.idle = s.idle[:n-1]
+		s.lock.Unlock()
+		return c, true, nil
+	}
+	s.lock.Unlock()
+	c, e = s.dial()
+	return
+}
+
+// put the client back to the pool for reuse, or close it if the pool is full.
+func (s *server) put(c *rpc.Client) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if len(s.idle) >= conf.Args().RPCMaxIdle {
+		c.Close()
+		return
+	}
+	s.idle = append(s.idle, c)
+}
+
+// trim closes idle connections exceeding max.
+func (s *server) trim(max int) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if max < 0 {
+		max = 0
+	}
+	for len(s.idle) > max {
+		n := len(s.idle)
+		s.idle[n-1].Close()
+		s.idle = s.idle[:n-1]
+	}
+}
+
+func (s *server) close() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for _, c := range s.idle {
+		c.Close()
+	}
+	s.idle = nil
+}
+
+// probe checks whether the server is alive by pinging an idle connection, closing those failing
+// the ping. A new connection is dialed, pinged and kept in the pool if no idle one responds.
+func (s *server) probe() error {
+	for {
+		s.lock.Lock()
+		n := len(s.idle)
+		if n == 0 {
+			s.lock.Unlock()
+			break
+		}
+		c := s.idle[n-1]
+		s.idle = s.idle[:n-1]
+		s.lock.Unlock()
+		if e := s.ping(c); e == nil {
+			s.put(c)
+			return nil
+		}
+		logr.Debugf("stale idle connection to %s, closing", s.addr)
+		c.Close()
+	}
+	c, e := s.dial()
+	if e != nil {
+		return e
+	}
+	if e = s.ping(c); e != nil {
+		c.Close()
+		return errors.Wrapf(e, "%s failed to respond to ping", s.addr)
+	}
+	s.put(c)
+	return nil
+}
+
+// ping makes a round trip of Health.Ping on the connection within PING_TIMEOUT. A service error
+// still proves the server is serving, e.g. one without Health service registered.
+func (s *server) ping(c *rpc.Client) error {
+	var rep bool
+	call := c.Go("Health.Ping", true, &rep, make(chan *rpc.Call, 1))
+	select {
+	case <-call.Done:
+		if _, ok := call.Error.(rpc.ServerError); ok {
+			return nil
+		}
+		return call.Error
+	case <-time.After(PING_TIMEOUT):
+		return errors.Errorf("ping timed out after %v", PING_TIMEOUT)
+	}
+}
+
+// call the rpc service on this server, bounded by rpc_timeout configured in stock.toml.
+// A stale pooled connection is replaced with a new one once.
+func (s *server) call(service string, request interface{}, reply interface{}) (e error) {
+	atomic.AddInt64(&s.inflight, 1)
+	defer atomic.AddInt64(&s.inflight, -1)
+	st := time.Now()
+	defer func() {
+		metrics.RpcCall(s.addr, service, st, e)
+	}()
+	for {
+		c, reused, err := s.get()
+		if err != nil {
+			return err
+		}
+		err = s.invoke(c, service, request, reply)
+		if err == nil {
+			s.put(c)
+			return nil
+		}
+		if _, ok := err.(rpc.ServerError); ok {
+			// the connection is still usable for application level errors
+			s.put(c)
+			return errors.Wrapf(err, "%s rpc service error: %s", s.addr, service)
+		}
+		c.Close()
+		if reused && (err == rpc.ErrShutdown || err == io.EOF || err == io.ErrUnexpectedEOF) {
+			logr.Debugf("stale connection to %s, redialing", s.addr)
+			continue
+		}
+		return errors.Wrapf(err, "%s rpc service error: %s", s.addr, service)
+	}
+}
+
+// invoke decodes the response into a fresh value of the reply type, which is copied to reply only
+// on success. A call abandoned on timeout may still complete later, and must not write to reply
+// while it's being filled by a retry.
+func (s *server) invoke(c *rpc.Client, service string, request interface{}, reply interface{}) error {
+	rv := reflect.ValueOf(reply)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return errors.Errorf("reply must be a non-nil pointer: %T", reply)
+	}
+	fresh := reflect.New(rv.Type().Elem())
+	call := c.Go(service, request, fresh.Interface(), make(chan *rpc.Call, 1))
+	if conf.Args().RPCTimeout > 0 {
+		select {
+		case <-call.Done:
+		case <-time.After(time.Duration(conf.Args().RPCTimeout) * time.Second):
+			return errors.Errorf("deadline exceeded after %d sec", conf.Args().RPCTimeout)
+		}
+	} else {
+		<-call.Done
+	}
+	if call.Error == nil {
+		rv.Elem().Set(fresh.Elem())
+	}
+	return call.Error
+}
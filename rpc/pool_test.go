@@ -0,0 +1,125 @@
+package rpc
+
+import (
+	"net"
+	"net/rpc"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/carusyte/stock/conf"
+)
+
+type Echo struct{}
+
+func (e *Echo) Say(req string, rep *string) error {
+	*rep = req
+	return nil
+}
+
+func (e *Echo) Sleep(sec int, rep *bool) error {
+	time.Sleep(time.Duration(sec) * time.Second)
+	*rep = true
+	return nil
+}
+
+func startEchoServer(t *testing.T) (addr string, accepted *int32) {
+	srv := rpc.NewServer()
+	srv.Register(new(Echo))
+	l, e := net.Listen("tcp", "127.0.0.1:0")
+	if e != nil {
+		t.Fatal(e)
+	}
+	accepted = new(int32)
+	go func() {
+		for {
+			c, e := l.Accept()
+			if e != nil {
+				return
+			}
+			atomic.AddInt32(accepted, 1)
+			go srv.ServeConn(c)
+		}
+	}()
+	return l.Addr().String(), accepted
+}
+
+func TestConnectionReuse(t *testing.T) {
+	addr, accepted := startEchoServer(t)
+	SetServers([]string{addr})
+	for i := 0; i < 10; i++ {
+		var rep string
+		if e := Call("Echo.Say", "hi", &rep, 1); e != nil || rep != "hi" {
+			t.Fatalf("unexpected reply: %s, %+v", rep, e)
+		}
+	}
+	if c, _ := Available(false); c != 1 {
+		t.Errorf("expected 1 available server, got %d", c)
+	}
+	if n := atomic.LoadInt32(accepted); n != 1 {
+		t.Errorf("expected 1 connection, got %d", n)
+	}
+}
+
+func TestCallDeadline(t *testing.T) {
+	addr, _ := startEchoServer(t)
+	SetServers([]string{addr})
+	saved := conf.Args()
+	n := *saved
+	n.RPCTimeout = 1
+	conf.Apply(&n)
+	defer conf.Apply(saved)
+	var rep bool
+	if e := <-Go("Echo.Sleep", 2, &rep, 1); e == nil {
+		t.Error("expected deadline exceeded error")
+	}
+	// the late response must not reach the reply of the abandoned call, even if the connection is kept
+	s := &server{addr: addr}
+	c, e := s.dial()
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer c.Close()
+	if e = s.invoke(c, "Echo.Sleep", 2, &rep); e == nil {
+		t.Error("expected deadline exceeded error")
+	}
+	time.Sleep(2 * time.Second)
+	if rep {
+		t.Error("reply written after deadline exceeded")
+	}
+}
+
+func TestPickLeastLoaded(t *testing.T) {
+	SetServers([]string{"127.0.0.1:1", "127.0.0.1:2"})
+	srvs := snapshot()
+	atomic.AddInt64(&srvs[0].inflight, 3)
+	defer atomic.AddInt64(&srvs[0].inflight, -3)
+	if p := pick(); p != srvs[1] {
+		t.Errorf("expected %s, got %s", srvs[1].addr, p.addr)
+	}
+	srvs[1].mark(net.ErrWriteToConnected)
+	if p := pick(); p != srvs[0] {
+		t.Errorf("expected %s, got %s", srvs[0].addr, p.addr)
+	}
+}
+
+func TestProbeStaleConnection(t *testing.T) {
+	addr, accepted := startEchoServer(t)
+	SetServers([]string{addr})
+	srv := snapshot()[0]
+	c, e := srv.dial()
+	if e != nil {
+		t.Fatal(e)
+	}
+	c.Close()
+	srv.put(c)
+	if e = srv.probe(); e != nil {
+		t.Fatalf("unexpected probe error: %+v", e)
+	}
+	if n := atomic.LoadInt32(accepted); n != 2 {
+		t.Errorf("expected stale connection replaced, got %d connections", n)
+	}
+	if len(srv.idle) != 1 || srv.idle[0] == c {
+		t.Errorf("expected stale connection dropped from pool")
+	}
+}
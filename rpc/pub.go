@@ -0,0 +1,122 @@
+package rpc
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+	logr "github.com/sirupsen/logrus"
+)
+
+//Policy decides whether a broadcast is successful based on the number of servers succeeded.
+type Policy int
+
+const (
+	//ALL every server must succeed
+	ALL Policy = iota
+	//QUORUM more than half of the servers must succeed
+	QUORUM
+	//ANY at least one server must succeed
+	ANY
+)
+
+func (p Policy) String() string {
+	switch p {
+	case ALL:
+		return "ALL"
+	case QUORUM:
+		return "QUORUM"
+	case ANY:
+		return "ANY"
+	default:
+		return fmt.Sprintf("Policy(%d)", int(p))
+	}
+}
+
+func (p Policy) satisfied(suc, total int) bool {
+	switch p {
+	case ALL:
+		return suc == total
+	case QUORUM:
+		return suc*2 > total
+	case ANY:
+		return suc > 0
+	default:
+		return false
+	}
+}
+
+//Reply the outcome of broadcast call on a single rpc server.
+type Reply struct {
+	Server string
+	//Value the reply created by newReply function, filled by the remote service.
+	Value interface{}
+	Err   error
+}
+
+//Pub Publish data to all rpc servers concurrently. newReply creates a reply holder for each server.
+// Each server is retried for up to 'retry' times, and servers not responding within 'timeout'
+// are reported as failed. No overall timeout is set if timeout <= 0.
+// Returns the reply of each server in the order of the pool, and an error if the policy is not satisfied.
+func Pub(service string, request interface{}, newReply func() interface{}, retry int,
+	policy Policy, timeout time.Duration) (replies []*Reply, e error) {
+	srvs := snapshot()
+	if len(srvs) == 0 {
+		return nil, errors.Errorf("no rpc server configured for service: %s", service)
+	}
+	if retry < 1 {
+		retry = 1
+	}
+	type idxReply struct {
+		idx int
+		rep *Reply
+	}
+	// buffered to let late servers finish without blocking after timeout
+	chrep := make(chan *idxReply, len(srvs))
+	for i, srv := range srvs {
+		go func(idx int, srv *server) {
+			r := &Reply{Server: srv.addr, Value: newReply()}
+			for i := 0; i < retry; i++ {
+				logr.Debugf("rpc call start, server: %s, service: %s", srv.addr, service)
+				r.Err = srv.call(service, request, r.Value)
+				srv.mark(r.Err)
+				if r.Err == nil {
+					break
+				} else if i+1 < retry {
+					logr.Warnf("retrying to call rpc service: %d\n, %s", i+1, fmt.Sprintln(r.Err))
+					time.Sleep(time.Millisecond * time.Duration(500+500*i))
+				} else {
+					logr.Errorf("failed to call rpc service\n%s", fmt.Sprintln(r.Err))
+				}
+			}
+			chrep <- &idxReply{idx, r}
+		}(i, srv)
+	}
+	var tmout <-chan time.Time
+	if timeout > 0 {
+		tmout = time.After(timeout)
+	}
+	replies = make([]*Reply, len(srvs))
+collect:
+	for c := 0; c < len(srvs); c++ {
+		select {
+		case ir := <-chrep:
+			replies[ir.idx] = ir.rep
+		case <-tmout:
+			break collect
+		}
+	}
+	suc := 0
+	for i, r := range replies {
+		if r == nil {
+			replies[i] = &Reply{Server: srvs[i].addr,
+				Err: errors.Errorf("%s rpc service timeout after %v: %s", srvs[i].addr, timeout, service)}
+		} else if r.Err == nil {
+			suc++
+		}
+	}
+	if !policy.satisfied(suc, len(srvs)) {
+		e = errors.Errorf("broadcast of %s failed, policy: %s, succeeded: %d/%d", service, policy, suc, len(srvs))
+	}
+	return
+}
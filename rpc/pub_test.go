@@ -0,0 +1,48 @@
+package rpc
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPub(t *testing.T) {
+	a1, _ := startEchoServer(t)
+	a2, _ := startEchoServer(t)
+	SetServers([]string{a1, a2})
+	reps, e := Pub("Echo.Say", "hi", func() interface{} { return new(string) }, 1, ALL, time.Second*5)
+	if e != nil {
+		t.Fatal(e)
+	}
+	for i, r := range reps {
+		if r.Err != nil || *r.Value.(*string) != "hi" {
+			t.Errorf("unexpected reply from server %d: %+v", i, r)
+		}
+	}
+}
+
+func TestPubPolicy(t *testing.T) {
+	a1, _ := startEchoServer(t)
+	a2, _ := startEchoServer(t)
+	SetServers([]string{a1, a2, "127.0.0.1:1"})
+	newReply := func() interface{} { return new(string) }
+	reps, e := Pub("Echo.Say", "hi", newReply, 1, ALL, 0)
+	if e == nil {
+		t.Error("expected ALL policy to fail")
+	}
+	if len(reps) != 3 || reps[2].Err == nil {
+		t.Errorf("expected error reply from broken server: %+v", reps)
+	}
+	SetServers([]string{a1, a2, "127.0.0.1:1"})
+	if _, e = Pub("Echo.Say", "hi", newReply, 1, QUORUM, 0); e != nil {
+		t.Errorf("expected QUORUM policy to pass: %+v", e)
+	}
+}
+
+func TestPubTimeout(t *testing.T) {
+	a1, _ := startEchoServer(t)
+	SetServers([]string{a1})
+	reps, e := Pub("Echo.Sleep", 3, func() interface{} { return new(bool) }, 1, ANY, time.Second)
+	if e == nil || reps[0].Err == nil {
+		t.Errorf("expected timeout error: %+v", reps)
+	}
+}
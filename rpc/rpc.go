@@ -2,68 +2,26 @@ package rpc
 
 import (
 	"fmt"
-	"net"
-	"net/rpc"
-	"sync"
-	"time"
 
-	"github.com/bitly/go-hostpool"
-	"github.com/carusyte/stock/conf"
-	"github.com/felixge/tcpkeepalive"
 	"github.com/pkg/errors"
 	logr "github.com/sirupsen/logrus"
 )
 
-var (
-	hp = hostpool.New(conf.Args.RPCServers)
-	//lock                   = sync.RWMutex{}
-)
-
-//Pub Publish data to all rpc servers
-func Pub(service string, request interface{}, reply interface{}, retry int) (e []error) {
-	var wg sync.WaitGroup
-	cherr := make(chan error)
-	for _, srv := range hp.Hosts() {
-		wg.Add(1)
-		go func(wg *sync.WaitGroup, cherr chan error) {
-			defer wg.Done()
-			for i := 0; i < retry; i++ {
-				logr.Debugf("rpc call start, server: %s, service: %s", srv, service)
-				err := tryRpcCall(srv, service, request, reply)
-				if err == nil {
-					return
-				} else if i+1 < retry {
-					logr.Warnf("retrying to call rpc service: %d\n, %s", i+1, fmt.Sprintln(err))
-					time.Sleep(time.Millisecond * time.Duration(500+500*i))
-				} else {
-					logr.Errorf("failed to call rpc service\n%s", fmt.Sprintln(err))
-					cherr <- err
-				}
-			}
-		}(&wg, cherr)
-	}
-	wg.Wait()
-	for err := range cherr {
-		e = append(e, err)
-	}
-	close(cherr)
-	return nil
-}
-
+//Call invokes the rpc service on the least loaded healthy server, retrying on other servers if it fails.
 func Call(service string, request interface{}, reply interface{}, retry int) (e error) {
 	for i := 0; i < retry; i++ {
-		hpr := hp.Get()
-		serverAddress := hpr.Host()
-		logr.Debugf("rpc call start, server: %s, service: %s", serverAddress, service)
-		err := tryRpcCall(serverAddress, service, request, reply)
+		srv := pick()
+		if srv == nil {
+			return errors.Errorf("no rpc server configured for service: %s", service)
+		}
+		logr.Debugf("rpc call start, server: %s, load: %d, service: %s", srv.addr, srv.load(), service)
+		err := srv.call(service, request, reply)
+		srv.mark(err)
 		if err == nil {
-			hpr.Mark(nil)
 			return nil
 		} else if i+1 < retry {
-			hpr.Mark(err)
 			logr.Warnf("retrying to call rpc service: %d\n, %s", i+1, fmt.Sprintln(err))
 		} else {
-			hpr.Mark(err)
 			logr.Errorf("failed to call rpc service\n%s", fmt.Sprintln(err))
 			return err
 		}
@@ -71,56 +29,59 @@ func Call(service string, request interface{}, reply interface{}, retry int) (e
 	return nil
 }
 
-func tryRpcCall(serverAddress, service string, request interface{}, reply interface{}) (e error) {
-	conn, err := net.Dial("tcp", serverAddress)
-	if err != nil {
-		return errors.Wrapf(err, "failed to connect rpc server: %s", serverAddress)
-	}
-	defer conn.Close()
-	err = tcpkeepalive.SetKeepAlive(conn, time.Second*60, 2048, time.Second*45)
-	if err != nil {
-		return errors.Wrapf(err, "failed to set tcp keep-alive for connection to %s", serverAddress)
+//CallOn invokes the rpc service on the specified server in the pool, without retry.
+func CallOn(addr string, service string, request interface{}, reply interface{}) error {
+	var srv *server
+	for _, s := range snapshot() {
+		if s.addr == addr {
+			srv = s
+			break
+		}
 	}
-	client := rpc.NewClient(conn)
-	defer client.Close()
-	err = client.Call(service, request, reply)
-	if err != nil {
-		return errors.Wrapf(err, "%s rpc service error: %s", serverAddress, service)
+	if srv == nil {
+		return errors.Errorf("rpc server %s is not in the pool", addr)
 	}
-	return nil
+	e := srv.call(service, request, reply)
+	srv.mark(e)
+	return e
+}
+
+//Go invokes the rpc service asynchronously. The returned channel receives the outcome
+// of the call once it's done, including any retries.
+func Go(service string, request interface{}, reply interface{}, retry int) <-chan error {
+	done := make(chan error, 1)
+	go func() {
+		done <- Call(service, request, reply, retry)
+	}()
+	return done
 }
 
 // Returns the number of available RPC servers configured in rpc_servers in stock.toml
-// If filter is set to true, broken servers will be removed from the host pool.
+// If filter is set to true, broken servers will be removed from the pool.
 func Available(filter bool) (c int, healthy float64) {
-	srvs := hp.Hosts()
+	srvs := snapshot()
 	if len(srvs) == 0 {
 		return 0, 0
 	}
 	all := len(srvs)
-	for i := 0; i < len(srvs); {
-		srv := srvs[i]
-		conn, err := net.Dial("tcp", srv)
+	alive := make([]string, 0, all)
+	for _, srv := range srvs {
+		err := srv.probe()
 		if err == nil {
-			conn.Close()
 			c++
-			i++
+			alive = append(alive, srv.addr)
 		} else {
-			logr.Warnf("rpc server %s is inaccessible", srv)
+			srv.mark(err)
+			logr.Warnf("rpc server %s is inaccessible", srv.addr)
 			if filter {
-				logr.Printf("removing rpc server %s from the host pool", srv)
-				if i+1 < len(srvs) {
-					srvs = append(srvs[:i], srvs[i+1:]...)
-				} else {
-					srvs = srvs[:i]
-				}
+				logr.Printf("removing rpc server %s from the pool", srv.addr)
 			} else {
-				i++
+				alive = append(alive, srv.addr)
 			}
 		}
 	}
 	if c < all {
-		hp = hostpool.New(srvs)
+		SetServers(alive)
 	}
 	healthy = float64(c) / float64(all)
 	return
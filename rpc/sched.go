@@ -0,0 +1,138 @@
+package rpc
+
+import (
+	"math"
+	"runtime"
+	"time"
+
+	"github.com/carusyte/stock/conf"
+	"github.com/carusyte/stock/util"
+	"github.com/pkg/errors"
+	logr "github.com/sirupsen/logrus"
+)
+
+const (
+	//SCHED_INTERVAL interval of sampling local cpu usage to adjust local concurrency
+	SCHED_INTERVAL = time.Second * 2
+)
+
+// outcome of a scheduled job
+type outcome struct {
+	job *Job
+	srv *server
+	err error
+}
+
+//Schedule runs the jobs in AUTO mode. Each job is routed to the local machine if there's spare local
+// capacity, otherwise to the least loaded healthy rpc server having less than dist_concurrency jobs in flight.
+// Local capacity starts at 1 and is adjusted with every cpu usage sample: doubled while the cpu usage is
+// below cpu_usage_threshold and the capacity is used up, halved once the usage is above the threshold.
+// A job failed remotely is rescheduled, and the failing server is skipped until its backoff period is over.
+// Errors of jobs failed locally are returned, prefixed by job ID.
+func Schedule(jobs []*Job) (errs []error) {
+	if len(jobs) == 0 {
+		return
+	}
+	rs, h := Available(false)
+	logr.Debugf("scheduling %d jobs, available rpc servers: %d, %.2f%%", len(jobs), rs, h*100)
+	var (
+		queue    = make([]*Job, len(jobs))
+		chout    = make(chan *outcome, len(jobs))
+		pending  = len(jobs)
+		localCap = 1
+		localRun = 0
+		remRun   = make(map[*server]int)
+		maxLocal = runtime.NumCPU()
+		ticker   = time.NewTicker(SCHED_INTERVAL)
+	)
+	defer ticker.Stop()
+	copy(queue, jobs)
+	util.CpuUsage() // sets the baseline of the next sample
+	for pending > 0 {
+		for len(queue) > 0 {
+			if localRun < localCap {
+				localRun++
+				j := queue[0]
+				queue = queue[1:]
+				go func(j *Job) {
+					chout <- &outcome{job: j, err: j.Local()}
+				}(j)
+				continue
+			}
+			srv := pickFree(remRun)
+			if srv == nil {
+				break
+			}
+			i := 0
+			for ; i < len(queue); i++ {
+				if queue[i].Remote != nil && queue[i].fails < MAX_DIST_RETRY {
+					break
+				}
+			}
+			if i == len(queue) {
+				break
+			}
+			j := queue[i]
+			queue = append(queue[:i], queue[i+1:]...)
+			remRun[srv]++
+			go func(j *Job, srv *server) {
+				chout <- &outcome{job: j, srv: srv, err: j.Remote(srv.addr)}
+			}(j, srv)
+		}
+		select {
+		case o := <-chout:
+			if o.srv != nil {
+				remRun[o.srv]--
+				if o.err != nil {
+					o.job.fails++
+					logr.Warnf("job %s failed on %s, rescheduling\n%+v", o.job.ID, o.srv.addr, o.err)
+					queue = append(queue, o.job)
+					continue
+				}
+			} else {
+				localRun--
+				if o.err != nil {
+					logr.Errorf("job %s failed locally\n%+v", o.job.ID, o.err)
+					errs = append(errs, errors.Wrap(o.err, o.job.ID))
+				}
+			}
+			pending--
+		case <-ticker.C:
+			cpu, e := util.CpuUsage()
+			if e != nil {
+				logr.Warnf("failed to get cpu usage: %+v", e)
+				continue
+			}
+			if cpu < conf.Args().CPUUsageThreshold && len(queue) > 0 && localRun >= localCap && localCap < maxLocal {
+				localCap = int(math.Min(float64(maxLocal), float64(localCap*2)))
+			} else if cpu > conf.Args().CPUUsageThreshold && localCap > 1 {
+				localCap /= 2
+			}
+			remote := 0
+			for _, n := range remRun {
+				remote += n
+			}
+			logr.Debugf("%%cpu: %.2f, local concurrency: %d/%d, remote: %d, queued: %d, pending: %d",
+				cpu, localRun, localCap, remote, len(queue), pending)
+		}
+	}
+	return
+}
+
+// pickFree picks the least loaded healthy server with less than dist_concurrency scheduled jobs.
+func pickFree(running map[*server]int) (p *server) {
+	var minLoad int64 = math.MaxInt64
+	for _, s := range snapshot() {
+		if running[s] >= conf.Args().DistConcurrency {
+			continue
+		}
+		if ok, _ := s.health(); !ok {
+			continue
+		}
+		if l := s.load(); l < minLoad {
+			minLoad = l
+			p = s
+		}
+	}
+	return
+}
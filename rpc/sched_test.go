@@ -0,0 +1,71 @@
+package rpc
+
+import (
+	"fmt"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSchedule(t *testing.T) {
+	good, _ := startEchoServer(t)
+	l, e := net.Listen("tcp", "127.0.0.1:0")
+	if e != nil {
+		t.Fatal(e)
+	}
+	broken := l.Addr().String()
+	l.Close()
+	SetServers([]string{good, broken})
+	var remote, local int32
+	runs := make([]int32, 50)
+	jobs := make([]*Job, len(runs))
+	for i := range jobs {
+		idx := i
+		jobs[i] = &Job{ID: fmt.Sprintf("job-%d", i)}
+		jobs[i].Remote = func(addr string) error {
+			var rep string
+			if e := CallOn(addr, "Echo.Say", jobs[idx].ID, &rep); e != nil {
+				return e
+			}
+			atomic.AddInt32(&remote, 1)
+			atomic.AddInt32(&runs[idx], 1)
+			return nil
+		}
+		jobs[i].Local = func() error {
+			time.Sleep(time.Millisecond * 10)
+			atomic.AddInt32(&local, 1)
+			atomic.AddInt32(&runs[idx], 1)
+			return nil
+		}
+	}
+	if errs := Schedule(jobs); len(errs) != 0 {
+		t.Fatalf("unexpected errors: %+v", errs)
+	}
+	for i, r := range runs {
+		if r != 1 {
+			t.Errorf("job %d was done %d times", i, r)
+		}
+	}
+	if remote == 0 || local == 0 {
+		t.Errorf("expected jobs done both remotely and locally, remote: %d, local: %d", remote, local)
+	}
+}
+
+func TestScheduleLocalOnly(t *testing.T) {
+	SetServers(nil)
+	var done int32
+	jobs := make([]*Job, 10)
+	for i := range jobs {
+		jobs[i] = &Job{ID: fmt.Sprintf("job-%d", i), Local: func() error {
+			atomic.AddInt32(&done, 1)
+			return nil
+		}}
+	}
+	if errs := Schedule(jobs); len(errs) != 0 {
+		t.Fatalf("unexpected errors: %+v", errs)
+	}
+	if done != int32(len(jobs)) {
+		t.Errorf("expected %d jobs done, got %d", len(jobs), done)
+	}
+}
@@ -0,0 +1,204 @@
+package rpc
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"net/rpc"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/carusyte/stock/indc"
+	"github.com/carusyte/stock/model"
+	"github.com/pkg/errors"
+	logr "github.com/sirupsen/logrus"
+)
+
+// fdStore holds the kdj feature data pushed by DataSync.SyncKdjFd, keyed by model.KdjFdKey.
+// vers records the versions synchronized.
+type fdStore struct {
+	lock sync.RWMutex
+	kdj  map[string][]*model.KDJfdView
+	vers map[string]bool
+}
+
+func (f *fdStore) get(ver string, cytp model.CYTP, bysl string, num int) []*model.KDJfdView {
+	return f.kdj[model.KdjFdKey(ver, cytp, bysl, num)]
+}
+
+// kdjFdViews returns the buy and sell feature data of the version with sample number close to len.
+func (f *fdStore) kdjFdViews(ver string, cytp model.CYTP, len int) (buy, sell []*model.KDJfdView) {
+	buy = make([]*model.KDJfdView, 0, 1024)
+	sell = make([]*model.KDJfdView, 0, 1024)
+	for i := -2; i < 3; i++ {
+		n := len + i
+		if n >= 2 {
+			buy = append(buy, f.get(ver, cytp, "BY", n)...)
+			sell = append(sell, f.get(ver, cytp, "SL", n)...)
+		}
+	}
+	return
+}
+
+//DataSync rpc service receiving feature data from the client.
+type DataSync struct {
+	fds *fdStore
+}
+
+//SyncKdjFd replaces the in-memory kdj feature data of the versions in request, keyed by model.KdjFdKey.
+// Feature data of other versions are kept, so that different versions can be scored side by side.
+func (d *DataSync) SyncKdjFd(req map[string][]*model.KDJfdView, rep *bool) error {
+	count := 0
+	vers := make(map[string]bool)
+	for k, fdvs := range req {
+		i := strings.Index(k, ":")
+		if i < 0 {
+			return errors.Errorf("invalid kdj feature data key: %s", k)
+		}
+		vers[k[:i]] = true
+		count += len(fdvs)
+	}
+	d.fds.lock.Lock()
+	for k := range d.fds.kdj {
+		if vers[k[:strings.Index(k, ":")]] {
+			delete(d.fds.kdj, k)
+		}
+	}
+	for k, fdvs := range req {
+		d.fds.kdj[k] = fdvs
+	}
+	for v := range vers {
+		d.fds.vers[v] = true
+	}
+	d.fds.lock.Unlock()
+	logr.Printf("kdj feature data synchronized, versions: %v, keys: %d, size: %d", keys(vers), len(req), count)
+	*rep = true
+	return nil
+}
+
+//IndcScorer rpc service scoring and pruning indicator data against the in-memory feature data.
+type IndcScorer struct {
+	fds *fdStore
+}
+
+//ScoreKdj scores each of the kdj series in request, in the same way as KdjV scorer does locally.
+func (s *IndcScorer) ScoreKdj(req *model.KdjScoreReq, rep *model.KdjScoreRep) error {
+	st := time.Now()
+	s.fds.lock.RLock()
+	defer s.fds.lock.RUnlock()
+	if !s.fds.vers[req.Ver] {
+		return errors.Errorf("kdj feature data version %q has not been synchronized", req.Ver)
+	}
+	wgt := req.WgtDay + req.WgtWeek + req.WgtMonth
+	if wgt <= 0 {
+		return errors.Errorf("invalid weights: %.2f/%.2f/%.2f", req.WgtDay, req.WgtWeek, req.WgtMonth)
+	}
+	sim, e := indc.KdjSimOf(req.SimMetric, req.DtwWindow)
+	if e != nil {
+		return e
+	}
+	rep.RowIds = make([]string, len(req.Data))
+	rep.Scores = make([]float64, len(req.Data))
+	rep.Detail = make([]map[string]interface{}, len(req.Data))
+	rep.Matches = make([][]*model.KdjMatch, len(req.Data))
+	var wg sync.WaitGroup
+	chidx := make(chan int, len(req.Data))
+	for i := range req.Data {
+		chidx <- i
+	}
+	close(chidx)
+	for p := 0; p < runtime.NumCPU(); p++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range chidx {
+				ks := req.Data[i]
+				det := make(map[string]interface{})
+				var ms []*model.KdjMatch
+				sc := s.scoreKdj(req.Ver, model.MONTH, ks.KdjMo, sim, req.TopMatch, det, &ms) * req.WgtMonth
+				sc += s.scoreKdj(req.Ver, model.WEEK, ks.KdjWk, sim, req.TopMatch, det, &ms) * req.WgtWeek
+				sc += s.scoreKdj(req.Ver, model.DAY, ks.KdjDy, sim, req.TopMatch, det, &ms) * req.WgtDay
+				rep.RowIds[i] = ks.RowId
+				rep.Scores[i] = math.Min(100, math.Max(0, sc/wgt))
+				rep.Detail[i] = det
+				rep.Matches[i] = ms
+			}
+		}()
+	}
+	wg.Wait()
+	logr.Debugf("%d kdj series scored, time: %.2f", len(req.Data), time.Since(st).Seconds())
+	return nil
+}
+
+func (s *IndcScorer) scoreKdj(ver string, cytp model.CYTP, hist []*model.Indicator, sim indc.KdjSim,
+	top int, det map[string]interface{}, matches *[]*model.KdjMatch) float64 {
+	byfds, slfds := s.fds.kdjFdViews(ver, cytp, len(hist))
+	sc, bdet, sdet, ms := indc.ScoreKdj(hist, byfds, slfds, sim, top)
+	*matches = append(*matches, ms...)
+	for i, n := range []string{"hdr", "pdr", "mpd", "di"} {
+		det[fmt.Sprintf("%s.b%s", cytp, n)] = bdet[i]
+		det[fmt.Sprintf("%s.s%s", cytp, n)] = sdet[i]
+	}
+	return sc
+}
+
+//PruneKdj groups similar kdj feature data in request into clusters, see indc.ClusterKdjFd.
+func (s *IndcScorer) PruneKdj(req *model.KdjPruneReq, rep *model.KdjPruneRep) error {
+	st := time.Now()
+	bfc := len(req.Data)
+	sim, e := indc.KdjSimOf(req.SimMetric, req.DtwWindow)
+	if e != nil {
+		return e
+	}
+	rep.ID = req.ID
+	rep.Data, rep.Assign = indc.ClusterKdjFd(req.ID, req.Data, req.Prec, req.PruneRate, sim)
+	logr.Debugf("%s pruned, before: %d, after: %d, time: %.2f", req.ID, bfc, len(rep.Data),
+		time.Since(st).Seconds())
+	return nil
+}
+
+//Health rpc service for clients to check whether the server is alive.
+type Health struct{}
+
+//Ping replies true.
+func (h *Health) Ping(req bool, rep *bool) error {
+	*rep = true
+	return nil
+}
+
+//NewServer creates a rpc server with Health, IndcScorer and DataSync services registered,
+// sharing the same in-memory feature data.
+func NewServer() *rpc.Server {
+	fds := &fdStore{kdj: make(map[string][]*model.KDJfdView), vers: make(map[string]bool)}
+	srv := rpc.NewServer()
+	srv.Register(new(Health))
+	srv.Register(&IndcScorer{fds})
+	srv.Register(&DataSync{fds})
+	return srv
+}
+
+//Serve accepts connections on the listener and serves rpc requests on each of them,
+// until the listener is closed.
+func Serve(l net.Listener) error {
+	srv := NewServer()
+	logr.Printf("rpc server listening on %s", l.Addr())
+	for {
+		c, e := l.Accept()
+		if e != nil {
+			return errors.Wrap(e, "rpc server stopped accepting connections")
+		}
+		go srv.ServeConn(c)
+	}
+}
+
+func keys(m map[string]bool) []string {
+	ks := make([]string, 0, len(m))
+	for k := range m {
+		ks = append(ks, k)
+	}
+	sort.Strings(ks)
+	return ks
+}
@@ -0,0 +1,144 @@
+package rpc
+
+import (
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/carusyte/stock/model"
+)
+
+func startIndcServer(t *testing.T) string {
+	l, e := net.Listen("tcp", "127.0.0.1:0")
+	if e != nil {
+		t.Fatal(e)
+	}
+	go Serve(l)
+	return l.Addr().String()
+}
+
+func kdjIndicators(code string, k ...float64) []*model.Indicator {
+	r := make([]*model.Indicator, len(k))
+	for i, v := range k {
+		r[i] = &model.Indicator{Code: code, Klid: i, KDJ_K: v, KDJ_D: v * 0.9, KDJ_J: v*1.2 - 5}
+	}
+	return r
+}
+
+func kdjFd(cytp model.CYTP, bysl string, weight float64, k ...float64) *model.KDJfdView {
+	f := &model.KDJfdView{Indc: "KDJ", Fid: fmt.Sprintf("%s-%s-%v", cytp, bysl, k), Bysl: bysl, Cytp: cytp,
+		SmpNum: len(k), FdNum: 1, Weight: weight}
+	for _, i := range kdjIndicators("", k...) {
+		f.Add(i.KDJ_K, i.KDJ_D, i.KDJ_J)
+	}
+	return f
+}
+
+func TestScoreKdj(t *testing.T) {
+	SetServers([]string{startIndcServer(t)})
+	ks := &model.KdjSeries{RowId: "600000:1"}
+	ks.KdjDy = kdjIndicators("600000", 20, 15, 12, 18, 30)
+	ks.KdjWk = kdjIndicators("600000", 25, 20, 22, 35)
+	ks.KdjMo = kdjIndicators("600000", 40, 30, 35)
+	req := &model.KdjScoreReq{Data: []*model.KdjSeries{ks}, WgtDay: 30, WgtWeek: 30, WgtMonth: 40, TopMatch: 2}
+	var rep *model.KdjScoreRep
+	if e := Call("IndcScorer.ScoreKdj", req, &rep, 1); e == nil {
+		t.Fatal("expected error before feature data is synchronized")
+	}
+	fdMap := make(map[string][]*model.KDJfdView)
+	for _, f := range []*model.KDJfdView{
+		kdjFd(model.DAY, "BY", 1, 20, 15, 12, 18, 30),
+		kdjFd(model.DAY, "SL", 1, 80, 85, 90, 70, 60),
+		kdjFd(model.WEEK, "BY", 1, 25, 20, 22, 35),
+		kdjFd(model.MONTH, "BY", 1, 40, 30, 35),
+	} {
+		k := model.KdjFdKey("V1", f.Cytp, f.Bysl, f.SmpNum)
+		fdMap[k] = append(fdMap[k], f)
+	}
+	reps, e := Pub("DataSync.SyncKdjFd", fdMap, func() interface{} { return new(bool) }, 1, ALL, time.Second*5)
+	if e != nil || !*reps[0].Value.(*bool) {
+		t.Fatalf("failed to sync kdj feature data: %+v", e)
+	}
+	if e = Call("IndcScorer.ScoreKdj", req, &rep, 1); e == nil {
+		t.Fatal("expected error scoring against a version not synchronized")
+	}
+	req.Ver = "V1"
+	if e = Call("IndcScorer.ScoreKdj", req, &rep, 1); e != nil {
+		t.Fatal(e)
+	}
+	if len(rep.RowIds) != 1 || rep.RowIds[0] != ks.RowId || len(rep.Scores) != 1 || len(rep.Detail) != 1 {
+		t.Fatalf("unexpected reply: %+v", rep)
+	}
+	if rep.Scores[0] <= 0 || rep.Scores[0] > 100 {
+		t.Errorf("score out of range: %f", rep.Scores[0])
+	}
+	if d, ok := rep.Detail[0]["D.bhdr"].(float64); !ok || d != 1 {
+		t.Errorf("expected high devia ratio of 1 against identical buy feature, got %v", rep.Detail[0]["D.bhdr"])
+	}
+	if len(rep.Matches) != 1 || len(rep.Matches[0]) == 0 {
+		t.Fatalf("expected matched feature data, got %+v", rep.Matches)
+	}
+	for _, m := range rep.Matches[0] {
+		if m.Bysl == "BY" && m.Cytp == model.DAY && m.Sim != 1 {
+			t.Errorf("identical buy feature should be matched with similarity of 1: %+v", m)
+		}
+		if m.Bysl == "SL" {
+			t.Errorf("dissimilar sell feature should not be matched: %+v", m)
+		}
+	}
+}
+
+func TestPruneKdj(t *testing.T) {
+	SetServers([]string{startIndcServer(t)})
+	fdvs := []*model.KDJfdView{
+		kdjFd(model.DAY, "BY", 0, 20, 15, 12, 18, 30),
+		kdjFd(model.DAY, "BY", 0, 20, 15, 12, 18, 30.5),
+		kdjFd(model.DAY, "BY", 0, 80, 60, 75, 40, 10),
+	}
+	req := &model.KdjPruneReq{ID: "D-BY-5", Prec: 0.99, PruneRate: 0.1, Data: fdvs}
+	var rep *model.KdjPruneRep
+	if e := Call("IndcScorer.PruneKdj", req, &rep, 1); e != nil {
+		t.Fatal(e)
+	}
+	if rep.ID != req.ID || len(rep.Data) != 2 {
+		t.Fatalf("expected 2 feature data after pruning, got %+v", rep)
+	}
+	if rep.Data[0].FdNum != 2 || rep.Data[1].FdNum != 1 {
+		t.Errorf("expected clusters of 2 and 1 feature data, got %d and %d", rep.Data[0].FdNum, rep.Data[1].FdNum)
+	}
+	if len(rep.Assign) != 3 || rep.Assign[0] != 0 || rep.Assign[1] != 0 || rep.Assign[2] != 1 {
+		t.Errorf("unexpected cluster assignment: %v", rep.Assign)
+	}
+}
+
+func TestSyncKdjFdVersions(t *testing.T) {
+	fds := &fdStore{kdj: make(map[string][]*model.KDJfdView), vers: make(map[string]bool)}
+	ds := &DataSync{fds}
+	var ok bool
+	push := func(ver string, fs ...*model.KDJfdView) {
+		req := make(map[string][]*model.KDJfdView)
+		for _, f := range fs {
+			k := model.KdjFdKey(ver, f.Cytp, f.Bysl, f.SmpNum)
+			req[k] = append(req[k], f)
+		}
+		if e := ds.SyncKdjFd(req, &ok); e != nil || !ok {
+			t.Fatalf("failed to sync %s: %+v", ver, e)
+		}
+	}
+	push("V1", kdjFd(model.DAY, "BY", 1, 20, 15, 12), kdjFd(model.DAY, "SL", 1, 80, 85, 90))
+	push("V2", kdjFd(model.DAY, "BY", 1, 25, 20, 22))
+	push("V1", kdjFd(model.WEEK, "BY", 1, 40, 30, 35))
+	if len(fds.get("V1", model.DAY, "BY", 3)) != 0 || len(fds.get("V1", model.DAY, "SL", 3)) != 0 {
+		t.Error("feature data of V1 should have been replaced")
+	}
+	if len(fds.get("V1", model.WEEK, "BY", 3)) != 1 {
+		t.Error("expected re-synchronized feature data of V1")
+	}
+	if len(fds.get("V2", model.DAY, "BY", 3)) != 1 {
+		t.Error("feature data of V2 should be kept")
+	}
+	if e := ds.SyncKdjFd(map[string][]*model.KDJfdView{"D-BY-3": nil}, &ok); e == nil {
+		t.Error("expected error syncing unversioned key")
+	}
+}
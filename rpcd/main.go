@@ -0,0 +1,49 @@
+//
+// Serves the IndcScorer and DataSync rpc services with local computation power.
+// Feature data is kept in memory and needs to be pushed by the client (see KdjV.SyncKdjFeatDat)
+// before any scoring request.
+//
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+
+	"github.com/carusyte/stock/metrics"
+	"github.com/carusyte/stock/rpc"
+	"github.com/carusyte/stock/util"
+	logr "github.com/sirupsen/logrus"
+)
+
+const APP_VERSION = "0.1"
+const LOGFILE = "rpcd.log"
+
+var (
+	versionFlag *bool   = flag.Bool("v", false, "Print the version number.")
+	addr        *string = flag.String("addr", ":45321", "The address to listen on for rpc requests.")
+)
+
+func init() {
+	logFile, err := os.OpenFile(LOGFILE, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
+	util.CheckErr(err, "failed to open log file")
+	mw := io.MultiWriter(os.Stdout, logFile)
+	log.SetOutput(mw)
+	logr.SetOutput(mw)
+}
+
+func main() {
+	flag.Parse() // Scan the arguments list
+	metrics.Serve()
+
+	if *versionFlag {
+		fmt.Println("Version:", APP_VERSION)
+		return
+	}
+	l, e := net.Listen("tcp", *addr)
+	util.CheckErr(e, "failed to listen on "+*addr)
+	log.Fatal(rpc.Serve(l))
+}
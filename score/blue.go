@@ -1,6 +1,8 @@
 package score
 
 import (
+	"github.com/carusyte/stock/conf"
+	"github.com/carusyte/stock/getd"
 	"github.com/carusyte/stock/model"
 	"github.com/carusyte/stock/util"
 	"fmt"
@@ -11,6 +13,8 @@ import (
 	"github.com/montanaflynn/stats"
 	"strings"
 	"github.com/carusyte/stock/indc"
+	"github.com/carusyte/stock/metrics"
+	"time"
 )
 
 // Search for stocks with excellent financial report.
@@ -36,22 +40,13 @@ type BlueChip struct {
 	DarAvg     float64
 }
 
-// The assessment metric diverts, some of them are somewhat negative correlated.
-const (
-	SCORE_PE     = 20.
-	SCORE_GEPS   = 60.
-	SCORE_PU     = 10.
-	SCORE_GUDPPS = 10.
-	PENALTY_DAR  = 15.
-	//PE_THRESHOLD        = 50.
-	//BLUE_HIST_SPAN_YEAR = 3.
-)
-
 func (b *BlueChip) Geta() (r *Result) {
 	return b.Get(nil, -1, false)
 }
 
 func (b *BlueChip) Get(s []string, limit int, ranked bool) (r *Result) {
+	defer metrics.ScorerTime(b.Id(), time.Now())
+	getd.RecordParams(b.Id(), conf.Args().BlueChip)
 	r = &Result{}
 	r.PfIds = append(r.PfIds, b.Id())
 	var blus []*BlueChip
@@ -111,7 +106,7 @@ func pDar(b *BlueChip, hist []*model.Finance) (s float64) {
 	if !b.Dar.Valid || b.Dar.Float64 < 0 || b.Dar.Float64 <= ZERO_DAR {
 		s = 0
 	} else {
-		s = 1. / 2. * PENALTY_DAR * math.Min(1, math.Pow((b.Dar.Float64-ZERO_DAR)/(MAX_DAR-ZERO_DAR), 4.37))
+		s = 1. / 2. * conf.Args().BlueChip.PenaltyDar * math.Min(1, math.Pow((b.Dar.Float64-ZERO_DAR)/(MAX_DAR-ZERO_DAR), 4.37))
 	}
 	// fine average DAR
 	dars := make([]float64, 0, 16)
@@ -142,7 +137,7 @@ func pDar(b *BlueChip, hist []*model.Finance) (s float64) {
 	}
 	b.DarAvg = avg
 	if avg > 70 {
-		s += 1. / 2. * PENALTY_DAR * math.Min(1, math.Pow((avg-70.)/(95.-70.), 2.1))
+		s += 1. / 2. * conf.Args().BlueChip.PenaltyDar * math.Min(1, math.Pow((avg-70.)/(95.-70.), 2.1))
 	}
 	return
 }
@@ -160,7 +155,7 @@ func sUdpps(b *BlueChip, fins []*model.Finance) (s float64) {
 	} else if b.Pu.Float64 < 0 || b.Pu.Float64 >= ZERO_PU {
 		s = 0
 	} else {
-		s = SCORE_PU * math.Min(1, math.Pow((ZERO_PU-b.Pu.Float64)/(ZERO_PU-MAX_PU), 0.5))
+		s = conf.Args().BlueChip.ScorePu * math.Min(1, math.Pow((ZERO_PU-b.Pu.Float64)/(ZERO_PU-MAX_PU), 0.5))
 	}
 	// score UDPPS growth rate
 	grs := make([]float64, 0, 16)
@@ -200,14 +195,14 @@ func sUdpps(b *BlueChip, fins []*model.Finance) (s float64) {
 		util.CheckErr(e, "failed to calculate mean for "+fmt.Sprintf("%+v", grs))
 	}
 	b.UdppsGrAvg = avg
-	s += 2. / 5. * SCORE_GUDPPS * math.Min(1, math.Log((math.E-1)*pnum/4.+1))
+	s += 2. / 5. * conf.Args().BlueChip.ScoreGudpps * math.Min(1, math.Log((math.E-1)*pnum/4.+1))
 	if avg >= -20. {
-		s += 3. / 5. * SCORE_GUDPPS * math.Min(1, math.Pow((20.+avg)/30., 0.55))
+		s += 3. / 5. * conf.Args().BlueChip.ScoreGudpps * math.Min(1, math.Pow((20.+avg)/30., 0.55))
 	}
 	if len(ngrs) > 0 {
 		navg, e := stats.Mean(ngrs)
 		util.CheckErr(e, "failed to calculate mean for "+fmt.Sprintf("%+v", ngrs))
-		s -= SCORE_GUDPPS * math.Min(1, math.Pow(navg / -70., 3.12))
+		s -= conf.Args().BlueChip.ScoreGudpps * math.Min(1, math.Pow(navg / -70., 3.12))
 		s = math.Max(0, s)
 	}
 	return
@@ -232,7 +227,7 @@ func sEps(b *BlueChip, hist []*model.Finance) (s float64) {
 	if b.Pe.Float64 < 0 || b.Pe.Float64 >= ZERO_PE {
 		s = 0
 	} else {
-		s = SCORE_PE * math.Min(1, math.Pow((ZERO_PE-b.Pe.Float64)/(ZERO_PE-MAX_PE), 0.5))
+		s = conf.Args().BlueChip.ScorePe * math.Min(1, math.Pow((ZERO_PE-b.Pe.Float64)/(ZERO_PE-MAX_PE), 0.5))
 	}
 	// score EPS growth rate
 	grs := make([]float64, 0, 16)
@@ -271,14 +266,14 @@ func sEps(b *BlueChip, hist []*model.Finance) (s float64) {
 		util.CheckErr(e, "failed to calculate mean for "+fmt.Sprintf("%+v", grs))
 	}
 	b.EpsGrAvg = avg
-	s += 2. / 5. * SCORE_GEPS * math.Min(1, math.Log((math.E-1)*pnum/4.+1))
+	s += 2. / 5. * conf.Args().BlueChip.ScoreGeps * math.Min(1, math.Log((math.E-1)*pnum/4.+1))
 	if avg >= -15. {
-		s += 3. / 5. * SCORE_GEPS * math.Min(1, math.Pow((15.+avg)/30., 1.75))
+		s += 3. / 5. * conf.Args().BlueChip.ScoreGeps * math.Min(1, math.Pow((15.+avg)/30., 1.75))
 	}
 	if len(ngrs) > 0 {
 		navg, e := stats.Mean(ngrs)
 		util.CheckErr(e, "failed to calculate mean for "+fmt.Sprintf("%+v", ngrs))
-		s -= 0.7 * SCORE_GEPS * math.Min(1, math.Pow(navg / -80., 3.12))
+		s -= 0.7 * conf.Args().BlueChip.ScoreGeps * math.Min(1, math.Pow(navg / -80., 3.12))
 		s = math.Max(0, s)
 	}
 	return
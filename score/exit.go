@@ -0,0 +1,279 @@
+package score
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/carusyte/stock/conf"
+	"github.com/carusyte/stock/getd"
+	"github.com/carusyte/stock/indc"
+	"github.com/carusyte/stock/metrics"
+	"github.com/carusyte/stock/model"
+	"github.com/carusyte/stock/portfolio"
+	"github.com/carusyte/stock/util"
+	"github.com/pkg/errors"
+)
+
+// Sell-side advisor for held positions. Score stands for the urgency to sell, adding up from:
+// 1. Similarity of kdj history to the sell feature data rather than the buy ones, see KdjV
+// 2. Drawdown from the highest close in recent days
+// 3. Loss against cost price
+// Urgency is relieved if dividend registration is coming soon.
+// Action is HOLD, TRIM or EXIT according to the score, with reasons in comments.
+type Exit struct {
+	Code      string
+	Name      string
+	Cost      float64
+	Price     float64
+	PriceDate string
+	Pnl       float64 // Percentage of gain against cost
+	High      float64 // Highest close in drawdown span
+	Drawdown  float64 // Percentage of drop from High
+	SellPtn   float64 // Score of kdj sell pattern similarity, 0~100
+	RegDate   string  // Upcoming dividend registration date
+	Divi      float64 // Dividend per 10 shares of the upcoming registration
+	Action    string
+	// Held positions to be evaluated, cost price keyed by code
+	Positions map[string]float64
+	// Portfolio account whose holdings are evaluated if Positions is not specified
+	Account string
+	// Feature data version of kdj sell pattern, see getd.KdjFdVer
+	Ver string
+}
+
+const (
+	ACT_HOLD = "HOLD"
+	ACT_TRIM = "TRIM"
+	ACT_EXIT = "EXIT"
+)
+
+//ParsePositions parses held positions in the form of "<code>:<cost>,<code>:<cost>...". Cost can be
+// omitted, in which case loss against cost is not evaluated.
+func ParsePositions(s string) (map[string]float64, error) {
+	pos := make(map[string]float64)
+	for _, p := range strings.Split(s, ",") {
+		p = strings.TrimSpace(p)
+		if p == "" {
+			continue
+		}
+		kv := strings.SplitN(p, ":", 2)
+		pos[kv[0]] = 0
+		if len(kv) == 2 {
+			c, e := strconv.ParseFloat(kv[1], 64)
+			if e != nil || c < 0 {
+				return nil, errors.Errorf("invalid cost price of %s: %s", kv[0], kv[1])
+			}
+			pos[kv[0]] = c
+		}
+	}
+	return pos, nil
+}
+
+func (x *Exit) GetFieldStr(name string) string {
+	switch name {
+	case "COST":
+		return fmt.Sprintf("%.2f", x.Cost)
+	case "PRICE":
+		return fmt.Sprintf("%.2f\n%s", x.Price, x.PriceDate)
+	case "PNL":
+		if x.Cost <= 0 {
+			return "-"
+		}
+		return fmt.Sprintf("%.2f%%", x.Pnl)
+	case "DRAWDOWN":
+		return fmt.Sprintf("%.2f%%\n%.2f", x.Drawdown, x.High)
+	case "SELL_PTN":
+		return fmt.Sprintf("%.2f", x.SellPtn)
+	case "DIVI":
+		if x.Divi == 0 {
+			return "-"
+		}
+		return fmt.Sprintf("%.2f\n%s", x.Divi, x.RegDate)
+	default:
+		r := reflect.ValueOf(x)
+		f := reflect.Indirect(r).FieldByName(name)
+		if !f.IsValid() {
+			panic(errors.New("undefined field for EXIT: " + name))
+		}
+		return fmt.Sprintf("%+v", f.Interface())
+	}
+}
+
+// Evaluates the stocks held, or all the Positions, or holdings of the Account if not specified.
+func (x *Exit) Get(codes []string, limit int, ranked bool) (r *Result) {
+	defer metrics.ScorerTime(x.Id(), time.Now())
+	getd.RecordParams(x.Id(), conf.Args().Exit)
+	r = &Result{}
+	r.PfIds = append(r.PfIds, x.Id())
+	if len(x.Positions) == 0 && x.Account != "" {
+		x.Positions = portfolio.CostMap(x.Account)
+	}
+	if len(codes) == 0 {
+		for c := range x.Positions {
+			codes = append(codes, c)
+		}
+		sort.Strings(codes)
+	}
+	if len(codes) == 0 {
+		log.Printf("no position to evaluate")
+		return
+	}
+	p := conf.Args().Exit
+	ver := getd.KdjFdVer(x.Ver)
+	for _, s := range getd.StocksDbByCode(codes...) {
+		item := new(Item)
+		r.AddItem(item)
+		item.Code = s.Code
+		item.Name = s.Name
+		item.Profiles = make(map[string]*Profile)
+		ix := &Exit{Code: s.Code, Name: s.Name, Cost: x.Positions[s.Code], Action: ACT_HOLD}
+		ip := new(Profile)
+		item.Profiles[x.Id()] = ip
+		ip.FieldHolder = ix
+		klhist := getd.GetKlineDb(s.Code, model.KLINE_DAY, p.DrawdownSpan, false)
+		if len(klhist) == 0 {
+			item.Cmt("lack of kline data")
+			ip.Skipped = true
+			continue
+		}
+		ip.Score += exitDrawdown(ix, item, klhist, p)
+		ip.Score += exitStopLoss(ix, item, p)
+		ip.Score += exitSellPtn(ix, item, ver, p)
+		ip.Score -= exitDiviRelief(ix, item, p)
+		ip.Score = math.Max(0, ip.Score)
+		ix.Action = exitAction(ip.Score, p)
+		item.Score += ip.Score
+	}
+	r.SetFields(x.Id(), x.Fields()...)
+	if ranked {
+		r.Sort()
+	}
+	r.Shrink(limit)
+	return
+}
+
+//Score by drop from the highest close in kline history.
+//Get max score if drawdown reaches MaxDrawdown.
+func exitDrawdown(ix *Exit, item *Item, klhist []*model.Quote, p conf.ExitArgs) float64 {
+	last := klhist[len(klhist)-1]
+	ix.Price = last.Close
+	ix.PriceDate = last.Date
+	ix.High = last.Close
+	for _, q := range klhist {
+		ix.High = math.Max(ix.High, q.Close)
+	}
+	if ix.High <= 0 {
+		return 0
+	}
+	ix.Drawdown = (ix.High - ix.Price) / ix.High * 100
+	if ix.Drawdown >= p.MaxDrawdown/2 {
+		item.Cmtf("Drawdown %.1f%% from high of %.2f in %d days", ix.Drawdown, ix.High, len(klhist))
+	}
+	return p.ScoreDrawdown * math.Min(1, ix.Drawdown/p.MaxDrawdown)
+}
+
+//Score by loss against cost price, 0 if cost is unknown or there's no loss.
+//Get max score if loss reaches StopLoss.
+func exitStopLoss(ix *Exit, item *Item, p conf.ExitArgs) float64 {
+	if ix.Cost <= 0 {
+		return 0
+	}
+	ix.Pnl = (ix.Price - ix.Cost) / ix.Cost * 100
+	if ix.Pnl >= 0 {
+		return 0
+	}
+	if -ix.Pnl >= p.StopLoss {
+		item.Cmtf("Loss %.1f%% against cost %.2f hits stop line", -ix.Pnl, ix.Cost)
+	}
+	return p.ScoreStopLoss * math.Min(1, -ix.Pnl/p.StopLoss)
+}
+
+//Score by similarity of kdj history to sell feature data, which is the KdjV score with buy and sell
+// feature data swapped.
+func exitSellPtn(ix *Exit, item *Item, ver string, p conf.ExitArgs) float64 {
+	w := conf.Args().Kdjv
+	wgts := map[model.CYTP]float64{model.MONTH: w.WeightMonth, model.WEEK: w.WeightWeek, model.DAY: w.WeightDay}
+	s := 0.
+	for _, c := range []struct {
+		cytp model.CYTP
+		tab  model.DBTab
+	}{{model.MONTH, model.INDICATOR_MONTH}, {model.WEEK, model.INDICATOR_WEEK}, {model.DAY, model.INDICATOR_DAY}} {
+		hist, fnd := getd.ToLstJDCross(getd.GetKdjHist(ix.Code, c.tab, 100, ""))
+		if !fnd {
+			item.Cmt("Insufficient kdj history to evaluate sell pattern")
+			return 0
+		}
+		byfds, slfds := getKDJfdViews(ver, c.cytp, len(hist))
+		sc, _, _, _ := indc.ScoreKdj(hist, slfds, byfds, kdjSim(), 0)
+		s += sc * wgts[c.cytp]
+	}
+	ix.SellPtn = math.Min(100, math.Max(0, s/(w.WeightMonth+w.WeightWeek+w.WeightDay)))
+	if ix.SellPtn >= 50 {
+		item.Cmtf("KDJ resembles historical sell points: %.1f", ix.SellPtn)
+	}
+	return p.ScoreSellPtn * ix.SellPtn / 100
+}
+
+//Relief of urgency if dividend registration is due within DiviWindow days, so as to hold through
+// the registration date. Pending dividend plans without registration date are noted only.
+func exitDiviRelief(ix *Exit, item *Item, p conf.ExitArgs) float64 {
+	sql, e := dot.Raw("EXIT_XDXR")
+	util.CheckErr(e, "failed to get EXIT_XDXR sql")
+	var xdxrs []*model.Xdxr
+	_, e = dbmap.Select(&xdxrs, sql, ix.Code, time.Now().Format("2006-01-02"))
+	if e != nil && "sql: no rows in result set" != e.Error() {
+		log.Panicf("%s failed to query upcoming xdxr\n%+v", ix.Code, e)
+	}
+	if len(xdxrs) == 0 {
+		return 0
+	}
+	x := xdxrs[0]
+	ix.Divi = x.Divi.Float64
+	if !x.RegDate.Valid {
+		item.Cmtf("Dividend plan of %.2f per 10 shares pending", ix.Divi)
+		return 0
+	}
+	ix.RegDate = x.RegDate.String
+	treg, e := time.Parse("2006-01-02", x.RegDate.String)
+	util.CheckErr(e, "failed to parse registration date: "+x.RegDate.String)
+	days := int(math.Ceil(treg.Sub(time.Now()).Hours() / 24))
+	if days < 0 || days > p.DiviWindow {
+		return 0
+	}
+	item.Cmtf("Dividend of %.2f per 10 shares registered on %s, consider holding through", ix.Divi, ix.RegDate)
+	return p.DiviRelief
+}
+
+//exitAction decides the action on the exit urgency.
+func exitAction(score float64, p conf.ExitArgs) string {
+	switch {
+	case score >= p.ExitLine:
+		return ACT_EXIT
+	case score >= p.TrimLine:
+		return ACT_TRIM
+	default:
+		return ACT_HOLD
+	}
+}
+
+func (x *Exit) Id() string {
+	return "EXIT"
+}
+
+func (x *Exit) Fields() []string {
+	return []string{"Action", "COST", "PRICE", "PNL", "DRAWDOWN", "SELL_PTN", "DIVI"}
+}
+
+func (x *Exit) Description() string {
+	return "Sell-side advice of hold, trim or exit for held positions."
+}
+
+func (x *Exit) Geta() (r *Result) {
+	return x.Get(nil, -1, true)
+}
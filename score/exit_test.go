@@ -0,0 +1,50 @@
+package score
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/carusyte/stock/conf"
+	"github.com/carusyte/stock/model"
+)
+
+func TestParsePositions(t *testing.T) {
+	pos, e := ParsePositions("600000:10.5, 000001:12,601398")
+	if e != nil {
+		t.Fatal(e)
+	}
+	if len(pos) != 3 || pos["600000"] != 10.5 || pos["000001"] != 12 || pos["601398"] != 0 {
+		t.Errorf("unexpected positions: %+v", pos)
+	}
+	if _, e = ParsePositions("600000:abc"); e == nil {
+		t.Error("expecting error on invalid cost price")
+	}
+}
+
+func TestExitAspects(t *testing.T) {
+	p := conf.ExitArgs{ScoreDrawdown: 30, ScoreStopLoss: 20, MaxDrawdown: 20, StopLoss: 10, TrimLine: 40,
+		ExitLine: 70}
+	closes := []float64{10, 11, 12.5, 12, 11, 10}
+	klhist := make([]*model.Quote, len(closes))
+	for i, c := range closes {
+		klhist[i] = &model.Quote{Klid: i, Date: fmt.Sprintf("2018-01-%02d", i+1), Close: c}
+	}
+	item := new(Item)
+	ix := &Exit{Cost: 11.5}
+	s := exitDrawdown(ix, item, klhist, p)
+	if s != 30 || ix.High != 12.5 || fmt.Sprintf("%.2f", ix.Drawdown) != "20.00" {
+		t.Errorf("unexpected drawdown score %.2f: %+v", s, ix)
+	}
+	if s := exitStopLoss(ix, item, p); fmt.Sprintf("%.2f", s) != "20.00" {
+		t.Errorf("unexpected stop loss score %.2f, pnl %.2f", s, ix.Pnl)
+	}
+	ix = &Exit{Cost: 0, Price: 5}
+	if s := exitStopLoss(ix, item, p); s != 0 {
+		t.Errorf("expecting no stop loss score without cost: %.2f", s)
+	}
+	for s, a := range map[float64]string{0: ACT_HOLD, 39.9: ACT_HOLD, 40: ACT_TRIM, 69: ACT_TRIM, 70: ACT_EXIT} {
+		if act := exitAction(s, p); act != a {
+			t.Errorf("expecting %s on score %.1f, got %s", a, s, act)
+		}
+	}
+}
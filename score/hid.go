@@ -1,6 +1,9 @@
 package score
 
 import (
+	"github.com/carusyte/stock/conf"
+	"github.com/carusyte/stock/getd"
+	"github.com/carusyte/stock/metrics"
 	"github.com/carusyte/stock/model"
 	"github.com/carusyte/stock/util"
 	"fmt"
@@ -47,21 +50,13 @@ type HiD struct {
 	PriceDate   string    `db:"price_date"`
 }
 
-const (
-	AVG_GR_HIST_SIZE         = 5
-	SCORE_DYR_AVG    float64 = 35
-	SCORE_DYR_GR             = 20
-	SCORE_LATEST_DYR         = 20
-	SCORE_DYR2DPR            = 15
-	SCORE_REG_DATE           = 10
-	PENALTY_DPR              = 25
-)
-
 func (h *HiD) Geta() (r *Result) {
 	return h.Get(nil, -1, false)
 }
 
 func (h *HiD) Get(s []string, limit int, ranked bool) (r *Result) {
+	defer metrics.ScorerTime(h.Id(), time.Now())
+	getd.RecordParams(h.Id(), conf.Args().HiD)
 	r = &Result{}
 	r.PfIds = append(r.PfIds, h.Id())
 	var hids []*HiD
@@ -87,7 +82,7 @@ func (h *HiD) Get(s []string, limit int, ranked bool) (r *Result) {
 		ip := new(Profile)
 		item.Profiles[h.Id()] = ip
 		ip.FieldHolder = ih
-		ip.Score += scoreDyr(ih, SCORE_LATEST_DYR)
+		ip.Score += scoreDyr(ih, conf.Args().HiD.ScoreLatestDyr)
 
 		//supplement latest price
 		lp := &HiD{}
@@ -105,7 +100,7 @@ func (h *HiD) Get(s []string, limit int, ranked bool) (r *Result) {
 
 		ip.Score += scoreDyrHist(ih)
 
-		ip.Score += scoreRegDate(ih, item, SCORE_REG_DATE)
+		ip.Score += scoreRegDate(ih, item, conf.Args().HiD.ScoreRegDate)
 
 		//warn if dpr is greater than 90%
 		if ih.Dpr.Valid && ih.Dpr.Float64 > 0.9 {
@@ -184,10 +179,11 @@ func scoreDyrHist(ih *HiD) (s float64) {
 	var hist []*HiD
 	_, e = dbmap.Select(&hist, sql, ih.Code)
 	util.CheckErr(e, "failed to query hid hist for "+ih.Code)
-	s += scoreDyrAvg(ih, hist, SCORE_DYR_AVG)
-	s += scoreDyrGr(ih, hist, SCORE_DYR_GR)
-	s += scoreDyr2Dpr(ih, SCORE_DYR2DPR)
-	s -= fineDpr(ih, hist, PENALTY_DPR)
+	h := conf.Args().HiD
+	s += scoreDyrAvg(ih, hist, h.ScoreDyrAvg)
+	s += scoreDyrGr(ih, hist, h.ScoreDyrGr)
+	s += scoreDyr2Dpr(ih, h.ScoreDyr2Dpr)
+	s -= fineDpr(ih, hist, h.PenaltyDpr)
 	return
 }
 
@@ -261,7 +257,7 @@ func scoreDyrAvg(ih *HiD, hist []*HiD, m float64) float64 {
 				dprs[i] = 0
 			}
 		}
-		s := 0.3 * m * math.Min(1, math.Pow(yrs/AVG_GR_HIST_SIZE, 1.82))
+		s := 0.3 * m * math.Min(1, math.Pow(yrs/float64(conf.Args().HiD.AvgGrHistSize), 1.82))
 		var e error
 		avgDyr := .0
 		avgDpr := .0
@@ -306,9 +302,9 @@ func scoreDyrGr(ih *HiD, hist []*HiD, m float64) float64 {
 					gr = -100.0
 				}
 				grs[j] = gr
-				if j < AVG_GR_HIST_SIZE {
+				if j < conf.Args().HiD.AvgGrHistSize {
 					ih.DyrGrYoy = ih.DyrGrYoy + fmt.Sprintf("%.1f", gr)
-					if j < int(math.Min(AVG_GR_HIST_SIZE-1, float64(len(hist)-2))) {
+					if j < int(math.Min(float64(conf.Args().HiD.AvgGrHistSize-1), float64(len(hist)-2))) {
 						ih.DyrGrYoy = ih.DyrGrYoy + "/"
 					}
 				}
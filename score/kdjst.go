@@ -4,7 +4,9 @@ import (
 	"fmt"
 	"math"
 	"reflect"
+	"time"
 
+	"github.com/carusyte/stock/metrics"
 	"github.com/pkg/errors"
 )
 
@@ -49,6 +51,7 @@ var (
 )
 
 func (k *KdjSt) Get(stock []string, limit int, ranked bool) (r *Result) {
+	defer metrics.ScorerTime(k.Id(), time.Now())
 	r = new(Result)
 	r.PfIds = append(r.PfIds, k.Id())
 	vr := kdjv.Get(stock, -1, false)
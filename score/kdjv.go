@@ -1,10 +1,12 @@
 package score
 
 import (
+	"database/sql"
 	"fmt"
-	rm "github.com/carusyte/rima/model"
 	"github.com/carusyte/stock/conf"
 	"github.com/carusyte/stock/getd"
+	"github.com/carusyte/stock/indc"
+	"github.com/carusyte/stock/metrics"
 	"github.com/carusyte/stock/model"
 	"github.com/carusyte/stock/rpc"
 	"github.com/carusyte/stock/util"
@@ -38,12 +40,15 @@ type KdjV struct {
 	CCMO  string
 	CCWK  string
 	CCDY  string
+	// Most similar buy and sell feature data of each cycle, explaining the score
+	Matches []*model.KdjMatch
+	// Feature data version scored against, see getd.KdjFdVer
+	Ver string
 }
 
 const (
-	WEIGHT_KDJV_MONTH float64 = 40.0
-	WEIGHT_KDJV_WEEK  float64 = 30.0
-	WEIGHT_KDJV_DAY   float64 = 30.0
+	//number of stocks scored in each job in distributed mode
+	KDJV_DIST_BATCH = 50
 )
 
 func (k *KdjV) GetFieldStr(name string) string {
@@ -64,6 +69,13 @@ func (k *KdjV) GetFieldStr(name string) string {
 		return k.CCWK
 	case "KDJ_MO":
 		return k.CCMO
+	case "MATCH":
+		var b strings.Builder
+		for _, m := range k.Matches {
+			fmt.Fprintf(&b, "%s.%s %s@%s %.2f%%/%d %.2f*%.3f\n", m.Cytp, m.Bysl, m.SrcCode, m.SmpDate, m.Mark,
+				m.Tspan, m.Sim, m.Weight)
+		}
+		return b.String()
 	default:
 		r := reflect.ValueOf(k)
 		f := reflect.Indirect(r).FieldByName(name)
@@ -75,13 +87,19 @@ func (k *KdjV) GetFieldStr(name string) string {
 }
 
 // The codes slice may contain either stock codes or index codes. If not specified, both will be handled.
+// Feature data version is specified by Ver, see getd.KdjFdVer.
 func (k *KdjV) Get(codes []string, limit int, ranked bool) (r *Result) {
+	defer metrics.ScorerTime(k.Id(), time.Now())
+	getd.RecordParams(k.Id(), conf.Args().Kdjv)
+	ver := getd.KdjFdVer(k.Ver)
+	logr.Infof("scoring kdjv against feature data version %s", ver)
 	r = &Result{}
 	r.PfIds = append(r.PfIds, k.Id())
 	var (
 		stks   []*model.Stock
 		idxlst []*model.IdxLst
 		items  []*Item
+		errs   []error
 		e      error
 	)
 	if codes == nil || len(codes) == 0 {
@@ -109,34 +127,41 @@ func (k *KdjV) Get(codes []string, limit int, ranked bool) (r *Result) {
 		item.Name = idx.Name
 		items = append(items, item)
 	}
-	pl := 2
-	switch conf.Args.RunMode {
-	case conf.LOCAL:
-		pl = int(float64(runtime.NumCPU()) * 0.7)
+	switch conf.Args().RunMode {
+	case conf.DISTRIBUTED:
+		for _, itm := range items {
+			r.AddItem(itm)
+		}
+		errs = rpc.Distribute(kdjScoreJobs(ver, items), int(float64(runtime.NumCPU())*0.7))
 	case conf.AUTO:
-		rs, h := rpc.Available(true)
-		logr.Debugf("available rpc servers: %d, %.2f%%", rs, h*100)
-		if rs > 0 {
-			pl = rs
-		} else {
-			pl = int(float64(runtime.NumCPU()) * 0.7)
+		for _, itm := range items {
+			r.AddItem(itm)
 		}
+		errs = rpc.Schedule(kdjScoreJobs(ver, items))
 	default:
-		pl = conf.Args.Concurrency
+		pl := conf.Args().Concurrency
+		if conf.Args().RunMode == conf.LOCAL {
+			pl = int(float64(runtime.NumCPU()) * 0.7)
+		}
+		logr.Debugf("Parallel Level: %d", pl)
+		var wg sync.WaitGroup
+		chitm := make(chan *Item, len(items))
+		for i := 0; i < pl; i++ {
+			wg.Add(1)
+			go scoreKdjRoutine(ver, &wg, chitm, len(items))
+		}
+		for _, itm := range items {
+			r.AddItem(itm)
+			chitm <- itm
+		}
+		close(chitm)
+		wg.Wait()
 	}
-	logr.Debugf("Parallel Level: %d", pl)
-	var wg sync.WaitGroup
-	chitm := make(chan *Item, len(items))
-	for i := 0; i < pl; i++ {
-		wg.Add(1)
-		go scoreKdjRoutine(&wg, chitm, len(items))
+	if len(errs) > 0 {
+		// batches failed are left unscored rather than failing the others
+		logr.Errorf("%d kdjv scoring jobs failed: %+v", len(errs), errs)
 	}
-	for _, itm := range items {
-		r.AddItem(itm)
-		chitm <- itm
-	}
-	close(chitm)
-	wg.Wait()
+	fillKdjMatches(k.Id(), ver, items)
 	r.SetFields(k.Id(), k.Fields()...)
 	if ranked {
 		r.Sort()
@@ -145,7 +170,24 @@ func (k *KdjV) Get(codes []string, limit int, ranked bool) (r *Result) {
 	return
 }
 
+//fillKdjMatches fills the matches of the items scored in profile pfid all at once, see getd.FillKdjMatch.
+func fillKdjMatches(pfid, ver string, items []*Item) {
+	var ms []*model.KdjMatch
+	for _, itm := range items {
+		if p, ok := itm.Profiles[pfid]; ok {
+			if kdjv, ok := p.FieldHolder.(*KdjV); ok {
+				ms = append(ms, kdjv.Matches...)
+			}
+		}
+	}
+	getd.FillKdjMatch(ver, ms...)
+}
+
+//RenewStats renews kdjv stats of the stocks, or all if not specified, against the feature data version
+// specified by Ver. Only sample points not scored in previous renewals are evaluated, see calcKdjStats and ResetStats.
 func (k *KdjV) RenewStats(useRaw bool, code ...string) {
+	getd.RecordParams(k.Id(), conf.Args().Kdjv)
+	ver := getd.KdjFdVer(k.Ver)
 	var (
 		codes   []string
 		stks    []*model.Stock
@@ -173,10 +215,7 @@ func (k *KdjV) RenewStats(useRaw bool, code ...string) {
 	for _, idx := range idxlst {
 		codes = append(codes, idx.Code)
 	}
-	pl = getParallelLevel()
-	logr.Debugf("Parallel Level: %d", pl)
 	logr.Debugf("#Stocks: %d", len(codes))
-	chcde := make(chan string, pl)
 	chkps := make(chan *model.KDJVStat, JOB_CAPACITY)
 	wgr.Add(1)
 	go func(wgr *sync.WaitGroup) {
@@ -185,56 +224,91 @@ func (k *KdjV) RenewStats(useRaw bool, code ...string) {
 		for kps := range chkps {
 			c++
 			if kps != nil {
-				saveKps(kps)
+				saveKps(ver, kps)
 			}
 			logr.Debugf("KDJ stats renew progress: %d/%d, %.2f%%",
 				c, len(codes), 100*float64(c)/float64(len(codes)))
 		}
 	}(&wgr)
-	for i, c := range codes {
-		wg.Add(1)
-		chcde <- c
-		go renewKdjStats(c, useRaw, &wg, chcde, chkps)
-		if i < pl {
-			time.Sleep(time.Millisecond * 500)
+	var errs []error
+	switch conf.Args().RunMode {
+	case conf.DISTRIBUTED:
+		errs = rpc.Distribute(kdjStatsJobs(ver, codes, useRaw, chkps), int(float64(runtime.NumCPU())*0.7))
+	case conf.AUTO:
+		errs = rpc.Schedule(kdjStatsJobs(ver, codes, useRaw, chkps))
+	default:
+		pl = getParallelLevel()
+		logr.Debugf("Parallel Level: %d", pl)
+		chcde := make(chan string, pl)
+		for i, c := range codes {
+			wg.Add(1)
+			chcde <- c
+			go renewKdjStats(c, ver, useRaw, &wg, chcde, chkps)
+			if i < pl {
+				time.Sleep(time.Millisecond * 500)
+			}
 		}
+		close(chcde)
+		wg.Wait()
 	}
-	close(chcde)
-	wg.Wait()
 	close(chkps)
 	wgr.Wait()
+	if len(errs) > 0 {
+		// stats of the failed stocks are left undone, to be renewed in the next run, see KDJV_STATS_UNDONE
+		logr.Errorf("%d kdjv stats jobs failed: %+v", len(errs), errs)
+	}
+}
+
+//ResetStats discards the scores of sample points kept for kdjv stats of the feature data version specified
+// by Ver, so the stats of the stocks, or all if not specified, are renewed from scratch next time.
+func (k *KdjV) ResetStats(code ...string) {
+	ver := getd.KdjFdVer(k.Ver)
+	var e error
+	if len(code) == 0 {
+		_, e = dbmap.Exec("update kdjv_stats set pkey = '' where ver = ?", ver)
+		util.CheckErr(e, "failed to reset kdjv_stats")
+		_, e = dbmap.Exec("delete from kdjv_stats_smp where ver = ?", ver)
+		util.CheckErr(e, "failed to purge kdjv_stats_smp")
+		return
+	}
+	codes := util.Join(code, ",", true)
+	_, e = dbmap.Exec(fmt.Sprintf("update kdjv_stats set pkey = '' where ver = ? and code in (%s)", codes), ver)
+	util.CheckErr(e, "failed to reset kdjv_stats")
+	_, e = dbmap.Exec(fmt.Sprintf("delete from kdjv_stats_smp where ver = ? and code in (%s)", codes), ver)
+	util.CheckErr(e, "failed to purge kdjv_stats_smp")
 }
 
 func getParallelLevel() (pl int) {
-	switch conf.Args.RunMode {
+	switch conf.Args().RunMode {
 	case conf.LOCAL:
 		pl = int(float64(runtime.NumCPU()) * 0.7)
-	case conf.AUTO:
-		rs, h := rpc.Available(true)
-		logr.Debugf("available rpc servers: %d, %.2f%%", rs, h*100)
-		if rs > 0 {
-			pl = int(float64(conf.Args.Concurrency) * h)
-		} else {
-			pl = int(float64(runtime.NumCPU()) * 0.7)
-		}
 	default:
-		pl = conf.Args.Concurrency
+		pl = conf.Args().Concurrency
 	}
 	return
 }
 
+//SyncKdjFeatDat publishes kdj feature data of the version specified by Ver to all rpc servers.
 func (k *KdjV) SyncKdjFeatDat() bool {
 	st := time.Now()
-	logr.Debug("Getting all kdj feature data...")
-	fdMap, count := getd.GetAllKdjFeatDat()
-	var suc bool
-	//e := util.Call(global.RPC_SERVER_ADDRESS, "IndcScorer.InitKdjFeatDat", fdMap, &suc)
-	es := rpc.Pub("DataSync.SyncKdjFd", fdMap, &suc, 3)
-	if es != nil && len(es) > 0 {
-		logr.Debugf("%d KDJ feature data synchronization failed. time: %.2f", count, time.Since(st).Seconds())
-		for _, e := range es {
-			logr.Error(e)
+	ver := getd.KdjFdVer(k.Ver)
+	logr.Debugf("Getting all kdj feature data of %s...", ver)
+	fdMap, count := getd.GetAllKdjFeatDat(ver)
+	reps, e := rpc.Pub("DataSync.SyncKdjFd", fdMap, func() interface{} { return new(bool) }, 3, rpc.ALL,
+		time.Duration(conf.Args().RPCTimeout)*time.Second)
+	for _, r := range reps {
+		if r.Err != nil {
+			logr.Errorf("%s failed to sync KDJ feature data\n%+v", r.Server, r.Err)
+		} else if !*r.Value.(*bool) {
+			logr.Errorf("%s reported failure of KDJ feature data synchronization", r.Server)
+			if e == nil {
+				e = errors.Errorf("%s reported failure", r.Server)
+			}
 		}
+	}
+	if e != nil {
+		logr.Debugf("%d KDJ feature data synchronization failed. time: %.2f\n%+v", count,
+			time.Since(st).Seconds(), e)
 		return false
 	} else {
 		logr.Debugf("%d KDJ feature data has been publish to remote rpc server. time: %.2f",
@@ -243,13 +317,14 @@ func (k *KdjV) SyncKdjFeatDat() bool {
 	}
 }
 
-func saveKps(kps ...*model.KDJVStat) {
+func saveKps(ver string, kps ...*model.KDJVStat) {
 	if kps != nil && len(kps) > 0 {
 		valueStrings := make([]string, 0, len(kps))
-		valueArgs := make([]interface{}, 0, len(kps)*16)
+		valueArgs := make([]interface{}, 0, len(kps)*18)
 		for _, k := range kps {
-			valueStrings = append(valueStrings, "(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)")
+			valueStrings = append(valueStrings, "(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)")
 			valueArgs = append(valueArgs, k.Code)
+			valueArgs = append(valueArgs, ver)
 			valueArgs = append(valueArgs, k.Dod)
 			valueArgs = append(valueArgs, k.Sl)
 			valueArgs = append(valueArgs, k.Sh)
@@ -263,64 +338,174 @@ func saveKps(kps ...*model.KDJVStat) {
 			valueArgs = append(valueArgs, k.Bmean)
 			valueArgs = append(valueArgs, k.Frmdt)
 			valueArgs = append(valueArgs, k.Todt)
+			valueArgs = append(valueArgs, k.Pkey)
 			valueArgs = append(valueArgs, k.Udate)
 			valueArgs = append(valueArgs, k.Utime)
 		}
-		stmt := fmt.Sprintf("INSERT INTO kdjv_stats (code,dod,sl,sh,bl,bh,sor,bor,scnt,bcnt,smean,bmean,"+
-			"frmdt,todt,udate,utime) VALUES %s on duplicate key update "+
+		stmt := fmt.Sprintf("INSERT INTO kdjv_stats (code,ver,dod,sl,sh,bl,bh,sor,bor,scnt,bcnt,smean,bmean,"+
+			"frmdt,todt,pkey,udate,utime) VALUES %s on duplicate key update "+
 			"dod=values(dod),sl=values(sl),"+
 			"sh=values(sh),bl=values(bl),bh=values(bh),"+
 			"sor=values(sor),bor=values(bor),scnt=values(scnt),bcnt=values(bcnt),smean=values(smean),"+
 			"bmean=values(bmean),"+
-			"frmdt=values(frmdt),todt=values(todt),udate=values(udate),utime=values(utime)",
+			"frmdt=values(frmdt),todt=values(todt),pkey=values(pkey),udate=values(udate),utime=values(utime)",
 			strings.Join(valueStrings, ","))
 		_, err := dbmap.Exec(stmt, valueArgs...)
 		util.CheckErr(err, "failed to bulk update kdjv_stats")
+		metrics.RowsUpserted("kdjv_stats", len(kps))
 		logr.Debugf("%d kdjv_stats updated", len(kps))
 	}
 }
 
 // collect kdjv stats and save to database
-func renewKdjStats(code string, useRaw bool, wg *sync.WaitGroup, chcde chan string,
+func renewKdjStats(code, ver string, useRaw bool, wg *sync.WaitGroup, chcde chan string,
 	chkps chan *model.KDJVStat) {
 	defer func() {
 		wg.Done()
 		<-chcde
 	}()
+	e := calcKdjStats(code, ver, useRaw, chkps, func(pts []*model.Quote, buy bool) ([]float64, error) {
+		switch conf.Args().RunMode {
+		case conf.REMOTE:
+			return kdjScoresRemote(code, ver, pts, buy, "")
+		default:
+			return kdjScoresLocal(code, ver, pts, buy, useRaw)
+		}
+	})
+	if e != nil {
+		logr.Warn(e)
+	}
+}
+
+//kdjStatsJobs creates a job renewing kdjv stats for each of the stocks, which can be run either
+// remotely or locally, unless raw feature data is used.
+func kdjStatsJobs(ver string, codes []string, useRaw bool, chkps chan *model.KDJVStat) []*rpc.Job {
+	jobs := make([]*rpc.Job, len(codes))
+	for i, c := range codes {
+		code := c
+		j := &rpc.Job{ID: code}
+		j.Local = func() error {
+			return calcKdjStats(code, ver, useRaw, chkps, func(pts []*model.Quote, buy bool) ([]float64, error) {
+				return kdjScoresLocal(code, ver, pts, buy, useRaw)
+			})
+		}
+		if !useRaw {
+			j.Remote = func(addr string) error {
+				return calcKdjStats(code, ver, useRaw, chkps, func(pts []*model.Quote, buy bool) ([]float64, error) {
+					return kdjScoresRemote(code, ver, pts, buy, addr)
+				})
+			}
+		}
+		jobs[i] = j
+	}
+	return jobs
+}
+
+//calcKdjStats collects kdjv stats of the stock from the scores of buy and sell sample points, and sends
+// the stats to chkps, or nil if there's insufficient data or the stats are up to date. Nothing is sent if
+// score function fails. Score of each sample point is kept in kdjv_stats_smp, so only the points not scored
+// yet, usually those after Todt of last renewal, are evaluated by score function, as long as the scoring
+// parameters and feature data remain the same, see kdjStatsPkey. Points out of the retrospective span are discarded. Stats and sample points
+// are kept separately for each feature data version.
+func calcKdjStats(code, ver string, useRaw bool, chkps chan *model.KDJVStat,
+	score func(pts []*model.Quote, buy bool) (scores []float64, e error)) error {
 	start := time.Now()
-	var e error
-	expvr := 5.0
-	mxrt := 2.0
-	mxhold := 3
-	retro := conf.Args.Kdjv.StatsRetroSpan
-	kps := new(model.KDJVStat)
+	p := conf.Args().Kdjv
+	retro := p.StatsRetroSpan
 	klhist := getd.GetKlineDb(code, model.KLINE_DAY, retro, false)
 	if len(klhist) < retro {
 		log.Printf("%s insufficient data to collect kdjv stats: %d", code, len(klhist))
 		chkps <- nil
-		return
+		return nil
 	}
+	pkey := kdjStatsPkey(ver, useRaw)
+	prev := getKps(code, ver)
+	purge := prev == nil || prev.Pkey != pkey
+	smps := make(map[string]*model.KDJVStatSmp)
+	if !purge {
+		if prev.Frmdt == klhist[0].Date && prev.Todt == klhist[len(klhist)-1].Date {
+			logr.Debugf("%s kdjv stats up to date: %s", code, prev.Todt)
+			chkps <- nil
+			return nil
+		}
+		smps = getKpsSmps(code, ver)
+	}
+	kps := new(model.KDJVStat)
 	kps.Code = code
+	kps.Ver = ver
 	kps.Frmdt = klhist[0].Date
 	kps.Todt = klhist[len(klhist)-1].Date
+	kps.Pkey = pkey
 	kps.Udate, kps.Utime = util.TimeStr()
-	var buys, sells []float64
-	switch conf.Args.RunMode {
-	case conf.REMOTE:
-		buys, sells, e = kdjScoresRemote(code, klhist, expvr, mxrt, mxhold)
-	case conf.LOCAL:
-		buys, sells, e = kdjScoresLocal(code, klhist, expvr, mxrt, mxhold, useRaw)
-	case conf.AUTO:
-		buys, sells, e = kdjScoresAuto(code, klhist, expvr, mxrt, mxhold, useRaw)
-	default:
-		buys, sells, e = kdjScoresLocal(code, klhist, expvr, mxrt, mxhold, useRaw)
+	var (
+		buys, sells []float64
+		fresh       []*model.KDJVStatSmp
+		keep        = make(map[string]bool)
+	)
+	for _, buy := range []bool{true, false} {
+		bysl := "BY"
+		if !buy {
+			bysl = "SL"
+		}
+		pts := kdjStatsPoints(klhist, buy, p.StatsExpvr, p.StatsMxrt, p.StatsMxhold)
+		todo := make([]*model.Quote, 0, 16)
+		for _, q := range pts {
+			keep[bysl+q.Date] = true
+			if _, ok := smps[bysl+q.Date]; !ok {
+				todo = append(todo, q)
+			}
+		}
+		ss, e := score(todo, buy)
+		if e != nil {
+			return e
+		}
+		for i, q := range todo {
+			s := &model.KDJVStatSmp{Code: code, Ver: ver, Bysl: bysl, Date: q.Date, Klid: q.Klid,
+				Udate: kps.Udate, Utime: kps.Utime}
+			if !math.IsNaN(ss[i]) {
+				s.Score = sql.NullFloat64{Float64: ss[i], Valid: true}
+			}
+			smps[bysl+q.Date] = s
+			fresh = append(fresh, s)
+		}
+		scores := make([]float64, 0, len(pts))
+		for _, q := range pts {
+			if s := smps[bysl+q.Date]; s.Score.Valid {
+				scores = append(scores, s.Score.Float64)
+			}
+		}
+		if buy {
+			buys = scores
+		} else {
+			sells = scores
+		}
 	}
-	if e != nil {
-		logr.Warn(e)
-		return
+	stale := make([]*model.KDJVStatSmp, 0, 16)
+	for k, s := range smps {
+		if !keep[k] {
+			stale = append(stale, s)
+		}
+	}
+	saveKpsSmps(code, ver, purge, fresh, stale)
+	if len(buys) == 0 || len(sells) == 0 {
+		log.Printf("%s insufficient sample points to collect kdjv stats, buy: %d, sell: %d", code,
+			len(buys), len(sells))
+		chkps <- nil
+		return nil
 	}
+	kdjStatsOf(kps, buys, sells)
+	logr.Debugf("%s kdjv DOD: %.2f, new points: %d, stale points: %d, time: %.2f", code, kps.Dod,
+		len(fresh), len(stale), time.Since(start).Seconds())
+	chkps <- kps
+	return nil
+}
+
+//kdjStatsOf calculates the distribution of buy and sell scores and their degree of distinction.
+func kdjStatsOf(kps *model.KDJVStat, buys, sells []float64) {
+	code := kps.Code
 	sort.Float64s(buys)
 	sort.Float64s(sells)
+	var e error
 	kps.Bl, e = stats.Round(buys[0], 2)
 	util.CheckErr(e, fmt.Sprintf("%s failed to round BL %f", code, buys[0]))
 	kps.Sl, e = stats.Round(sells[0], 2)
@@ -378,114 +563,107 @@ func renewKdjStats(code string, useRaw bool, wg *sync.WaitGroup, chcde chan stri
 	} else {
 		kps.Dod = 100
 	}
-	logr.Debugf("%s kdjv DOD: %.2f, time: %.2f", code, kps.Dod, time.Since(start).Seconds())
-	chkps <- kps
 }
 
-func kdjScoresAuto(code string, klhist []*model.Quote, expvr, mxrt float64, mxhold int, useRaw bool) (
-	buys, sells []float64, e error) {
-	ars, _ := rpc.Available(false)
-	if ars == 0 {
-		logr.Debugf("%s: no available rpc servers, use local power", code)
-		buys, sells, e = kdjScoresLocal(code, klhist, expvr, mxrt, mxhold, useRaw)
-		return
+// kdjStatsPkey returns the key of parameters and feature data affecting scores of kdjv stats sample points.
+// Feature data is identified by the version along with its revision, which changes if the version is made
+// ready again, e.g. by resumed pruning, or by the sampling version if raw feature data is used.
+func kdjStatsPkey(ver string, useRaw bool) string {
+	p := conf.Args().Kdjv
+	fd := ver + "@" + getd.FeatVerRev(ver)
+	if useRaw {
+		fd = getd.RawKdjSmpVer()
 	}
-	cpu, e := util.CpuUsage()
+	return fmt.Sprintf("%s/%g/%g/%d/%g/%g/%g/%s/%g/%t", fd, p.StatsExpvr, p.StatsMxrt, p.StatsMxhold,
+		p.WeightMonth, p.WeightWeek, p.WeightDay, p.SimMetric, p.DtwWindow, useRaw)
+}
+
+func getKps(code, ver string) *model.KDJVStat {
+	var stat *model.KDJVStat
+	e := dbmap.SelectOne(&stat, "select * from kdjv_stats where code = ? and ver = ?", code, ver)
 	if e != nil {
-		logr.Warnf("%s failed to get cpu usage: %+v", code, e)
-	}
-	if cpu < conf.Args.CPUUsageThreshold && e == nil {
-		logr.Debugf("%s current %%cpu: %.2f use local power", code, cpu)
-		buys, sells, e = kdjScoresLocal(code, klhist, expvr, mxrt, mxhold, useRaw)
-	} else {
-		logr.Debugf("%s current %%cpu: %.2f using remote service", code, cpu)
-		buys, sells, e = kdjScoresRemote(code, klhist, expvr, mxrt, mxhold)
-		if e != nil {
-			//try one more time with local power
-			logr.Warnf("remote processing failed, retry with local power\n%+v", e)
-			buys, sells, e = kdjScoresLocal(code, klhist, expvr, mxrt, mxhold, useRaw)
+		if "sql: no rows in result set" != e.Error() {
+			log.Panicf("%s failed to query kdjv stats\n%+v", code, e)
 		}
+		return nil
 	}
-	return
+	return stat
 }
 
-func kdjScoresLocal(code string, klhist []*model.Quote, expvr, mxrt float64, mxhold int, useRaw bool) (
-	buys, sells []float64, e error) {
-	st := time.Now()
-	buys = getKdjBuyScores(code, klhist, expvr, mxrt, mxhold, useRaw)
-	dur := time.Since(st).Seconds()
-	logr.Debugf("%s buy points: %d, time: %.2f, %.2f/p", code, len(buys), dur, dur/float64(len(buys)))
-	st = time.Now()
-	sells = getKdjSellScores(code, klhist, expvr, mxrt, mxhold, useRaw)
-	dur = time.Since(st).Seconds()
-	logr.Debugf("%s sell points: %d, time: %.2f, %.2f/p", code, len(sells), dur, dur/float64(len(sells)))
-	return
-}
-
-func kdjScoresRemote(code string, klhist []*model.Quote, expvr, mxrt float64, mxhold int) (
-	buys, sells []float64, e error) {
-	st := time.Now()
-	logr.Debugf("%s connecting rpc server for kdj score calculation...", code)
-	_, buys, _, e = fetchKdjScores(getKdjBuySeries(code, klhist, expvr, mxrt, mxhold))
-	if e != nil {
-		return buys, sells, errors.Wrapf(e, "%s failed to fetch kdj buy scores.", code)
+// getKpsSmps returns the sample points of kdjv stats, keyed by bysl and date.
+func getKpsSmps(code, ver string) map[string]*model.KDJVStatSmp {
+	var smps []*model.KDJVStatSmp
+	_, e := dbmap.Select(&smps, "select * from kdjv_stats_smp where code = ? and ver = ?", code, ver)
+	if e != nil && "sql: no rows in result set" != e.Error() {
+		log.Panicf("%s failed to query kdjv stats sample points\n%+v", code, e)
 	}
-	dur := time.Since(st).Seconds()
-	logr.Debugf("%s buy points: %d, time: %.2f, %.2f/p", code, len(buys), dur, dur/float64(len(buys)))
-	st = time.Now()
-	_, sells, _, e = fetchKdjScores(getKdjSellSeries(code, klhist, expvr, mxrt, mxhold))
-	if e != nil {
-		return buys, sells, errors.Wrapf(e, "%s failed to fetch kdj sell scores.", code)
+	m := make(map[string]*model.KDJVStatSmp, len(smps))
+	for _, s := range smps {
+		m[s.Bysl+s.Date] = s
 	}
-	dur = time.Since(st).Seconds()
-	logr.Debugf("%s sell points: %d, time: %.2f, %.2f/p", code, len(sells), dur, dur/float64(len(sells)))
-	return
+	return m
 }
 
-func fetchKdjScores(s []*rm.KdjSeries) (rowIds []string, scores []float64, details []map[string]interface{}, e error) {
-	req := &rm.KdjScoreReq{s, WEIGHT_KDJV_DAY, WEIGHT_KDJV_WEEK, WEIGHT_KDJV_MONTH}
-	var rep *rm.KdjScoreRep
-	e = rpc.Call("IndcScorer.ScoreKdj", req, &rep, 3)
-	if e != nil {
-		log.Printf("RPC service IndcScorer.ScoreKdj failed\n%+v", e)
-		return nil, nil, nil, e
-	} else if len(rep.Scores) != len(rep.RowIds) {
-		return nil, nil, nil, errors.Errorf("len of Scores[%d] does not match len of RowIds[%d]",
-			len(rep.Scores), len(rep.RowIds))
+// saveKpsSmps saves the fresh sample points of kdjv stats and deletes the stale ones, or all the previous
+// ones if purge is true.
+func saveKpsSmps(code, ver string, purge bool, fresh, stale []*model.KDJVStatSmp) {
+	tran, e := dbmap.Begin()
+	util.CheckErr(e, "failed to begin new transaction")
+	if purge {
+		_, e = tran.Exec("delete from kdjv_stats_smp where code = ? and ver = ?", code, ver)
 	} else {
-		rowids := make([]string, len(s))
-		for i := 0; i < len(s); i++ {
-			rowids[i] = s[i].RowId
+		for _, s := range stale {
+			if _, e = tran.Exec("delete from kdjv_stats_smp where code = ? and ver = ? and bysl = ? and date = ?",
+				code, ver, s.Bysl, s.Date); e != nil {
+				break
+			}
 		}
-		equal, rrid, srid := util.DiffStrings(rep.RowIds, rowids)
-		if !equal {
-			return nil, nil, nil, errors.Errorf("Scores[%d] does not match KdjSeries[%d]:%+v, %+v",
-				len(rep.Scores), len(s), rrid, srid)
+	}
+	if e != nil {
+		tran.Rollback()
+		log.Panicf("%s failed to purge kdjv_stats_smp: %+v", code, e)
+	}
+	for bg := 0; bg < len(fresh); bg += JOB_CAPACITY {
+		ed := int(math.Min(float64(bg+JOB_CAPACITY), float64(len(fresh))))
+		valueStrings := make([]string, 0, ed-bg)
+		valueArgs := make([]interface{}, 0, (ed-bg)*8)
+		for _, s := range fresh[bg:ed] {
+			valueStrings = append(valueStrings, "(?, ?, ?, ?, ?, ?, ?, ?)")
+			valueArgs = append(valueArgs, s.Code, s.Ver, s.Bysl, s.Date, s.Klid, s.Score, s.Udate, s.Utime)
+		}
+		stmt := fmt.Sprintf("INSERT INTO kdjv_stats_smp (code,ver,bysl,date,klid,score,udate,utime) VALUES %s "+
+			"on duplicate key update klid=values(klid),score=values(score),udate=values(udate),"+
+			"utime=values(utime)", strings.Join(valueStrings, ","))
+		if _, e = tran.Exec(stmt, valueArgs...); e != nil {
+			tran.Rollback()
+			log.Panicf("%s failed to bulk insert kdjv_stats_smp: %+v", code, e)
 		}
 	}
-	return rep.RowIds, rep.Scores, rep.Detail, nil
+	tran.Commit()
+	metrics.RowsUpserted("kdjv_stats_smp", len(fresh))
 }
 
-// collect kdjv buy samples
-func getKdjBuySeries(code string, klhist []*model.Quote, expvr, mxrt float64,
-	mxhold int) (s []*rm.KdjSeries) {
+//kdjStatsPoints returns the buy or sell sample points in klhist, labeled the same way as kdj feature data.
+func kdjStatsPoints(klhist []*model.Quote, buy bool, expvr, mxrt float64, mxhold int) (pts []*model.Quote) {
 	for i := 1; i < len(klhist)-1; i++ {
-		kl := klhist[i]
-		sc := kl.Close
-		if sc >= klhist[i+1].Close {
+		sc := klhist[i].Close
+		if (buy && sc >= klhist[i+1].Close) || (!buy && sc <= klhist[i+1].Close) {
 			continue
 		}
-		hc := math.Inf(-1)
+		xc := math.Inf(-1)
+		if !buy {
+			xc = math.Inf(0)
+		}
 		tspan := 0
 		pc := klhist[i-1].Close
 		for w, j := 0, 0; i+j < len(klhist); j++ {
 			nc := klhist[i+j].Close
-			if nc > hc {
-				hc = nc
+			if (buy && nc > xc) || (!buy && nc < xc) {
+				xc = nc
 				tspan = j
 			}
-			if pc >= nc {
-				rt := (hc - nc) / math.Abs(hc) * 100
+			if (buy && pc >= nc) || (!buy && pc <= nc) {
+				rt := math.Abs(xc-nc) / math.Abs(xc) * 100
 				if rt >= mxrt || w > mxhold {
 					break
 				}
@@ -498,221 +676,133 @@ func getKdjBuySeries(code string, klhist []*model.Quote, expvr, mxrt float64,
 			pc = nc
 		}
 		if sc == 0 {
-			sc = 0.01
-			hc += 0.01
-		}
-		mark := (hc - sc) / math.Abs(sc) * 100
-		if mark >= expvr {
-			ks := new(rm.KdjSeries)
-			s = append(s, ks)
-			fnd := false
-			ks.KdjDy, fnd = getd.ToLstJDCross(getd.GetKdjHist(code, model.INDICATOR_DAY, 100, kl.Date))
-			if !fnd {
-				continue
-			}
-			ks.KdjWk, fnd = getd.ToLstJDCross(getd.GetKdjHist(code, model.INDICATOR_WEEK, 100, kl.Date))
-			if !fnd {
-				continue
-			}
-			ks.KdjMo, fnd = getd.ToLstJDCross(getd.GetKdjHist(code, model.INDICATOR_MONTH, 100, kl.Date))
-			if !fnd {
-				continue
+			if buy {
+				sc = 0.01
+				xc += 0.01
+			} else {
+				sc = -0.01
+				xc -= 0.01
 			}
-			ks.RowId = fmt.Sprintf("BUY-%d-%d-%d-%s", len(ks.KdjDy), len(ks.KdjWk), len(ks.KdjMo), uuid.NewV1())
+		}
+		mark := (xc - sc) / math.Abs(sc) * 100
+		if (buy && mark >= expvr) || (!buy && mark <= -expvr) {
+			pts = append(pts, klhist[i])
 		}
 		i += tspan
 	}
-	logr.Debugf("%s kdj buy series: %d", code, len(s))
-	return s
+	return
 }
 
-// collect kdjv sell samples
-func getKdjSellSeries(code string, klhist []*model.Quote, expvr, mxrt float64,
-	mxhold int) (s []*rm.KdjSeries) {
-	for i := 1; i < len(klhist)-1; i++ {
-		kl := klhist[i]
-		sc := kl.Close
-		if sc <= klhist[i+1].Close {
-			continue
-		}
-		lc := math.Inf(0)
-		tspan := 0
-		pc := klhist[i-1].Close
-		for w, j := 0, 0; i+j < len(klhist); j++ {
-			nc := klhist[i+j].Close
-			if nc < lc {
-				lc = nc
-				tspan = j
-			}
-			if pc <= nc {
-				rt := (nc - lc) / math.Abs(lc) * 100
-				if rt >= mxrt || w > mxhold {
-					break
-				}
-				if j > 0 {
-					w++
-				}
-			} else {
-				w = 0
-			}
-			pc = nc
-		}
-		if sc == 0 {
-			sc = -0.01
-			lc -= 0.01
-		}
-		mark := (lc - sc) / math.Abs(sc) * 100
-		if mark <= -expvr {
-			ks := new(rm.KdjSeries)
-			s = append(s, ks)
-			fnd := false
-			ks.KdjMo, fnd = getd.ToLstJDCross(getd.GetKdjHist(code, model.INDICATOR_MONTH, 100, kl.Date))
-			if !fnd {
-				continue
-			}
-			ks.KdjWk, fnd = getd.ToLstJDCross(getd.GetKdjHist(code, model.INDICATOR_WEEK, 100, kl.Date))
-			if !fnd {
-				continue
-			}
-			ks.KdjDy, fnd = getd.ToLstJDCross(getd.GetKdjHist(code, model.INDICATOR_DAY, 100, kl.Date))
-			if !fnd {
-				continue
-			}
-			ks.RowId = fmt.Sprintf("SELL-%d-%d-%d-%s", len(ks.KdjDy), len(ks.KdjWk), len(ks.KdjMo), uuid.NewV1())
-		}
-		i += tspan
+// kdjStatsHist returns the kdj history of each cycle up to the date, ok is false if any of them
+// is insufficient for scoring.
+func kdjStatsHist(code, date string) (histmo, histwk, histdy []*model.Indicator, ok bool) {
+	if histmo, ok = getd.ToLstJDCross(getd.GetKdjHist(code, model.INDICATOR_MONTH, 100, date)); !ok {
+		return
+	}
+	if histwk, ok = getd.ToLstJDCross(getd.GetKdjHist(code, model.INDICATOR_WEEK, 100, date)); !ok {
+		return
 	}
-	logr.Debugf("%s kdj sell series: %d", code, len(s))
-	return s
+	histdy, ok = getd.ToLstJDCross(getd.GetKdjHist(code, model.INDICATOR_DAY, 100, date))
+	return
 }
 
-// collect kdjv buy stats
-func getKdjBuyScores(code string, klhist []*model.Quote, expvr, mxrt float64,
-	mxhold int, useRawData bool) (s []float64) {
-	for i := 1; i < len(klhist)-1; i++ {
-		kl := klhist[i]
-		sc := kl.Close
-		if sc >= klhist[i+1].Close {
-			continue
-		}
-		hc := math.Inf(-1)
-		tspan := 0
-		pc := klhist[i-1].Close
-		for w, j := 0, 0; i+j < len(klhist); j++ {
-			nc := klhist[i+j].Close
-			if nc > hc {
-				hc = nc
-				tspan = j
-			}
-			if pc >= nc {
-				rt := (hc - nc) / math.Abs(hc) * 100
-				if rt >= mxrt || w > mxhold {
-					break
-				}
-				if j > 0 {
-					w++
-				}
-			} else {
-				w = 0
-			}
-			pc = nc
-		}
-		if sc == 0 {
-			sc = 0.01
-			hc += 0.01
-		}
-		mark := (hc - sc) / math.Abs(sc) * 100
-		if mark >= expvr {
-			histmo, fnd := getd.ToLstJDCross(getd.GetKdjHist(code, model.INDICATOR_MONTH, 100, kl.Date))
-			if !fnd {
-				continue
-			}
-			histwk, fnd := getd.ToLstJDCross(getd.GetKdjHist(code, model.INDICATOR_WEEK, 100, kl.Date))
-			if !fnd {
-				continue
-			}
-			histdy, fnd := getd.ToLstJDCross(getd.GetKdjHist(code, model.INDICATOR_DAY, 100, kl.Date))
-			if !fnd {
-				continue
-			}
-			if useRawData {
-				s = append(s, wgtKdjScoreRaw(nil, histmo, histwk, histdy))
-			} else {
-				s = append(s, wgtKdjScore(nil, histmo, histwk, histdy))
-			}
+//kdjScoresLocal scores the sample points locally, NaN if the point is disqualified for scoring.
+func kdjScoresLocal(code, ver string, pts []*model.Quote, buy, useRaw bool) (scores []float64, e error) {
+	st := time.Now()
+	scores = make([]float64, len(pts))
+	for i, q := range pts {
+		histmo, histwk, histdy, ok := kdjStatsHist(code, q.Date)
+		if !ok {
+			scores[i] = math.NaN()
+		} else if useRaw {
+			scores[i] = wgtKdjScoreRaw(nil, histmo, histwk, histdy)
+		} else {
+			scores[i] = wgtKdjScore(ver, nil, histmo, histwk, histdy)
 		}
-		i += tspan
 	}
-	return s
+	dur := time.Since(st).Seconds()
+	logr.Debugf("%s buy: %t, points: %d, time: %.2f", code, buy, len(pts), dur)
+	return
 }
 
-// collect kdjv sell stats
-func getKdjSellScores(code string, klhist []*model.Quote, expvr, mxrt float64,
-	mxhold int, useRawData bool) (s []float64) {
-	for i := 1; i < len(klhist)-1; i++ {
-		kl := klhist[i]
-		sc := kl.Close
-		if sc <= klhist[i+1].Close {
+//kdjScoresRemote scores the sample points using rpc service, on the specified server if addr is not empty.
+// Score is NaN if the point is disqualified for scoring.
+func kdjScoresRemote(code, ver string, pts []*model.Quote, buy bool, addr string) (scores []float64, e error) {
+	st := time.Now()
+	prefix := "BUY"
+	if !buy {
+		prefix = "SELL"
+	}
+	scores = make([]float64, len(pts))
+	idx := make(map[string]int, len(pts))
+	ks := make([]*model.KdjSeries, 0, len(pts))
+	for i, q := range pts {
+		scores[i] = math.NaN()
+		histmo, histwk, histdy, ok := kdjStatsHist(code, q.Date)
+		if !ok {
 			continue
 		}
-		lc := math.Inf(0)
-		tspan := 0
-		pc := klhist[i-1].Close
-		for w, j := 0, 0; i+j < len(klhist); j++ {
-			nc := klhist[i+j].Close
-			if nc < lc {
-				lc = nc
-				tspan = j
-			}
-			if pc <= nc {
-				rt := (nc - lc) / math.Abs(lc) * 100
-				if rt >= mxrt || w > mxhold {
-					break
-				}
-				if j > 0 {
-					w++
-				}
-			} else {
-				w = 0
-			}
-			pc = nc
-		}
-		if sc == 0 {
-			sc = -0.01
-			lc -= 0.01
+		k := &model.KdjSeries{KdjDy: histdy, KdjWk: histwk, KdjMo: histmo}
+		k.RowId = fmt.Sprintf("%s-%d-%d-%d-%s", prefix, len(histdy), len(histwk), len(histmo), uuid.NewV1())
+		idx[k.RowId] = i
+		ks = append(ks, k)
+	}
+	if len(ks) == 0 {
+		return
+	}
+	logr.Debugf("%s connecting rpc server for kdj score calculation...", code)
+	ids, ss, _, _, e := fetchKdjScores(ver, ks, addr, 0)
+	if e != nil {
+		return nil, errors.Wrapf(e, "%s failed to fetch kdj %s scores.", code, strings.ToLower(prefix))
+	}
+	for i, id := range ids {
+		scores[idx[id]] = ss[i]
+	}
+	dur := time.Since(st).Seconds()
+	logr.Debugf("%s buy: %t, points: %d, time: %.2f", code, buy, len(pts), dur)
+	return
+}
+
+//fetchKdjScores calls rpc service to score the kdj series against the feature data version, on the specified
+// server if addr is not empty. Up to top most similar buy and sell feature data of each cycle are returned
+// as matches.
+func fetchKdjScores(ver string, s []*model.KdjSeries, addr string, top int) (rowIds []string, scores []float64,
+	details []map[string]interface{}, matches [][]*model.KdjMatch, e error) {
+	w := conf.Args().Kdjv
+	req := &model.KdjScoreReq{s, w.WeightDay, w.WeightWeek, w.WeightMonth, w.SimMetric, w.DtwWindow, top, ver}
+	var rep *model.KdjScoreRep
+	if addr == "" {
+		e = rpc.Call("IndcScorer.ScoreKdj", req, &rep, 3)
+	} else {
+		e = rpc.CallOn(addr, "IndcScorer.ScoreKdj", req, &rep)
+	}
+	if e != nil {
+		log.Printf("RPC service IndcScorer.ScoreKdj failed\n%+v", e)
+		return nil, nil, nil, nil, e
+	} else if len(rep.Scores) != len(rep.RowIds) {
+		return nil, nil, nil, nil, errors.Errorf("len of Scores[%d] does not match len of RowIds[%d]",
+			len(rep.Scores), len(rep.RowIds))
+	} else {
+		rowids := make([]string, len(s))
+		for i := 0; i < len(s); i++ {
+			rowids[i] = s[i].RowId
 		}
-		mark := (lc - sc) / math.Abs(sc) * 100
-		if mark <= -expvr {
-			histmo, fnd := getd.ToLstJDCross(getd.GetKdjHist(code, model.INDICATOR_MONTH, 100, kl.Date))
-			if !fnd {
-				continue
-			}
-			histwk, fnd := getd.ToLstJDCross(getd.GetKdjHist(code, model.INDICATOR_WEEK, 100, kl.Date))
-			if !fnd {
-				continue
-			}
-			histdy, fnd := getd.ToLstJDCross(getd.GetKdjHist(code, model.INDICATOR_DAY, 100, kl.Date))
-			if !fnd {
-				continue
-			}
-			if useRawData {
-				s = append(s, wgtKdjScoreRaw(nil, histmo, histwk, histdy))
-			} else {
-				s = append(s, wgtKdjScore(nil, histmo, histwk, histdy))
-			}
+		equal, rrid, srid := util.DiffStrings(rep.RowIds, rowids)
+		if !equal {
+			return nil, nil, nil, nil, errors.Errorf("Scores[%d] does not match KdjSeries[%d]:%+v, %+v",
+				len(rep.Scores), len(s), rrid, srid)
 		}
-		i += tspan
 	}
-	return s
+	return rep.RowIds, rep.Scores, rep.Detail, rep.Matches, nil
 }
 
-func scoreKdjRoutine(wg *sync.WaitGroup, chitm chan *Item, total int) {
+func scoreKdjRoutine(ver string, wg *sync.WaitGroup, chitm chan *Item, total int) {
 	defer wg.Done()
 	ars, _ := rpc.Available(false)
 	if ars == 0 {
 		logr.Warn("no available rpc servers, use local power")
 		for item := range chitm {
-			scoreKdjLocal(item)
+			scoreKdjLocal(ver, item)
 		}
 	} else {
 		//calculate buffer size based on available rpc servers and total
@@ -722,12 +812,12 @@ func scoreKdjRoutine(wg *sync.WaitGroup, chitm chan *Item, total int) {
 			iBuf = append(iBuf, item)
 			if len(iBuf) >= bufSize {
 				// buffer is full, fire to remote server
-				e := scoreKdjRemote(iBuf)
+				e := scoreKdjRemote(ver, iBuf, "")
 				if e != nil {
 					// fall back to local power
 					logr.Warnf("remote processing failed, retry with local power\n%+v", e)
 					for _, bitm := range iBuf {
-						scoreKdjLocal(bitm)
+						scoreKdjLocal(ver, bitm)
 					}
 				}
 				iBuf = nil
@@ -735,12 +825,12 @@ func scoreKdjRoutine(wg *sync.WaitGroup, chitm chan *Item, total int) {
 		}
 		// process remaining items in iBuf
 		if len(iBuf) > 0 {
-			e := scoreKdjRemote(iBuf)
+			e := scoreKdjRemote(ver, iBuf, "")
 			if e != nil {
 				// fall back to local power
 				logr.Warnf("remote processing failed, fall back to local power\n%+v", e)
 				for _, bitm := range iBuf {
-					scoreKdjLocal(bitm)
+					scoreKdjLocal(ver, bitm)
 				}
 			}
 			iBuf = nil
@@ -749,22 +839,24 @@ func scoreKdjRoutine(wg *sync.WaitGroup, chitm chan *Item, total int) {
 	return
 }
 
-func scoreKdjRemote(items []*Item) (e error) {
+//scoreKdjRemote scores the items using rpc service, on the specified server if addr is not empty.
+func scoreKdjRemote(ver string, items []*Item, addr string) (e error) {
 	start := time.Now()
 	itmMap := make(map[string]*Item)
 	var pid string
-	ks := make([]*rm.KdjSeries, 0, 16)
+	ks := make([]*model.KdjSeries, 0, 16)
 	for _, item := range items {
 		kdjv := new(KdjV)
 		pid = kdjv.Id()
 		kdjv.Code = item.Code
 		kdjv.Name = item.Name
+		kdjv.Ver = ver
 		item.Profiles = make(map[string]*Profile)
 		ip := new(Profile)
 		item.Profiles[pid] = ip
 		ip.FieldHolder = kdjv
 
-		k := new(rm.KdjSeries)
+		k := new(model.KdjSeries)
 		k.RowId = fmt.Sprintf("%s:%s", item.Code, uuid.NewV1())
 		fdy, fwk, fmo := false, false, false
 		k.KdjDy, fdy = getd.ToLstJDCross(getd.GetKdjHist(item.Code, model.INDICATOR_DAY, 100, ""))
@@ -778,7 +870,7 @@ func scoreKdjRemote(items []*Item) (e error) {
 		}
 		ks = append(ks, k)
 		var stat *model.KDJVStat
-		e := dbmap.SelectOne(&stat, "select * from kdjv_stats where code = ?", item.Code)
+		e := dbmap.SelectOne(&stat, "select * from kdjv_stats where code = ? and ver = ?", item.Code, ver)
 		if e != nil {
 			if "sql: no rows in result set" != e.Error() {
 				log.Panicf("%s failed to query kdjv stats\n%+v", item.Code, e)
@@ -795,7 +887,7 @@ func scoreKdjRemote(items []*Item) (e error) {
 		itmMap[k.RowId] = item
 	}
 	logr.Debugf("ready to call rpc service, input size: %d", len(ks))
-	ids, ss, dets, e := fetchKdjScores(ks)
+	ids, ss, dets, mss, e := fetchKdjScores(ver, ks, addr, conf.Args().Kdjv.TopMatch)
 	if e != nil {
 		return errors.Wrapf(e, "%d failed to calculate kdj scores", len(items))
 	}
@@ -812,6 +904,9 @@ func scoreKdjRemote(items []*Item) (e error) {
 			d["W.bhdr"], d["W.bpdr"], d["W.bmpd"], d["W.bdi"], d["W.shdr"], d["W.spdr"], d["W.smpd"], d["W.sdi"])
 		kdjv.CCMO = fmt.Sprintf("%.2f/%.2f/%.2f/%.2f\n%.2f/%.2f/%.2f/%.2f\n",
 			d["M.bhdr"], d["M.bpdr"], d["M.bmpd"], d["M.bdi"], d["M.shdr"], d["M.spdr"], d["M.smpd"], d["M.sdi"])
+		if i < len(mss) {
+			kdjv.Matches = mss[i]
+		}
 	}
 	tt := time.Since(start).Seconds()
 	logr.Debugf("%d kdj scores calculated using rpc service, time: %.2f, %.2f/stk",
@@ -819,12 +914,33 @@ func scoreKdjRemote(items []*Item) (e error) {
 	return nil
 }
 
-func scoreKdjLocal(item *Item) {
+//kdjScoreJobs splits the items into batches, creating a kdjv scoring job for each of them.
+func kdjScoreJobs(ver string, items []*Item) []*rpc.Job {
+	jobs := make([]*rpc.Job, 0, len(items)/KDJV_DIST_BATCH+1)
+	for i := 0; i < len(items); i += KDJV_DIST_BATCH {
+		batch := items[i:int(math.Min(float64(i+KDJV_DIST_BATCH), float64(len(items))))]
+		j := &rpc.Job{ID: fmt.Sprintf("%s~%s", batch[0].Code, batch[len(batch)-1].Code)}
+		j.Local = func() error {
+			for _, itm := range batch {
+				scoreKdjLocal(ver, itm)
+			}
+			return nil
+		}
+		j.Remote = func(addr string) error {
+			return scoreKdjRemote(ver, batch, addr)
+		}
+		jobs = append(jobs, j)
+	}
+	return jobs
+}
+
+func scoreKdjLocal(ver string, item *Item) {
 	start := time.Now()
 	logr.Debugf("calculating %s...", item.Code)
 	kdjv := new(KdjV)
 	kdjv.Code = item.Code
 	kdjv.Name = item.Name
+	kdjv.Ver = ver
 	item.Profiles = make(map[string]*Profile)
 	ip := new(Profile)
 	item.Profiles[kdjv.Id()] = ip
@@ -847,11 +963,11 @@ func scoreKdjLocal(item *Item) {
 	//warn if...
 
 	//ip.Score = wgtKdjScoreRaw(kdjv, histmo, histwk, histdy)
-	ip.Score = wgtKdjScore(kdjv, histmo, histwk, histdy)
+	ip.Score = wgtKdjScore(ver, kdjv, histmo, histwk, histdy)
 	item.Score += ip.Score
 
 	var stat *model.KDJVStat
-	e := dbmap.SelectOne(&stat, "select * from kdjv_stats where code = ?", item.Code)
+	e := dbmap.SelectOne(&stat, "select * from kdjv_stats where code = ? and ver = ?", item.Code, ver)
 	if e != nil {
 		if "sql: no rows in result set" != e.Error() {
 			log.Panicf("%s failed to query kdjv stats\n%+v", item.Code, e)
@@ -867,59 +983,54 @@ func scoreKdjLocal(item *Item) {
 }
 
 func wgtKdjScoreRaw(kdjv *KdjV, histmo, histwk, histdy []*model.Indicator) (s float64) {
-	s += scoreKdjRaw(kdjv, model.MONTH, histmo) * WEIGHT_KDJV_MONTH
-	s += scoreKdjRaw(kdjv, model.WEEK, histwk) * WEIGHT_KDJV_WEEK
-	s += scoreKdjRaw(kdjv, model.DAY, histdy) * WEIGHT_KDJV_DAY
-	s /= WEIGHT_KDJV_MONTH + WEIGHT_KDJV_WEEK + WEIGHT_KDJV_DAY
+	w := conf.Args().Kdjv
+	s += scoreKdjRaw(kdjv, model.MONTH, histmo) * w.WeightMonth
+	s += scoreKdjRaw(kdjv, model.WEEK, histwk) * w.WeightWeek
+	s += scoreKdjRaw(kdjv, model.DAY, histdy) * w.WeightDay
+	s /= w.WeightMonth + w.WeightWeek + w.WeightDay
 	s = math.Min(100, math.Max(0, s))
 	return
 }
 
-func wgtKdjScore(kdjv *KdjV, histmo, histwk, histdy []*model.Indicator) (s float64) {
-	s += scoreKdj(kdjv, model.MONTH, histmo) * WEIGHT_KDJV_MONTH
-	s += scoreKdj(kdjv, model.WEEK, histwk) * WEIGHT_KDJV_WEEK
-	s += scoreKdj(kdjv, model.DAY, histdy) * WEIGHT_KDJV_DAY
-	s /= WEIGHT_KDJV_MONTH + WEIGHT_KDJV_WEEK + WEIGHT_KDJV_DAY
+func wgtKdjScore(ver string, kdjv *KdjV, histmo, histwk, histdy []*model.Indicator) (s float64) {
+	w := conf.Args().Kdjv
+	s += scoreKdj(ver, kdjv, model.MONTH, histmo) * w.WeightMonth
+	s += scoreKdj(ver, kdjv, model.WEEK, histwk) * w.WeightWeek
+	s += scoreKdj(ver, kdjv, model.DAY, histdy) * w.WeightDay
+	s /= w.WeightMonth + w.WeightWeek + w.WeightDay
 	s = math.Min(100, math.Max(0, s))
 	return
 }
 
-func wgtKdjScoreRpc(kdjv *KdjV, histmo, histwk, histdy []*model.Indicator) (s float64) {
-	s += scoreKdj(kdjv, model.MONTH, histmo) * WEIGHT_KDJV_MONTH
-	s += scoreKdj(kdjv, model.WEEK, histwk) * WEIGHT_KDJV_WEEK
-	s += scoreKdj(kdjv, model.DAY, histdy) * WEIGHT_KDJV_DAY
-	s /= WEIGHT_KDJV_MONTH + WEIGHT_KDJV_WEEK + WEIGHT_KDJV_DAY
+func wgtKdjScoreRpc(ver string, kdjv *KdjV, histmo, histwk, histdy []*model.Indicator) (s float64) {
+	w := conf.Args().Kdjv
+	s += scoreKdj(ver, kdjv, model.MONTH, histmo) * w.WeightMonth
+	s += scoreKdj(ver, kdjv, model.WEEK, histwk) * w.WeightWeek
+	s += scoreKdj(ver, kdjv, model.DAY, histdy) * w.WeightDay
+	s /= w.WeightMonth + w.WeightWeek + w.WeightDay
 	s = math.Min(100, math.Max(0, s))
 	return
 }
 
-//Score by assessing the historical data against pruned kdj feature data.
-func scoreKdj(v *KdjV, cytp model.CYTP, kdjhist []*model.Indicator) (s float64) {
-	var val string
-	byfds, slfds := getKDJfdViews(cytp, len(kdjhist))
-	hdr, pdr, mpd, bdi := calcKdjDI(kdjhist, byfds)
-	val = fmt.Sprintf("%.2f/%.2f/%.2f/%.2f\n", hdr, pdr, mpd, bdi)
-	hdr, pdr, mpd, sdi := calcKdjDI(kdjhist, slfds)
-	val += fmt.Sprintf("%.2f/%.2f/%.2f/%.2f\n", hdr, pdr, mpd, sdi)
-	dirat := .0
-	s = .0
-	if sdi == 0 {
-		dirat = bdi
-	} else {
-		dirat = (bdi - sdi) / math.Abs(sdi)
-	}
-	if dirat > 0 && dirat < 0.995 {
-		s = 30 * (0.0015 + 3.3609*dirat - 4.3302*math.Pow(dirat, 2.) + 2.5115*math.Pow(dirat, 3.) -
-			0.5449*math.Pow(dirat, 4.))
-	} else if dirat >= 0.995 {
-		s = 30
-	}
-	if bdi > 0.201 && bdi < 0.81 {
-		s += 70 * (0.0283 - 1.8257*bdi + 10.4231*math.Pow(bdi, 2.) - 10.8682*math.Pow(bdi, 3.) + 3.2234*math.Pow(bdi, 4.))
-	} else if bdi >= 0.81 {
-		s += 70
+// kdjSim returns the configured similarity measure of kdj history and feature data.
+func kdjSim() indc.KdjSim {
+	sim, e := indc.KdjSimOf(conf.Args().Kdjv.SimMetric, conf.Args().Kdjv.DtwWindow)
+	util.CheckErr(e, "invalid kdjv similarity metric")
+	return sim
+}
+
+//Score by assessing the historical data against pruned kdj feature data of the version.
+func scoreKdj(ver string, v *KdjV, cytp model.CYTP, kdjhist []*model.Indicator) (s float64) {
+	byfds, slfds := getKDJfdViews(ver, cytp, len(kdjhist))
+	top := 0
+	if v != nil {
+		top = conf.Args().Kdjv.TopMatch
 	}
+	s, bdet, sdet, ms := indc.ScoreKdj(kdjhist, byfds, slfds, kdjSim(), top)
 	if v != nil {
+		v.Matches = append(v.Matches, ms...)
+		val := fmt.Sprintf("%.2f/%.2f/%.2f/%.2f\n%.2f/%.2f/%.2f/%.2f\n",
+			bdet[0], bdet[1], bdet[2], bdet[3], sdet[0], sdet[1], sdet[2], sdet[3])
 		switch cytp {
 		case model.DAY:
 			v.CCDY = val
@@ -988,14 +1099,14 @@ func getKDJfdrViews(cytp model.CYTP, len int) (buy, sell []*model.KDJfdrView) {
 	return
 }
 
-func getKDJfdViews(cytp model.CYTP, len int) (buy, sell []*model.KDJfdView) {
+func getKDJfdViews(ver string, cytp model.CYTP, len int) (buy, sell []*model.KDJfdView) {
 	buy = make([]*model.KDJfdView, 0, 1024)
 	sell = make([]*model.KDJfdView, 0, 1024)
 	for i := -2; i < 3; i++ {
 		n := len + i
 		if n >= 2 {
-			buy = append(buy, getd.GetKdjFeatDat(cytp, true, n)...)
-			sell = append(sell, getd.GetKdjFeatDat(cytp, false, n)...)
+			buy = append(buy, getd.GetKdjFeatDat(ver, cytp, true, n)...)
+			sell = append(sell, getd.GetKdjFeatDat(ver, cytp, false, n)...)
 		}
 	}
 	return
@@ -1016,6 +1127,7 @@ func calcKdjDIRaw(hist []*model.Indicator, fdvs []*model.KDJfdrView) (hdr, pdr,
 		hd[i] = h.KDJ_D
 		hj[i] = h.KDJ_J
 	}
+	sim := kdjSim()
 	pds := make([]float64, 0, 16)
 	hdc := .0
 	for _, fd := range fdvs {
@@ -1030,7 +1142,7 @@ func calcKdjDIRaw(hist []*model.Indicator, fdvs []*model.KDJfdrView) (hdr, pdr,
 		if days > 800 {
 			mod = math.Max(0.8, -0.0003*math.Pow(days-800, 1.0002)+1)
 		}
-		bkd := bestKdjDevi(hk, hd, hj, fd.K, fd.D, fd.J) * mod
+		bkd := sim(hk, hd, hj, fd.K, fd.D, fd.J) * mod
 		if bkd >= 0 {
 			pds = append(pds, bkd)
 			if bkd >= 0.8 {
@@ -1053,76 +1165,6 @@ func calcKdjDIRaw(hist []*model.Indicator, fdvs []*model.KDJfdrView) (hdr, pdr,
 	return
 }
 
-// Evaluates KDJ DEVIA indicator against pruned feature data, returns the following result:
-// Ratio of high DEVIA, ratio of positive DEVIA, mean of positive DEVIA, and DEVIA indicator, ranging from 0 to 1
-func calcKdjDI(hist []*model.Indicator, fdvs []*model.KDJfdView) (hdr, pdr, mpd, di float64) {
-	if len(hist) == 0 {
-		return 0, 0, 0, 0
-	}
-	code := hist[0].Code
-	hk := make([]float64, len(hist))
-	hd := make([]float64, len(hist))
-	hj := make([]float64, len(hist))
-	for i, h := range hist {
-		hk[i] = h.KDJ_K
-		hd[i] = h.KDJ_D
-		hj[i] = h.KDJ_J
-	}
-	pds := make([]float64, 0, 16)
-	for _, fd := range fdvs {
-		bkd := bestKdjDevi(hk, hd, hj, fd.K, fd.D, fd.J)
-		if bkd >= 0 {
-			pds = append(pds, bkd)
-			pdr += fd.Weight
-			if bkd >= 0.8 {
-				hdr += fd.Weight
-			}
-		}
-	}
-	var e error
-	if len(pds) > 0 {
-		mpd, e = stats.Mean(pds)
-		util.CheckErr(e, code+" failed to calculate mean of positive devia")
-	}
-	di = 0.5 * math.Min(1, math.Pow(hdr+0.92, 50))
-	di += 0.3 * math.Min(1, math.Pow(math.Log(pdr+1), 0.37)+0.4*math.Pow(pdr, math.Pi)+math.Pow(pdr, 0.476145))
-	di += 0.2 * math.Min(1, math.Pow(math.Log(math.Pow(mpd, math.E*math.Pi/1.1)+1), 0.06)+
-		math.E/1.25/math.Pi*math.Pow(mpd, math.E*math.Pi))
-	return
-}
-
-// Calculates the best match KDJ DEVIA, len(sk)==len(sd)==len(sj),
-// and len(sk) and len(tk) can vary.
-// DEVIA ranges from negative infinite to 1, with 1 indicating the most relevant KDJ data sets.
-func bestKdjDevi(sk, sd, sj, tk, td, tj []float64) float64 {
-	//should we also consider the len(x) to weigh the final result?
-	dif := len(sk) - len(tk)
-	if dif > 0 {
-		cc := -100.0
-		for i := 0; i <= dif; i++ {
-			e := len(sk) - dif + i
-			tcc := getd.CalcKdjDevi(sk[i:e], sd[i:e], sj[i:e], tk, td, tj)
-			if tcc > cc {
-				cc = tcc
-			}
-		}
-		return cc
-	} else if dif < 0 {
-		cc := -100.0
-		dif *= -1
-		for i := 0; i <= dif; i++ {
-			e := len(tk) - dif + i
-			tcc := getd.CalcKdjDevi(sk, sd, sj, tk[i:e], td[i:e], tj[i:e])
-			if tcc > cc {
-				cc = tcc
-			}
-		}
-		return cc
-	} else {
-		return getd.CalcKdjDevi(sk, sd, sj, tk, td, tj)
-	}
-}
-
 func extractKdjFd(fds []*model.KDJfdRaw) (k, d, j []float64) {
 	for _, f := range fds {
 		k = append(k, f.K)
@@ -1137,7 +1179,77 @@ func (k *KdjV) Id() string {
 }
 
 func (k *KdjV) Fields() []string {
-	return []string{"DOD", "SFL", "BMEAN", "SMEAN", "LEN", "KDJ_DY", "KDJ_WK", "KDJ_MO"}
+	return []string{"DOD", "SFL", "BMEAN", "SMEAN", "LEN", "KDJ_DY", "KDJ_WK", "KDJ_MO", "MATCH"}
+}
+
+//KdjMatches returns the most similar kdj feature data matched by the stock in KdjV scoring, nil if
+// the stock is not scored by KdjV.
+func (r *Result) KdjMatches(code string) []*model.KdjMatch {
+	it, ok := r.itMap[code]
+	if !ok {
+		return nil
+	}
+	p, ok := it.Profiles[(&KdjV{}).Id()]
+	if !ok || p.FieldHolder == nil {
+		return nil
+	}
+	if k, ok := p.FieldHolder.(*KdjV); ok {
+		return k.Matches
+	}
+	return nil
+}
+
+//CompareKdjV scores the stocks against two feature data versions on the same universe. Profiles of the
+// versions are named "KDJV@<ver>" and weighted equally in the combined result. Mean absolute difference of
+// the scores and overlap of the top n stocks, if n > 0, are logged.
+func CompareKdjV(codes []string, verA, verB string, n int) (r *Result) {
+	verA, verB = getd.KdjFdVer(verA), getd.KdjFdVer(verB)
+	if verA == verB {
+		log.Panicf("nothing to compare, both versions resolve to %s", verA)
+	}
+	id := (&KdjV{}).Id()
+	rs := make([]*Result, 2)
+	scores := make([]map[string]float64, 2)
+	for i, v := range []string{verA, verB} {
+		rs[i] = (&KdjV{Ver: v}).Get(codes, -1, true)
+		scores[i] = make(map[string]float64, len(rs[i].Items))
+		for _, it := range rs[i].Items {
+			if p, ok := it.Profiles[id]; ok {
+				scores[i][it.Code] = p.Score
+			}
+		}
+		rs[i].RenameProfile(id, id+"@"+v)
+		rs[i].Weight = 0.5
+	}
+	diff, cnt, higher := 0., 0, 0
+	for c, sa := range scores[0] {
+		if sb, ok := scores[1][c]; ok {
+			diff += math.Abs(sa - sb)
+			cnt++
+			if sa > sb {
+				higher++
+			}
+		}
+	}
+	if cnt > 0 {
+		diff /= float64(cnt)
+	}
+	overlap := 0
+	if n > 0 {
+		// items are ranked by Get
+		top := make(map[string]bool, n)
+		for i := 0; i < n && i < len(rs[0].Items); i++ {
+			top[rs[0].Items[i].Code] = true
+		}
+		for i := 0; i < n && i < len(rs[1].Items); i++ {
+			if top[rs[1].Items[i].Code] {
+				overlap++
+			}
+		}
+	}
+	log.Printf("kdjv %s vs %s, stocks: %d, mean abs diff: %.2f, %s higher: %d, top %d overlap: %d",
+		verA, verB, cnt, diff, verA, higher, n, overlap)
+	return Combine(rs...).Sort()
 }
 
 func (k *KdjV) Description() string {
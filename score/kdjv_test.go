@@ -4,6 +4,12 @@ import (
 	"testing"
 	"log"
 	"fmt"
+	"time"
+
+	"github.com/carusyte/stock/conf"
+	"github.com/carusyte/stock/getd"
+	"github.com/carusyte/stock/indc"
+	"github.com/carusyte/stock/model"
 )
 
 func TestKdjv_SyncRemoteKdjFd(t *testing.T) {
@@ -21,7 +27,100 @@ func TestKdjV_RenewStats(t *testing.T) {
 	//kdjv.RenewStats(false)
 }
 
+func TestKdjStatsPoints(t *testing.T) {
+	closes := []float64{10, 9, 9.5, 10, 11, 10.8, 10, 9, 8.5, 8, 8.8, 9.6, 10.5}
+	klhist := make([]*model.Quote, len(closes))
+	for i, c := range closes {
+		klhist[i] = &model.Quote{Klid: i, Date: fmt.Sprintf("2018-01-%02d", i+1), Close: c}
+	}
+	bys := kdjStatsPoints(klhist, true, 5, 2, 3)
+	sls := kdjStatsPoints(klhist, false, 5, 2, 3)
+	if len(bys) != 2 || bys[0].Klid != 1 || bys[1].Klid != 9 {
+		t.Errorf("unexpected buy points: %+v", bys)
+	}
+	if len(sls) != 1 || sls[0].Klid != 4 {
+		t.Errorf("unexpected sell points: %+v", sls)
+	}
+	// points are evaluated on a growing history the same way, so earlier points remain stable
+	if p := kdjStatsPoints(klhist[:9], true, 5, 2, 3); len(p) != 1 || p[0].Klid != 1 {
+		t.Errorf("unexpected buy points of partial history: %+v", p)
+	}
+}
+
 func TestKdjV_Get(t *testing.T) {
 	r := new(KdjV).Get([]string{"603089"}, -1, false)
 	fmt.Println(r)
 }
+
+// Compares the similarity metrics on historical raw feature data: each sample is held out and classified
+// as buy if its DEVIA indicator against the other buy samples is higher than against the sell samples.
+func TestKdjSimAccuracy(t *testing.T) {
+	const maxHeldOut = 100
+	metrics := []string{indc.SIM_DEVIA, indc.SIM_ZED, indc.SIM_DTW}
+	for _, cytp := range []model.CYTP{model.DAY, model.WEEK} {
+		for n := 4; n <= 8; n++ {
+			var buys, sells []*model.KDJfdrView
+			for i := -2; i < 3; i++ {
+				if n+i >= 2 {
+					buys = append(buys, getd.GetKdjFeatDatRaw(cytp, true, n+i)...)
+					sells = append(sells, getd.GetKdjFeatDatRaw(cytp, false, n+i)...)
+				}
+			}
+			for _, m := range metrics {
+				sim, e := indc.KdjSimOf(m, conf.Args().Kdjv.DtwWindow)
+				if e != nil {
+					t.Fatal(e)
+				}
+				st := time.Now()
+				hit, total := 0, 0
+				for _, set := range []struct {
+					buy  bool
+					smps []*model.KDJfdrView
+				}{{true, buys}, {false, sells}} {
+					held := 0
+					for _, s := range set.smps {
+						if s.SmpNum != n || held >= maxHeldOut {
+							continue
+						}
+						held++
+						hist := rawToIndicators(s)
+						_, _, _, bdi := indc.CalcKdjDI(hist, rawToViews(buys, s), sim)
+						_, _, _, sdi := indc.CalcKdjDI(hist, rawToViews(sells, s), sim)
+						if (bdi > sdi) == set.buy {
+							hit++
+						}
+						total++
+					}
+				}
+				if total == 0 {
+					continue
+				}
+				t.Logf("%s-%d %-5s accuracy: %.2f%% (%d/%d), time: %.2f", cytp, n, m,
+					float64(hit)/float64(total)*100, hit, total, time.Since(st).Seconds())
+			}
+		}
+	}
+}
+
+func rawToIndicators(s *model.KDJfdrView) []*model.Indicator {
+	hist := make([]*model.Indicator, len(s.K))
+	for i := range hist {
+		hist[i] = &model.Indicator{Code: s.Code, Klid: s.Klid[i], KDJ_K: s.K[i], KDJ_D: s.D[i], KDJ_J: s.J[i]}
+	}
+	return hist
+}
+
+// rawToViews converts raw samples to equally weighted feature data, excluding the held out one.
+func rawToViews(raws []*model.KDJfdrView, held *model.KDJfdrView) []*model.KDJfdView {
+	fdvs := make([]*model.KDJfdView, 0, len(raws))
+	for _, r := range raws {
+		if r.Code == held.Code && r.Klid[0] == held.Klid[0] {
+			continue
+		}
+		fdvs = append(fdvs, &model.KDJfdView{SmpNum: r.SmpNum, FdNum: 1, K: r.K, D: r.D, J: r.J})
+	}
+	for _, f := range fdvs {
+		f.Weight = 1. / float64(len(fdvs))
+	}
+	return fdvs
+}
@@ -1,6 +1,8 @@
 package score
 
 import (
+	"github.com/carusyte/stock/conf"
+	"github.com/carusyte/stock/getd"
 	"github.com/carusyte/stock/global"
 	"log"
 	"encoding/json"
@@ -8,6 +10,7 @@ import (
 	"bytes"
 	"github.com/olekukonko/tablewriter"
 	"sort"
+	"reflect"
 )
 
 const JOB_CAPACITY = global.JOB_CAPACITY
@@ -18,9 +21,32 @@ var (
 	dot   = global.Dot
 )
 
+func init() {
+	// scorer parameters are sampled per stock, so a change applies to stocks scored thereafter
+	conf.Subscribe("scorer_params", func(old, new *conf.Arguments) {
+		if !reflect.DeepEqual(old.Kdjv, new.Kdjv) {
+			getd.RecordParams((&KdjV{}).Id(), new.Kdjv)
+		}
+		if old.HiD != new.HiD {
+			getd.RecordParams((&HiD{}).Id(), new.HiD)
+		}
+		if old.BlueChip != new.BlueChip {
+			getd.RecordParams((&BlueChip{}).Id(), new.BlueChip)
+		}
+		if old.Exit != new.Exit {
+			getd.RecordParams((&Exit{}).Id(), new.Exit)
+		}
+		if old.Valuation != new.Valuation {
+			getd.RecordParams((&Valuation{}).Id(), new.Valuation)
+		}
+	})
+}
+
 type Profile struct {
 	//Score for this aspect
 	Score float64
+	//Whether the item is left unscored in this aspect, e.g. for lack of data
+	Skipped bool
 	//Field holder handy to get formatted field value
 	FieldHolder FieldHolder
 }
@@ -121,6 +147,27 @@ func (r *Result) SetFields(id string, fields ...string) {
 	r.Fields[id] = fields
 }
 
+//RenameProfile renames the profile in the result and all of its items, so that results of the same
+// scorer can be combined.
+func (r *Result) RenameProfile(id, nid string) *Result {
+	for i, pfid := range r.PfIds {
+		if pfid == id {
+			r.PfIds[i] = nid
+		}
+	}
+	if fs, ok := r.Fields[id]; ok {
+		delete(r.Fields, id)
+		r.Fields[nid] = fs
+	}
+	for _, it := range r.Items {
+		if p, ok := it.Profiles[id]; ok {
+			delete(it.Profiles, id)
+			it.Profiles[nid] = p
+		}
+	}
+	return r
+}
+
 func (r *Result) String() string {
 	if len(r.Items) == 0 {
 		return ""
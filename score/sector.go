@@ -0,0 +1,139 @@
+package score
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/carusyte/stock/getd"
+	"github.com/carusyte/stock/metrics"
+	"github.com/carusyte/stock/model"
+)
+
+// Ranks the stocks scored by the wrapped scorer by percentile of the score among peers of the same sector or
+// industry, so that stocks of sectors with different norms compare fairly, e.g. PE of banks against that of
+// software. Score is the percentage of peers scoring lower, counting half of those equal, in [0, 100).
+// The profile is renamed so that the result can be combined with that of the wrapped scorer.
+type InSector struct {
+	Scorer Scorer
+	// Level of peers, model.SECTOR_LV_SECTOR if empty or model.SECTOR_LV_INDUSTRY
+	Level string
+}
+
+//sectorField field holder of the wrapped scorer with peer ranking fields.
+type sectorField struct {
+	FieldHolder
+	Sector string
+	Raw    float64
+	Rank   int
+	Peers  int
+}
+
+func (f *sectorField) GetFieldStr(name string) string {
+	switch name {
+	case "SECTOR":
+		return f.Sector
+	case "RAW":
+		if f.Rank == 0 {
+			return ""
+		}
+		return fmt.Sprintf("%.2f", f.Raw)
+	case "PEER_RANK":
+		if f.Rank == 0 {
+			return ""
+		}
+		return fmt.Sprintf("%d/%d", f.Rank, f.Peers)
+	default:
+		if f.FieldHolder == nil {
+			return ""
+		}
+		return f.FieldHolder.GetFieldStr(name)
+	}
+}
+
+func (s *InSector) Get(stock []string, limit int, ranked bool) (r *Result) {
+	defer metrics.ScorerTime(s.Id(), time.Now())
+	r = s.Scorer.Get(stock, -1, false)
+	r.RenameProfile(s.Scorer.Id(), s.Id())
+	sectorPct(r.Items, s.Id(), getd.GetSectorOf(s.level(), stock...))
+	r.SetFields(s.Id(), s.Fields()...)
+	if ranked {
+		r.Sort()
+	}
+	r.Shrink(limit)
+	return
+}
+
+//sectorPct replaces the score of items and their profile pfid with the percentile among items of the same
+// sector, keeping the raw score in the field holder. Stocks not in sectors are taken as model.SECTOR_OTHER.
+// Items skipped by the wrapped scorer are neither counted as peers nor ranked.
+func sectorPct(items []*Item, pfid string, sectors map[string]string) {
+	peers := make(map[string][]float64)
+	for _, it := range items {
+		if skipped(it, pfid) {
+			continue
+		}
+		sec, ok := sectors[it.Code]
+		if !ok {
+			sec = model.SECTOR_OTHER
+		}
+		peers[sec] = append(peers[sec], it.Score)
+	}
+	for _, ss := range peers {
+		sort.Float64s(ss)
+	}
+	for _, it := range items {
+		sec, ok := sectors[it.Code]
+		if !ok {
+			sec = model.SECTOR_OTHER
+		}
+		ss := peers[sec]
+		if skipped(it, pfid) {
+			p := it.Profiles[pfid]
+			p.FieldHolder = &sectorField{FieldHolder: p.FieldHolder, Sector: sec, Peers: len(ss)}
+			continue
+		}
+		lo := sort.SearchFloat64s(ss, it.Score)
+		hi := sort.Search(len(ss), func(i int) bool {
+			return ss[i] > it.Score
+		})
+		f := &sectorField{Sector: sec, Raw: it.Score, Rank: len(ss) - hi + 1, Peers: len(ss)}
+		it.Score = (float64(lo) + float64(hi-lo)/2) / float64(len(ss)) * 100
+		if p, ok := it.Profiles[pfid]; ok {
+			f.FieldHolder = p.FieldHolder
+			p.FieldHolder = f
+			p.Score = it.Score
+		}
+	}
+}
+
+func skipped(it *Item, pfid string) bool {
+	p, ok := it.Profiles[pfid]
+	return ok && p.Skipped
+}
+
+func (s *InSector) level() string {
+	if s.Level == "" {
+		return model.SECTOR_LV_SECTOR
+	}
+	return s.Level
+}
+
+func (s *InSector) Geta() (r *Result) {
+	return s.Get(nil, -1, true)
+}
+
+func (s *InSector) Id() string {
+	if s.level() == model.SECTOR_LV_INDUSTRY {
+		return s.Scorer.Id() + "_IND"
+	}
+	return s.Scorer.Id() + "_SEC"
+}
+
+func (s *InSector) Fields() []string {
+	return append([]string{"SECTOR", "RAW", "PEER_RANK"}, s.Scorer.Fields()...)
+}
+
+func (s *InSector) Description() string {
+	return s.Scorer.Description() + " Ranked by percentile within sector."
+}
@@ -0,0 +1,53 @@
+package score
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/carusyte/stock/model"
+)
+
+func TestSectorPct(t *testing.T) {
+	var items []*Item
+	for _, s := range []struct {
+		code  string
+		score float64
+	}{{"600000", 10}, {"600001", 30}, {"600002", 20}, {"600003", 20}, {"000001", 5}, {"000002", 90}} {
+		it := &Item{Code: s.code, Score: s.score, Profiles: map[string]*Profile{"X": {Score: s.score}}}
+		items = append(items, it)
+	}
+	sectors := map[string]string{"600000": "金融", "600001": "金融", "600002": "金融", "600003": "金融",
+		"000001": "医药"}
+	sectorPct(items, "X", sectors)
+	exp := []string{"12.50/4/4", "87.50/1/4", "50.00/2/4", "50.00/2/4", "50.00/1/1", "50.00/1/1"}
+	for i, it := range items {
+		f := it.Profiles["X"].FieldHolder.(*sectorField)
+		if s := fmt.Sprintf("%.2f/%d/%d", it.Score, f.Rank, f.Peers); s != exp[i] || it.Profiles["X"].Score != it.Score {
+			t.Errorf("expecting %s for %s, got %s", exp[i], it.Code, s)
+		}
+	}
+	if f := items[5].Profiles["X"].FieldHolder; f.GetFieldStr("SECTOR") != model.SECTOR_OTHER ||
+		f.GetFieldStr("RAW") != "90.00" {
+		t.Errorf("unexpected fields of unclassified stock: %+v", f)
+	}
+}
+
+func TestSectorPctSkipped(t *testing.T) {
+	items := []*Item{
+		{Code: "600000", Score: 10, Profiles: map[string]*Profile{"X": {Score: 10}}},
+		{Code: "600001", Score: 30, Profiles: map[string]*Profile{"X": {Score: 30}}},
+		{Code: "600002", Profiles: map[string]*Profile{"X": {Skipped: true}}},
+	}
+	sectors := map[string]string{"600000": "金融", "600001": "金融", "600002": "金融"}
+	sectorPct(items, "X", sectors)
+	exp := []string{"25.00/2/2", "75.00/1/2", "0.00/0/2"}
+	for i, it := range items {
+		f := it.Profiles["X"].FieldHolder.(*sectorField)
+		if s := fmt.Sprintf("%.2f/%d/%d", it.Score, f.Rank, f.Peers); s != exp[i] || it.Profiles["X"].Score != it.Score {
+			t.Errorf("expecting %s for %s, got %s", exp[i], it.Code, s)
+		}
+	}
+	if f := items[2].Profiles["X"].FieldHolder; f.GetFieldStr("PEER_RANK") != "" || f.GetFieldStr("RAW") != "" {
+		t.Errorf("unexpected fields of skipped stock: %+v", f)
+	}
+}
@@ -0,0 +1,144 @@
+package score
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"reflect"
+	"time"
+
+	"github.com/carusyte/stock/getd"
+	"github.com/carusyte/stock/metrics"
+	"github.com/carusyte/stock/model"
+	"github.com/pkg/errors"
+)
+
+// Real holding return of stocks with dividends reinvested, compared against an index over the same period.
+// Score is the excess total return over the index in percentage points, which can be negative.
+type TotalRet struct {
+	Code     string
+	Name     string
+	From     string
+	To       string
+	Tr       float64 // Total return in percentage
+	PriceRet float64 // Price return in percentage, without dividends
+	IdxRet   float64 // Index return in percentage
+	Excess   float64 // Tr - IdxRet
+	// Index code to compare with, defaults to sh000300
+	Index string
+	// Days back from the latest trading day, defaults to 250
+	Days int
+	// Whether to reinvest after-tax dividends rather than pre-tax ones
+	AfterTax bool
+}
+
+func (t *TotalRet) GetFieldStr(name string) string {
+	switch name {
+	case "PERIOD":
+		return fmt.Sprintf("%s\n%s", t.From, t.To)
+	case "TR":
+		return fmt.Sprintf("%.2f%%", t.Tr)
+	case "PRICE_RET":
+		return fmt.Sprintf("%.2f%%", t.PriceRet)
+	case "IDX_RET":
+		return fmt.Sprintf("%.2f%%", t.IdxRet)
+	case "EXCESS":
+		return fmt.Sprintf("%.2f", t.Excess)
+	default:
+		r := reflect.ValueOf(t)
+		f := reflect.Indirect(r).FieldByName(name)
+		if !f.IsValid() {
+			panic(errors.New("undefined field for TOTAL_RET: " + name))
+		}
+		return fmt.Sprintf("%+v", f.Interface())
+	}
+}
+
+func (t *TotalRet) Get(s []string, limit int, ranked bool) (r *Result) {
+	defer metrics.ScorerTime(t.Id(), time.Now())
+	r = &Result{}
+	r.PfIds = append(r.PfIds, t.Id())
+	idx, days := t.Index, t.Days
+	if idx == "" {
+		idx = "sh000300"
+	}
+	if days <= 0 {
+		days = 250
+	}
+	var stks []*model.Stock
+	if len(s) == 0 {
+		stks = getd.StocksDb()
+	} else {
+		stks = getd.StocksDbByCode(s...)
+	}
+	itrs := getd.GetTotalReturn(idx, "", "")
+	if len(itrs) < 2 {
+		log.Printf("insufficient total return data of index %s", idx)
+		return
+	}
+	if len(itrs) > days+1 {
+		itrs = itrs[len(itrs)-days-1:]
+	}
+	from, to := itrs[0].Date, itrs[len(itrs)-1].Date
+	iret := periodReturn(itrs, false)
+	for _, stk := range stks {
+		item := new(Item)
+		r.AddItem(item)
+		item.Code = stk.Code
+		item.Name = stk.Name
+		item.Profiles = make(map[string]*Profile)
+		ip := new(Profile)
+		item.Profiles[t.Id()] = ip
+		it := &TotalRet{Code: stk.Code, Name: stk.Name, Index: idx, Days: days, AfterTax: t.AfterTax, IdxRet: iret}
+		ip.FieldHolder = it
+		trs := getd.GetTotalReturn(stk.Code, from, to)
+		if len(trs) < 2 {
+			item.Cmtf("insufficient total return data between %s and %s", from, to)
+			ip.Skipped = true
+			continue
+		}
+		if trs[0].Date != from {
+			item.Cmtf("listed or resumed since %s", trs[0].Date)
+		}
+		it.From, it.To = trs[0].Date, trs[len(trs)-1].Date
+		it.Tr = periodReturn(trs, t.AfterTax)
+		it.PriceRet = (trs[len(trs)-1].Close/trs[0].Close - 1) * 100
+		it.Excess = it.Tr - iret
+		ip.Score = it.Excess
+		item.Score += ip.Score
+	}
+	r.SetFields(t.Id(), t.Fields()...)
+	if ranked {
+		r.Sort()
+	}
+	r.Shrink(limit)
+	return
+}
+
+//periodReturn returns the total return in percentage over the series.
+func periodReturn(trs []*model.TotalReturn, afterTax bool) float64 {
+	first, last := trs[0].Tri, trs[len(trs)-1].Tri
+	if afterTax {
+		first, last = trs[0].TriAtx, trs[len(trs)-1].TriAtx
+	}
+	if first == 0 {
+		return math.NaN()
+	}
+	return (last/first - 1) * 100
+}
+
+func (t *TotalRet) Geta() (r *Result) {
+	return t.Get(nil, -1, true)
+}
+
+func (t *TotalRet) Id() string {
+	return "TOTAL_RET"
+}
+
+func (t *TotalRet) Fields() []string {
+	return []string{"PERIOD", "TR", "PRICE_RET", "IDX_RET", "EXCESS"}
+}
+
+func (t *TotalRet) Description() string {
+	return "Total return with dividends reinvested against index."
+}
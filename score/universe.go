@@ -0,0 +1,63 @@
+package score
+
+import (
+	"log"
+
+	"github.com/carusyte/stock/getd"
+)
+
+// Restricts the wrapped scorer to the constituents of an index as of a date, e.g. CSI 300 members, see
+// getd.IdxMembers. Stocks given to Get are further intersected with the constituents.
+type InUniverse struct {
+	Scorer Scorer
+	// Index code as in idxlst, e.g. sh000300
+	Index string
+	// Date on which the constituents snapshot is in effect, the latest if empty
+	Date string
+}
+
+func (u *InUniverse) Get(stock []string, limit int, ranked bool) (r *Result) {
+	members := restrict(stock, getd.IdxMembers(u.Index, u.Date))
+	if len(members) == 0 {
+		log.Printf("no constituents of %s as of %q in scope", u.Index, u.Date)
+		r = &Result{}
+		r.PfIds = append(r.PfIds, u.Id())
+		r.SetFields(u.Id(), u.Fields()...)
+		return
+	}
+	return u.Scorer.Get(members, limit, ranked)
+}
+
+//restrict returns the stocks which are members, in the order of stocks, or all members if stocks is empty.
+func restrict(stocks, members []string) []string {
+	if len(stocks) == 0 {
+		return members
+	}
+	mset := make(map[string]bool, len(members))
+	for _, m := range members {
+		mset[m] = true
+	}
+	var r []string
+	for _, s := range stocks {
+		if mset[s] {
+			r = append(r, s)
+		}
+	}
+	return r
+}
+
+func (u *InUniverse) Geta() (r *Result) {
+	return u.Get(nil, -1, true)
+}
+
+func (u *InUniverse) Id() string {
+	return u.Scorer.Id()
+}
+
+func (u *InUniverse) Fields() []string {
+	return u.Scorer.Fields()
+}
+
+func (u *InUniverse) Description() string {
+	return u.Scorer.Description() + " Within constituents of " + u.Index + "."
+}
@@ -0,0 +1,19 @@
+package score
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestRestrict(t *testing.T) {
+	members := []string{"600519", "000001", "601318"}
+	if r := restrict(nil, members); fmt.Sprint(r) != fmt.Sprint(members) {
+		t.Errorf("expecting all members, got %+v", r)
+	}
+	if r := restrict([]string{"601318", "300001", "600519"}, members); fmt.Sprint(r) != "[601318 600519]" {
+		t.Errorf("unexpected restricted stocks: %+v", r)
+	}
+	if r := restrict([]string{"300001"}, members); len(r) != 0 {
+		t.Errorf("expecting none, got %+v", r)
+	}
+}
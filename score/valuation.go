@@ -0,0 +1,143 @@
+package score
+
+import (
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/carusyte/stock/conf"
+	"github.com/carusyte/stock/getd"
+	"github.com/carusyte/stock/metrics"
+	"github.com/carusyte/stock/model"
+	"github.com/pkg/errors"
+)
+
+// Cheapness of the latest valuation against the stock's own history within the trailing window.
+// · Low percentile of PE, PB and PS
+// · High percentile of dividend yield
+// Score is the weighted average of each metric's score ranging in [0, 100], see valScore. Metrics with
+// insufficient history are left out, while loss or negative book value scores 0 for the metric.
+// Combine with BlueChip to favor quality stocks at historically low valuation.
+type Valuation struct {
+	Code  string
+	Name  string
+	Date  string
+	Years int
+	// Bands of the stock keyed by metric, see getd.ValBands
+	Bands map[string]*model.ValBand
+}
+
+func (v *Valuation) GetFieldStr(name string) string {
+	switch name {
+	case "PE", "PB", "PS", "DYR":
+		if b, ok := v.Bands[name]; ok && b.Value.Valid {
+			return fmt.Sprintf("%.2f", b.Value.Float64)
+		}
+		return "-"
+	case "PE_PCT", "PB_PCT", "PS_PCT", "DYR_PCT":
+		if b, ok := v.Bands[name[:len(name)-4]]; ok && b.Pct.Valid {
+			return fmt.Sprintf("%.2f%%", b.Pct.Float64)
+		}
+		return "-"
+	default:
+		r := reflect.ValueOf(v)
+		f := reflect.Indirect(r).FieldByName(name)
+		if !f.IsValid() {
+			panic(errors.New("undefined field for VALUATION: " + name))
+		}
+		return fmt.Sprintf("%+v", f.Interface())
+	}
+}
+
+func (v *Valuation) Get(s []string, limit int, ranked bool) (r *Result) {
+	defer metrics.ScorerTime(v.Id(), time.Now())
+	args := conf.Args().Valuation
+	getd.RecordParams(v.Id(), args)
+	r = &Result{}
+	r.PfIds = append(r.PfIds, v.Id())
+	var stks []*model.Stock
+	if len(s) == 0 {
+		stks = getd.StocksDb()
+	} else {
+		stks = getd.StocksDbByCode(s...)
+	}
+	bands := getd.GetValBands(args.Years, s...)
+	for _, stk := range stks {
+		item := new(Item)
+		r.AddItem(item)
+		item.Code = stk.Code
+		item.Name = stk.Name
+		item.Profiles = make(map[string]*Profile)
+		ip := new(Profile)
+		item.Profiles[v.Id()] = ip
+		iv := &Valuation{Code: stk.Code, Name: stk.Name, Years: args.Years, Bands: bands[stk.Code]}
+		ip.FieldHolder = iv
+		if b, ok := iv.Bands[model.VAL_PE]; ok {
+			iv.Date = b.Date
+		} else {
+			item.Cmtf("no valuation bands of %d years", args.Years)
+			ip.Skipped = true
+			continue
+		}
+		score, ok := valScore(iv.Bands, args)
+		if !ok {
+			item.Cmtf("less than %d days of valuation history", args.MinSamples)
+			ip.Skipped = true
+			continue
+		}
+		ip.Score = score
+		item.Score += ip.Score
+	}
+	r.SetFields(v.Id(), v.Fields()...)
+	if ranked {
+		r.Sort()
+	}
+	r.Shrink(limit)
+	return
+}
+
+//valScore returns the weighted average of metric scores, where PE, PB and PS score 100 minus the
+// percentile, and dividend yield scores the percentile. Metrics of less than MinSamples valid samples are
+// left out, and ok is false if none is left.
+func valScore(bands map[string]*model.ValBand, a conf.ValuationArgs) (score float64, ok bool) {
+	wsum := 0.
+	for _, mw := range []struct {
+		metric string
+		weight float64
+	}{{model.VAL_PE, a.WeightPe}, {model.VAL_PB, a.WeightPb}, {model.VAL_PS, a.WeightPs},
+		{model.VAL_DYR, a.WeightDyr}} {
+		b, exists := bands[mw.metric]
+		if !exists || mw.weight <= 0 || b.Samples < a.MinSamples {
+			continue
+		}
+		wsum += mw.weight
+		if !b.Pct.Valid {
+			continue
+		}
+		if mw.metric == model.VAL_DYR {
+			score += mw.weight * b.Pct.Float64
+		} else {
+			score += mw.weight * (100 - b.Pct.Float64)
+		}
+	}
+	if wsum == 0 {
+		return 0, false
+	}
+	return score / wsum, true
+}
+
+func (v *Valuation) Geta() (r *Result) {
+	return v.Get(nil, -1, true)
+}
+
+func (v *Valuation) Id() string {
+	return "VALUATION"
+}
+
+func (v *Valuation) Fields() []string {
+	return []string{"Date", "PE", "PE_PCT", "PB", "PB_PCT", "PS", "PS_PCT", "DYR", "DYR_PCT"}
+}
+
+func (v *Valuation) Description() string {
+	return "Latest valuation percentile against the stock's own history."
+}
@@ -0,0 +1,35 @@
+package score
+
+import (
+	"database/sql"
+	"fmt"
+	"testing"
+
+	"github.com/carusyte/stock/conf"
+	"github.com/carusyte/stock/model"
+)
+
+func TestValScore(t *testing.T) {
+	a := conf.ValuationArgs{Years: 5, MinSamples: 250, WeightPe: 40, WeightPb: 30, WeightPs: 10, WeightDyr: 20}
+	band := func(metric string, pct float64, valid bool, samples int) *model.ValBand {
+		return &model.ValBand{Metric: metric, Pct: sql.NullFloat64{Float64: pct, Valid: valid}, Samples: samples}
+	}
+	bands := map[string]*model.ValBand{
+		model.VAL_PE:  band(model.VAL_PE, 20, true, 1000),
+		model.VAL_PB:  band(model.VAL_PB, 50, true, 1000),
+		model.VAL_PS:  band(model.VAL_PS, 10, true, 100),
+		model.VAL_DYR: band(model.VAL_DYR, 90, true, 1000),
+	}
+	// PS left out for insufficient samples: (40*80 + 30*50 + 20*90) / 90
+	if s, ok := valScore(bands, a); !ok || fmt.Sprintf("%.2f", s) != "72.22" {
+		t.Errorf("unexpected score %.2f, %t", s, ok)
+	}
+	// loss scores 0 for PE
+	bands[model.VAL_PE] = band(model.VAL_PE, 0, false, 1000)
+	if s, ok := valScore(bands, a); !ok || fmt.Sprintf("%.2f", s) != "36.67" {
+		t.Errorf("unexpected score on loss %.2f, %t", s, ok)
+	}
+	if _, ok := valScore(map[string]*model.ValBand{model.VAL_PS: bands[model.VAL_PS]}, a); ok {
+		t.Error("expecting no score without sufficient samples")
+	}
+}
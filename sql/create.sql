@@ -1,5 +1,26 @@
 CREATE DATABASE `secu` /*!40100 DEFAULT CHARACTER SET utf8 */;
 
+CREATE TABLE `alert_log` (
+  `rule` varchar(50) NOT NULL COMMENT '规则名称',
+  `kind` varchar(20) NOT NULL DEFAULT '' COMMENT '规则类型',
+  `code` varchar(8) NOT NULL COMMENT '股票代码',
+  `ekey` varchar(30) NOT NULL COMMENT '事件标识，用于去重',
+  `msg` varchar(500) DEFAULT NULL COMMENT '提醒内容',
+  `udate` varchar(10) NOT NULL COMMENT '更新日期',
+  `utime` varchar(8) NOT NULL COMMENT '更新时间',
+  PRIMARY KEY (`rule`,`code`,`ekey`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8 COMMENT='自选股提醒记录';
+
+CREATE TABLE `alert_sent` (
+  `rule` varchar(50) NOT NULL COMMENT '规则名称',
+  `code` varchar(8) NOT NULL COMMENT '股票代码',
+  `ekey` varchar(30) NOT NULL COMMENT '事件标识',
+  `sink` varchar(200) NOT NULL COMMENT '发送目标',
+  `udate` varchar(10) NOT NULL COMMENT '更新日期',
+  `utime` varchar(8) NOT NULL COMMENT '更新时间',
+  PRIMARY KEY (`rule`,`code`,`ekey`,`sink`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8 COMMENT='自选股提醒发送记录';
+
 CREATE TABLE `basics` (
   `code` varchar(6) NOT NULL COMMENT '股票代码',
   `name` varchar(10) DEFAULT NULL COMMENT '名称',
@@ -71,6 +92,58 @@ CREATE TABLE `finance` (
   PRIMARY KEY (`code`,`year`)
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8 COMMENT='财务信息';
 
+CREATE TABLE `fin_item` (
+  `stmt` varchar(2) NOT NULL COMMENT '报表：BS资产负债表，IS利润表，CF现金流量表',
+  `item` varchar(100) NOT NULL COMMENT '科目',
+  `title` varchar(100) DEFAULT NULL COMMENT '原科目名称',
+  `unit` varchar(10) DEFAULT NULL COMMENT '原单位',
+  PRIMARY KEY (`stmt`,`item`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8 COMMENT='财务报表科目';
+
+CREATE TABLE `fin_stmt` (
+  `code` varchar(8) NOT NULL COMMENT '股票代码',
+  `year` varchar(10) NOT NULL COMMENT '报告期，同finance.year',
+  `stmt` varchar(2) NOT NULL COMMENT '报表',
+  `item` varchar(100) NOT NULL COMMENT '科目，见fin_item',
+  `value` double DEFAULT NULL COMMENT '金额(亿)，每股项目为元',
+  `udate` varchar(10) DEFAULT NULL COMMENT '更新日期',
+  `utime` varchar(8) DEFAULT NULL COMMENT '更新时间',
+  PRIMARY KEY (`code`,`year`,`stmt`,`item`),
+  KEY `idx_item` (`stmt`,`item`,`year`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8 COMMENT='财务报表明细';
+
+CREATE TABLE `fin_ttm` (
+  `code` varchar(8) NOT NULL COMMENT '股票代码',
+  `year` varchar(10) NOT NULL COMMENT '报告期，同finance.year',
+  `eps_q` double DEFAULT NULL COMMENT '单季每股收益',
+  `eps_ttm` double DEFAULT NULL COMMENT '滚动四季每股收益',
+  `np_q` double DEFAULT NULL COMMENT '单季净利润(亿)',
+  `np_ttm` double DEFAULT NULL COMMENT '滚动四季净利润(亿)',
+  `gr_q` double DEFAULT NULL COMMENT '单季营业总收入(亿)',
+  `gr_ttm` double DEFAULT NULL COMMENT '滚动四季营业总收入(亿)',
+  `roe_q` double DEFAULT NULL COMMENT '单季净资产收益率',
+  `roe_ttm` double DEFAULT NULL COMMENT '滚动四季净资产收益率',
+  `ocfps_q` double DEFAULT NULL COMMENT '单季每股经营现金流',
+  `ocfps_ttm` double DEFAULT NULL COMMENT '滚动四季每股经营现金流',
+  `navps` double DEFAULT NULL COMMENT '每股净资产',
+  `shares` double DEFAULT NULL COMMENT '股本(亿)，净利润/每股收益',
+  `udate` varchar(10) DEFAULT NULL COMMENT '更新日期',
+  `utime` varchar(8) DEFAULT NULL COMMENT '更新时间',
+  PRIMARY KEY (`code`,`year`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8 COMMENT='单季及滚动四季财务指标';
+
+CREATE TABLE `idx_cst` (
+  `code` varchar(8) NOT NULL COMMENT '指数代码',
+  `date` varchar(10) NOT NULL COMMENT '生效日期',
+  `stock` varchar(8) NOT NULL COMMENT '成分股代码',
+  `name` varchar(10) DEFAULT NULL COMMENT '成分股名称',
+  `weight` double DEFAULT NULL COMMENT '权重(%)',
+  `udate` varchar(10) DEFAULT NULL COMMENT '更新日期',
+  `utime` varchar(8) DEFAULT NULL COMMENT '更新时间',
+  PRIMARY KEY (`code`,`date`,`stock`),
+  KEY `idx_stock` (`stock`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8 COMMENT='指数成分股及权重';
+
 CREATE TABLE `idxlst` (
   `code` varchar(8) NOT NULL COMMENT '代码',
   `name` varchar(10) NOT NULL COMMENT '指数名称',
@@ -79,6 +152,7 @@ CREATE TABLE `idxlst` (
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8 COMMENT='指数列表';
 
 CREATE TABLE `indc_feat` (
+  `ver` varchar(40) NOT NULL DEFAULT '' COMMENT '模型版本',
   `indc` varchar(10) NOT NULL COMMENT '指标类型',
   `fid` varchar(50) NOT NULL COMMENT '特征ID(UUID)',
   `cytp` varchar(5) NOT NULL COMMENT '周期类型（D:天/W:周/M:月）',
@@ -87,11 +161,55 @@ CREATE TABLE `indc_feat` (
   `fd_num` int(10) NOT NULL COMMENT '同类样本数量',
   `weight` double DEFAULT NULL COMMENT '权重',
   `remarks` varchar(200) DEFAULT NULL COMMENT '备注',
+  `src_code` varchar(8) NOT NULL DEFAULT '' COMMENT '代表样本股票代码',
+  `src_fid` varchar(15) NOT NULL DEFAULT '' COMMENT '代表样本原始特征ID',
   `udate` varchar(10) NOT NULL COMMENT '更新日期',
   `utime` varchar(8) NOT NULL COMMENT '更新时间',
-  PRIMARY KEY (`indc`,`cytp`,`bysl`,`smp_num`,`fid`)
+  PRIMARY KEY (`ver`,`indc`,`cytp`,`bysl`,`smp_num`,`fid`)
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8 COMMENT='指标特征数据总表';
 
+CREATE TABLE `feat_ver` (
+  `ver` varchar(40) NOT NULL COMMENT '模型版本',
+  `indc` varchar(10) NOT NULL COMMENT '指标类型',
+  `kind` varchar(5) NOT NULL COMMENT 'SMP：采样/FD：特征数据',
+  `params` text COMMENT '生成参数(JSON)',
+  `parent` varchar(40) NOT NULL DEFAULT '' COMMENT '派生自的版本',
+  `smp_ver` varchar(500) NOT NULL DEFAULT '' COMMENT '所用采样版本',
+  `run_id` varchar(36) DEFAULT NULL COMMENT '运行ID',
+  `status` varchar(10) NOT NULL COMMENT 'BUILDING：生成中/READY：可用',
+  `remarks` varchar(200) DEFAULT NULL COMMENT '备注',
+  `udate` varchar(10) NOT NULL COMMENT '更新日期',
+  `utime` varchar(8) NOT NULL COMMENT '更新时间',
+  PRIMARY KEY (`ver`),
+  KEY `idx_indc` (`indc`,`kind`,`status`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8 COMMENT='指标特征模型版本';
+
+CREATE TABLE `indc_feat_mbr` (
+  `ver` varchar(40) NOT NULL DEFAULT '' COMMENT '模型版本',
+  `indc` varchar(10) NOT NULL COMMENT '指标类型',
+  `code` varchar(8) NOT NULL COMMENT '股票代码',
+  `rfid` varchar(15) NOT NULL COMMENT '原始特征ID',
+  `fid` varchar(50) NOT NULL COMMENT '所属特征ID(UUID)',
+  `cytp` varchar(5) NOT NULL COMMENT '周期类型（D:天/W:周/M:月）',
+  `bysl` varchar(2) NOT NULL COMMENT 'BY：买/SL：卖',
+  `smp_num` int(3) NOT NULL COMMENT '采样数量',
+  `udate` varchar(10) NOT NULL COMMENT '更新日期',
+  `utime` varchar(8) NOT NULL COMMENT '更新时间',
+  PRIMARY KEY (`ver`,`indc`,`code`,`rfid`),
+  KEY `idx_fid` (`ver`,`fid`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8 COMMENT='指标特征聚类成员';
+
+CREATE TABLE `indc_feat_dat_raw` (
+  `code` varchar(8) NOT NULL COMMENT '股票代码',
+  `indc` varchar(10) NOT NULL COMMENT '指标类型',
+  `fid` varchar(15) NOT NULL COMMENT '特征ID',
+  `klid` int(11) NOT NULL COMMENT 'K线ID',
+  `vals` text NOT NULL COMMENT '各维度指标值(JSON数组)',
+  `udate` varchar(10) NOT NULL COMMENT '更新日期',
+  `utime` varchar(8) NOT NULL COMMENT '更新时间',
+  PRIMARY KEY (`code`,`indc`,`fid`,`klid`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8 COMMENT='通用指标特征原始数据';
+
 CREATE TABLE `indc_feat_raw` (
   `code` varchar(8) NOT NULL COMMENT '股票代码',
   `indc` varchar(10) NOT NULL COMMENT '指标类型',
@@ -104,9 +222,10 @@ CREATE TABLE `indc_feat_raw` (
   `tspan` int(11) DEFAULT NULL COMMENT '获利/亏损的时间跨度',
   `mpt` double DEFAULT NULL COMMENT '单位时间的获利/亏损（Mark/TSpan）',
   `remarks` varchar(200) DEFAULT NULL COMMENT '备注',
+  `ver` varchar(40) NOT NULL DEFAULT '' COMMENT '采样版本',
   `udate` varchar(10) NOT NULL COMMENT '更新日期',
   `utime` varchar(8) NOT NULL COMMENT '更新时间',
-  PRIMARY KEY (`code`,`fid`,`indc`),
+  PRIMARY KEY (`code`,`fid`,`indc`,`ver`),
   KEY `INDEX` (`smp_num`,`cytp`,`bysl`,`indc`,`smp_date`)
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8 COMMENT='指标特征原始数据总表';
 
@@ -147,6 +266,7 @@ CREATE TABLE `indicator_w` (
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8;
 
 CREATE TABLE `kdj_feat_dat` (
+  `ver` varchar(40) NOT NULL DEFAULT '' COMMENT '模型版本',
   `fid` varchar(50) NOT NULL COMMENT '特征ID',
   `seq` int(11) NOT NULL COMMENT '序号',
   `K` double NOT NULL,
@@ -154,23 +274,25 @@ CREATE TABLE `kdj_feat_dat` (
   `J` double NOT NULL,
   `udate` varchar(10) NOT NULL COMMENT '更新日期',
   `utime` varchar(8) NOT NULL COMMENT '更新时间',
-  PRIMARY KEY (`fid`,`seq`)
+  PRIMARY KEY (`ver`,`fid`,`seq`)
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8 COMMENT='KDJ指标特征数据';
 
 CREATE TABLE `kdj_feat_dat_raw` (
   `code` varchar(8) NOT NULL COMMENT '股票代码',
   `fid` varchar(15) NOT NULL COMMENT '特征ID',
+  `ver` varchar(40) NOT NULL DEFAULT '' COMMENT '采样版本',
   `klid` int(11) NOT NULL COMMENT '序号',
   `K` double NOT NULL,
   `D` double NOT NULL,
   `J` double NOT NULL,
   `udate` varchar(10) NOT NULL COMMENT '更新日期',
   `utime` varchar(8) NOT NULL COMMENT '更新时间',
-  PRIMARY KEY (`code`,`fid`,`klid`)
+  PRIMARY KEY (`code`,`ver`,`fid`,`klid`)
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8 COMMENT='KDJ指标特征原始数据';
 
 CREATE TABLE `kdjv_stats` (
   `code` varchar(8) NOT NULL COMMENT '股票代码',
+  `ver` varchar(40) NOT NULL DEFAULT '' COMMENT 'Feature Data Version',
   `dod` double DEFAULT NULL COMMENT 'Degree of Distinction',
   `sl` double DEFAULT NULL COMMENT 'Sell Low',
   `sh` double DEFAULT NULL COMMENT 'Sell High',
@@ -184,11 +306,24 @@ CREATE TABLE `kdjv_stats` (
   `bmean` double DEFAULT NULL COMMENT 'Buy Mean',
   `frmdt` varchar(10) DEFAULT NULL COMMENT 'Data Date Start',
   `todt` varchar(10) DEFAULT NULL COMMENT 'Data Date End',
+  `pkey` varchar(200) NOT NULL DEFAULT '' COMMENT 'Scoring Parameters Key',
   `udate` varchar(10) DEFAULT NULL COMMENT 'Update Date',
   `utime` varchar(8) DEFAULT NULL COMMENT 'Update Time',
-  PRIMARY KEY (`code`)
+  PRIMARY KEY (`code`,`ver`)
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8 COMMENT='KDJV Scorer Performance Statistics';
 
+CREATE TABLE `kdjv_stats_smp` (
+  `code` varchar(8) NOT NULL COMMENT '股票代码',
+  `ver` varchar(40) NOT NULL DEFAULT '' COMMENT '特征数据版本',
+  `bysl` varchar(2) NOT NULL COMMENT 'BY：买/SL：卖',
+  `date` varchar(10) NOT NULL COMMENT '采样日期',
+  `klid` int(11) NOT NULL COMMENT 'K线ID',
+  `score` double DEFAULT NULL COMMENT 'KDJV评分，不符合评分条件则为空',
+  `udate` varchar(10) DEFAULT NULL COMMENT 'Update Date',
+  `utime` varchar(8) DEFAULT NULL COMMENT 'Update Time',
+  PRIMARY KEY (`code`,`ver`,`bysl`,`date`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8 COMMENT='KDJV Scorer Performance Statistics Sample Points';
+
 CREATE TABLE `kline_60m` (
   `code` varchar(8) NOT NULL,
   `date` varchar(20) NOT NULL,
@@ -246,6 +381,22 @@ CREATE TABLE `kline_d_n` (
   PRIMARY KEY (`code`,`klid`)
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8 COMMENT='日K线（不复权）';
 
+CREATE TABLE `kline_d_tr` (
+  `code` varchar(8) NOT NULL,
+  `date` varchar(10) NOT NULL,
+  `klid` int(11) NOT NULL,
+  `close` double NOT NULL COMMENT '收盘价（不复权）',
+  `divi` double NOT NULL DEFAULT 0 COMMENT '当日除息的每股分红（税前）',
+  `divi_atx` double NOT NULL DEFAULT 0 COMMENT '当日除息的每股分红（税后）',
+  `ratio` double NOT NULL DEFAULT 1 COMMENT '当日除权的股本倍数（送转股）',
+  `tri` double NOT NULL COMMENT '全收益指数（税前分红再投资），首日等于收盘价',
+  `tri_atx` double NOT NULL COMMENT '全收益指数（税后分红再投资）',
+  `udate` varchar(10) NOT NULL COMMENT '更新日期',
+  `utime` varchar(8) NOT NULL COMMENT '更新时间',
+  PRIMARY KEY (`code`,`klid`),
+  KEY `idx_date` (`code`,`date`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8 COMMENT='日全收益（分红于除权除息日再投资）';
+
 CREATE TABLE `kline_m` (
   `Code` varchar(8) NOT NULL,
   `Date` varchar(10) NOT NULL,
@@ -280,6 +431,93 @@ CREATE TABLE `kline_w` (
   PRIMARY KEY (`Code`,`Klid`)
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8;
 
+CREATE TABLE `pf_account` (
+  `acct` varchar(20) NOT NULL COMMENT '账户ID',
+  `name` varchar(50) DEFAULT NULL COMMENT '账户名称',
+  `udate` varchar(10) NOT NULL COMMENT '更新日期',
+  `utime` varchar(8) NOT NULL COMMENT '更新时间',
+  PRIMARY KEY (`acct`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8 COMMENT='组合账户';
+
+CREATE TABLE `pf_nav` (
+  `acct` varchar(20) NOT NULL COMMENT '账户ID',
+  `date` varchar(10) NOT NULL COMMENT '日期',
+  `cash` double NOT NULL COMMENT '现金',
+  `mkt_val` double NOT NULL COMMENT '持仓市值',
+  `total` double NOT NULL COMMENT '总资产',
+  `units` double NOT NULL COMMENT '份额',
+  `nav` double NOT NULL COMMENT '单位净值',
+  `realized` double NOT NULL COMMENT '累计已实现盈亏',
+  `unrealized` double NOT NULL COMMENT '未实现盈亏',
+  `udate` varchar(10) NOT NULL COMMENT '更新日期',
+  `utime` varchar(8) NOT NULL COMMENT '更新时间',
+  PRIMARY KEY (`acct`,`date`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8 COMMENT='组合每日净值';
+
+CREATE TABLE `pf_position` (
+  `acct` varchar(20) NOT NULL COMMENT '账户ID',
+  `code` varchar(8) NOT NULL COMMENT '股票代码',
+  `qty` double NOT NULL COMMENT '持股数量',
+  `cost` double NOT NULL COMMENT '持仓成本（总额）',
+  `realized` double NOT NULL COMMENT '已实现盈亏（含分红）',
+  `udate` varchar(10) NOT NULL COMMENT '更新日期',
+  `utime` varchar(8) NOT NULL COMMENT '更新时间',
+  PRIMARY KEY (`acct`,`code`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8 COMMENT='组合持仓';
+
+CREATE TABLE `pf_trade` (
+  `id` bigint(20) NOT NULL AUTO_INCREMENT,
+  `acct` varchar(20) NOT NULL COMMENT '账户ID',
+  `code` varchar(8) NOT NULL DEFAULT '' COMMENT '股票代码，存取现金时为空',
+  `date` varchar(10) NOT NULL COMMENT '成交日期',
+  `kind` varchar(10) NOT NULL COMMENT 'DEPOSIT：存入/WITHDRAW：取出/BUY：买/SELL：卖/DIVI：分红/BONUS：送转股',
+  `qty` double NOT NULL DEFAULT 0 COMMENT '数量，分红时为登记持股数',
+  `price` double NOT NULL DEFAULT 0 COMMENT '价格，分红时为每股派息',
+  `fee` double NOT NULL DEFAULT 0 COMMENT '费用及税',
+  `amount` double NOT NULL DEFAULT 0 COMMENT '现金变动',
+  `xdxr_idx` int(10) DEFAULT NULL COMMENT '对应除权除息序号',
+  `remarks` varchar(200) DEFAULT NULL COMMENT '备注',
+  `udate` varchar(10) NOT NULL COMMENT '更新日期',
+  `utime` varchar(8) NOT NULL COMMENT '更新时间',
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `idx_xdxr` (`acct`,`code`,`xdxr_idx`,`kind`),
+  KEY `idx_acct` (`acct`,`date`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8 COMMENT='组合交易流水';
+
+CREATE TABLE `run_params` (
+  `run_id` varchar(36) NOT NULL,
+  `scope` varchar(20) NOT NULL,
+  `profile` varchar(20) DEFAULT NULL,
+  `params` text,
+  `udate` varchar(10) DEFAULT NULL,
+  `utime` varchar(8) DEFAULT NULL,
+  PRIMARY KEY (`run_id`,`scope`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
+
+CREATE TABLE `sector_idx` (
+  `level` varchar(1) NOT NULL COMMENT '层级：S板块，I行业',
+  `name` varchar(20) NOT NULL COMMENT '板块或行业名称',
+  `date` varchar(10) NOT NULL COMMENT '日期',
+  `members` int(11) DEFAULT NULL COMMENT '当日成分股数',
+  `ew_ret` double DEFAULT NULL COMMENT '等权日收益率(%)',
+  `cw_ret` double DEFAULT NULL COMMENT '流通市值加权日收益率(%)',
+  `ew` double DEFAULT NULL COMMENT '等权指数',
+  `cw` double DEFAULT NULL COMMENT '流通市值加权指数',
+  `mktcap` double DEFAULT NULL COMMENT '流通市值(亿)',
+  `udate` varchar(10) DEFAULT NULL COMMENT '更新日期',
+  `utime` varchar(8) DEFAULT NULL COMMENT '更新时间',
+  PRIMARY KEY (`level`,`name`,`date`),
+  KEY `idx_date` (`level`,`date`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8 COMMENT='板块及行业指数';
+
+CREATE TABLE `sector_map` (
+  `industry` varchar(20) NOT NULL COMMENT '所属行业',
+  `sector` varchar(20) NOT NULL COMMENT '标准板块',
+  `udate` varchar(10) DEFAULT NULL COMMENT '更新日期',
+  `utime` varchar(8) DEFAULT NULL COMMENT '更新时间',
+  PRIMARY KEY (`industry`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8 COMMENT='行业板块映射';
+
 CREATE TABLE `stats` (
   `code` varchar(6) NOT NULL,
   `start` varchar(20) DEFAULT NULL,
@@ -297,6 +535,41 @@ CREATE TABLE `tradecal` (
   KEY `ix_tradecal_index` (`index`)
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8;
 
+CREATE TABLE `val_band` (
+  `code` varchar(8) NOT NULL COMMENT '股票或指数代码',
+  `metric` varchar(3) NOT NULL COMMENT '估值指标：PE，PB，PS，DYR',
+  `years` int(11) NOT NULL COMMENT '滚动窗口年数',
+  `date` varchar(10) NOT NULL COMMENT '日期',
+  `value` double DEFAULT NULL COMMENT '当前值',
+  `pct` double DEFAULT NULL COMMENT '当前值在窗口内的百分位',
+  `min` double DEFAULT NULL,
+  `p20` double DEFAULT NULL,
+  `p50` double DEFAULT NULL,
+  `p80` double DEFAULT NULL,
+  `max` double DEFAULT NULL,
+  `samples` int(11) DEFAULT NULL COMMENT '窗口内有效样本数',
+  `udate` varchar(10) DEFAULT NULL COMMENT '更新日期',
+  `utime` varchar(8) DEFAULT NULL COMMENT '更新时间',
+  PRIMARY KEY (`code`,`metric`,`years`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8 COMMENT='估值百分位及区间';
+
+CREATE TABLE `valuation` (
+  `code` varchar(8) NOT NULL COMMENT '股票代码',
+  `date` varchar(10) NOT NULL COMMENT '日期',
+  `klid` int(11) NOT NULL COMMENT '同kline_d_n.klid',
+  `close` double DEFAULT NULL COMMENT '不复权收盘价',
+  `year` varchar(10) DEFAULT NULL COMMENT '所依据的报告期',
+  `pe_ttm` double DEFAULT NULL COMMENT '市盈率TTM',
+  `pb` double DEFAULT NULL COMMENT '市净率',
+  `ps_ttm` double DEFAULT NULL COMMENT '市销率TTM',
+  `dyr` double DEFAULT NULL COMMENT '近12个月股息率（%，税前）',
+  `mktcap` double DEFAULT NULL COMMENT '总市值(亿)',
+  `udate` varchar(10) DEFAULT NULL COMMENT '更新日期',
+  `utime` varchar(8) DEFAULT NULL COMMENT '更新时间',
+  PRIMARY KEY (`code`,`klid`),
+  KEY `idx_date` (`date`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8 COMMENT='每日估值';
+
 CREATE TABLE `xdxr` (
   `code` varchar(6) NOT NULL COMMENT '股票代码',
   `name` varchar(10) DEFAULT NULL COMMENT '股票名称',
@@ -5,13 +5,16 @@ import (
 	"log"
 	"time"
 
+	"github.com/carusyte/stock/conf"
 	"github.com/carusyte/stock/getd"
 	"github.com/carusyte/stock/global"
+	"github.com/carusyte/stock/metrics"
 	"github.com/carusyte/stock/score"
 	"github.com/carusyte/stock/util"
 )
 
 func main() {
+	metrics.Serve()
 	//logr.SetLevel(logr.DebugLevel)
 	//getData()
 	pruneKdjFd(true)
@@ -23,6 +26,11 @@ func main() {
 	//hidBlueKdjSt()
 	//kdjOnly()
 	//renewKdjStats(true)
+	//exitAdv("600000:10.5,000001:12")
+	//totalRet("sh000300", 250)
+	//blueValuation()
+	//sectorRotation("S", "sh000300", 20)
+	//idxContrib("sh000300", "2018-06-29", "2018-07-31")
 	// test()
 }
 
@@ -66,7 +74,7 @@ func blueKdjv() {
 }
 
 func pruneKdjFd(resume bool) {
-	getd.PruneKdjFeatDat(getd.KDJ_FD_PRUNE_PREC, getd.KDJ_PRUNE_RATE, resume)
+	getd.PruneKdjFeatDat(conf.Args().Kdjv.PrunePrec, conf.Args().Kdjv.PruneRate, resume)
 }
 
 func renewKdjStats(resume bool) {
@@ -75,13 +83,54 @@ func renewKdjStats(resume bool) {
 		sql, e := global.Dot.Raw("KDJV_STATS_UNDONE")
 		util.CheckErr(e, "failed to get sql KDJV_STATS_UNDONE")
 		var stocks []string
-		_, e = global.Dbmap.Select(&stocks, sql)
+		_, e = global.Dbmap.Select(&stocks, sql, getd.KdjFdVer(kv.Ver))
 		kv.RenewStats(false, stocks...)
 	} else {
 		kv.RenewStats(false)
 	}
 }
 
+func exitAdv(positions string) {
+	pos, e := score.ParsePositions(positions)
+	util.CheckErr(e, "invalid positions")
+	log.Printf("\n%+v", (&score.Exit{Positions: pos}).Geta())
+}
+
+func blueValuation() {
+	start := time.Now()
+	r1 := new(score.BlueChip).Geta()
+	r1.Weight = 0.5
+	r2 := new(score.Valuation).Get(r1.Stocks(), -1, false)
+	r2.Weight = 0.5
+	log.Printf("\n%+v", score.Combine(r1, r2).Sort().Shrink(100))
+	log.Printf("Time Cost: %v", time.Since(start).Seconds())
+}
+
+func sectorRotation(level, bench string, days int) {
+	for _, s := range getd.SectorRotation(level, bench, days) {
+		log.Printf("%d\t%s\tRS %.2f\tret %.2f\tprev %d\tshift %d", s.Rank, s.Name, s.RS, s.Ret, s.PrevRank,
+			s.Shift)
+	}
+	r := (&score.InSector{Scorer: new(score.Valuation)}).Get(nil, 100, true)
+	log.Printf("\n%+v", r)
+}
+
+func idxContrib(index, from, to string) {
+	sum := 0.
+	for _, c := range getd.IdxContrib(index, from, to) {
+		sum += c.Contrib
+		log.Printf("%s\t%s\tweight %.2f\tret %.2f\tcontrib %.4f", c.Stock, c.Name, c.Weight, c.Ret, c.Contrib)
+	}
+	log.Printf("%s return from %s to %s: %.2f%%", index, from, to, sum)
+	r := (&score.InUniverse{Scorer: new(score.Valuation), Index: index, Date: from}).Get(nil, 50, true)
+	log.Printf("\n%+v", r)
+}
+
+func totalRet(index string, days int) {
+	r := (&score.TotalRet{Index: index, Days: days}).Get(nil, 50, true)
+	log.Printf("\n%+v", r)
+}
+
 func blue() {
 	r := new(score.BlueChip).Get(nil, -1, true)
 	log.Printf("\n%+v", r)
@@ -2,6 +2,8 @@ package util
 
 import (
 	"fmt"
+	"github.com/carusyte/stock/conf"
+	"github.com/carusyte/stock/metrics"
 	"golang.org/x/net/proxy"
 	"io"
 	"io/ioutil"
@@ -10,13 +12,34 @@ import (
 	"net/http"
 	"os"
 	"regexp"
+	"sync"
 	"time"
 )
 
 const RETRY int = 3
 
-var PART_PROXY float64 = 0
-var PROXY_ADDR string = ""
+var (
+	proxyLock  sync.RWMutex
+	PART_PROXY float64 = 0
+	PROXY_ADDR string  = ""
+)
+
+func init() {
+	SetProxy(conf.Args().ProxyPart, conf.Args().ProxyAddr)
+	conf.Subscribe("proxy", func(old, new *conf.Arguments) {
+		if old.ProxyPart != new.ProxyPart || old.ProxyAddr != new.ProxyAddr {
+			SetProxy(new.ProxyPart, new.ProxyAddr)
+		}
+	})
+}
+
+//SetProxy sets the portion of http requests made via the socks5 proxy at addr.
+func SetProxy(part float64, addr string) {
+	proxyLock.Lock()
+	defer proxyLock.Unlock()
+	PART_PROXY = part
+	PROXY_ADDR = addr
+}
 
 func HttpGetResp(url string) (res *http.Response, e error) {
 	return HttpGetRespUsingHeaders(url, nil)
@@ -31,9 +54,12 @@ func HttpGetRespUsingHeaders(url string, headers map[string]string) (res *http.R
 
 	var client *http.Client
 	//determine if we must use a proxy
-	if PART_PROXY > 0 && rand.Float64() < PART_PROXY {
+	proxyLock.RLock()
+	part, paddr := PART_PROXY, PROXY_ADDR
+	proxyLock.RUnlock()
+	if part > 0 && rand.Float64() < part {
 		// create a socks5 dialer
-		dialer, err := proxy.SOCKS5("tcp", PROXY_ADDR, nil, proxy.Direct)
+		dialer, err := proxy.SOCKS5("tcp", paddr, nil, proxy.Direct)
 		if err != nil {
 			fmt.Fprintln(os.Stderr, "can't connect to the proxy:", err)
 			os.Exit(1)
@@ -72,14 +98,17 @@ func HttpGetRespUsingHeaders(url string, headers map[string]string) (res *http.R
 			}
 		}
 
+		st := time.Now()
 		res, err = client.Do(req)
 		if err != nil {
+			metrics.HttpRequest(host, 0, st)
 			//handle "read: connection reset by peer" error by retrying
 			if i >= RETRY {
 				log.Printf("http communication failed. url=%s\n%+v", url, err)
 				e = err
 				return
 			} else {
+				metrics.HttpRetry(host)
 				log.Printf("http communication error. url=%s, retrying %d ...\n%+v", url, i+1, err)
 				if res != nil {
 					res.Body.Close()
@@ -87,6 +116,7 @@ func HttpGetRespUsingHeaders(url string, headers map[string]string) (res *http.R
 				time.Sleep(time.Millisecond * 500)
 			}
 		} else {
+			metrics.HttpRequest(host, res.StatusCode, st)
 			return
 		}
 	}